@@ -0,0 +1,91 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ClusterMonitorStackSpec defines the desired state of ClusterMonitorStack
+// ClusterMonitorStackSpec 定义ClusterMonitorStack的期望状态
+// 配置与MonitorStack相同，spec.namespace指定工作负载所在的命名空间，为空时使用monitoring
+type ClusterMonitorStackSpec struct {
+	MonitorStackSpec `json:",inline"`
+}
+
+// ClusterMonitorStackStatus defines the observed state of ClusterMonitorStack
+type ClusterMonitorStackStatus struct {
+	// 整体状态 - 与生成的MonitorStack一致
+	// +kubebuilder:validation:Enum=Pending;Ready;Failed;Updating;Paused
+	Phase string `json:"phase,omitempty"`
+
+	// 状态消息
+	Message string `json:"message,omitempty"`
+
+	// 工作负载所在的命名空间
+	Namespace string `json:"namespace,omitempty"`
+
+	// Prometheus组件状态
+	PrometheusStatus ComponentStatus `json:"prometheusStatus,omitempty"`
+
+	// Grafana组件状态
+	GrafanaStatus ComponentStatus `json:"grafanaStatus,omitempty"`
+
+	// 最后更新时间
+	LastUpdated metav1.Time `json:"lastUpdated,omitempty"`
+
+	// 条件列表
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:resource:scope=Cluster
+//+kubebuilder:printcolumn:name="Namespace",type="string",JSONPath=".status.namespace"
+//+kubebuilder:printcolumn:name="Phase",type="string",JSONPath=".status.phase"
+//+kubebuilder:printcolumn:name="Prometheus",type="boolean",JSONPath=".status.prometheusStatus.ready"
+//+kubebuilder:printcolumn:name="Grafana",type="boolean",JSONPath=".status.grafanaStatus.ready"
+//+kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// ClusterMonitorStack is the Schema for the clustermonitorstacks API
+// 集群级监控栈 - 在指定命名空间中部署监控栈，并授予Prometheus集群范围的服务发现权限
+type ClusterMonitorStack struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// 期望状态 - 用户定义的配置
+	Spec ClusterMonitorStackSpec `json:"spec,omitempty"`
+
+	// 观察状态 - 控制器维护的实际状态
+	Status ClusterMonitorStackStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// ClusterMonitorStackList contains a list of ClusterMonitorStack
+type ClusterMonitorStackList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterMonitorStack `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ClusterMonitorStack{}, &ClusterMonitorStackList{})
+}
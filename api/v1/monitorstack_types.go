@@ -17,7 +17,10 @@ limitations under the License.
 package v1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
@@ -42,6 +45,10 @@ type MonitorStackSpec struct {
 	// +kubebuilder:validation:Required
 	Grafana GrafanaSpec `json:"grafana"`
 
+	// Loki日志聚合配置 - 部署单体模式的Loki和采集Pod日志的Promtail
+	// +optional
+	Loki *LokiSpec `json:"loki,omitempty"`
+
 	// 通用配置 - 应用于整个监控栈的配置
 	// 目标命名空间，如果为空则使用当前命名空间
 
@@ -49,18 +56,54 @@ type MonitorStackSpec struct {
 
 	// 资源标签
 	Labels map[string]string `json:"labels,omitempty"`
+
+	// 引用的MonitorStackClass名称，未设置的字段从类中继承
+	// +optional
+	ClassName string `json:"className,omitempty"`
+
+	// 暂停协调 - 暂停期间不修改任何子资源，只刷新状态
+	// 也可以通过注解monitoring.cillian.website/paused: "true"暂停
+	// +optional
+	Paused bool `json:"paused,omitempty"`
+
+	// 版本升级配置
+	// +optional
+	Upgrade *UpgradeSpec `json:"upgrade,omitempty"`
+}
+
+// UpgradeSpec defines how image upgrades are rolled out
+// 升级按组件依次进行（先Prometheus后Grafana），新版本在超时时间内未就绪时自动回滚到上一个可用版本
+type UpgradeSpec struct {
+	// 等待新版本就绪的超时时间，默认10分钟
+	// +optional
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+
+	// 禁用自动回滚
+	// +optional
+	DisableAutoRollback bool `json:"disableAutoRollback,omitempty"`
 }
 
 // PrometheusSpec defines Prometheus configuration
+// +kubebuilder:validation:XValidation:rule="!has(self.mode) || self.mode != 'agent' || (has(self.remoteWrite) && size(self.remoteWrite) > 0) || (has(self.config) && size(self.config) > 0)",message="agent mode requires at least one remoteWrite"
+// +kubebuilder:validation:XValidation:rule="!has(self.shards) || self.shards == 1 || !has(self.config) || size(self.config) == 0",message="shards requires the default Prometheus config"
 type PrometheusSpec struct {
 	// 是否启用Prometheus
 	Enabled bool `json:"enabled"`
 
-	// 镜像配置
-	// +kubebuilder:default="prom/prometheus"
+	// 运行模式 - server为完整的Prometheus服务端（默认）；
+	// agent只抓取指标并通过remote write转发，只保留WAL，不支持查询、规则和告警
+	// agent模式下不创建PVC，WAL保存在emptyDir中，storage.size用于限制其大小
+	// +kubebuilder:validation:Enum=server;agent
+	// +optional
+	Mode string `json:"mode,omitempty"`
+
+	// 镜像配置 - 未设置时使用MonitorStackClass或默认值prom/prometheus:latest
 	Image string `json:"image,omitempty"`
-	// +kubebuilder:default="latest"
-	Tag string `json:"tag,omitempty"`
+	Tag   string `json:"tag,omitempty"`
+	// 镜像摘要 - 设置后使用摘要固定镜像，忽略标签
+	// +kubebuilder:validation:Pattern=`^sha256:[a-f0-9]{64}$`
+	// +optional
+	Digest string `json:"digest,omitempty"`
 
 	// 资源配置
 	Resources ResourceRequirements `json:"resources,omitempty"`
@@ -74,10 +117,305 @@ type PrometheusSpec struct {
 	// 配置文件
 	Config string `json:"config,omitempty"`
 
-	// 数据保留时间
+	// 分片数量 - 大于1时创建多个Prometheus，每个分片按__address__的哈希只抓取一部分目标，
+	// 并通过shard外部标签区分，Grafana为每个分片注册数据源，可以通过Mixed数据源汇总查询
+	// 分片0使用原有的资源名称，其余分片为{MonitorStack名称}-prometheus-shard-{序号}，减少分片时删除多出的分片
+	// 只支持默认配置，不支持备份和数据恢复，默认为1
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	Shards *int32 `json:"shards,omitempty"`
+
+	// 数据保留时间 - 未设置时使用MonitorStackClass或默认值15d，agent模式下忽略
 	// +kubebuilder:validation:Pattern=`^[0-9]+[smhdy]$`
-	// +kubebuilder:default="15d"
 	Retention string `json:"retention,omitempty"`
+
+	// 远程写入配置 - 添加到默认配置的remote_write中，使用自定义配置时忽略
+	// agent模式下至少需要一个
+	// +optional
+	RemoteWrite []RemoteWriteSpec `json:"remoteWrite,omitempty"`
+
+	// 服务发现的命名空间范围 - 设置后默认配置只发现这些命名空间中的目标，
+	// 并且只在这些命名空间中为Prometheus授予服务发现权限
+	// 自身所在命名空间以外的命名空间需要MonitorStackPolicy的allowedTargetNamespaces允许，否则被忽略
+	// 未设置时只发现MonitorStack所在的命名空间，ClusterMonitorStack未设置时发现整个集群
+	// +optional
+	TargetNamespaces *TargetNamespacesSpec `json:"targetNamespaces,omitempty"`
+
+	// 联邦配置 - 通过/federate从其他MonitorStack的Prometheus抓取指标，添加到默认配置的scrape_configs中
+	// 自身所在命名空间以外的MonitorStack需要MonitorStackPolicy的allowedTargetNamespaces允许，否则被忽略
+	// 目标启用HTTPS或Basic认证时，operator把目标的密码和CA证书复制到{名称}-prometheus-federation Secret中使用
+	// 使用自定义配置时忽略
+	// +optional
+	Federation *FederationSpec `json:"federation,omitempty"`
+
+	// TSDB快照备份配置 - 需要持久化存储
+	// +optional
+	Backup *BackupSpec `json:"backup,omitempty"`
+
+	// 安全上下文配置
+	// +optional
+	Security *SecuritySpec `json:"security,omitempty"`
+
+	// 健康检查配置 - 覆盖默认的探针参数
+	// +optional
+	Probes *ProbesSpec `json:"probes,omitempty"`
+
+	// Web服务配置 - HTTPS和Basic认证
+	// operator据此生成web.config.file，探针、Grafana数据源和自监控抓取自动使用相同的协议和凭据
+	// +optional
+	Web *PrometheusWebSpec `json:"web,omitempty"`
+
+	// 资源建议配置 - 根据Prometheus自身的内存和序列数指标计算建议的内存requests和limits
+	// +optional
+	Sizing *SizingSpec `json:"sizing,omitempty"`
+
+	// Pod中断预算 - 限制节点排空等主动驱逐同时驱逐的Pod数量
+	// Prometheus为单实例，设置minAvailable: 1会阻止排空所在节点
+	// +optional
+	PodDisruptionBudget *PodDisruptionBudgetSpec `json:"podDisruptionBudget,omitempty"`
+
+	// Pod模板覆盖 - 以strategic merge patch的方式合并到生成的PodTemplateSpec
+	// 可用于配置nodeSelector、tolerations、affinity、priorityClassName、sidecar容器等
+	// 主容器的image、resources以及serviceAccountName、automountServiceAccountToken和Pod的securityContext不允许覆盖，需通过对应字段设置
+	// 不允许使用宿主机的命名空间、hostPath卷、宿主机端口和特权容器
+	// +kubebuilder:pruning:PreserveUnknownFields
+	// +kubebuilder:validation:Schemaless
+	// +kubebuilder:validation:Type=object
+	// +optional
+	PodTemplate *runtime.RawExtension `json:"podTemplate,omitempty"`
+}
+
+// PrometheusWebSpec defines Prometheus web server TLS and basic auth
+type PrometheusWebSpec struct {
+	// TLS配置，启用后Prometheus只接受HTTPS连接
+	// +optional
+	TLS *PrometheusWebTLSSpec `json:"tls,omitempty"`
+
+	// Basic认证配置，启用后所有HTTP接口都需要认证
+	// 存活、就绪和启动探针改为TCP探针，Pod中不需要保存探针凭据
+	// +optional
+	BasicAuth *PrometheusWebBasicAuthSpec `json:"basicAuth,omitempty"`
+}
+
+// PrometheusWebTLSSpec defines the Prometheus server certificate
+type PrometheusWebTLSSpec struct {
+	// 包含tls.crt和tls.key的Secret名称，例如cert-manager签发的证书
+	// 证书需要包含Service域名{name}-prometheus.{namespace}.svc（启用分片时还包括各分片的{name}-prometheus-shard-{i}.{namespace}.svc）和localhost，证书轮换后Prometheus自动加载
+	// +kubebuilder:validation:MinLength=1
+	SecretName string `json:"secretName"`
+
+	// 签发证书的CA，Grafana数据源和Prometheus自监控校验证书时使用，未设置时使用系统根证书
+	// +optional
+	CA *corev1.SecretKeySelector `json:"ca,omitempty"`
+}
+
+// PrometheusWebBasicAuthSpec defines the Prometheus basic auth user
+type PrometheusWebBasicAuthSpec struct {
+	// 用户名
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:Pattern=`^[^:\s]+$`
+	Username string `json:"username"`
+
+	// 密码所在的Secret键，operator计算bcrypt哈希后写入web.config.file
+	Password corev1.SecretKeySelector `json:"password"`
+}
+
+// FederationSpec defines which MonitorStacks to federate from
+// targets和selector选中的MonitorStack合并，未启用Prometheus或以agent模式运行的MonitorStack会被忽略
+// +kubebuilder:validation:XValidation:rule="(has(self.targets) && size(self.targets) > 0) || has(self.selector)",message="targets or selector must be set"
+type FederationSpec struct {
+	// 按名称引用的MonitorStack
+	// +optional
+	Targets []FederationTargetRef `json:"targets,omitempty"`
+
+	// MonitorStack标签选择器
+	// +optional
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+
+	// selector匹配的命名空间，未设置时只选择同一命名空间中的MonitorStack，设置为{}时选择所有命名空间
+	// +optional
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+
+	// /federate的match[]参数，例如{job="kubernetes-pods"}或{__name__=~"job:.*"}
+	// +kubebuilder:validation:MinItems=1
+	Match []string `json:"match"`
+
+	// 联邦抓取间隔，未设置时使用全局抓取间隔
+	// +kubebuilder:validation:Pattern=`^[0-9]+(ms|s|m|h)$`
+	// +optional
+	ScrapeInterval string `json:"scrapeInterval,omitempty"`
+}
+
+// FederationTargetRef references a MonitorStack to federate from
+type FederationTargetRef struct {
+	// MonitorStack名称
+	// +kubebuilder:validation:Required
+	Name string `json:"name"`
+
+	// MonitorStack命名空间，未设置时为同一命名空间
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// RemoteWriteSpec defines a Prometheus remote write endpoint
+type RemoteWriteSpec struct {
+	// 远程写入地址，例如https://metrics.example.com/api/v1/write
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Pattern=`^https?://`
+	URL string `json:"url"`
+
+	// 名称，用于区分多个远程写入的指标
+	// +optional
+	Name string `json:"name,omitempty"`
+
+	// 请求头，例如多租户的X-Scope-OrgID
+	// +optional
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// LokiSpec defines Loki configuration
+// Loki以单体模式（-target=all）运行单个副本，同时启用Grafana时自动注册Loki数据源
+// +kubebuilder:validation:XValidation:rule="!has(self.storage) || !has(self.storage.type) || self.storage.type != 's3' || has(self.storage.s3)",message="s3 storage requires storage.s3"
+type LokiSpec struct {
+	// 是否启用Loki
+	Enabled bool `json:"enabled"`
+
+	// 镜像配置 - 未设置时使用默认值grafana/loki:3.5.0
+	// +optional
+	Image string `json:"image,omitempty"`
+	// +optional
+	Tag string `json:"tag,omitempty"`
+
+	// 资源配置
+	// +optional
+	Resources ResourceRequirements `json:"resources,omitempty"`
+
+	// 存储配置
+	// +optional
+	Storage LokiStorageSpec `json:"storage,omitempty"`
+
+	// 服务配置，默认端口3100
+	// +optional
+	Service ServiceSpec `json:"service,omitempty"`
+
+	// 日志保留时间，未设置时为7d
+	// +kubebuilder:validation:Pattern=`^[0-9]+[hdy]$`
+	// +optional
+	Retention string `json:"retention,omitempty"`
+
+	// 安全上下文配置
+	// +optional
+	Security *SecuritySpec `json:"security,omitempty"`
+
+	// Promtail配置 - 以DaemonSet在每个节点上采集Pod日志并推送到Loki
+	// 设置prometheus.targetNamespaces时只采集status.targetNamespaces中的命名空间，
+	// 未设置时只有ClusterMonitorStack生成或被MonitorStackPolicy允许的MonitorStack采集所有命名空间，否则只采集自身所在的命名空间
+	// +kubebuilder:default={enabled: true}
+	// +optional
+	Promtail PromtailSpec `json:"promtail,omitempty"`
+
+	// 自动注册的Loki数据源的派生字段，用于从日志跳转到链路追踪
+	// 未设置时，如果Grafana中有设置了uid的tempo、jaeger或zipkin数据源，自动添加TraceID派生字段
+	// +optional
+	DerivedFields []LokiDerivedFieldSpec `json:"derivedFields,omitempty"`
+}
+
+// LokiStorageSpec defines where Loki stores chunks and indexes
+type LokiStorageSpec struct {
+	// 存储类型 - filesystem保存在本地卷中，s3保存在S3兼容的对象存储中，默认为filesystem
+	// 修改存储类型后已有的日志无法查询
+	// +kubebuilder:validation:Enum=filesystem;s3
+	// +optional
+	Type string `json:"type,omitempty"`
+
+	// 本地卷大小 - filesystem时保存日志数据，s3时只保存WAL和索引缓存，未设置时使用emptyDir
+	// +optional
+	Size string `json:"size,omitempty"`
+
+	// 本地卷的StorageClass
+	// +optional
+	StorageClass string `json:"storageClass,omitempty"`
+
+	// PVC保留策略，size未设置时不使用PVC
+	// Delete: 禁用Loki、不再使用本地卷或删除MonitorStack时删除PVC
+	// Retain: 始终保留PVC，删除MonitorStack时解除PVC的OwnerReference
+	// RetainOnDisable: 禁用Loki或不再使用本地卷时保留PVC，删除MonitorStack时随之删除
+	// 默认为Retain，删除MonitorStack不会删除日志数据
+	// +kubebuilder:validation:Enum=Delete;Retain;RetainOnDisable
+	// +kubebuilder:default="Retain"
+	// +optional
+	RetentionPolicy string `json:"retentionPolicy,omitempty"`
+
+	// S3兼容的对象存储，type为s3时必须设置
+	// +optional
+	S3 *LokiS3Storage `json:"s3,omitempty"`
+}
+
+// LokiS3Storage defines an S3-compatible bucket for Loki chunks and indexes
+type LokiS3Storage struct {
+	// 对象存储地址，例如https://s3.amazonaws.com或http://minio.minio.svc:9000
+	// +kubebuilder:validation:Pattern=`^https?://`
+	Endpoint string `json:"endpoint"`
+
+	// 存储桶名称
+	// +kubebuilder:validation:MinLength=1
+	Bucket string `json:"bucket"`
+
+	// 区域
+	// +optional
+	Region string `json:"region,omitempty"`
+
+	// 使用路径方式访问存储桶，MinIO等需要开启
+	// +optional
+	ForcePathStyle bool `json:"forcePathStyle,omitempty"`
+
+	// 访问凭证Secret，包含AWS_ACCESS_KEY_ID和AWS_SECRET_ACCESS_KEY
+	CredentialsSecret corev1.LocalObjectReference `json:"credentialsSecret"`
+}
+
+// PromtailSpec defines the Promtail DaemonSet collecting pod logs
+type PromtailSpec struct {
+	// 是否部署Promtail
+	// +kubebuilder:default=true
+	Enabled bool `json:"enabled"`
+
+	// 镜像配置 - 未设置时使用默认值grafana/promtail:3.5.0
+	// Promtail已停止维护，不再随Loki发布新版本
+	// +optional
+	Image string `json:"image,omitempty"`
+	// +optional
+	Tag string `json:"tag,omitempty"`
+
+	// 资源配置
+	// +optional
+	Resources ResourceRequirements `json:"resources,omitempty"`
+
+	// 容忍度 - 需要采集带有污点的节点（例如控制平面节点）的日志时设置
+	// +optional
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+}
+
+// LokiDerivedFieldSpec defines a Grafana derived field extracted from log lines
+type LokiDerivedFieldSpec struct {
+	// 字段名称
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+
+	// 从日志中提取值的正则表达式，第一个捕获组为字段值，例如traceID=(\w+)
+	// +kubebuilder:validation:MinLength=1
+	MatcherRegex string `json:"matcherRegex"`
+
+	// 链接地址，设置datasourceUid时为查询语句，例如${__value.raw}
+	// +optional
+	URL string `json:"url,omitempty"`
+
+	// 链接到的数据源uid，例如Tempo数据源
+	// +optional
+	DatasourceUID string `json:"datasourceUid,omitempty"`
+
+	// 外部链接的显示名称
+	// +optional
+	URLDisplayLabel string `json:"urlDisplayLabel,omitempty"`
 }
 
 // GrafanaSpec defines Grafana configuration
@@ -86,11 +424,13 @@ type GrafanaSpec struct {
 	// +kubebuilder:default=true
 	Enabled bool `json:"enabled"`
 
-	// 镜像配置
-	// +kubebuilder:default="grafana/grafana"
+	// 镜像配置 - 未设置时使用MonitorStackClass或默认值grafana/grafana:latest
 	Image string `json:"image,omitempty"`
-	// +kubebuilder:default="latest"
-	Tag string `json:"tag,omitempty"`
+	Tag   string `json:"tag,omitempty"`
+	// 镜像摘要 - 设置后使用摘要固定镜像，忽略标签
+	// +kubebuilder:validation:Pattern=`^sha256:[a-f0-9]{64}$`
+	// +optional
+	Digest string `json:"digest,omitempty"`
 
 	// 资源配置
 	Resources ResourceRequirements `json:"resources,omitempty"`
@@ -105,8 +445,189 @@ type GrafanaSpec struct {
 	// 数据源配置
 	Datasources []DatasourceSpec `json:"datasources,omitempty"`
 
+	// 是否禁用自动注册数据源
+	// 默认情况下同时启用Prometheus和Grafana时，会自动将栈内Prometheus注册为默认数据源
+	// +optional
+	DisableAutoDatasource bool `json:"disableAutoDatasource,omitempty"`
+
 	// 仪表板配置
 	Dashboards []DashboardSpec `json:"dashboards,omitempty"`
+
+	// 认证配置 - 单点登录（OAuth/OIDC、LDAP）
+	// +optional
+	Auth *GrafanaAuthSpec `json:"auth,omitempty"`
+
+	// grafana.ini配置 - section -> key -> value
+	// 空字符串section表示ini文件顶部的全局配置项
+	// +optional
+	Config map[string]map[string]string `json:"config,omitempty"`
+
+	// 从Secret读取的grafana.ini配置项，例如SMTP密码
+	// +optional
+	ConfigSecrets []GrafanaConfigSecret `json:"configSecrets,omitempty"`
+
+	// 插件配置 - 在Grafana启动前通过init容器安装
+	// +listType=map
+	// +listMapKey=id
+	// +optional
+	Plugins []GrafanaPluginSpec `json:"plugins,omitempty"`
+
+	// 插件仓库地址 - 离线环境可指向内部镜像，默认为grafana.com
+	// +optional
+	PluginRepositoryURL string `json:"pluginRepositoryUrl,omitempty"`
+
+	// 安全上下文配置
+	// +optional
+	Security *SecuritySpec `json:"security,omitempty"`
+
+	// 健康检查配置 - 覆盖默认的探针参数
+	// +optional
+	Probes *ProbesSpec `json:"probes,omitempty"`
+
+	// 水平自动扩缩容 - 启用后由HPA管理副本数，operator不再设置Deployment的副本数
+	// 多副本需要共享的数据库，maxReplicas大于1时必须通过config或configSecrets配置database（mysql或postgres）
+	// +optional
+	Autoscaling *AutoscalingSpec `json:"autoscaling,omitempty"`
+
+	// Pod中断预算 - 限制节点排空等主动驱逐同时驱逐的Pod数量
+	// +optional
+	PodDisruptionBudget *PodDisruptionBudgetSpec `json:"podDisruptionBudget,omitempty"`
+
+	// Pod模板覆盖 - 以strategic merge patch的方式合并到生成的PodTemplateSpec
+	// 可用于配置nodeSelector、tolerations、affinity、priorityClassName、sidecar容器等
+	// 主容器的image、resources以及serviceAccountName、automountServiceAccountToken和Pod的securityContext不允许覆盖，需通过对应字段设置
+	// 不允许使用宿主机的命名空间、hostPath卷、宿主机端口和特权容器
+	// +kubebuilder:pruning:PreserveUnknownFields
+	// +kubebuilder:validation:Schemaless
+	// +kubebuilder:validation:Type=object
+	// +optional
+	PodTemplate *runtime.RawExtension `json:"podTemplate,omitempty"`
+}
+
+// GrafanaPluginSpec defines a Grafana plugin to install
+type GrafanaPluginSpec struct {
+	// 插件ID，例如grafana-piechart-panel
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Pattern=`^[a-zA-Z0-9._-]+$`
+	ID string `json:"id"`
+
+	// 插件版本，为空时安装最新版本
+	// +kubebuilder:validation:Pattern=`^[a-zA-Z0-9.+-]+$`
+	// +optional
+	Version string `json:"version,omitempty"`
+
+	// 插件zip包下载地址，设置后忽略插件仓库
+	// +optional
+	URL string `json:"url,omitempty"`
+}
+
+// GrafanaConfigSecret defines a grafana.ini key whose value is read from a Secret
+type GrafanaConfigSecret struct {
+	// grafana.ini中的section，例如smtp
+	// +kubebuilder:validation:Required
+	Section string `json:"section"`
+
+	// section中的配置项，例如password
+	// +kubebuilder:validation:Required
+	Key string `json:"key"`
+
+	// 配置值所在的Secret
+	// +kubebuilder:validation:Required
+	SecretKeyRef corev1.SecretKeySelector `json:"secretKeyRef"`
+}
+
+// GrafanaAuthSpec defines Grafana authentication configuration
+type GrafanaAuthSpec struct {
+	// 是否禁用登录表单，仅允许通过SSO登录
+	// +optional
+	DisableLoginForm bool `json:"disableLoginForm,omitempty"`
+
+	// 通用OAuth/OIDC配置
+	// +optional
+	GenericOAuth *GrafanaGenericOAuthSpec `json:"genericOAuth,omitempty"`
+
+	// LDAP配置
+	// +optional
+	LDAP *GrafanaLDAPSpec `json:"ldap,omitempty"`
+}
+
+// GrafanaGenericOAuthSpec defines Grafana generic OAuth/OIDC configuration
+type GrafanaGenericOAuthSpec struct {
+	// 登录页面上显示的名称
+	// +kubebuilder:default="OAuth"
+	Name string `json:"name,omitempty"`
+
+	// OAuth客户端ID
+	// +kubebuilder:validation:Required
+	ClientID string `json:"clientId"`
+
+	// OAuth客户端密钥 - 从Secret中读取
+	// +kubebuilder:validation:Required
+	ClientSecret corev1.SecretKeySelector `json:"clientSecret"`
+
+	// 请求的权限范围
+	// +optional
+	Scopes []string `json:"scopes,omitempty"`
+
+	// 授权端点
+	// +kubebuilder:validation:Required
+	AuthURL string `json:"authUrl"`
+
+	// 令牌端点
+	// +kubebuilder:validation:Required
+	TokenURL string `json:"tokenUrl"`
+
+	// 用户信息端点
+	// +optional
+	APIURL string `json:"apiUrl,omitempty"`
+
+	// 角色映射表达式（JMESPath），例如 contains(groups[*], 'admin') && 'Admin' || 'Viewer'
+	// +optional
+	RoleAttributePath string `json:"roleAttributePath,omitempty"`
+
+	// 是否允许首次登录的用户自动注册
+	// +optional
+	AllowSignUp bool `json:"allowSignUp,omitempty"`
+}
+
+// GrafanaLDAPSpec defines Grafana LDAP configuration
+type GrafanaLDAPSpec struct {
+	// LDAP配置文件（ldap.toml）- 从Secret中读取
+	// +kubebuilder:validation:Required
+	Config corev1.SecretKeySelector `json:"config"`
+
+	// 是否允许首次登录的用户自动注册
+	// +optional
+	AllowSignUp bool `json:"allowSignUp,omitempty"`
+}
+
+// SizingSpec defines how resource recommendations are computed and applied
+// 通过Prometheus HTTP API逐个查询分片中自监控任务（job="prometheus"）采集的
+// process_resident_memory_bytes和prometheus_tsdb_head_series，只统计monitor_stack标签为{命名空间}/{名称}的序列
+// 使用自定义配置或agent模式时直接读取Prometheus的/metrics，只能根据当前值计算
+type SizingSpec struct {
+	// 是否计算资源建议
+	Enabled bool `json:"enabled"`
+
+	// 是否自动应用建议值，应用后覆盖resources中的内存配置
+	// 建议值与已应用值相差超过20%时才更新，避免频繁重启Prometheus
+	// +optional
+	AutoApply bool `json:"autoApply,omitempty"`
+
+	// 自动应用时内存的下限
+	// +optional
+	MinMemory string `json:"minMemory,omitempty"`
+
+	// 自动应用时内存的上限，同时限制requests和limits
+	// 所在命名空间的MonitorStackPolicy设置了maxResources.memory时，自动应用的值也不会超过该值
+	// +optional
+	MaxMemory string `json:"maxMemory,omitempty"`
+
+	// 内存使用量达到limits的百分比时发出警告事件，默认90
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=100
+	// +optional
+	WarningThresholdPercent *int32 `json:"warningThresholdPercent,omitempty"`
 }
 
 // ResourceRequirements defines resource limits and requests
@@ -121,10 +642,261 @@ type ResourceList struct {
 	Memory string `json:"memory,omitempty"`
 }
 
+// TargetNamespacesSpec defines the namespaces Prometheus discovers targets in
+// 命名空间列表和标签选择器可以同时设置，结果取并集
+type TargetNamespacesSpec struct {
+	// 命名空间列表
+	// +optional
+	Names []string `json:"names,omitempty"`
+
+	// 命名空间标签选择器，匹配的命名空间增减时自动更新
+	// +optional
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+}
+
+// BackupSpec defines scheduled TSDB snapshot backups
+// 通过Prometheus管理API创建快照，再将快照目录上传到备份目标
+// 只支持单个Prometheus实例，备份的是Prometheus Service后端实例的数据PVC
+type BackupSpec struct {
+	// 备份计划，Cron格式，例如"0 2 * * *"
+	// +kubebuilder:validation:MinLength=1
+	Schedule string `json:"schedule"`
+
+	// 保留的备份数量，超出的旧备份会被删除
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default=7
+	// +optional
+	Retention int32 `json:"retention,omitempty"`
+
+	// 暂停备份
+	// +optional
+	Suspend bool `json:"suspend,omitempty"`
+
+	// 备份目标
+	Destination BackupDestination `json:"destination"`
+
+	// 运行上传脚本使用的镜像，需要包含/bin/sh，默认使用busybox
+	// 上传到S3时mc二进制从minio/mc镜像复制到共享目录，不要求镜像中包含mc
+	// +optional
+	Image string `json:"image,omitempty"`
+}
+
+// BackupDestination defines where snapshots are uploaded, exactly one must be set
+// +kubebuilder:validation:XValidation:rule="has(self.s3) != has(self.pvc)",message="exactly one backup destination (s3 or pvc) must be set"
+type BackupDestination struct {
+	// S3兼容的对象存储（AWS S3、MinIO等）
+	// +optional
+	S3 *S3BackupDestination `json:"s3,omitempty"`
+
+	// 备份到PVC
+	// +optional
+	PVC *PVCBackupDestination `json:"pvc,omitempty"`
+}
+
+// S3BackupDestination defines an S3-compatible backup bucket
+type S3BackupDestination struct {
+	// 对象存储地址，例如https://s3.amazonaws.com或http://minio.minio.svc:9000
+	// +kubebuilder:validation:MinLength=1
+	Endpoint string `json:"endpoint"`
+
+	// 存储桶名称
+	// +kubebuilder:validation:MinLength=1
+	Bucket string `json:"bucket"`
+
+	// 对象前缀，快照保存在{bucket}/{prefix}/{快照名称}/下
+	// +optional
+	Prefix string `json:"prefix,omitempty"`
+
+	// 跳过TLS证书校验，仅用于测试环境
+	// +optional
+	Insecure bool `json:"insecure,omitempty"`
+
+	// 访问凭证Secret，包含AWS_ACCESS_KEY_ID和AWS_SECRET_ACCESS_KEY
+	CredentialsSecret corev1.LocalObjectReference `json:"credentialsSecret"`
+}
+
+// PVCBackupDestination defines a PVC backup target
+type PVCBackupDestination struct {
+	// PVC名称，必须与MonitorStack位于同一命名空间
+	// +kubebuilder:validation:MinLength=1
+	ClaimName string `json:"claimName"`
+}
+
+// SecuritySpec defines pod and container security contexts
+// 默认生成符合PodSecurity restricted标准的安全上下文
+type SecuritySpec struct {
+	// 不设置固定的runAsUser/fsGroup，由平台分配UID（例如OpenShift restricted SCC）
+	// +optional
+	OmitFixedUIDs bool `json:"omitFixedUIDs,omitempty"`
+
+	// Pod安全上下文，设置后完全替换默认值
+	// +optional
+	PodSecurityContext *corev1.PodSecurityContext `json:"podSecurityContext,omitempty"`
+
+	// 容器安全上下文，设置后完全替换默认值，同时应用于init容器
+	// 不允许特权容器和添加NET_BIND_SERVICE以外的capabilities
+	// +optional
+	ContainerSecurityContext *corev1.SecurityContext `json:"containerSecurityContext,omitempty"`
+}
+
+// ProbesSpec defines probe overrides for a component
+type ProbesSpec struct {
+	// 存活探针
+	// +optional
+	Liveness *ProbeSpec `json:"liveness,omitempty"`
+
+	// 就绪探针
+	// +optional
+	Readiness *ProbeSpec `json:"readiness,omitempty"`
+
+	// 启动探针 - 启动探针成功前不会执行存活探针
+	// Prometheus默认根据存储大小计算failureThreshold，为WAL回放预留足够时间
+	// +optional
+	Startup *ProbeSpec `json:"startup,omitempty"`
+}
+
+// ProbeSpec defines probe timing parameters
+// 检查路径和端口由operator管理，这里只配置时间参数，未设置的字段使用默认值
+type ProbeSpec struct {
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	InitialDelaySeconds *int32 `json:"initialDelaySeconds,omitempty"`
+
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	PeriodSeconds *int32 `json:"periodSeconds,omitempty"`
+
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	TimeoutSeconds *int32 `json:"timeoutSeconds,omitempty"`
+
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	FailureThreshold *int32 `json:"failureThreshold,omitempty"`
+
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	SuccessThreshold *int32 `json:"successThreshold,omitempty"`
+}
+
+// AutoscalingSpec defines HorizontalPodAutoscaler configuration
+// CPU和内存目标使用率相对于resources.requests计算，使用前需要配置requests
+// +kubebuilder:validation:XValidation:rule="!has(self.minReplicas) || self.minReplicas <= self.maxReplicas",message="minReplicas must not be greater than maxReplicas"
+type AutoscalingSpec struct {
+	// 是否启用自动扩缩容
+	Enabled bool `json:"enabled"`
+
+	// 最小副本数，默认1
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	MinReplicas *int32 `json:"minReplicas,omitempty"`
+
+	// 最大副本数
+	// +kubebuilder:validation:Minimum=1
+	MaxReplicas int32 `json:"maxReplicas"`
+
+	// CPU目标使用率（百分比），CPU和内存都未设置时默认80
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	TargetCPUUtilizationPercentage *int32 `json:"targetCPUUtilizationPercentage,omitempty"`
+
+	// 内存目标使用率（百分比）
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	TargetMemoryUtilizationPercentage *int32 `json:"targetMemoryUtilizationPercentage,omitempty"`
+}
+
+// PodDisruptionBudgetSpec defines PodDisruptionBudget configuration
+// minAvailable和maxUnavailable只能设置一个，都未设置时默认maxUnavailable为1
+// +kubebuilder:validation:XValidation:rule="!(has(self.minAvailable) && has(self.maxUnavailable))",message="minAvailable and maxUnavailable are mutually exclusive"
+type PodDisruptionBudgetSpec struct {
+	// 是否创建PodDisruptionBudget
+	Enabled bool `json:"enabled"`
+
+	// 驱逐后至少可用的Pod数量或百分比
+	// +optional
+	MinAvailable *intstr.IntOrString `json:"minAvailable,omitempty"`
+
+	// 最多不可用的Pod数量或百分比
+	// +optional
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+}
+
 // StorageSpec defines storage configuration
 type StorageSpec struct {
 	Size         string `json:"size,omitempty"`
 	StorageClass string `json:"storageClass,omitempty"`
+
+	// PVC保留策略
+	// Delete: 禁用组件或删除MonitorStack时删除PVC
+	// Retain: 始终保留PVC，删除MonitorStack时解除PVC的OwnerReference
+	// RetainOnDisable: 禁用组件时保留PVC，删除MonitorStack时随之删除
+	// 默认为Retain，删除MonitorStack不会删除监控数据
+	// 保留的PVC会在同名MonitorStack重新创建时被重新接管
+	// +kubebuilder:validation:Enum=Delete;Retain;RetainOnDisable
+	// +kubebuilder:default="Retain"
+	// +optional
+	RetentionPolicy string `json:"retentionPolicy,omitempty"`
+
+	// 从已有数据恢复 - 只在PVC中还没有数据时执行一次
+	// +optional
+	RestoreFrom *RestoreSource `json:"restoreFrom,omitempty"`
+}
+
+// RestoreSource defines where to restore Prometheus data from, exactly one must be set
+// +kubebuilder:validation:XValidation:rule="(has(self.s3) ? 1 : 0) + (has(self.pvc) ? 1 : 0) + (has(self.volumeSnapshot) ? 1 : 0) == 1",message="exactly one restore source (s3, pvc or volumeSnapshot) must be set"
+type RestoreSource struct {
+	// 从S3兼容对象存储中的备份恢复
+	// +optional
+	S3 *S3RestoreSource `json:"s3,omitempty"`
+
+	// 从已有PVC复制数据
+	// +optional
+	PVC *PVCRestoreSource `json:"pvc,omitempty"`
+
+	// 从VolumeSnapshot创建PVC，只在PVC创建时生效
+	// +optional
+	VolumeSnapshot *VolumeSnapshotRestoreSource `json:"volumeSnapshot,omitempty"`
+}
+
+// S3RestoreSource defines a backup stored in an S3-compatible bucket
+type S3RestoreSource struct {
+	// 对象存储地址
+	// +kubebuilder:validation:MinLength=1
+	Endpoint string `json:"endpoint"`
+
+	// 存储桶名称
+	// +kubebuilder:validation:MinLength=1
+	Bucket string `json:"bucket"`
+
+	// 快照在存储桶中的路径，例如production/20240101T020000Z-1a2b3c4d5e6f7a8b
+	// +kubebuilder:validation:MinLength=1
+	Path string `json:"path"`
+
+	// 跳过TLS证书校验，仅用于测试环境
+	// +optional
+	Insecure bool `json:"insecure,omitempty"`
+
+	// 访问凭证Secret，包含AWS_ACCESS_KEY_ID和AWS_SECRET_ACCESS_KEY
+	CredentialsSecret corev1.LocalObjectReference `json:"credentialsSecret"`
+}
+
+// PVCRestoreSource defines an existing PVC to copy data from
+type PVCRestoreSource struct {
+	// PVC名称，必须与MonitorStack位于同一命名空间
+	// +kubebuilder:validation:MinLength=1
+	ClaimName string `json:"claimName"`
+
+	// PVC中的数据目录，为空时使用根目录
+	// +optional
+	Path string `json:"path,omitempty"`
+}
+
+// VolumeSnapshotRestoreSource defines a VolumeSnapshot to provision the PVC from
+type VolumeSnapshotRestoreSource struct {
+	// VolumeSnapshot名称，必须与MonitorStack位于同一命名空间
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
 }
 
 // ServiceSpec defines service configuration
@@ -151,6 +923,48 @@ type DatasourceSpec struct {
 	Type string `json:"type"`
 	// +kubebuilder:validation:Required
 	URL string `json:"url"`
+
+	// 数据源唯一标识，仪表板通过uid引用数据源
+	// +kubebuilder:validation:MaxLength=40
+	// +kubebuilder:validation:Pattern=`^[a-zA-Z0-9_-]+$`
+	// +optional
+	UID string `json:"uid,omitempty"`
+
+	// 访问模式
+	// +kubebuilder:validation:Enum=proxy;direct
+	// +kubebuilder:default="proxy"
+	Access string `json:"access,omitempty"`
+
+	// 是否为默认数据源，最多只能有一个
+	// 未指定时第一个Prometheus类型的数据源作为默认数据源
+	// +optional
+	IsDefault bool `json:"isDefault,omitempty"`
+
+	// 是否启用Basic认证
+	// +optional
+	BasicAuth bool `json:"basicAuth,omitempty"`
+
+	// Basic认证用户名，密码通过secureJsonData.basicAuthPassword设置
+	// +optional
+	BasicAuthUser string `json:"basicAuthUser,omitempty"`
+
+	// 是否允许在Grafana界面中编辑
+	// +optional
+	Editable bool `json:"editable,omitempty"`
+
+	// 所属组织ID
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	OrgID int64 `json:"orgId,omitempty"`
+
+	// 数据源类型相关的附加配置（jsonData），内容原样写入Grafana
+	// +kubebuilder:pruning:PreserveUnknownFields
+	// +optional
+	JSONData *runtime.RawExtension `json:"jsonData,omitempty"`
+
+	// 加密存储的配置（secureJsonData），值从Secret读取
+	// +optional
+	SecureJSONData map[string]corev1.SecretKeySelector `json:"secureJsonData,omitempty"`
 }
 
 // DashboardSpec defines Grafana dashboard
@@ -178,7 +992,7 @@ type MonitorStackStatus struct {
 	//
 	// The status of each condition is one of True, False, or Unknown.
 	// 整体状态 - Pending, Ready, Failed等
-	// +kubebuilder:validation:Enum=Pending;Ready;Failed;Updating
+	// +kubebuilder:validation:Enum=Pending;Ready;Failed;Updating;Paused
 	Phase string `json:"phase,omitempty"`
 
 	// 状态消息 - 详细的状态描述
@@ -190,6 +1004,46 @@ type MonitorStackStatus struct {
 	// Grafana组件状态
 	GrafanaStatus ComponentStatus `json:"grafanaStatus,omitempty"`
 
+	// Loki组件状态
+	// +optional
+	LokiStatus ComponentStatus `json:"lokiStatus,omitempty"`
+
+	// Promtail组件状态，副本数量为已就绪的节点数量
+	// +optional
+	PromtailStatus ComponentStatus `json:"promtailStatus,omitempty"`
+
+	// Grafana插件安装状态
+	// +optional
+	GrafanaPlugins []PluginStatus `json:"grafanaPlugins,omitempty"`
+
+	// Prometheus持久化存储状态
+	// +optional
+	PrometheusStorage *StorageStatus `json:"prometheusStorage,omitempty"`
+
+	// Prometheus资源建议
+	// +optional
+	PrometheusSizing *SizingStatus `json:"prometheusSizing,omitempty"`
+
+	// Prometheus备份状态
+	// +optional
+	Backup *BackupStatus `json:"backup,omitempty"`
+
+	// Prometheus服务发现的命名空间
+	// +optional
+	TargetNamespaces []string `json:"targetNamespaces,omitempty"`
+
+	// 联邦抓取的MonitorStack
+	// +optional
+	FederationTargets []FederationTargetStatus `json:"federationTargets,omitempty"`
+
+	// Prometheus分片状态，未分片时为空
+	// +optional
+	PrometheusShards []ShardStatus `json:"prometheusShards,omitempty"`
+
+	// 生效的MonitorStackClass的generation，类修改后同步到MonitorStack时更新
+	// +optional
+	ObservedClassGeneration int64 `json:"observedClassGeneration,omitempty"`
+
 	// 最后更新时间
 	LastUpdated metav1.Time `json:"lastUpdated,omitempty"`
 
@@ -212,6 +1066,157 @@ type ComponentStatus struct {
 
 	// 服务端点 - 可访问的服务地址
 	Endpoint string `json:"endpoint,omitempty"`
+
+	// 当前部署的镜像
+	// +optional
+	Image string `json:"image,omitempty"`
+
+	// 当前部署的镜像对应的版本标签，镜像使用摘要时用于判断版本
+	// +optional
+	Tag string `json:"tag,omitempty"`
+
+	// 正在运行的镜像摘要，从Pod状态中解析
+	// +optional
+	ImageDigest string `json:"imageDigest,omitempty"`
+
+	// 最后一个成功就绪的镜像，升级失败时回滚到该镜像
+	// +optional
+	LastKnownGoodImage string `json:"lastKnownGoodImage,omitempty"`
+
+	// 最后一个成功就绪的镜像对应的版本标签，回滚时一起恢复
+	// +optional
+	LastKnownGoodTag string `json:"lastKnownGoodTag,omitempty"`
+
+	// 升级失败并已回滚的镜像，修改为其他版本前不会重试
+	// +optional
+	FailedImage string `json:"failedImage,omitempty"`
+
+	// 当前升级开始的时间，升级完成后清空
+	// +optional
+	UpgradeStartedAt *metav1.Time `json:"upgradeStartedAt,omitempty"`
+}
+
+// StorageStatus defines the observed state of a persistent volume claim
+type StorageStatus struct {
+	// 期望的存储大小
+	Size string `json:"size,omitempty"`
+
+	// PVC当前的实际容量
+	Capacity string `json:"capacity,omitempty"`
+
+	// 为完成文件系统扩容而重启Pod的时间
+	// +optional
+	RestartedAt string `json:"restartedAt,omitempty"`
+}
+
+// SizingStatus defines observed Prometheus usage and the resulting recommendations
+type SizingStatus struct {
+	// 最近1小时的峰值常驻内存，使用自定义配置或agent模式时为当前值
+	// +optional
+	MemoryUsage string `json:"memoryUsage,omitempty"`
+
+	// 最近1小时的峰值head序列数，使用自定义配置时为当前值，agent模式时为当前的活跃序列数
+	// +optional
+	HeadSeries int64 `json:"headSeries,omitempty"`
+
+	// 建议的资源requests
+	// +optional
+	RecommendedRequests ResourceList `json:"recommendedRequests,omitempty"`
+
+	// 建议的资源limits
+	// +optional
+	RecommendedLimits ResourceList `json:"recommendedLimits,omitempty"`
+
+	// 已自动应用的资源requests
+	// +optional
+	AppliedRequests *ResourceList `json:"appliedRequests,omitempty"`
+
+	// 已自动应用的资源limits
+	// +optional
+	AppliedLimits *ResourceList `json:"appliedLimits,omitempty"`
+
+	// 最后一次查询指标的时间
+	// +optional
+	LastObservedTime *metav1.Time `json:"lastObservedTime,omitempty"`
+}
+
+// FederationTargetStatus defines a resolved federation target
+type FederationTargetStatus struct {
+	// MonitorStack名称
+	Name string `json:"name"`
+
+	// MonitorStack命名空间
+	Namespace string `json:"namespace"`
+
+	// Prometheus Service地址，格式为{Service名称}.{命名空间}.svc:{端口}，分片时包含所有分片
+	Endpoints []string `json:"endpoints"`
+
+	// 访问目标Prometheus的协议，目标启用HTTPS时为https
+	// +optional
+	Scheme string `json:"scheme,omitempty"`
+
+	// 目标启用Basic认证时的用户名，密码复制到本栈的联邦凭据Secret中
+	// +optional
+	Username string `json:"username,omitempty"`
+
+	// 是否使用目标配置的CA证书校验服务端证书，CA证书复制到本栈的联邦凭据Secret中
+	// +optional
+	TLSCA bool `json:"tlsCA,omitempty"`
+}
+
+// ShardStatus defines the observed state of a Prometheus shard
+type ShardStatus struct {
+	// 分片序号，从0开始
+	Shard int32 `json:"shard"`
+
+	// 分片的Deployment和Service名称
+	Name string `json:"name"`
+
+	// 是否就绪
+	Ready bool `json:"ready"`
+
+	// 副本数量
+	// +optional
+	Replicas int32 `json:"replicas,omitempty"`
+
+	// 服务端点
+	// +optional
+	Endpoint string `json:"endpoint,omitempty"`
+}
+
+// BackupStatus defines the observed state of scheduled backups
+type BackupStatus struct {
+	// 最后一次备份开始的时间
+	// +optional
+	LastBackupTime *metav1.Time `json:"lastBackupTime,omitempty"`
+
+	// 最后一次成功备份的时间
+	// +optional
+	LastSuccessfulTime *metav1.Time `json:"lastSuccessfulTime,omitempty"`
+
+	// 最后一次备份的结果 - Running, Succeeded, Failed
+	// +optional
+	LastResult string `json:"lastResult,omitempty"`
+
+	// 最后一次备份的详细信息
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// PluginStatus defines the installation status of a Grafana plugin
+type PluginStatus struct {
+	// 插件ID
+	ID string `json:"id"`
+
+	// 已安装的版本
+	Version string `json:"version,omitempty"`
+
+	// 是否已安装
+	Installed bool `json:"installed"`
+
+	// 安装失败时的说明
+	// +optional
+	Message string `json:"message,omitempty"`
 }
 
 //+kubebuilder:object:root=true
@@ -0,0 +1,108 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// MonitorStackClassSpec defines the defaults inherited by MonitorStacks referencing the class
+// MonitorStackClassSpec 定义引用该类的MonitorStack继承的默认配置
+// MonitorStack中设置的字段优先于类中的字段
+type MonitorStackClassSpec struct {
+	// Prometheus默认配置
+	// +optional
+	Prometheus PrometheusClassSpec `json:"prometheus,omitempty"`
+
+	// Grafana默认配置
+	// +optional
+	Grafana GrafanaClassSpec `json:"grafana,omitempty"`
+
+	// 默认资源标签，与MonitorStack的标签合并
+	// +optional
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// PrometheusClassSpec defines Prometheus defaults of a MonitorStackClass
+type PrometheusClassSpec struct {
+	// 镜像配置
+	// +optional
+	Image string `json:"image,omitempty"`
+	// +optional
+	Tag string `json:"tag,omitempty"`
+
+	// 资源配置
+	// +optional
+	Resources ResourceRequirements `json:"resources,omitempty"`
+
+	// 持久化存储的StorageClass，只用于新建的PVC，已有PVC的StorageClass不可修改
+	// +optional
+	StorageClass string `json:"storageClass,omitempty"`
+
+	// 数据保留时间
+	// +kubebuilder:validation:Pattern=`^[0-9]+[smhdy]$`
+	// +optional
+	Retention string `json:"retention,omitempty"`
+}
+
+// GrafanaClassSpec defines Grafana defaults of a MonitorStackClass
+type GrafanaClassSpec struct {
+	// 镜像配置
+	// +optional
+	Image string `json:"image,omitempty"`
+	// +optional
+	Tag string `json:"tag,omitempty"`
+
+	// 资源配置
+	// +optional
+	Resources ResourceRequirements `json:"resources,omitempty"`
+
+	// 数据源配置 - MonitorStack中同名的数据源覆盖类中的数据源
+	// +optional
+	Datasources []DatasourceSpec `json:"datasources,omitempty"`
+
+	// 仪表板配置 - MonitorStack中同名的仪表板覆盖类中的仪表板
+	// +optional
+	Dashboards []DashboardSpec `json:"dashboards,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:resource:scope=Cluster
+//+kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// MonitorStackClass is the Schema for the monitorstackclasses API
+// 监控栈模板 - 集中维护一组默认配置，MonitorStack通过spec.className引用
+type MonitorStackClass struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// 默认配置
+	Spec MonitorStackClassSpec `json:"spec,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// MonitorStackClassList contains a list of MonitorStackClass
+type MonitorStackClassList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []MonitorStackClass `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&MonitorStackClass{}, &MonitorStackClassList{})
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// MonitorStackPolicySpec defines the limits enforced on MonitorStacks in the selected namespaces
+// MonitorStackPolicySpec 定义对所选命名空间中MonitorStack的限制
+// 多个策略选中同一命名空间时，MonitorStack需要同时满足所有策略
+type MonitorStackPolicySpec struct {
+	// 策略生效的命名空间，未设置时对所有命名空间生效
+	// +optional
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+
+	// 最大数据保留时间
+	// +kubebuilder:validation:Pattern=`^[0-9]+[smhdy]$`
+	// +optional
+	MaxRetention string `json:"maxRetention,omitempty"`
+
+	// 最大持久化存储大小
+	// +optional
+	MaxStorageSize string `json:"maxStorageSize,omitempty"`
+
+	// 允许的Service类型，未设置时不限制
+	// +kubebuilder:validation:items:Enum=ClusterIP;NodePort;LoadBalancer;ExternalName
+	// +optional
+	AllowedServiceTypes []string `json:"allowedServiceTypes,omitempty"`
+
+	// 允许的镜像仓库，例如registry.example.com或registry.example.com/monitoring，未设置时不限制
+	// 未指定仓库的镜像属于docker.io
+	// +optional
+	AllowedImageRegistries []string `json:"allowedImageRegistries,omitempty"`
+
+	// 每个组件的最大资源，同时限制requests和limits
+	// +optional
+	MaxResources ResourceList `json:"maxResources,omitempty"`
+
+	// 允许MonitorStack通过targetNamespaces发现或通过federation联邦抓取的其他命名空间
+	// MonitorStack所在的命名空间始终允许，其他命名空间需要至少一个生效的策略列出，
+	// 没有策略列出时只能发现自身所在的命名空间，避免租户为自己的Prometheus取得其他命名空间的权限
+	// +optional
+	AllowedTargetNamespaces []string `json:"allowedTargetNamespaces,omitempty"`
+
+	// 所有组件的最大Pod副本总数，与maxResources一起限制MonitorStack可以使用的总资源
+	// Grafana启用自动扩缩容时按maxReplicas计算，Prometheus分片时每个分片计为一个副本，Promtail不计入
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	MaxReplicas *int32 `json:"maxReplicas,omitempty"`
+
+	// Prometheus的最大分片数量
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	MaxShards *int32 `json:"maxShards,omitempty"`
+
+	// 允许未设置targetNamespaces的MonitorStack通过Promtail采集节点上所有命名空间的日志
+	// 没有策略允许时只采集MonitorStack所在的命名空间，ClusterMonitorStack生成的MonitorStack始终允许
+	// +optional
+	AllowNodeLogCollection bool `json:"allowNodeLogCollection,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:resource:scope=Cluster
+//+kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// MonitorStackPolicy is the Schema for the monitorstackpolicies API
+// 租户策略 - 限制MonitorStack可以申请的资源，由准入Webhook和控制器共同执行
+type MonitorStackPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// 策略配置
+	Spec MonitorStackPolicySpec `json:"spec,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// MonitorStackPolicyList contains a list of MonitorStackPolicy
+type MonitorStackPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []MonitorStackPolicy `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&MonitorStackPolicy{}, &MonitorStackPolicyList{})
+}
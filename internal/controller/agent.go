@@ -0,0 +1,126 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+
+	monitoringv1 "github.com/ciliverse/monitor-operator/api/v1"
+)
+
+// Agent模式 - 边缘集群只需要抓取指标并转发到中心存储，
+// Prometheus以agent模式运行，只保留WAL，不提供查询，也不执行规则和告警
+
+// prometheusModeAgent Prometheus的agent运行模式
+const prometheusModeAgent = "agent"
+
+// remoteWriteConfig Prometheus配置文件中的remote_write条目
+type remoteWriteConfig struct {
+	URL     string            `json:"url"`
+	Name    string            `json:"name,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// agentConfigCheck 检查自定义配置时关心的字段
+type agentConfigCheck struct {
+	RemoteWrite []any `json:"remote_write"`
+	RemoteRead  []any `json:"remote_read"`
+	RuleFiles   []any `json:"rule_files"`
+	Alerting    *struct {
+		Alertmanagers []any `json:"alertmanagers"`
+	} `json:"alerting"`
+}
+
+// prometheusAgentFlag 根据实际部署的Prometheus版本选择启用agent模式的参数
+// 2.x通过--enable-feature=agent启用，3.0移除了该特性开关，改为--agent；
+// 镜像使用摘要时按状态中记录的实际部署的标签判断，无法识别版本的标签（例如latest）视为3.x
+func prometheusAgentFlag(image, tag string) string {
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") && !strings.Contains(image, "@") {
+		tag = image[i+1:]
+	}
+	major, _, _ := strings.Cut(strings.TrimPrefix(tag, "v"), ".")
+	if version, err := strconv.Atoi(major); err == nil && version < 3 {
+		return "--enable-feature=agent"
+	}
+	return "--agent"
+}
+
+// isPrometheusAgentMode 判断Prometheus是否以agent模式运行
+func isPrometheusAgentMode(monitorStack *monitoringv1.MonitorStack) bool {
+	return monitorStack.Spec.Prometheus.Mode == prometheusModeAgent
+}
+
+// buildPrometheusRemoteWriteConfig 生成默认配置中的remote_write部分，未配置远程写入时返回空字符串
+func (r *MonitorStackReconciler) buildPrometheusRemoteWriteConfig(monitorStack *monitoringv1.MonitorStack) string {
+	if len(monitorStack.Spec.Prometheus.RemoteWrite) == 0 {
+		return ""
+	}
+
+	remoteWrites := make([]remoteWriteConfig, 0, len(monitorStack.Spec.Prometheus.RemoteWrite))
+	for _, rw := range monitorStack.Spec.Prometheus.RemoteWrite {
+		remoteWrites = append(remoteWrites, remoteWriteConfig{URL: rw.URL, Name: rw.Name, Headers: rw.Headers})
+	}
+	// 只包含字符串字段，序列化不会失败
+	data, _ := yaml.Marshal(map[string][]remoteWriteConfig{"remote_write": remoteWrites})
+	return "# 远程写入配置\n" + string(data) + "\n"
+}
+
+// validatePrometheusAgent 验证agent模式的配置
+// agent模式至少需要一个远程写入，并且不支持规则、告警、远程读取以及依赖TSDB的备份和恢复
+func (r *MonitorStackReconciler) validatePrometheusAgent(monitorStack *monitoringv1.MonitorStack) error {
+	if !isPrometheusAgentMode(monitorStack) {
+		return nil
+	}
+	prometheus := monitorStack.Spec.Prometheus
+
+	if prometheus.Backup != nil {
+		return fmt.Errorf("backup is not supported in agent mode")
+	}
+	if prometheus.Storage.RestoreFrom != nil {
+		return fmt.Errorf("restoreFrom is not supported in agent mode")
+	}
+
+	// 默认配置由operator生成，只需要检查远程写入
+	if prometheus.Config == "" {
+		if len(prometheus.RemoteWrite) == 0 {
+			return fmt.Errorf("agent mode requires at least one remoteWrite")
+		}
+		return nil
+	}
+
+	check := &agentConfigCheck{}
+	if err := yaml.Unmarshal([]byte(prometheus.Config), check); err != nil {
+		return fmt.Errorf("failed to parse Prometheus config: %w", err)
+	}
+	if len(check.RemoteWrite) == 0 {
+		return fmt.Errorf("agent mode requires at least one remote_write in the Prometheus config")
+	}
+	if len(check.RuleFiles) > 0 {
+		return fmt.Errorf("rule_files is not supported in agent mode")
+	}
+	if check.Alerting != nil && len(check.Alerting.Alertmanagers) > 0 {
+		return fmt.Errorf("alerting is not supported in agent mode")
+	}
+	if len(check.RemoteRead) > 0 {
+		return fmt.Errorf("remote_read is not supported in agent mode")
+	}
+	return nil
+}
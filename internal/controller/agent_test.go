@@ -0,0 +1,128 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	monitoringv1 "github.com/ciliverse/monitor-operator/api/v1"
+)
+
+var _ = Describe("Prometheus agent mode", func() {
+	r := &MonitorStackReconciler{}
+
+	newAgentMonitorStack := func() *monitoringv1.MonitorStack {
+		monitorStack := newTestMonitorStack()
+		monitorStack.Spec.Prometheus.Mode = prometheusModeAgent
+		monitorStack.Spec.Prometheus.RemoteWrite = []monitoringv1.RemoteWriteSpec{
+			{URL: "https://metrics.example.com/api/v1/write", Headers: map[string]string{"X-Scope-OrgID": "edge"}},
+		}
+		return monitorStack
+	}
+
+	DescribeTable("prometheusAgentFlag",
+		func(image, tag, expected string) {
+			Expect(prometheusAgentFlag(image, tag)).To(Equal(expected))
+		},
+		Entry("uses the feature flag for 2.x", "prom/prometheus:v2.53.0", "v2.53.0", "--enable-feature=agent"),
+		Entry("uses --agent for 3.x", "prom/prometheus:v3.1.0", "v3.1.0", "--agent"),
+		Entry("uses --agent for latest", "prom/prometheus:latest", "latest", "--agent"),
+		Entry("uses the deployed tag during an upgrade", "prom/prometheus:v2.53.0", "v3.1.0", "--enable-feature=agent"),
+		Entry("uses the spec tag for digests", "prom/prometheus@sha256:abc", "v2.53.0", "--enable-feature=agent"),
+		Entry("ignores registry ports", "localhost:5000/prom/prometheus@sha256:abc", "v3.1.0", "--agent"),
+	)
+
+	It("uses the deployed tag after rolling back to a digest", func() {
+		monitorStack := newAgentMonitorStack()
+		monitorStack.Spec.Prometheus.Tag = "v3.1.0"
+		monitorStack.Status.PrometheusStatus = monitoringv1.ComponentStatus{
+			Image: "prom/prometheus@sha256:abc",
+			Tag:   "v2.53.0",
+		}
+
+		Expect(r.buildPrometheusArgs(monitorStack)).To(ContainElement("--enable-feature=agent"))
+	})
+
+	It("runs without TSDB and retention arguments", func() {
+		monitorStack := newAgentMonitorStack()
+		monitorStack.Spec.Prometheus.Tag = "v2.53.0"
+
+		args := r.buildPrometheusArgs(monitorStack)
+		Expect(args).To(ContainElements("--enable-feature=agent", "--storage.agent.path=/prometheus"))
+		for _, arg := range args {
+			Expect(arg).NotTo(HavePrefix("--storage.tsdb"))
+			Expect(arg).NotTo(Equal("--web.enable-admin-api"))
+		}
+	})
+
+	It("stores the WAL in an emptyDir even when a storage size is set", func() {
+		monitorStack := newAgentMonitorStack()
+		monitorStack.Spec.Prometheus.Storage.Size = "5Gi"
+
+		deployment := r.buildPrometheusDeployment(monitorStack)
+		var found bool
+		for _, volume := range deployment.Spec.Template.Spec.Volumes {
+			if volume.Name == "data" {
+				found = true
+				Expect(volume.PersistentVolumeClaim).To(BeNil())
+				Expect(volume.EmptyDir.SizeLimit.String()).To(Equal("5Gi"))
+			}
+		}
+		Expect(found).To(BeTrue())
+	})
+
+	It("generates remote_write and no rules in the default config", func() {
+		config := r.getPrometheusConfig(newAgentMonitorStack())
+		Expect(config).To(ContainSubstring("remote_write:"))
+		Expect(config).To(ContainSubstring("url: https://metrics.example.com/api/v1/write"))
+		Expect(config).To(ContainSubstring("X-Scope-OrgID: edge"))
+		Expect(config).NotTo(ContainSubstring("rule_files:"))
+	})
+
+	DescribeTable("validatePrometheusAgent",
+		func(mutate func(*monitoringv1.MonitorStack), expectedError string) {
+			monitorStack := newAgentMonitorStack()
+			mutate(monitorStack)
+			err := r.validatePrometheusAgent(monitorStack)
+			if expectedError == "" {
+				Expect(err).NotTo(HaveOccurred())
+			} else {
+				Expect(err).To(MatchError(ContainSubstring(expectedError)))
+			}
+		},
+		Entry("accepts a remote write", func(*monitoringv1.MonitorStack) {}, ""),
+		Entry("requires a remote write", func(m *monitoringv1.MonitorStack) {
+			m.Spec.Prometheus.RemoteWrite = nil
+		}, "at least one remoteWrite"),
+		Entry("rejects backups", func(m *monitoringv1.MonitorStack) {
+			m.Spec.Prometheus.Backup = &monitoringv1.BackupSpec{}
+		}, "backup is not supported"),
+		Entry("accepts a custom config with remote_write", func(m *monitoringv1.MonitorStack) {
+			m.Spec.Prometheus.Config = "remote_write:\n  - url: https://metrics.example.com/api/v1/write\n"
+		}, ""),
+		Entry("requires remote_write in a custom config", func(m *monitoringv1.MonitorStack) {
+			m.Spec.Prometheus.Config = "scrape_configs: []\n"
+		}, "at least one remote_write"),
+		Entry("rejects rule_files in a custom config", func(m *monitoringv1.MonitorStack) {
+			m.Spec.Prometheus.Config = "remote_write:\n  - url: https://a\nrule_files:\n  - rules.yml\n"
+		}, "rule_files is not supported"),
+		Entry("rejects alerting in a custom config", func(m *monitoringv1.MonitorStack) {
+			m.Spec.Prometheus.Config = "remote_write:\n  - url: https://a\nalerting:\n  alertmanagers:\n    - static_configs: []\n"
+		}, "alerting is not supported"),
+	)
+})
@@ -0,0 +1,257 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	monitoringv1 "github.com/ciliverse/monitor-operator/api/v1"
+)
+
+// 高可用 - Grafana的水平自动扩缩容和各组件的Pod中断预算
+// HPA和PDB与Deployment同名，启用自动扩缩容后Deployment的副本数由HPA管理
+
+// defaultTargetCPUUtilization CPU和内存目标都未设置时的默认CPU目标使用率
+const defaultTargetCPUUtilization = int32(80)
+
+// isGrafanaAutoscalingEnabled 判断是否启用了Grafana自动扩缩容
+func isGrafanaAutoscalingEnabled(monitorStack *monitoringv1.MonitorStack) bool {
+	return monitorStack.Spec.Grafana.Autoscaling != nil && monitorStack.Spec.Grafana.Autoscaling.Enabled
+}
+
+// validateGrafanaAutoscaling 验证Grafana自动扩缩容配置
+// CRD中的CEL规则只在支持的API Server上生效，这里再检查一次副本数范围
+// 多个副本使用各自的sqlite数据库会导致用户、仪表板等数据不一致，因此要求配置共享的数据库
+func validateGrafanaAutoscaling(grafana monitoringv1.GrafanaSpec) error {
+	autoscaling := grafana.Autoscaling
+	if autoscaling == nil || !autoscaling.Enabled {
+		return nil
+	}
+	if autoscaling.MaxReplicas < 1 {
+		return fmt.Errorf("maxReplicas must be at least 1, got %d", autoscaling.MaxReplicas)
+	}
+	if autoscaling.MinReplicas != nil {
+		if *autoscaling.MinReplicas < 1 {
+			return fmt.Errorf("minReplicas must be at least 1, got %d", *autoscaling.MinReplicas)
+		}
+		if *autoscaling.MinReplicas > autoscaling.MaxReplicas {
+			return fmt.Errorf("minReplicas %d must not be greater than maxReplicas %d",
+				*autoscaling.MinReplicas, autoscaling.MaxReplicas)
+		}
+	}
+	if autoscaling.MaxReplicas > 1 && !hasGrafanaSharedDatabase(grafana) {
+		return fmt.Errorf("maxReplicas greater than 1 requires a shared database (mysql or postgres) in the grafana.ini database section")
+	}
+	return nil
+}
+
+// hasGrafanaSharedDatabase 判断grafana.ini是否配置了多副本共享的数据库
+// database.type为mysql或postgres，或者设置了database.url；从Secret读取的值无法检查，视为已配置
+func hasGrafanaSharedDatabase(grafana monitoringv1.GrafanaSpec) bool {
+	for _, configSecret := range grafana.ConfigSecrets {
+		if configSecret.Section == "database" && (configSecret.Key == "type" || configSecret.Key == "url") {
+			return true
+		}
+	}
+	database := grafana.Config["database"]
+	if url := database["url"]; url != "" {
+		return !strings.HasPrefix(url, "sqlite3")
+	}
+	switch database["type"] {
+	case "mysql", "postgres":
+		return true
+	}
+	return false
+}
+
+// isPodDisruptionBudgetEnabled 判断是否启用了Pod中断预算
+func isPodDisruptionBudgetEnabled(spec *monitoringv1.PodDisruptionBudgetSpec) bool {
+	return spec != nil && spec.Enabled
+}
+
+// buildGrafanaHPA 构建Grafana HorizontalPodAutoscaler
+func (r *MonitorStackReconciler) buildGrafanaHPA(monitorStack *monitoringv1.MonitorStack) *autoscalingv2.HorizontalPodAutoscaler {
+	autoscaling := monitorStack.Spec.Grafana.Autoscaling
+	name := r.getGrafanaName(monitorStack)
+
+	metricSpec := func(resourceName corev1.ResourceName, utilization int32) autoscalingv2.MetricSpec {
+		return autoscalingv2.MetricSpec{
+			Type: autoscalingv2.ResourceMetricSourceType,
+			Resource: &autoscalingv2.ResourceMetricSource{
+				Name: resourceName,
+				Target: autoscalingv2.MetricTarget{
+					Type:               autoscalingv2.UtilizationMetricType,
+					AverageUtilization: &utilization,
+				},
+			},
+		}
+	}
+
+	var metrics []autoscalingv2.MetricSpec
+	if autoscaling.TargetCPUUtilizationPercentage != nil {
+		metrics = append(metrics, metricSpec(corev1.ResourceCPU, *autoscaling.TargetCPUUtilizationPercentage))
+	}
+	if autoscaling.TargetMemoryUtilizationPercentage != nil {
+		metrics = append(metrics, metricSpec(corev1.ResourceMemory, *autoscaling.TargetMemoryUtilizationPercentage))
+	}
+	if len(metrics) == 0 {
+		metrics = append(metrics, metricSpec(corev1.ResourceCPU, defaultTargetCPUUtilization))
+	}
+
+	return &autoscalingv2.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: monitorStack.Namespace,
+			Labels:    r.getLabels(monitorStack, "grafana"),
+		},
+		Spec: autoscalingv2.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscalingv2.CrossVersionObjectReference{
+				APIVersion: "apps/v1",
+				Kind:       "Deployment",
+				Name:       name,
+			},
+			MinReplicas: autoscaling.MinReplicas,
+			MaxReplicas: autoscaling.MaxReplicas,
+			Metrics:     metrics,
+		},
+	}
+}
+
+// reconcileGrafanaAutoscaling 创建或删除Grafana HPA
+func (r *MonitorStackReconciler) reconcileGrafanaAutoscaling(ctx context.Context, monitorStack *monitoringv1.MonitorStack) error {
+	if !isGrafanaAutoscalingEnabled(monitorStack) {
+		return r.deleteGrafanaHPA(ctx, monitorStack)
+	}
+
+	hpa := r.buildGrafanaHPA(monitorStack)
+
+	// 设置OwnerReference
+	if err := controllerutil.SetControllerReference(monitorStack, hpa, r.Scheme); err != nil {
+		return err
+	}
+
+	// 创建或更新HPA
+	existing := &autoscalingv2.HorizontalPodAutoscaler{}
+	err := r.Get(ctx, types.NamespacedName{Name: hpa.Name, Namespace: hpa.Namespace}, existing)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return r.Create(ctx, hpa)
+		}
+		return err
+	}
+
+	// 保留用户或其他工具配置的扩缩容行为
+	hpa.Spec.Behavior = existing.Spec.Behavior
+	existing.Spec = hpa.Spec
+	existing.Labels = hpa.Labels
+	return r.Update(ctx, existing)
+}
+
+// deleteGrafanaHPA 删除Grafana HPA
+func (r *MonitorStackReconciler) deleteGrafanaHPA(ctx context.Context, monitorStack *monitoringv1.MonitorStack) error {
+	hpa := &autoscalingv2.HorizontalPodAutoscaler{}
+	err := r.Get(ctx, types.NamespacedName{
+		Name:      r.getGrafanaName(monitorStack),
+		Namespace: monitorStack.Namespace,
+	}, hpa)
+	if err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	return client.IgnoreNotFound(r.Delete(ctx, hpa))
+}
+
+// buildPodDisruptionBudget 构建组件的PodDisruptionBudget，选择器与Deployment一致
+func (r *MonitorStackReconciler) buildPodDisruptionBudget(monitorStack *monitoringv1.MonitorStack, name, component string,
+	spec *monitoringv1.PodDisruptionBudgetSpec) *policyv1.PodDisruptionBudget {
+	labels := r.getLabels(monitorStack, component)
+
+	pdb := &policyv1.PodDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: monitorStack.Namespace,
+			Labels:    labels,
+		},
+		Spec: policyv1.PodDisruptionBudgetSpec{
+			Selector: &metav1.LabelSelector{
+				MatchLabels: labels,
+			},
+			MinAvailable:   spec.MinAvailable,
+			MaxUnavailable: spec.MaxUnavailable,
+		},
+	}
+
+	// 都未设置时每次最多驱逐一个Pod
+	if spec.MinAvailable == nil && spec.MaxUnavailable == nil {
+		maxUnavailable := intstr.FromInt32(1)
+		pdb.Spec.MaxUnavailable = &maxUnavailable
+	}
+
+	return pdb
+}
+
+// reconcilePodDisruptionBudget 创建或删除组件的PodDisruptionBudget
+func (r *MonitorStackReconciler) reconcilePodDisruptionBudget(ctx context.Context, monitorStack *monitoringv1.MonitorStack, name, component string,
+	spec *monitoringv1.PodDisruptionBudgetSpec) error {
+	if !isPodDisruptionBudgetEnabled(spec) {
+		return r.deletePodDisruptionBudget(ctx, monitorStack, name)
+	}
+
+	pdb := r.buildPodDisruptionBudget(monitorStack, name, component, spec)
+
+	// 设置OwnerReference
+	if err := controllerutil.SetControllerReference(monitorStack, pdb, r.Scheme); err != nil {
+		return err
+	}
+
+	// 创建或更新PDB
+	existing := &policyv1.PodDisruptionBudget{}
+	err := r.Get(ctx, types.NamespacedName{Name: pdb.Name, Namespace: pdb.Namespace}, existing)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return r.Create(ctx, pdb)
+		}
+		return err
+	}
+
+	existing.Spec.Selector = pdb.Spec.Selector
+	existing.Spec.MinAvailable = pdb.Spec.MinAvailable
+	existing.Spec.MaxUnavailable = pdb.Spec.MaxUnavailable
+	existing.Labels = pdb.Labels
+	return r.Update(ctx, existing)
+}
+
+// deletePodDisruptionBudget 删除组件的PodDisruptionBudget
+func (r *MonitorStackReconciler) deletePodDisruptionBudget(ctx context.Context, monitorStack *monitoringv1.MonitorStack, name string) error {
+	pdb := &policyv1.PodDisruptionBudget{}
+	err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: monitorStack.Namespace}, pdb)
+	if err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	return client.IgnoreNotFound(r.Delete(ctx, pdb))
+}
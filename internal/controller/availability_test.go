@@ -0,0 +1,152 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	monitoringv1 "github.com/ciliverse/monitor-operator/api/v1"
+)
+
+var _ = Describe("Availability", func() {
+	ctx := context.Background()
+	r := &MonitorStackReconciler{}
+
+	Context("Grafana autoscaling", func() {
+		It("targets 80% CPU when no target is set", func() {
+			monitorStack := newTestMonitorStack()
+			monitorStack.Spec.Grafana.Autoscaling = &monitoringv1.AutoscalingSpec{Enabled: true, MaxReplicas: 3}
+
+			hpa := r.buildGrafanaHPA(monitorStack)
+			Expect(hpa.Spec.ScaleTargetRef.Name).To(Equal(r.getGrafanaName(monitorStack)))
+			Expect(hpa.Spec.MaxReplicas).To(Equal(int32(3)))
+			Expect(hpa.Spec.Metrics).To(HaveLen(1))
+			Expect(hpa.Spec.Metrics[0].Resource.Name).To(Equal(corev1.ResourceCPU))
+			Expect(*hpa.Spec.Metrics[0].Resource.Target.AverageUtilization).To(Equal(defaultTargetCPUUtilization))
+		})
+
+		It("uses the configured CPU and memory targets", func() {
+			monitorStack := newTestMonitorStack()
+			minReplicas, cpu, memory := int32(2), int32(60), int32(70)
+			monitorStack.Spec.Grafana.Autoscaling = &monitoringv1.AutoscalingSpec{
+				Enabled:                           true,
+				MinReplicas:                       &minReplicas,
+				MaxReplicas:                       5,
+				TargetCPUUtilizationPercentage:    &cpu,
+				TargetMemoryUtilizationPercentage: &memory,
+			}
+
+			hpa := r.buildGrafanaHPA(monitorStack)
+			Expect(*hpa.Spec.MinReplicas).To(Equal(int32(2)))
+			Expect(hpa.Spec.Metrics).To(HaveLen(2))
+			Expect(*hpa.Spec.Metrics[0].Resource.Target.AverageUtilization).To(Equal(int32(60)))
+			Expect(hpa.Spec.Metrics[1].Resource.Name).To(Equal(corev1.ResourceMemory))
+			Expect(*hpa.Spec.Metrics[1].Resource.Target.AverageUtilization).To(Equal(int32(70)))
+		})
+
+		It("leaves the Deployment replicas to the HPA and removes the HPA when disabled", func() {
+			monitorStack := newTestMonitorStack()
+			monitorStack.Spec.Grafana.Autoscaling = &monitoringv1.AutoscalingSpec{Enabled: true, MaxReplicas: 3}
+			Expect(r.buildGrafanaDeployment(monitorStack).Spec.Replicas).To(BeNil())
+
+			existing := r.buildGrafanaDeployment(newTestMonitorStack())
+			replicas := int32(3)
+			existing.Spec.Replicas = &replicas
+			reconciler := newFakeReconciler(monitorStack, existing)
+			Expect(reconciler.createGrafanaDeployment(ctx, monitorStack)).To(Succeed())
+			Expect(reconciler.reconcileGrafanaAutoscaling(ctx, monitorStack)).To(Succeed())
+
+			key := types.NamespacedName{Name: r.getGrafanaName(monitorStack), Namespace: monitorStack.Namespace}
+			deployment := &appsv1.Deployment{}
+			Expect(reconciler.Get(ctx, key, deployment)).To(Succeed())
+			Expect(*deployment.Spec.Replicas).To(Equal(int32(3)))
+			Expect(reconciler.Get(ctx, key, &autoscalingv2.HorizontalPodAutoscaler{})).To(Succeed())
+
+			monitorStack.Spec.Grafana.Autoscaling.Enabled = false
+			Expect(reconciler.reconcileGrafanaAutoscaling(ctx, monitorStack)).To(Succeed())
+			err := reconciler.Get(ctx, key, &autoscalingv2.HorizontalPodAutoscaler{})
+			Expect(errors.IsNotFound(err)).To(BeTrue())
+		})
+
+		DescribeTable("validates replicas and the shared database",
+			func(minReplicas int32, maxReplicas int32, config map[string]map[string]string, expectedErr string) {
+				grafana := newTestMonitorStack().Spec.Grafana
+				grafana.Config = config
+				grafana.Autoscaling = &monitoringv1.AutoscalingSpec{Enabled: true, MinReplicas: &minReplicas, MaxReplicas: maxReplicas}
+				err := validateGrafanaAutoscaling(grafana)
+				if expectedErr == "" {
+					Expect(err).NotTo(HaveOccurred())
+				} else {
+					Expect(err).To(MatchError(ContainSubstring(expectedErr)))
+				}
+			},
+			Entry("single replica without a database", int32(1), int32(1), nil, ""),
+			Entry("postgres database", int32(2), int32(5),
+				map[string]map[string]string{"database": {"type": "postgres"}}, ""),
+			Entry("minReplicas above maxReplicas", int32(4), int32(2),
+				map[string]map[string]string{"database": {"type": "postgres"}}, "must not be greater than maxReplicas"),
+			Entry("multiple replicas without a database", int32(1), int32(3), nil, "requires a shared database"),
+			Entry("multiple replicas on sqlite", int32(1), int32(3),
+				map[string]map[string]string{"database": {"type": "sqlite3"}}, "requires a shared database"),
+		)
+	})
+
+	Context("PodDisruptionBudget", func() {
+		It("allows one disruption when no budget is set", func() {
+			monitorStack := newTestMonitorStack()
+			pdb := r.buildPodDisruptionBudget(monitorStack, r.getGrafanaName(monitorStack), "grafana",
+				&monitoringv1.PodDisruptionBudgetSpec{Enabled: true})
+			Expect(pdb.Spec.MinAvailable).To(BeNil())
+			Expect(*pdb.Spec.MaxUnavailable).To(Equal(intstr.FromInt32(1)))
+			Expect(pdb.Spec.Selector.MatchLabels).To(Equal(r.getLabels(monitorStack, "grafana")))
+		})
+
+		It("creates, updates and deletes the budget", func() {
+			monitorStack := newTestMonitorStack()
+			name := r.getGrafanaName(monitorStack)
+			key := types.NamespacedName{Name: name, Namespace: monitorStack.Namespace}
+			reconciler := newFakeReconciler(monitorStack)
+
+			minAvailable := intstr.FromInt32(1)
+			spec := &monitoringv1.PodDisruptionBudgetSpec{Enabled: true, MinAvailable: &minAvailable}
+			Expect(reconciler.reconcilePodDisruptionBudget(ctx, monitorStack, name, "grafana", spec)).To(Succeed())
+			pdb := &policyv1.PodDisruptionBudget{}
+			Expect(reconciler.Get(ctx, key, pdb)).To(Succeed())
+			Expect(*pdb.Spec.MinAvailable).To(Equal(minAvailable))
+
+			maxUnavailable := intstr.FromString("50%")
+			spec = &monitoringv1.PodDisruptionBudgetSpec{Enabled: true, MaxUnavailable: &maxUnavailable}
+			Expect(reconciler.reconcilePodDisruptionBudget(ctx, monitorStack, name, "grafana", spec)).To(Succeed())
+			Expect(reconciler.Get(ctx, key, pdb)).To(Succeed())
+			Expect(pdb.Spec.MinAvailable).To(BeNil())
+			Expect(*pdb.Spec.MaxUnavailable).To(Equal(maxUnavailable))
+
+			Expect(reconciler.reconcilePodDisruptionBudget(ctx, monitorStack, name, "grafana", nil)).To(Succeed())
+			Expect(errors.IsNotFound(reconciler.Get(ctx, key, &policyv1.PodDisruptionBudget{}))).To(BeTrue())
+		})
+	})
+})
@@ -0,0 +1,388 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	monitoringv1 "github.com/ciliverse/monitor-operator/api/v1"
+)
+
+// TSDB快照备份 - 通过CronJob定期调用Prometheus管理API创建快照并上传到备份目标
+// 参考: https://prometheus.io/docs/prometheus/latest/querying/api/#snapshot
+//
+// 备份Job挂载Prometheus的PVC读取快照目录，PVC通常为ReadWriteOnce，
+// 因此备份Pod通过Pod亲和性调度到Prometheus所在的节点。
+// 备份只支持单个Prometheus实例：快照请求经Service发送，快照目录从唯一的数据PVC读取
+
+const (
+	// backupToolsImage 运行备份脚本使用的镜像
+	backupToolsImage = "busybox:1.36"
+	// backupSnapshotImage 调用管理API创建快照使用的镜像，需要curl校验Prometheus的服务端证书
+	backupSnapshotImage = "curlimages/curl:8.11.1"
+	// backupS3Image 提供mc二进制的镜像，镜像中不保证包含shell，只用于复制mc
+	// 固定版本，避免mc的命令行参数随上游发布变化导致备份失败
+	backupS3Image = "minio/mc:RELEASE.2024-11-21T17-21-54Z"
+	// mcBinaryPath mc二进制在共享目录中的路径
+	mcBinaryPath = "/work/mc"
+	// defaultBackupRetention 默认保留的备份数量
+	defaultBackupRetention = int32(7)
+)
+
+// backupSnapshotScript 调用管理API创建快照，并将快照名称写入共享目录
+// 协议、CA证书和Basic认证凭据与Prometheus的web配置一致，见addPrometheusClient
+const backupSnapshotScript = prometheusCurlScript + `set -e
+RESP=$(prometheus_curl -X POST "$PROMETHEUS_URL/api/v1/admin/tsdb/snapshot")
+NAME=$(echo "$RESP" | sed -n 's/.*"name":"\([^"]*\)".*/\1/p')
+if [ -z "$NAME" ]; then
+  echo "failed to create snapshot: $RESP" >&2
+  exit 1
+fi
+echo "$NAME" > /work/snapshot
+echo "created snapshot $NAME"`
+
+// backupPVCScript 将快照复制到备份PVC，并删除超出保留数量的旧备份
+// 快照名称以时间戳开头，按名称排序即按时间排序
+const backupPVCScript = `set -e
+NAME=$(cat /work/snapshot)
+mkdir -p "/backup/$NAME.tmp"
+cp -R "/prometheus/snapshots/$NAME/." "/backup/$NAME.tmp/"
+mv "/backup/$NAME.tmp" "/backup/$NAME"
+rm -rf "/prometheus/snapshots/$NAME"
+ls -1 /backup | grep -v '\.tmp$' | sort -r | tail -n +$((BACKUP_RETENTION + 1)) | while read -r OLD; do
+  echo "removing old backup $OLD"
+  rm -rf "/backup/$OLD"
+done
+echo "$NAME" > /dev/termination-log`
+
+// backupS3Script 将快照上传到S3兼容对象存储，并删除超出保留数量的旧备份
+const backupS3Script = `set -e
+NAME=$(cat /work/snapshot)
+chmod +x /work/mc
+MC="/work/mc --config-dir /work/.mc $MC_FLAGS"
+$MC alias set backup "$S3_ENDPOINT" "$AWS_ACCESS_KEY_ID" "$AWS_SECRET_ACCESS_KEY" >/dev/null
+$MC cp --recursive "/prometheus/snapshots/$NAME/" "backup/$S3_BUCKET/$S3_PREFIX$NAME/"
+rm -rf "/prometheus/snapshots/$NAME"
+$MC ls "backup/$S3_BUCKET/$S3_PREFIX" | awk '{print $NF}' | grep '/$' | sort -r | tail -n +$((BACKUP_RETENTION + 1)) | while read -r OLD; do
+  echo "removing old backup $OLD"
+  $MC rm --recursive --force "backup/$S3_BUCKET/$S3_PREFIX$OLD"
+done
+echo "$NAME" > /dev/termination-log`
+
+// buildPrometheusBackupCronJob 构建Prometheus备份CronJob
+func (r *MonitorStackReconciler) buildPrometheusBackupCronJob(monitorStack *monitoringv1.MonitorStack) *batchv1.CronJob {
+	prometheus := monitorStack.Spec.Prometheus
+	backup := prometheus.Backup
+	labels := r.getLabels(monitorStack, "backup")
+
+	retention := backup.Retention
+	if retention == 0 {
+		retention = defaultBackupRetention
+	}
+
+	containerSecurityContext := r.buildContainerSecurityContext(prometheus.Security)
+	workMount := corev1.VolumeMount{Name: "work", MountPath: "/work"}
+	dataMount := corev1.VolumeMount{Name: "data", MountPath: "/prometheus"}
+
+	// 创建快照的init容器
+	initContainers := []corev1.Container{
+		{
+			Name:            "snapshot",
+			Image:           r.rewriteImage(backupSnapshotImage),
+			Command:         []string{"/bin/sh", "-c"},
+			Args:            []string{backupSnapshotScript},
+			VolumeMounts:    []corev1.VolumeMount{workMount},
+			SecurityContext: containerSecurityContext,
+		},
+	}
+
+	// 上传容器
+	upload := corev1.Container{
+		Name:    "upload",
+		Command: []string{"/bin/sh", "-c"},
+		Env: []corev1.EnvVar{
+			{Name: "HOME", Value: "/work"},
+			{Name: "BACKUP_RETENTION", Value: fmt.Sprintf("%d", retention)},
+		},
+		VolumeMounts:    []corev1.VolumeMount{workMount, dataMount},
+		SecurityContext: containerSecurityContext,
+	}
+	volumes := []corev1.Volume{
+		{
+			Name:         "work",
+			VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+		},
+		{
+			Name: "data",
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+					ClaimName: r.getPrometheusPVCName(monitorStack),
+				},
+			},
+		},
+	}
+
+	if s3 := backup.Destination.S3; s3 != nil {
+		prefix := strings.Trim(s3.Prefix, "/")
+		if prefix != "" {
+			prefix += "/"
+		}
+		mcFlags := ""
+		if s3.Insecure {
+			mcFlags = "--insecure"
+		}
+
+		initContainers = append(initContainers, r.buildMCInstallContainer(workMount, containerSecurityContext))
+		upload.Image = r.rewriteImage(backupToolsImage)
+		upload.Args = []string{backupS3Script}
+		upload.Env = append(upload.Env,
+			corev1.EnvVar{Name: "S3_ENDPOINT", Value: s3.Endpoint},
+			corev1.EnvVar{Name: "S3_BUCKET", Value: s3.Bucket},
+			corev1.EnvVar{Name: "S3_PREFIX", Value: prefix},
+			corev1.EnvVar{Name: "MC_FLAGS", Value: mcFlags},
+		)
+		upload.EnvFrom = []corev1.EnvFromSource{
+			{
+				SecretRef: &corev1.SecretEnvSource{
+					LocalObjectReference: s3.CredentialsSecret,
+				},
+			},
+		}
+	} else if pvc := backup.Destination.PVC; pvc != nil {
+		upload.Image = r.rewriteImage(backupToolsImage)
+		upload.Args = []string{backupPVCScript}
+		upload.VolumeMounts = append(upload.VolumeMounts, corev1.VolumeMount{Name: "backup", MountPath: "/backup"})
+		volumes = append(volumes, corev1.Volume{
+			Name: "backup",
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+					ClaimName: pvc.ClaimName,
+				},
+			},
+		})
+	}
+	if backup.Image != "" {
+		upload.Image = r.rewriteImage(backup.Image)
+	}
+
+	cronJob := &batchv1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      r.getPrometheusBackupName(monitorStack),
+			Namespace: monitorStack.Namespace,
+			Labels:    labels,
+		},
+		Spec: batchv1.CronJobSpec{
+			Schedule: backup.Schedule,
+			Suspend:  &[]bool{backup.Suspend}[0],
+			// 同一时间只运行一个备份
+			ConcurrencyPolicy:          batchv1.ForbidConcurrent,
+			SuccessfulJobsHistoryLimit: &[]int32{3}[0],
+			FailedJobsHistoryLimit:     &[]int32{3}[0],
+			JobTemplate: batchv1.JobTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+				},
+				Spec: batchv1.JobSpec{
+					BackoffLimit: &[]int32{2}[0],
+					Template: corev1.PodTemplateSpec{
+						ObjectMeta: metav1.ObjectMeta{
+							Labels: labels,
+						},
+						Spec: corev1.PodSpec{
+							RestartPolicy: corev1.RestartPolicyNever,
+							// 与Prometheus使用相同的用户，才能删除已上传的快照
+							SecurityContext: r.buildPodSecurityContext(prometheus.Security, prometheusUID),
+							// 调度到Prometheus所在节点，以便挂载ReadWriteOnce的PVC
+							Affinity: &corev1.Affinity{
+								PodAffinity: &corev1.PodAffinity{
+									RequiredDuringSchedulingIgnoredDuringExecution: []corev1.PodAffinityTerm{
+										{
+											LabelSelector: &metav1.LabelSelector{
+												MatchLabels: r.getLabels(monitorStack, "prometheus"),
+											},
+											TopologyKey: "kubernetes.io/hostname",
+										},
+									},
+								},
+							},
+							InitContainers: initContainers,
+							Containers:     []corev1.Container{upload},
+							Volumes:        volumes,
+						},
+					},
+				},
+			},
+		},
+	}
+
+	// 快照容器按Prometheus的web配置访问管理API
+	podSpec := &cronJob.Spec.JobTemplate.Spec.Template.Spec
+	r.addPrometheusClient(podSpec, &podSpec.InitContainers[0], monitorStack, r.getPrometheusURL(monitorStack))
+
+	return cronJob
+}
+
+// buildMCInstallContainer 构建复制mc二进制的init容器
+// minio/mc镜像不保证包含shell，因此直接调用mc将自身复制到共享目录，脚本在包含shell的镜像中运行
+func (r *MonitorStackReconciler) buildMCInstallContainer(workMount corev1.VolumeMount, securityContext *corev1.SecurityContext) corev1.Container {
+	return corev1.Container{
+		Name:            "install-mc",
+		Image:           r.rewriteImage(backupS3Image),
+		Command:         []string{"mc", "--config-dir", "/work/.mc", "cp", "/usr/bin/mc", mcBinaryPath},
+		VolumeMounts:    []corev1.VolumeMount{workMount},
+		SecurityContext: securityContext,
+	}
+}
+
+// createPrometheusBackupCronJob 创建Prometheus备份CronJob
+func (r *MonitorStackReconciler) createPrometheusBackupCronJob(ctx context.Context, monitorStack *monitoringv1.MonitorStack) error {
+	cronJob := r.buildPrometheusBackupCronJob(monitorStack)
+
+	// 设置OwnerReference
+	if err := controllerutil.SetControllerReference(monitorStack, cronJob, r.Scheme); err != nil {
+		return err
+	}
+
+	// 创建或更新CronJob
+	existing := &batchv1.CronJob{}
+	err := r.Get(ctx, types.NamespacedName{Name: cronJob.Name, Namespace: cronJob.Namespace}, existing)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return r.Create(ctx, cronJob)
+		}
+		return err
+	}
+
+	// 更新现有CronJob
+	existing.Spec = cronJob.Spec
+	existing.Labels = cronJob.Labels
+	return r.Update(ctx, existing)
+}
+
+// deletePrometheusBackupCronJob 删除Prometheus备份CronJob
+func (r *MonitorStackReconciler) deletePrometheusBackupCronJob(ctx context.Context, monitorStack *monitoringv1.MonitorStack) error {
+	cronJob := &batchv1.CronJob{}
+	err := r.Get(ctx, types.NamespacedName{
+		Name:      r.getPrometheusBackupName(monitorStack),
+		Namespace: monitorStack.Namespace,
+	}, cronJob)
+	if err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	return client.IgnoreNotFound(r.Delete(ctx, cronJob, client.PropagationPolicy(metav1.DeletePropagationBackground)))
+}
+
+// updatePrometheusBackupStatus 更新备份状态
+// 根据CronJob创建的最新Job判断最后一次备份的结果
+func (r *MonitorStackReconciler) updatePrometheusBackupStatus(ctx context.Context, monitorStack *monitoringv1.MonitorStack) error {
+	cronJob := &batchv1.CronJob{}
+	if err := r.Get(ctx, types.NamespacedName{
+		Name:      r.getPrometheusBackupName(monitorStack),
+		Namespace: monitorStack.Namespace,
+	}, cronJob); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+
+	status := &monitoringv1.BackupStatus{
+		LastBackupTime:     cronJob.Status.LastScheduleTime,
+		LastSuccessfulTime: cronJob.Status.LastSuccessfulTime,
+	}
+
+	jobs := &batchv1.JobList{}
+	if err := r.List(ctx, jobs,
+		client.InNamespace(monitorStack.Namespace),
+		client.MatchingLabels(r.getLabels(monitorStack, "backup")),
+	); err != nil {
+		return err
+	}
+
+	var latest *batchv1.Job
+	for i := range jobs.Items {
+		job := &jobs.Items[i]
+		if !metav1.IsControlledBy(job, cronJob) {
+			continue
+		}
+		if latest == nil || latest.CreationTimestamp.Before(&job.CreationTimestamp) {
+			latest = job
+		}
+	}
+
+	if latest != nil {
+		status.LastResult = "Running"
+		status.Message = fmt.Sprintf("backup job %s is running", latest.Name)
+		for _, condition := range latest.Status.Conditions {
+			if condition.Status != corev1.ConditionTrue {
+				continue
+			}
+			switch condition.Type {
+			case batchv1.JobComplete:
+				status.LastResult = "Succeeded"
+				status.Message = fmt.Sprintf("backup job %s succeeded", latest.Name)
+			case batchv1.JobFailed:
+				status.LastResult = "Failed"
+				status.Message = fmt.Sprintf("backup job %s failed: %s", latest.Name, condition.Message)
+			}
+		}
+	}
+
+	monitorStack.Status.Backup = status
+	return nil
+}
+
+// validatePrometheusBackup 验证备份配置
+func (r *MonitorStackReconciler) validatePrometheusBackup(monitorStack *monitoringv1.MonitorStack) error {
+	prometheus := monitorStack.Spec.Prometheus
+	backup := prometheus.Backup
+	if backup == nil {
+		return nil
+	}
+
+	if prometheus.Storage.Size == "" {
+		return fmt.Errorf("backup requires persistent storage (storage.size)")
+	}
+	if strings.TrimSpace(backup.Schedule) == "" {
+		return fmt.Errorf("backup schedule cannot be empty")
+	}
+
+	destination := backup.Destination
+	if (destination.S3 == nil) == (destination.PVC == nil) {
+		return fmt.Errorf("exactly one backup destination (s3 or pvc) must be set")
+	}
+	if s3 := destination.S3; s3 != nil {
+		if s3.Endpoint == "" || s3.Bucket == "" {
+			return fmt.Errorf("s3 backup destination requires endpoint and bucket")
+		}
+		if s3.CredentialsSecret.Name == "" {
+			return fmt.Errorf("s3 backup destination requires credentialsSecret")
+		}
+	}
+	if pvc := destination.PVC; pvc != nil && pvc.ClaimName == r.getPrometheusPVCName(monitorStack) {
+		return fmt.Errorf("backup PVC cannot be the Prometheus data PVC")
+	}
+
+	return nil
+}
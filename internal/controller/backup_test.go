@@ -0,0 +1,148 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+
+	monitoringv1 "github.com/ciliverse/monitor-operator/api/v1"
+)
+
+var _ = Describe("Prometheus backup", func() {
+	r := &MonitorStackReconciler{}
+
+	s3Destination := func() monitoringv1.BackupDestination {
+		return monitoringv1.BackupDestination{
+			S3: &monitoringv1.S3BackupDestination{
+				Endpoint:          "http://minio:9000",
+				Bucket:            "backups",
+				CredentialsSecret: corev1.LocalObjectReference{Name: "s3"},
+			},
+		}
+	}
+
+	newBackupStack := func(destination monitoringv1.BackupDestination) *monitoringv1.MonitorStack {
+		monitorStack := newTestMonitorStack()
+		monitorStack.Spec.Prometheus.Storage.Size = "50Gi"
+		monitorStack.Spec.Prometheus.Backup = &monitoringv1.BackupSpec{Schedule: "0 2 * * *", Destination: destination}
+		return monitorStack
+	}
+
+	It("runs the S3 upload script in a shell image with mc copied from the mc image", func() {
+		podSpec := r.buildPrometheusBackupCronJob(newBackupStack(s3Destination())).Spec.JobTemplate.Spec.Template.Spec
+
+		Expect(podSpec.InitContainers).To(HaveLen(2))
+		install := podSpec.InitContainers[1]
+		Expect(install.Image).To(Equal(backupS3Image))
+		Expect(install.Command).To(Equal([]string{"mc", "--config-dir", "/work/.mc", "cp", "/usr/bin/mc", mcBinaryPath}))
+
+		upload := podSpec.Containers[0]
+		Expect(upload.Image).To(Equal(backupToolsImage))
+		Expect(upload.Command).To(Equal([]string{"/bin/sh", "-c"}))
+		Expect(upload.Args[0]).To(ContainSubstring(`MC="/work/mc --config-dir /work/.mc $MC_FLAGS"`))
+	})
+
+	It("does not install mc for PVC destinations", func() {
+		monitorStack := newBackupStack(monitoringv1.BackupDestination{
+			PVC: &monitoringv1.PVCBackupDestination{ClaimName: "backups"},
+		})
+		podSpec := r.buildPrometheusBackupCronJob(monitorStack).Spec.JobTemplate.Spec.Template.Spec
+		Expect(podSpec.InitContainers).To(HaveLen(1))
+		Expect(podSpec.InitContainers[0].Name).To(Equal("snapshot"))
+		Expect(podSpec.Containers[0].Image).To(Equal(backupToolsImage))
+	})
+
+	It("creates the snapshot through the Prometheus Service", func() {
+		podSpec := r.buildPrometheusBackupCronJob(newBackupStack(s3Destination())).Spec.JobTemplate.Spec.Template.Spec
+
+		snapshot := podSpec.InitContainers[0]
+		Expect(snapshot.Image).To(Equal(backupSnapshotImage))
+		Expect(snapshot.Args[0]).To(ContainSubstring(`prometheus_curl -X POST "$PROMETHEUS_URL/api/v1/admin/tsdb/snapshot"`))
+		Expect(snapshot.Env).To(Equal([]corev1.EnvVar{
+			{Name: "PROMETHEUS_URL", Value: "http://test-prometheus.monitoring.svc:9090"},
+		}))
+		Expect(snapshot.VolumeMounts).NotTo(ContainElement(HaveField("MountPath", prometheusClientDir)))
+	})
+
+	It("uses the Prometheus web scheme and credentials for the snapshot request", func() {
+		monitorStack := newBackupStack(s3Destination())
+		ca := secretKey("prometheus-tls", "ca.crt")
+		monitorStack.Spec.Prometheus.Web = &monitoringv1.PrometheusWebSpec{
+			TLS:       &monitoringv1.PrometheusWebTLSSpec{SecretName: "prometheus-tls", CA: &ca},
+			BasicAuth: &monitoringv1.PrometheusWebBasicAuthSpec{Username: "admin", Password: secretKey("prometheus-auth", "password")},
+		}
+		podSpec := r.buildPrometheusBackupCronJob(monitorStack).Spec.JobTemplate.Spec.Template.Spec
+
+		snapshot := podSpec.InitContainers[0]
+		Expect(snapshot.Env).To(Equal([]corev1.EnvVar{
+			{Name: "PROMETHEUS_URL", Value: "https://test-prometheus.monitoring.svc:9090"},
+			{Name: "PROMETHEUS_USERNAME", Value: "admin"},
+			{Name: "PROMETHEUS_PASSWORD_FILE", Value: "/etc/prometheus-client/password"},
+			{Name: "PROMETHEUS_CA_FILE", Value: "/etc/prometheus-client/ca.crt"},
+		}))
+		Expect(snapshot.VolumeMounts).To(ContainElement(corev1.VolumeMount{
+			Name: "prometheus-client", MountPath: prometheusClientDir, ReadOnly: true,
+		}))
+		Expect(podSpec.Volumes).To(ContainElement(corev1.Volume{
+			Name: "prometheus-client",
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName: "test-prometheus-web-config",
+					Items: []corev1.KeyToPath{
+						{Key: prometheusWebPasswordKey, Path: prometheusWebPasswordKey},
+						{Key: prometheusWebCAKey, Path: prometheusWebCAKey},
+					},
+				},
+			},
+		}))
+		// 上传容器不需要访问Prometheus
+		Expect(podSpec.Containers[0].VolumeMounts).NotTo(ContainElement(HaveField("Name", "prometheus-client")))
+	})
+
+	DescribeTable("validatePrometheusBackup",
+		func(mutate func(*monitoringv1.MonitorStack), expectedError string) {
+			monitorStack := newBackupStack(s3Destination())
+			mutate(monitorStack)
+			err := r.validateMonitorStack(monitorStack)
+			if expectedError == "" {
+				Expect(err).NotTo(HaveOccurred())
+			} else {
+				Expect(err).To(MatchError(ContainSubstring(expectedError)))
+			}
+		},
+		Entry("accepts an S3 destination", func(*monitoringv1.MonitorStack) {}, ""),
+		Entry("requires persistent storage", func(ms *monitoringv1.MonitorStack) {
+			ms.Spec.Prometheus.Storage.Size = ""
+		}, "backup requires persistent storage"),
+		Entry("requires a destination", func(ms *monitoringv1.MonitorStack) {
+			ms.Spec.Prometheus.Backup.Destination = monitoringv1.BackupDestination{}
+		}, "exactly one backup destination"),
+		Entry("rejects two destinations", func(ms *monitoringv1.MonitorStack) {
+			ms.Spec.Prometheus.Backup.Destination.PVC = &monitoringv1.PVCBackupDestination{ClaimName: "backups"}
+		}, "exactly one backup destination"),
+		Entry("requires S3 credentials", func(ms *monitoringv1.MonitorStack) {
+			ms.Spec.Prometheus.Backup.Destination.S3.CredentialsSecret.Name = ""
+		}, "requires credentialsSecret"),
+		Entry("rejects the data PVC as destination", func(ms *monitoringv1.MonitorStack) {
+			ms.Spec.Prometheus.Backup.Destination = monitoringv1.BackupDestination{
+				PVC: &monitoringv1.PVCBackupDestination{ClaimName: r.getPrometheusPVCName(ms)},
+			}
+		}, "cannot be the Prometheus data PVC"),
+	)
+})
@@ -0,0 +1,354 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	monitoringv1 "github.com/ciliverse/monitor-operator/api/v1"
+)
+
+// ClusterMonitorStackReconciler 协调ClusterMonitorStack对象
+// ClusterMonitorStack在指定命名空间中生成一个MonitorStack，由MonitorStack控制器使用同一套资源构建逻辑部署，
+// 另外为Prometheus授予集群范围的服务发现权限
+type ClusterMonitorStackReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+}
+
+const (
+	// defaultClusterMonitorStackNamespace spec.namespace为空时工作负载所在的命名空间
+	defaultClusterMonitorStackNamespace = "monitoring"
+	// clusterMonitorStackLabel 生成的MonitorStack上记录所属ClusterMonitorStack的标签
+	clusterMonitorStackLabel = "monitoring.cillian.website/cluster-monitor-stack"
+	// conditionTypeReady ClusterMonitorStack就绪状态条件
+	conditionTypeReady = "Ready"
+)
+
+//+kubebuilder:rbac:groups=monitoring.cillian.website,resources=clustermonitorstacks,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=monitoring.cillian.website,resources=clustermonitorstacks/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=monitoring.cillian.website,resources=clustermonitorstacks/finalizers,verbs=update
+//+kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch;create
+//+kubebuilder:rbac:groups=rbac.authorization.k8s.io,resources=clusterroles;clusterrolebindings,verbs=get;list;watch;create;update;patch;delete
+
+// Reconcile 协调ClusterMonitorStack
+// 子资源都设置了OwnerReference，删除时由垃圾回收清理，不需要finalizer
+func (r *ClusterMonitorStackReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	// 步骤1: 获取ClusterMonitorStack实例
+	var clusterStack monitoringv1.ClusterMonitorStack
+	if err := r.Get(ctx, req.NamespacedName, &clusterStack); err != nil {
+		if errors.IsNotFound(err) {
+			logger.Info("ClusterMonitorStack resource not found. Ignoring since object must be deleted")
+			return ctrl.Result{}, nil
+		}
+		logger.Error(err, "Failed to get ClusterMonitorStack")
+		return ctrl.Result{}, err
+	}
+
+	if clusterStack.DeletionTimestamp != nil {
+		return ctrl.Result{}, nil
+	}
+
+	namespace := getClusterMonitorStackNamespace(&clusterStack)
+	clusterStack.Status.Namespace = namespace
+
+	// 步骤2: 确保目标命名空间存在
+	if err := r.ensureNamespace(ctx, namespace); err != nil {
+		return r.updateFailedStatus(ctx, &clusterStack, fmt.Errorf("failed to ensure namespace %s: %w", namespace, err))
+	}
+
+	// 步骤3: 创建或更新MonitorStack
+	monitorStack, err := r.createMonitorStack(ctx, &clusterStack, namespace)
+	if err != nil {
+		return r.updateFailedStatus(ctx, &clusterStack, fmt.Errorf("failed to create MonitorStack: %w", err))
+	}
+
+	// 步骤4: 删除目标命名空间修改前生成的MonitorStack
+	if err := r.cleanupStaleMonitorStacks(ctx, &clusterStack, namespace); err != nil {
+		return r.updateFailedStatus(ctx, &clusterStack, fmt.Errorf("failed to cleanup MonitorStacks: %w", err))
+	}
+
+	// 步骤5: 授予Prometheus集群范围的服务发现权限
+	if err := r.createDiscoveryClusterRole(ctx, &clusterStack); err != nil {
+		return r.updateFailedStatus(ctx, &clusterStack, fmt.Errorf("failed to create ClusterRole: %w", err))
+	}
+	if err := r.createDiscoveryClusterRoleBinding(ctx, &clusterStack, monitorStack); err != nil {
+		return r.updateFailedStatus(ctx, &clusterStack, fmt.Errorf("failed to create ClusterRoleBinding: %w", err))
+	}
+
+	// 步骤6: 同步MonitorStack的状态
+	clusterStack.Status.Phase = monitorStack.Status.Phase
+	clusterStack.Status.Message = monitorStack.Status.Message
+	if clusterStack.Status.Phase == "" {
+		clusterStack.Status.Phase = "Pending"
+		clusterStack.Status.Message = "Waiting for MonitorStack to be reconciled"
+	}
+	clusterStack.Status.PrometheusStatus = monitorStack.Status.PrometheusStatus
+	clusterStack.Status.GrafanaStatus = monitorStack.Status.GrafanaStatus
+	if clusterStack.Status.Phase == "Ready" {
+		r.setCondition(&clusterStack, metav1.ConditionTrue, "Ready",
+			fmt.Sprintf("MonitorStack %s/%s is ready", namespace, monitorStack.Name))
+	} else {
+		r.setCondition(&clusterStack, metav1.ConditionFalse, clusterStack.Status.Phase,
+			fmt.Sprintf("MonitorStack %s/%s: %s", namespace, monitorStack.Name, clusterStack.Status.Message))
+	}
+	clusterStack.Status.LastUpdated = metav1.Now()
+	if err := r.Status().Update(ctx, &clusterStack); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	logger.Info("Successfully reconciled ClusterMonitorStack")
+	return ctrl.Result{RequeueAfter: time.Minute * 5}, nil
+}
+
+// getClusterMonitorStackNamespace 获取工作负载所在的命名空间
+func getClusterMonitorStackNamespace(clusterStack *monitoringv1.ClusterMonitorStack) string {
+	if clusterStack.Spec.Namespace != "" {
+		return clusterStack.Spec.Namespace
+	}
+	return defaultClusterMonitorStackNamespace
+}
+
+// getDiscoveryClusterRoleName 获取服务发现ClusterRole和ClusterRoleBinding的名称
+// 命名规则: monitor-operator:{ClusterMonitorStack名称}-prometheus
+func getDiscoveryClusterRoleName(clusterStack *monitoringv1.ClusterMonitorStack) string {
+	return fmt.Sprintf("monitor-operator:%s-prometheus", clusterStack.Name)
+}
+
+// getClusterMonitorStackLabels 获取ClusterMonitorStack生成资源的标签
+func getClusterMonitorStackLabels(clusterStack *monitoringv1.ClusterMonitorStack) map[string]string {
+	labels := map[string]string{
+		"app.kubernetes.io/name":       "monitor-operator",
+		"app.kubernetes.io/instance":   clusterStack.Name,
+		"app.kubernetes.io/managed-by": "monitor-operator",
+		"app.kubernetes.io/part-of":    "monitoring-stack",
+		clusterMonitorStackLabel:       clusterStack.Name,
+	}
+	for k, v := range clusterStack.Spec.Labels {
+		labels[k] = v
+	}
+	return labels
+}
+
+// ensureNamespace 确保命名空间存在，不存在时创建
+// 命名空间可能还有其他工作负载，ClusterMonitorStack删除时不删除命名空间
+func (r *ClusterMonitorStackReconciler) ensureNamespace(ctx context.Context, name string) error {
+	namespace := &corev1.Namespace{}
+	err := r.Get(ctx, types.NamespacedName{Name: name}, namespace)
+	if err == nil {
+		return nil
+	}
+	if !errors.IsNotFound(err) {
+		return err
+	}
+
+	log.FromContext(ctx).Info("Creating namespace", "namespace", name)
+	namespace = &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+			Labels: map[string]string{
+				"app.kubernetes.io/managed-by": "monitor-operator",
+			},
+		},
+	}
+	return client.IgnoreAlreadyExists(r.Create(ctx, namespace))
+}
+
+// createMonitorStack 在目标命名空间中创建或更新MonitorStack
+// MonitorStack的spec由ClusterMonitorStack完全控制，手动修改会被覆盖
+func (r *ClusterMonitorStackReconciler) createMonitorStack(ctx context.Context, clusterStack *monitoringv1.ClusterMonitorStack, namespace string) (*monitoringv1.MonitorStack, error) {
+	monitorStack := &monitoringv1.MonitorStack{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      clusterStack.Name,
+			Namespace: namespace,
+			Labels:    getClusterMonitorStackLabels(clusterStack),
+		},
+		Spec: *clusterStack.Spec.MonitorStackSpec.DeepCopy(),
+	}
+
+	// 设置OwnerReference - 命名空间级资源可以属于集群级资源
+	if err := controllerutil.SetControllerReference(clusterStack, monitorStack, r.Scheme); err != nil {
+		return nil, err
+	}
+
+	existing := &monitoringv1.MonitorStack{}
+	err := r.Get(ctx, types.NamespacedName{Name: monitorStack.Name, Namespace: namespace}, existing)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return monitorStack, r.Create(ctx, monitorStack)
+		}
+		return nil, err
+	}
+
+	// 不接管用户自己创建的同名MonitorStack
+	if !metav1.IsControlledBy(existing, clusterStack) {
+		return nil, fmt.Errorf("MonitorStack %s/%s already exists and is not managed by this ClusterMonitorStack", namespace, existing.Name)
+	}
+
+	// spec和标签都没有变化时不更新，避免每次协调都触发MonitorStack的协调
+	if equality.Semantic.DeepEqual(existing.Spec, monitorStack.Spec) &&
+		equality.Semantic.DeepEqual(existing.Labels, monitorStack.Labels) {
+		return existing, nil
+	}
+
+	existing.Spec = monitorStack.Spec
+	existing.Labels = monitorStack.Labels
+	return existing, r.Update(ctx, existing)
+}
+
+// cleanupStaleMonitorStacks 删除其他命名空间中由当前ClusterMonitorStack生成的MonitorStack
+func (r *ClusterMonitorStackReconciler) cleanupStaleMonitorStacks(ctx context.Context, clusterStack *monitoringv1.ClusterMonitorStack, namespace string) error {
+	monitorStacks := &monitoringv1.MonitorStackList{}
+	if err := r.List(ctx, monitorStacks, client.MatchingLabels{clusterMonitorStackLabel: clusterStack.Name}); err != nil {
+		return err
+	}
+
+	for i := range monitorStacks.Items {
+		monitorStack := &monitorStacks.Items[i]
+		if monitorStack.Namespace == namespace || !metav1.IsControlledBy(monitorStack, clusterStack) {
+			continue
+		}
+		log.FromContext(ctx).Info("Deleting MonitorStack from previous namespace", "namespace", monitorStack.Namespace, "name", monitorStack.Name)
+		if err := client.IgnoreNotFound(r.Delete(ctx, monitorStack)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createDiscoveryClusterRole 创建Prometheus服务发现的ClusterRole
+func (r *ClusterMonitorStackReconciler) createDiscoveryClusterRole(ctx context.Context, clusterStack *monitoringv1.ClusterMonitorStack) error {
+	clusterRole := &rbacv1.ClusterRole{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   getDiscoveryClusterRoleName(clusterStack),
+			Labels: getClusterMonitorStackLabels(clusterStack),
+		},
+		Rules: prometheusClusterDiscoveryRules,
+	}
+
+	if err := controllerutil.SetControllerReference(clusterStack, clusterRole, r.Scheme); err != nil {
+		return err
+	}
+
+	existing := &rbacv1.ClusterRole{}
+	err := r.Get(ctx, types.NamespacedName{Name: clusterRole.Name}, existing)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return r.Create(ctx, clusterRole)
+		}
+		return err
+	}
+
+	existing.Rules = clusterRole.Rules
+	existing.Labels = clusterRole.Labels
+	return r.Update(ctx, existing)
+}
+
+// createDiscoveryClusterRoleBinding 把服务发现ClusterRole绑定到Prometheus的ServiceAccount
+func (r *ClusterMonitorStackReconciler) createDiscoveryClusterRoleBinding(ctx context.Context, clusterStack *monitoringv1.ClusterMonitorStack, monitorStack *monitoringv1.MonitorStack) error {
+	name := getDiscoveryClusterRoleName(clusterStack)
+	// ServiceAccount名称与MonitorStack控制器保持一致
+	serviceAccountName := (&MonitorStackReconciler{}).getPrometheusServiceAccountName(monitorStack)
+
+	binding := &rbacv1.ClusterRoleBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: getClusterMonitorStackLabels(clusterStack),
+		},
+		RoleRef: rbacv1.RoleRef{
+			APIGroup: rbacv1.GroupName,
+			Kind:     "ClusterRole",
+			Name:     name,
+		},
+		Subjects: []rbacv1.Subject{
+			{
+				Kind:      rbacv1.ServiceAccountKind,
+				Name:      serviceAccountName,
+				Namespace: monitorStack.Namespace,
+			},
+		},
+	}
+
+	if err := controllerutil.SetControllerReference(clusterStack, binding, r.Scheme); err != nil {
+		return err
+	}
+
+	existing := &rbacv1.ClusterRoleBinding{}
+	err := r.Get(ctx, types.NamespacedName{Name: name}, existing)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return r.Create(ctx, binding)
+		}
+		return err
+	}
+
+	// roleRef不可修改，只更新subjects
+	existing.Subjects = binding.Subjects
+	existing.Labels = binding.Labels
+	return r.Update(ctx, existing)
+}
+
+// setCondition 设置ClusterMonitorStack的就绪条件
+func (r *ClusterMonitorStackReconciler) setCondition(clusterStack *monitoringv1.ClusterMonitorStack, status metav1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(&clusterStack.Status.Conditions, metav1.Condition{
+		Type:               conditionTypeReady,
+		Status:             status,
+		ObservedGeneration: clusterStack.Generation,
+		Reason:             reason,
+		Message:            message,
+	})
+}
+
+// updateFailedStatus 协调失败时更新状态并返回错误以便重试
+func (r *ClusterMonitorStackReconciler) updateFailedStatus(ctx context.Context, clusterStack *monitoringv1.ClusterMonitorStack, err error) (ctrl.Result, error) {
+	log.FromContext(ctx).Error(err, "Failed to reconcile ClusterMonitorStack")
+	clusterStack.Status.Phase = "Failed"
+	clusterStack.Status.Message = err.Error()
+	clusterStack.Status.LastUpdated = metav1.Now()
+	r.setCondition(clusterStack, metav1.ConditionFalse, "Failed", err.Error())
+	if updateErr := r.Status().Update(ctx, clusterStack); updateErr != nil {
+		log.FromContext(ctx).Error(updateErr, "Failed to update ClusterMonitorStack status")
+	}
+	return ctrl.Result{RequeueAfter: time.Minute}, err
+}
+
+// SetupWithManager 设置控制器与Manager的关系
+func (r *ClusterMonitorStackReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&monitoringv1.ClusterMonitorStack{}). // 监听ClusterMonitorStack资源
+		Owns(&monitoringv1.MonitorStack{}).       // 拥有MonitorStack资源，同步其状态
+		Owns(&rbacv1.ClusterRole{}).              // 拥有ClusterRole资源
+		Owns(&rbacv1.ClusterRoleBinding{}).       // 拥有ClusterRoleBinding资源
+		Complete(r)
+}
@@ -0,0 +1,159 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	monitoringv1 "github.com/ciliverse/monitor-operator/api/v1"
+)
+
+var _ = Describe("ClusterMonitorStack Controller", func() {
+	Context("When reconciling a resource", func() {
+		const (
+			resourceName = "test-resource"
+			namespace    = "cluster-stack-test"
+		)
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name: resourceName,
+		}
+		childNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: namespace,
+		}
+
+		reconcileOnce := func() {
+			controllerReconciler := &ClusterMonitorStackReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+			}
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		BeforeEach(func() {
+			By("creating the custom resource for the Kind ClusterMonitorStack")
+			resource := &monitoringv1.ClusterMonitorStack{}
+			err := k8sClient.Get(ctx, typeNamespacedName, resource)
+			if err != nil && errors.IsNotFound(err) {
+				resource = &monitoringv1.ClusterMonitorStack{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: resourceName,
+					},
+					Spec: monitoringv1.ClusterMonitorStackSpec{
+						MonitorStackSpec: monitoringv1.MonitorStackSpec{
+							Namespace:  namespace,
+							Prometheus: monitoringv1.PrometheusSpec{Enabled: true, Retention: "7d"},
+							Grafana:    monitoringv1.GrafanaSpec{Enabled: true},
+						},
+					},
+				}
+				Expect(k8sClient.Create(ctx, resource)).To(Succeed())
+			}
+		})
+
+		AfterEach(func() {
+			resource := &monitoringv1.ClusterMonitorStack{}
+			err := k8sClient.Get(ctx, typeNamespacedName, resource)
+			Expect(err).NotTo(HaveOccurred())
+
+			By("Cleanup the specific resource instance ClusterMonitorStack")
+			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+
+			// envtest没有运行垃圾回收，手动删除生成的MonitorStack
+			child := &monitoringv1.MonitorStack{}
+			if err := k8sClient.Get(ctx, childNamespacedName, child); err == nil {
+				Expect(k8sClient.Delete(ctx, child)).To(Succeed())
+			}
+		})
+
+		It("should create the MonitorStack with the propagated spec", func() {
+			By("Reconciling the created resource")
+			reconcileOnce()
+
+			resource := &monitoringv1.ClusterMonitorStack{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(resource.Status.Namespace).To(Equal(namespace))
+			Expect(resource.Status.Phase).To(Equal("Pending"))
+
+			child := &monitoringv1.MonitorStack{}
+			Expect(k8sClient.Get(ctx, childNamespacedName, child)).To(Succeed())
+			Expect(child.Spec.Prometheus.Retention).To(Equal("7d"))
+			Expect(child.Spec.Grafana.Enabled).To(BeTrue())
+			Expect(child.Labels).To(HaveKeyWithValue(clusterMonitorStackLabel, resourceName))
+
+			By("Checking the discovery RBAC is bound to the Prometheus ServiceAccount")
+			binding := &rbacv1.ClusterRoleBinding{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: getDiscoveryClusterRoleName(resource)}, binding)).To(Succeed())
+			Expect(binding.Subjects).To(HaveLen(1))
+			Expect(binding.Subjects[0].Namespace).To(Equal(namespace))
+		})
+
+		It("should make the MonitorStack a dependent that is deleted with the ClusterMonitorStack", func() {
+			reconcileOnce()
+
+			resource := &monitoringv1.ClusterMonitorStack{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			child := &monitoringv1.MonitorStack{}
+			Expect(k8sClient.Get(ctx, childNamespacedName, child)).To(Succeed())
+
+			// 垃圾回收根据控制者OwnerReference删除子资源
+			owner := metav1.GetControllerOf(child)
+			Expect(owner).NotTo(BeNil())
+			Expect(owner.UID).To(Equal(resource.UID))
+			Expect(*owner.BlockOwnerDeletion).To(BeTrue())
+		})
+
+		It("should update the MonitorStack only when the spec changes", func() {
+			reconcileOnce()
+
+			child := &monitoringv1.MonitorStack{}
+			Expect(k8sClient.Get(ctx, childNamespacedName, child)).To(Succeed())
+			resourceVersion := child.ResourceVersion
+
+			By("Reconciling again without changes")
+			reconcileOnce()
+			Expect(k8sClient.Get(ctx, childNamespacedName, child)).To(Succeed())
+			Expect(child.ResourceVersion).To(Equal(resourceVersion))
+
+			By("Changing the ClusterMonitorStack spec")
+			resource := &monitoringv1.ClusterMonitorStack{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			resource.Spec.Prometheus.Retention = "30d"
+			Expect(k8sClient.Update(ctx, resource)).To(Succeed())
+
+			reconcileOnce()
+			Expect(k8sClient.Get(ctx, childNamespacedName, child)).To(Succeed())
+			Expect(child.ResourceVersion).NotTo(Equal(resourceVersion))
+			Expect(child.Spec.Prometheus.Retention).To(Equal("30d"))
+		})
+	})
+})
@@ -0,0 +1,70 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	monitoringv1 "github.com/ciliverse/monitor-operator/api/v1"
+)
+
+// 配置热加载 - Prometheus配置变化时不重启Pod，避免每次服务发现命名空间增减都要回放WAL，
+// 由sidecar监听挂载的ConfigMap，kubelet同步新内容后调用Prometheus的/-/reload接口重新加载
+
+const (
+	// configReloaderImage 监听配置目录并调用reload接口的sidecar镜像
+	configReloaderImage = "ghcr.io/jimmidyson/configmap-reload:v0.14.0"
+	// configReloaderContainerName sidecar容器名称
+	configReloaderContainerName = "config-reloader"
+)
+
+// getConfigReloaderImage 获取配置热加载sidecar实际使用的镜像，策略检查使用相同的地址
+func (r *MonitorStackReconciler) getConfigReloaderImage() string {
+	return r.rewriteOperatorImage(configReloaderImage)
+}
+
+// buildPrometheusConfigReloader 构建Prometheus的配置热加载sidecar
+// 与Prometheus共用配置卷和安全上下文，只读挂载配置目录，reload接口需要--web.enable-lifecycle
+func (r *MonitorStackReconciler) buildPrometheusConfigReloader(monitorStack *monitoringv1.MonitorStack) corev1.Container {
+	container := corev1.Container{
+		Name:  configReloaderContainerName,
+		Image: r.getConfigReloaderImage(),
+		Args: []string{
+			"--volume-dir=/etc/prometheus",
+		},
+		SecurityContext: r.buildContainerSecurityContext(monitorStack.Spec.Prometheus.Security),
+		VolumeMounts: []corev1.VolumeMount{
+			{
+				Name:      "config",
+				MountPath: "/etc/prometheus",
+				ReadOnly:  true,
+			},
+		},
+		Resources: corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("5m"),
+				corev1.ResourceMemory: resource.MustParse("16Mi"),
+			},
+			Limits: corev1.ResourceList{
+				corev1.ResourceMemory: resource.MustParse("32Mi"),
+			},
+		},
+	}
+	r.addPrometheusReloadClient(&container, monitorStack)
+	return container
+}
@@ -0,0 +1,443 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/yaml"
+
+	monitoringv1 "github.com/ciliverse/monitor-operator/api/v1"
+	"github.com/ciliverse/monitor-operator/internal/policy"
+)
+
+// 联邦 - 全局MonitorStack通过/federate从各团队MonitorStack的Prometheus抓取指标
+// 被引用的MonitorStack的Service变化时，重新生成全局MonitorStack的抓取配置
+// 目标启用HTTPS或Basic认证时，把目标web配置Secret中的密码和CA证书复制到本栈的联邦凭据Secret，挂载到Prometheus容器中
+// 与服务发现一致，只能联邦抓取自身所在命名空间以及MonitorStackPolicy的allowedTargetNamespaces列出的命名空间
+
+const (
+	// conditionTypeFederationTargetsAllowed 联邦抓取的MonitorStack是否都被策略允许的状态条件
+	conditionTypeFederationTargetsAllowed = "FederationTargetsAllowed"
+
+	// prometheusFederationDir 联邦凭据Secret在Prometheus容器中的挂载目录
+	prometheusFederationDir = "/etc/prometheus/federation"
+)
+
+// federationJobConfig Prometheus配置文件中的联邦抓取任务
+type federationJobConfig struct {
+	JobName        string                   `json:"job_name"`
+	HonorLabels    bool                     `json:"honor_labels"`
+	MetricsPath    string                   `json:"metrics_path"`
+	ScrapeInterval string                   `json:"scrape_interval,omitempty"`
+	Params         map[string][]string      `json:"params"`
+	Scheme         string                   `json:"scheme,omitempty"`
+	BasicAuth      *federationBasicAuth     `json:"basic_auth,omitempty"`
+	TLSConfig      *federationTLSConfig     `json:"tls_config,omitempty"`
+	StaticConfigs  []federationStaticConfig `json:"static_configs"`
+	RelabelConfigs []relabelConfig          `json:"relabel_configs,omitempty"`
+}
+
+// federationBasicAuth 联邦抓取任务的Basic认证
+type federationBasicAuth struct {
+	Username     string `json:"username"`
+	PasswordFile string `json:"password_file"`
+}
+
+// federationTLSConfig 联邦抓取任务的TLS配置
+type federationTLSConfig struct {
+	CAFile string `json:"ca_file"`
+}
+
+// federationStaticConfig 联邦抓取任务的静态目标
+type federationStaticConfig struct {
+	Targets []string          `json:"targets"`
+	Labels  map[string]string `json:"labels,omitempty"`
+}
+
+// canFederateFrom 判断是否可以从目标MonitorStack联邦抓取
+func canFederateFrom(monitorStack, target *monitoringv1.MonitorStack) bool {
+	return target.UID != monitorStack.UID &&
+		target.DeletionTimestamp == nil &&
+		target.Spec.Prometheus.Enabled &&
+		target.Spec.Prometheus.Mode != prometheusModeAgent
+}
+
+// getFederationCredentialKey 获取目标的凭据在联邦凭据Secret中的键，格式为{命名空间}_{名称}_{key}
+// 命名空间和名称中不会出现下划线，不同目标的键不会冲突
+func getFederationCredentialKey(target monitoringv1.FederationTargetStatus, key string) string {
+	return target.Namespace + "_" + target.Name + "_" + key
+}
+
+// getFederationEndpoints 获取目标MonitorStack的Prometheus Service地址，分片时返回所有分片的地址
+func (r *MonitorStackReconciler) getFederationEndpoints(target *monitoringv1.MonitorStack) []string {
+	shards := getPrometheusShards(target)
+	endpoints := make([]string, 0, shards)
+	for shard := int32(0); shard < shards; shard++ {
+		endpoints = append(endpoints, r.getPrometheusShardAddress(target, shard))
+	}
+	return endpoints
+}
+
+// resolveFederationTargets 解析联邦抓取的MonitorStack，结果记录在status中
+func (r *MonitorStackReconciler) resolveFederationTargets(ctx context.Context, monitorStack *monitoringv1.MonitorStack) error {
+	federation := monitorStack.Spec.Prometheus.Federation
+	if federation == nil {
+		monitorStack.Status.FederationTargets = nil
+		meta.RemoveStatusCondition(&monitorStack.Status.Conditions, conditionTypeFederationTargetsAllowed)
+		return nil
+	}
+
+	policies, err := policy.MatchingPolicies(ctx, r.Client, monitorStack.Namespace)
+	if err != nil {
+		return err
+	}
+
+	resolved := map[types.NamespacedName]monitoringv1.FederationTargetStatus{}
+	refused := map[string]bool{}
+	add := func(target *monitoringv1.MonitorStack) {
+		if !canFederateFrom(monitorStack, target) {
+			return
+		}
+		if !policy.AllowsTargetNamespace(policies, monitorStack.Namespace, target.Namespace) {
+			refused[target.Namespace+"/"+target.Name] = true
+			return
+		}
+		status := monitoringv1.FederationTargetStatus{
+			Name:      target.Name,
+			Namespace: target.Namespace,
+			Endpoints: r.getFederationEndpoints(target),
+		}
+		if web := target.Spec.Prometheus.Web; web != nil {
+			if web.TLS != nil {
+				status.Scheme = getPrometheusScheme(target)
+				status.TLSCA = web.TLS.CA != nil
+			}
+			if web.BasicAuth != nil {
+				status.Username = web.BasicAuth.Username
+			}
+		}
+		resolved[types.NamespacedName{Name: target.Name, Namespace: target.Namespace}] = status
+	}
+
+	for _, ref := range federation.Targets {
+		namespace := ref.Namespace
+		if namespace == "" {
+			namespace = monitorStack.Namespace
+		}
+		target := &monitoringv1.MonitorStack{}
+		if err := r.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: namespace}, target); err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
+			return err
+		}
+		add(target)
+	}
+
+	if federation.Selector != nil {
+		selector, err := metav1.LabelSelectorAsSelector(federation.Selector)
+		if err != nil {
+			return fmt.Errorf("invalid federation selector: %w", err)
+		}
+		namespaces, err := r.getFederationNamespaces(ctx, monitorStack)
+		if err != nil {
+			return err
+		}
+		targets := &monitoringv1.MonitorStackList{}
+		if err := r.List(ctx, targets, client.MatchingLabelsSelector{Selector: selector}); err != nil {
+			return err
+		}
+		for i := range targets.Items {
+			if namespaces[targets.Items[i].Namespace] {
+				add(&targets.Items[i])
+			}
+		}
+	}
+
+	result := make([]monitoringv1.FederationTargetStatus, 0, len(resolved))
+	for _, target := range resolved {
+		result = append(result, target)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Namespace != result[j].Namespace {
+			return result[i].Namespace < result[j].Namespace
+		}
+		return result[i].Name < result[j].Name
+	})
+	monitorStack.Status.FederationTargets = result
+
+	if len(refused) > 0 {
+		names := make([]string, 0, len(refused))
+		for name := range refused {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		r.setCondition(monitorStack, conditionTypeFederationTargetsAllowed, metav1.ConditionFalse, "NamespaceNotAllowed",
+			fmt.Sprintf("MonitorStacks %s are in namespaces not listed in allowedTargetNamespaces of any MonitorStackPolicy and are not federated",
+				strings.Join(names, ", ")))
+	} else {
+		r.setCondition(monitorStack, conditionTypeFederationTargetsAllowed, metav1.ConditionTrue, "Allowed",
+			"all federation targets are allowed")
+	}
+	return nil
+}
+
+// getFederationNamespaces 获取联邦selector匹配的命名空间，未设置namespaceSelector时只包含自身命名空间
+func (r *MonitorStackReconciler) getFederationNamespaces(ctx context.Context, monitorStack *monitoringv1.MonitorStack) (map[string]bool, error) {
+	namespaceSelector := monitorStack.Spec.Prometheus.Federation.NamespaceSelector
+	if namespaceSelector == nil {
+		return map[string]bool{monitorStack.Namespace: true}, nil
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(namespaceSelector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid federation namespaceSelector: %w", err)
+	}
+	namespaces := &corev1.NamespaceList{}
+	if err := r.List(ctx, namespaces, client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return nil, err
+	}
+	result := make(map[string]bool, len(namespaces.Items))
+	for _, namespace := range namespaces.Items {
+		result[namespace.Name] = true
+	}
+	return result, nil
+}
+
+// buildPrometheusFederationJobs 生成指定分片默认配置中的联邦抓取任务，没有联邦目标时返回空字符串
+func (r *MonitorStackReconciler) buildPrometheusFederationJobs(monitorStack *monitoringv1.MonitorStack, shard int32) string {
+	federation := monitorStack.Spec.Prometheus.Federation
+	if federation == nil || len(monitorStack.Status.FederationTargets) == 0 {
+		return ""
+	}
+
+	jobs := make([]federationJobConfig, 0, len(monitorStack.Status.FederationTargets))
+	for _, target := range monitorStack.Status.FederationTargets {
+		job := federationJobConfig{
+			JobName:        fmt.Sprintf("federate-%s-%s", target.Namespace, target.Name),
+			HonorLabels:    true,
+			MetricsPath:    "/federate",
+			ScrapeInterval: federation.ScrapeInterval,
+			Params:         map[string][]string{"match[]": federation.Match},
+			Scheme:         target.Scheme,
+			StaticConfigs: []federationStaticConfig{
+				{
+					Targets: target.Endpoints,
+					Labels:  map[string]string{monitorStackLabel: target.Namespace + "/" + target.Name},
+				},
+			},
+			RelabelConfigs: buildShardRelabelConfigs(getPrometheusShards(monitorStack), shard),
+		}
+		if target.Username != "" {
+			job.BasicAuth = &federationBasicAuth{
+				Username:     target.Username,
+				PasswordFile: prometheusFederationDir + "/" + getFederationCredentialKey(target, prometheusWebPasswordKey),
+			}
+		}
+		if target.TLSCA {
+			job.TLSConfig = &federationTLSConfig{
+				CAFile: prometheusFederationDir + "/" + getFederationCredentialKey(target, prometheusWebCAKey),
+			}
+		}
+		jobs = append(jobs, job)
+	}
+
+	// 只包含字符串和列表字段，序列化不会失败
+	data, _ := yaml.Marshal(jobs)
+
+	// 作为scrape_configs的列表项缩进
+	var b strings.Builder
+	b.WriteString("  # 联邦抓取其他MonitorStack\n")
+	for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+		b.WriteString("  " + line + "\n")
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+// reconcilePrometheusFederationSecret 把联邦目标的密码和CA证书复制到联邦凭据Secret，未配置联邦时删除该Secret
+// 凭据从目标operator生成的web配置Secret中读取，目标已经通过策略的命名空间检查
+func (r *MonitorStackReconciler) reconcilePrometheusFederationSecret(ctx context.Context, monitorStack *monitoringv1.MonitorStack) error {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      r.getPrometheusFederationSecretName(monitorStack),
+			Namespace: monitorStack.Namespace,
+		},
+	}
+	if monitorStack.Spec.Prometheus.Federation == nil {
+		return r.deleteOwnedObject(ctx, monitorStack, secret)
+	}
+
+	data := map[string][]byte{}
+	for _, target := range monitorStack.Status.FederationTargets {
+		var keys []string
+		if target.Username != "" {
+			keys = append(keys, prometheusWebPasswordKey)
+		}
+		if target.TLSCA {
+			keys = append(keys, prometheusWebCAKey)
+		}
+		targetStack := &monitoringv1.MonitorStack{ObjectMeta: metav1.ObjectMeta{Name: target.Name, Namespace: target.Namespace}}
+		for _, key := range keys {
+			value, err := r.getSecretKey(ctx, target.Namespace, corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: r.getPrometheusWebConfigSecretName(targetStack)},
+				Key:                  key,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to get credentials of federation target %s/%s: %w", target.Namespace, target.Name, err)
+			}
+			data[getFederationCredentialKey(target, key)] = value
+		}
+	}
+
+	existing := &corev1.Secret{}
+	err := r.Get(ctx, client.ObjectKeyFromObject(secret), existing)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	secret.Labels = r.getLabels(monitorStack, "prometheus")
+	secret.Type = corev1.SecretTypeOpaque
+	secret.Data = data
+	if err := controllerutil.SetControllerReference(monitorStack, secret, r.Scheme); err != nil {
+		return err
+	}
+	if errors.IsNotFound(err) {
+		return r.Create(ctx, secret)
+	}
+	existing.Labels = secret.Labels
+	existing.Data = secret.Data
+	return r.Update(ctx, existing)
+}
+
+// addPrometheusFederationCredentials 配置联邦时把联邦凭据Secret挂载到Prometheus容器
+// Secret更新后kubelet同步挂载的文件，Prometheus每次抓取时重新读取，增减目标不需要重启Pod
+func (r *MonitorStackReconciler) addPrometheusFederationCredentials(deployment *appsv1.Deployment, monitorStack *monitoringv1.MonitorStack) {
+	if monitorStack.Spec.Prometheus.Federation == nil {
+		return
+	}
+	podSpec := &deployment.Spec.Template.Spec
+	podSpec.Containers[0].VolumeMounts = append(podSpec.Containers[0].VolumeMounts, corev1.VolumeMount{
+		Name:      "federation",
+		MountPath: prometheusFederationDir,
+		ReadOnly:  true,
+	})
+	podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+		Name: "federation",
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{SecretName: r.getPrometheusFederationSecretName(monitorStack)},
+		},
+	})
+}
+
+// findMonitorStacksForFederationSecret 联邦目标的web配置Secret变化后找出联邦抓取它的MonitorStack，重新复制凭据
+func (r *MonitorStackReconciler) findMonitorStacksForFederationSecret(ctx context.Context, obj client.Object) []reconcile.Request {
+	if !strings.HasSuffix(obj.GetName(), "-prometheus-web-config") {
+		return nil
+	}
+	monitorStacks := &monitoringv1.MonitorStackList{}
+	if err := r.List(ctx, monitorStacks); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list MonitorStacks for federation secret", "secret", obj.GetName())
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, monitorStack := range monitorStacks.Items {
+		for _, target := range monitorStack.Status.FederationTargets {
+			targetStack := &monitoringv1.MonitorStack{ObjectMeta: metav1.ObjectMeta{Name: target.Name}}
+			if target.Namespace == obj.GetNamespace() && r.getPrometheusWebConfigSecretName(targetStack) == obj.GetName() {
+				requests = append(requests, reconcile.Request{
+					NamespacedName: types.NamespacedName{Name: monitorStack.Name, Namespace: monitorStack.Namespace},
+				})
+				break
+			}
+		}
+	}
+	return requests
+}
+
+// findMonitorStacksForFederation 被引用的MonitorStack变化后找出联邦抓取它的MonitorStack
+func (r *MonitorStackReconciler) findMonitorStacksForFederation(ctx context.Context, obj client.Object) []reconcile.Request {
+	monitorStacks := &monitoringv1.MonitorStackList{}
+	if err := r.List(ctx, monitorStacks); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list MonitorStacks for federation", "monitorStack", obj.GetName())
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, monitorStack := range monitorStacks.Items {
+		if !referencesFederationTarget(&monitorStack, obj) {
+			continue
+		}
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Name: monitorStack.Name, Namespace: monitorStack.Namespace},
+		})
+	}
+	return requests
+}
+
+// referencesFederationTarget 判断MonitorStack的联邦配置是否可能引用目标
+// 设置了namespaceSelector时无法在这里判断命名空间标签，交给协调时解析
+func referencesFederationTarget(monitorStack *monitoringv1.MonitorStack, target client.Object) bool {
+	federation := monitorStack.Spec.Prometheus.Federation
+	if federation == nil || monitorStack.UID == target.GetUID() {
+		return false
+	}
+
+	for _, ref := range federation.Targets {
+		namespace := ref.Namespace
+		if namespace == "" {
+			namespace = monitorStack.Namespace
+		}
+		if ref.Name == target.GetName() && namespace == target.GetNamespace() {
+			return true
+		}
+	}
+
+	// 已经联邦抓取的目标不再匹配selector时也需要更新
+	for _, resolved := range monitorStack.Status.FederationTargets {
+		if resolved.Name == target.GetName() && resolved.Namespace == target.GetNamespace() {
+			return true
+		}
+	}
+
+	if federation.Selector == nil {
+		return false
+	}
+	if federation.NamespaceSelector == nil && monitorStack.Namespace != target.GetNamespace() {
+		return false
+	}
+	selector, err := metav1.LabelSelectorAsSelector(federation.Selector)
+	if err != nil {
+		return false
+	}
+	return selector.Matches(labels.Set(target.GetLabels()))
+}
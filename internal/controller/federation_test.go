@@ -0,0 +1,208 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	monitoringv1 "github.com/ciliverse/monitor-operator/api/v1"
+)
+
+var _ = Describe("Federation", func() {
+	ctx := context.Background()
+	r := &MonitorStackReconciler{}
+
+	newStack := func(name, namespace string, labels map[string]string) *monitoringv1.MonitorStack {
+		monitorStack := newTestMonitorStack()
+		monitorStack.Name = name
+		monitorStack.Namespace = namespace
+		monitorStack.UID = types.UID(namespace + "/" + name)
+		monitorStack.Labels = labels
+		return monitorStack
+	}
+
+	newGlobalStack := func() *monitoringv1.MonitorStack {
+		monitorStack := newStack("global", "monitoring", nil)
+		monitorStack.Spec.Prometheus.Federation = &monitoringv1.FederationSpec{
+			Targets: []monitoringv1.FederationTargetRef{
+				{Name: "team-a", Namespace: "team-a"},
+				{Name: "local"},
+				{Name: "missing"},
+			},
+			Selector:          &metav1.LabelSelector{MatchLabels: map[string]string{"federation": "global"}},
+			NamespaceSelector: &metav1.LabelSelector{},
+			Match:             []string{`{__name__=~"job:.*"}`},
+		}
+		return monitorStack
+	}
+
+	objects := func(global *monitoringv1.MonitorStack) []client.Object {
+		agent := newStack("edge", "team-b", map[string]string{"federation": "global"})
+		agent.Spec.Prometheus.Mode = prometheusModeAgent
+		shards := int32(2)
+		teamB := newStack("team-b", "team-b", map[string]string{"federation": "global"})
+		teamB.Spec.Prometheus.Shards = &shards
+		return []client.Object{
+			&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "monitoring"}},
+			&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a"}},
+			&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-b"}},
+			global,
+			newStack("team-a", "team-a", nil),
+			newStack("local", "monitoring", nil),
+			teamB,
+			agent,
+			newStack("other", "team-b", nil),
+		}
+	}
+
+	It("only federates stacks in the own namespace without a policy", func() {
+		global := newGlobalStack()
+		reconciler := newFakeReconciler(objects(global)...)
+
+		Expect(reconciler.resolveFederationTargets(ctx, global)).To(Succeed())
+		Expect(global.Status.FederationTargets).To(Equal([]monitoringv1.FederationTargetStatus{
+			{Name: "local", Namespace: "monitoring", Endpoints: []string{"local-prometheus.monitoring.svc:9090"}},
+		}))
+		condition := meta.FindStatusCondition(global.Status.Conditions, conditionTypeFederationTargetsAllowed)
+		Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+		Expect(condition.Message).To(ContainSubstring("team-a/team-a, team-b/team-b"))
+	})
+
+	It("federates stacks in namespaces allowed by a policy", func() {
+		global := newGlobalStack()
+		policy := &monitoringv1.MonitorStackPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: "global"},
+			Spec:       monitoringv1.MonitorStackPolicySpec{AllowedTargetNamespaces: []string{"team-a", "team-b"}},
+		}
+		reconciler := newFakeReconciler(append(objects(global), policy)...)
+
+		Expect(reconciler.resolveFederationTargets(ctx, global)).To(Succeed())
+		Expect(global.Status.FederationTargets).To(Equal([]monitoringv1.FederationTargetStatus{
+			{Name: "local", Namespace: "monitoring", Endpoints: []string{"local-prometheus.monitoring.svc:9090"}},
+			{Name: "team-a", Namespace: "team-a", Endpoints: []string{"team-a-prometheus.team-a.svc:9090"}},
+			{Name: "team-b", Namespace: "team-b", Endpoints: []string{
+				"team-b-prometheus.team-b.svc:9090",
+				"team-b-prometheus-shard-1.team-b.svc:9090",
+			}},
+		}))
+		Expect(meta.IsStatusConditionTrue(global.Status.Conditions, conditionTypeFederationTargetsAllowed)).To(BeTrue())
+
+		By("removing the status when federation is disabled")
+		global.Spec.Prometheus.Federation = nil
+		Expect(reconciler.resolveFederationTargets(ctx, global)).To(Succeed())
+		Expect(global.Status.FederationTargets).To(BeNil())
+		Expect(meta.FindStatusCondition(global.Status.Conditions, conditionTypeFederationTargetsAllowed)).To(BeNil())
+	})
+
+	It("generates a /federate job per target", func() {
+		global := newGlobalStack()
+		global.Spec.Prometheus.Federation.ScrapeInterval = "1m"
+		global.Status.FederationTargets = []monitoringv1.FederationTargetStatus{
+			{Name: "team-a", Namespace: "team-a", Endpoints: []string{"team-a-prometheus.team-a.svc:9090"}},
+		}
+
+		jobs := r.buildPrometheusFederationJobs(global, 0)
+		Expect(jobs).To(ContainSubstring("job_name: federate-team-a-team-a"))
+		Expect(jobs).To(ContainSubstring("metrics_path: /federate"))
+		Expect(jobs).To(ContainSubstring("honor_labels: true"))
+		Expect(jobs).To(ContainSubstring("scrape_interval: 1m"))
+		Expect(jobs).To(ContainSubstring(`- '{__name__=~"job:.*"}'`))
+		Expect(jobs).To(ContainSubstring("- team-a-prometheus.team-a.svc:9090"))
+		Expect(jobs).To(ContainSubstring("monitor_stack: team-a/team-a"))
+		Expect(jobs).NotTo(ContainSubstring("hashmod"))
+		Expect(r.getPrometheusConfig(global)).To(ContainSubstring(jobs))
+
+		global.Status.FederationTargets = nil
+		Expect(r.buildPrometheusFederationJobs(global, 0)).To(BeEmpty())
+	})
+
+	It("copies the credentials of targets with web TLS and basic auth", func() {
+		global := newGlobalStack()
+		global.Spec.Prometheus.Federation.Targets = []monitoringv1.FederationTargetRef{{Name: "secure"}}
+		global.Spec.Prometheus.Federation.Selector = nil
+		secure := newStack("secure", "monitoring", nil)
+		ca := secretKey("prometheus-tls", "ca.crt")
+		secure.Spec.Prometheus.Web = &monitoringv1.PrometheusWebSpec{
+			TLS:       &monitoringv1.PrometheusWebTLSSpec{SecretName: "prometheus-tls", CA: &ca},
+			BasicAuth: &monitoringv1.PrometheusWebBasicAuthSpec{Username: "admin", Password: secretKey("prometheus-auth", "password")},
+		}
+		reconciler := newFakeReconciler(global, secure, &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "secure-prometheus-web-config", Namespace: "monitoring"},
+			Data:       map[string][]byte{prometheusWebPasswordKey: []byte("s3cret"), prometheusWebCAKey: []byte("ca")},
+		})
+
+		Expect(reconciler.resolveFederationTargets(ctx, global)).To(Succeed())
+		Expect(global.Status.FederationTargets).To(Equal([]monitoringv1.FederationTargetStatus{{
+			Name: "secure", Namespace: "monitoring", Endpoints: []string{"secure-prometheus.monitoring.svc:9090"},
+			Scheme: "https", Username: "admin", TLSCA: true,
+		}}))
+
+		Expect(reconciler.reconcilePrometheusFederationSecret(ctx, global)).To(Succeed())
+		secret := &corev1.Secret{}
+		Expect(reconciler.Get(ctx, types.NamespacedName{Name: "global-prometheus-federation", Namespace: "monitoring"}, secret)).To(Succeed())
+		Expect(secret.Data).To(Equal(map[string][]byte{
+			"monitoring_secure_password": []byte("s3cret"),
+			"monitoring_secure_ca.crt":   []byte("ca"),
+		}))
+
+		jobs := r.buildPrometheusFederationJobs(global, 0)
+		Expect(jobs).To(ContainSubstring("scheme: https"))
+		Expect(jobs).To(ContainSubstring("username: admin"))
+		Expect(jobs).To(ContainSubstring("password_file: /etc/prometheus/federation/monitoring_secure_password"))
+		Expect(jobs).To(ContainSubstring("ca_file: /etc/prometheus/federation/monitoring_secure_ca.crt"))
+
+		deployment := r.buildPrometheusDeployment(global)
+		Expect(deployment.Spec.Template.Spec.Volumes).To(ContainElement(
+			HaveField("Secret.SecretName", "global-prometheus-federation")))
+
+		By("requeueing the stack when the target's web config Secret changes")
+		Expect(reconciler.Status().Update(ctx, global)).To(Succeed())
+		Expect(reconciler.findMonitorStacksForFederationSecret(ctx, &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "secure-prometheus-web-config", Namespace: "monitoring"},
+		})).To(ConsistOf(reconcile.Request{NamespacedName: types.NamespacedName{Name: "global", Namespace: "monitoring"}}))
+
+		By("deleting the Secret when federation is disabled")
+		global.Spec.Prometheus.Federation = nil
+		Expect(reconciler.reconcilePrometheusFederationSecret(ctx, global)).To(Succeed())
+		Expect(reconciler.Get(ctx, types.NamespacedName{Name: "global-prometheus-federation", Namespace: "monitoring"}, secret)).
+			To(MatchError(ContainSubstring("not found")))
+	})
+
+	DescribeTable("referencesFederationTarget",
+		func(target *monitoringv1.MonitorStack, expected bool) {
+			global := newGlobalStack()
+			global.Spec.Prometheus.Federation.NamespaceSelector = nil
+			Expect(referencesFederationTarget(global, target)).To(Equal(expected))
+		},
+		Entry("matches a stack referenced by name", newStack("team-a", "team-a", nil), true),
+		Entry("matches a stack in the own namespace selected by labels",
+			newStack("selected", "monitoring", map[string]string{"federation": "global"}), true),
+		Entry("ignores selected stacks in other namespaces without namespaceSelector",
+			newStack("selected", "team-b", map[string]string{"federation": "global"}), false),
+		Entry("ignores unrelated stacks", newStack("other", "monitoring", nil), false),
+		Entry("ignores itself", newStack("global", "monitoring", map[string]string{"federation": "global"}), false),
+	)
+})
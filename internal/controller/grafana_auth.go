@@ -0,0 +1,164 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+
+	monitoringv1 "github.com/ciliverse/monitor-operator/api/v1"
+)
+
+// Grafana认证配置 - 将GrafanaAuthSpec转换为GF_AUTH_*环境变量和LDAP配置卷
+
+const (
+	// grafanaLDAPConfigDir LDAP配置文件的挂载目录
+	grafanaLDAPConfigDir = "/etc/grafana/ldap"
+	// grafanaLDAPConfigFile LDAP配置文件名
+	grafanaLDAPConfigFile = "ldap.toml"
+)
+
+// buildGrafanaAuthEnv 构建Grafana认证相关的环境变量
+// 敏感信息（如OAuth客户端密钥）通过secretKeyRef注入，不会写入Deployment明文
+func (r *MonitorStackReconciler) buildGrafanaAuthEnv(monitorStack *monitoringv1.MonitorStack) []corev1.EnvVar {
+	auth := monitorStack.Spec.Grafana.Auth
+	if auth == nil {
+		return nil
+	}
+
+	var env []corev1.EnvVar
+
+	// 禁用登录表单，仅保留SSO登录入口
+	if auth.DisableLoginForm {
+		env = append(env, corev1.EnvVar{Name: "GF_AUTH_DISABLE_LOGIN_FORM", Value: "true"})
+	}
+
+	// 通用OAuth/OIDC
+	if oauth := auth.GenericOAuth; oauth != nil {
+		name := oauth.Name
+		if name == "" {
+			name = "OAuth"
+		}
+		env = append(env,
+			corev1.EnvVar{Name: "GF_AUTH_GENERIC_OAUTH_ENABLED", Value: "true"},
+			corev1.EnvVar{Name: "GF_AUTH_GENERIC_OAUTH_NAME", Value: name},
+			corev1.EnvVar{Name: "GF_AUTH_GENERIC_OAUTH_CLIENT_ID", Value: oauth.ClientID},
+			corev1.EnvVar{
+				Name: "GF_AUTH_GENERIC_OAUTH_CLIENT_SECRET",
+				ValueFrom: &corev1.EnvVarSource{
+					SecretKeyRef: oauth.ClientSecret.DeepCopy(),
+				},
+			},
+			corev1.EnvVar{Name: "GF_AUTH_GENERIC_OAUTH_AUTH_URL", Value: oauth.AuthURL},
+			corev1.EnvVar{Name: "GF_AUTH_GENERIC_OAUTH_TOKEN_URL", Value: oauth.TokenURL},
+			corev1.EnvVar{Name: "GF_AUTH_GENERIC_OAUTH_ALLOW_SIGN_UP", Value: strconv.FormatBool(oauth.AllowSignUp)},
+		)
+		if len(oauth.Scopes) > 0 {
+			env = append(env, corev1.EnvVar{Name: "GF_AUTH_GENERIC_OAUTH_SCOPES", Value: strings.Join(oauth.Scopes, " ")})
+		}
+		if oauth.APIURL != "" {
+			env = append(env, corev1.EnvVar{Name: "GF_AUTH_GENERIC_OAUTH_API_URL", Value: oauth.APIURL})
+		}
+		if oauth.RoleAttributePath != "" {
+			env = append(env, corev1.EnvVar{Name: "GF_AUTH_GENERIC_OAUTH_ROLE_ATTRIBUTE_PATH", Value: oauth.RoleAttributePath})
+		}
+	}
+
+	// LDAP - 配置文件由addGrafanaLDAPVolume挂载
+	if ldap := auth.LDAP; ldap != nil {
+		env = append(env,
+			corev1.EnvVar{Name: "GF_AUTH_LDAP_ENABLED", Value: "true"},
+			corev1.EnvVar{Name: "GF_AUTH_LDAP_CONFIG_FILE", Value: fmt.Sprintf("%s/%s", grafanaLDAPConfigDir, grafanaLDAPConfigFile)},
+			corev1.EnvVar{Name: "GF_AUTH_LDAP_ALLOW_SIGN_UP", Value: strconv.FormatBool(ldap.AllowSignUp)},
+		)
+	}
+
+	return env
+}
+
+// addGrafanaLDAPVolume 添加Grafana LDAP配置卷
+// 将Secret中的ldap.toml挂载到grafanaLDAPConfigDir
+func (r *MonitorStackReconciler) addGrafanaLDAPVolume(deployment *appsv1.Deployment, monitorStack *monitoringv1.MonitorStack) {
+	ldap := monitorStack.Spec.Grafana.Auth.LDAP
+
+	ldapVolumeMount := corev1.VolumeMount{
+		Name:      "ldap-config",
+		MountPath: grafanaLDAPConfigDir,
+		ReadOnly:  true,
+	}
+
+	ldapVolume := corev1.Volume{
+		Name: "ldap-config",
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName: ldap.Config.Name,
+				Items: []corev1.KeyToPath{
+					{
+						Key:  ldap.Config.Key,
+						Path: grafanaLDAPConfigFile,
+					},
+				},
+			},
+		},
+	}
+
+	// 添加卷挂载和卷定义
+	deployment.Spec.Template.Spec.Containers[0].VolumeMounts = append(
+		deployment.Spec.Template.Spec.Containers[0].VolumeMounts,
+		ldapVolumeMount,
+	)
+	deployment.Spec.Template.Spec.Volumes = append(
+		deployment.Spec.Template.Spec.Volumes,
+		ldapVolume,
+	)
+}
+
+// validateGrafanaAuth 验证Grafana认证配置
+func (r *MonitorStackReconciler) validateGrafanaAuth(auth *monitoringv1.GrafanaAuthSpec) error {
+	if auth == nil {
+		return nil
+	}
+
+	if oauth := auth.GenericOAuth; oauth != nil {
+		if oauth.ClientID == "" {
+			return fmt.Errorf("generic OAuth clientId cannot be empty")
+		}
+		if oauth.ClientSecret.Name == "" || oauth.ClientSecret.Key == "" {
+			return fmt.Errorf("generic OAuth clientSecret must reference a Secret name and key")
+		}
+		if oauth.AuthURL == "" || oauth.TokenURL == "" {
+			return fmt.Errorf("generic OAuth authUrl and tokenUrl cannot be empty")
+		}
+	}
+
+	if ldap := auth.LDAP; ldap != nil {
+		if ldap.Config.Name == "" || ldap.Config.Key == "" {
+			return fmt.Errorf("LDAP config must reference a Secret name and key")
+		}
+	}
+
+	// LDAP同样依赖登录表单，禁用登录表单时必须启用OAuth，否则无法登录
+	if auth.DisableLoginForm && auth.GenericOAuth == nil {
+		return fmt.Errorf("disableLoginForm requires genericOAuth to be configured")
+	}
+
+	return nil
+}
@@ -0,0 +1,329 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	monitoringv1 "github.com/ciliverse/monitor-operator/api/v1"
+)
+
+// grafana.ini配置 - 将GrafanaSpec.Config渲染为ConfigMap并挂载到Grafana容器
+
+const (
+	// grafanaIniPath grafana.ini在容器中的路径（Grafana默认配置路径）
+	grafanaIniPath = "/etc/grafana/grafana.ini"
+	// grafanaIniKey ConfigMap中grafana.ini的键名
+	grafanaIniKey = "grafana.ini"
+	// configHashAnnotation Pod模板上的配置哈希注解，配置变化时触发滚动更新
+	configHashAnnotation = "monitoring.cillian.website/config-hash"
+	// secretHashAnnotation Pod模板上引用的Secret的哈希注解，Secret轮换时触发滚动更新
+	secretHashAnnotation = "monitoring.cillian.website/secret-hash"
+)
+
+// envNameSanitizer 用于将section/key转换为合法的环境变量名
+var envNameSanitizer = regexp.MustCompile(`[^A-Za-z0-9]+`)
+
+// hasGrafanaIniConfig 判断是否需要生成grafana.ini
+func (r *MonitorStackReconciler) hasGrafanaIniConfig(monitorStack *monitoringv1.MonitorStack) bool {
+	return len(monitorStack.Spec.Grafana.Config) > 0 || len(monitorStack.Spec.Grafana.ConfigSecrets) > 0
+}
+
+// grafanaConfigSecretEnvName 获取Secret配置项对应的环境变量名
+// 命名规则: GRAFANA_INI_{SECTION}_{KEY}
+func grafanaConfigSecretEnvName(section, key string) string {
+	name := fmt.Sprintf("GRAFANA_INI_%s_%s", section, key)
+	return strings.ToUpper(envNameSanitizer.ReplaceAllString(name, "_"))
+}
+
+// buildGrafanaIni 构建grafana.ini内容
+// section和key按字母顺序输出，保证相同配置生成相同内容（配置哈希稳定）
+// Secret中的配置项通过Grafana的$__env{}语法引用环境变量，不会写入ConfigMap
+func (r *MonitorStackReconciler) buildGrafanaIni(monitorStack *monitoringv1.MonitorStack) string {
+	sections := map[string]map[string]string{}
+	for section, values := range monitorStack.Spec.Grafana.Config {
+		sections[section] = map[string]string{}
+		for k, v := range values {
+			sections[section][k] = v
+		}
+	}
+	for _, item := range monitorStack.Spec.Grafana.ConfigSecrets {
+		if sections[item.Section] == nil {
+			sections[item.Section] = map[string]string{}
+		}
+		sections[item.Section][item.Key] = fmt.Sprintf("$__env{%s}", grafanaConfigSecretEnvName(item.Section, item.Key))
+	}
+
+	names := make([]string, 0, len(sections))
+	for name := range sections {
+		names = append(names, name)
+	}
+	// 空section（全局配置项）必须位于文件开头
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString("# Managed by monitor-operator. DO NOT EDIT.\n")
+	for _, name := range names {
+		if name != "" {
+			fmt.Fprintf(&b, "\n[%s]\n", name)
+		}
+		keys := make([]string, 0, len(sections[name]))
+		for k := range sections[name] {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Fprintf(&b, "%s = %s\n", k, sections[name][k])
+		}
+	}
+
+	return b.String()
+}
+
+// buildGrafanaConfigSecretEnv 构建Secret配置项的环境变量
+func (r *MonitorStackReconciler) buildGrafanaConfigSecretEnv(monitorStack *monitoringv1.MonitorStack) []corev1.EnvVar {
+	env := make([]corev1.EnvVar, 0, len(monitorStack.Spec.Grafana.ConfigSecrets))
+	for _, item := range monitorStack.Spec.Grafana.ConfigSecrets {
+		env = append(env, corev1.EnvVar{
+			Name: grafanaConfigSecretEnvName(item.Section, item.Key),
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: item.SecretKeyRef.DeepCopy(),
+			},
+		})
+	}
+	return env
+}
+
+// createGrafanaConfigMap 创建grafana.ini ConfigMap
+func (r *MonitorStackReconciler) createGrafanaConfigMap(ctx context.Context, monitorStack *monitoringv1.MonitorStack) error {
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      r.getGrafanaConfigMapName(monitorStack),
+			Namespace: monitorStack.Namespace,
+			Labels:    r.getLabels(monitorStack, "grafana"),
+		},
+		Data: map[string]string{
+			grafanaIniKey: r.buildGrafanaIni(monitorStack),
+		},
+	}
+
+	// 设置OwnerReference
+	if err := controllerutil.SetControllerReference(monitorStack, configMap, r.Scheme); err != nil {
+		return err
+	}
+
+	// 创建或更新ConfigMap
+	existing := &corev1.ConfigMap{}
+	err := r.Get(ctx, types.NamespacedName{Name: configMap.Name, Namespace: configMap.Namespace}, existing)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return r.Create(ctx, configMap)
+		}
+		return err
+	}
+
+	// 更新现有ConfigMap
+	existing.Data = configMap.Data
+	return r.Update(ctx, existing)
+}
+
+// addGrafanaConfigVolume 添加grafana.ini配置卷
+// 使用subPath挂载单个文件，避免覆盖/etc/grafana目录下的其他文件；
+// subPath挂载不会自动更新，因此由Pod模板上的配置哈希（见getGrafanaConfigHash）触发滚动更新
+func (r *MonitorStackReconciler) addGrafanaConfigVolume(deployment *appsv1.Deployment, monitorStack *monitoringv1.MonitorStack) {
+	configVolumeMount := corev1.VolumeMount{
+		Name:      "grafana-config",
+		MountPath: grafanaIniPath,
+		SubPath:   grafanaIniKey,
+		ReadOnly:  true,
+	}
+
+	configVolume := corev1.Volume{
+		Name: "grafana-config",
+		VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{
+					Name: r.getGrafanaConfigMapName(monitorStack),
+				},
+			},
+		},
+	}
+
+	// 添加卷挂载和卷定义
+	deployment.Spec.Template.Spec.Containers[0].VolumeMounts = append(
+		deployment.Spec.Template.Spec.Containers[0].VolumeMounts,
+		configVolumeMount,
+	)
+	deployment.Spec.Template.Spec.Volumes = append(
+		deployment.Spec.Template.Spec.Volumes,
+		configVolume,
+	)
+}
+
+// getGrafanaConfigHash 计算Grafana配置哈希
+// grafana.ini和数据源配置都只在Grafana启动时读取，任一变化都需要重启Pod；
+// 两者都未配置时返回空字符串
+func (r *MonitorStackReconciler) getGrafanaConfigHash(monitorStack *monitoringv1.MonitorStack) (string, error) {
+	var data string
+	if r.hasGrafanaIniConfig(monitorStack) {
+		data += r.buildGrafanaIni(monitorStack)
+	}
+	if len(r.getGrafanaDatasources(monitorStack)) > 0 {
+		datasourcesConfig, err := r.buildGrafanaDatasourcesConfig(monitorStack)
+		if err != nil {
+			return "", err
+		}
+		data += datasourcesConfig
+	}
+	if data == "" {
+		return "", nil
+	}
+	return computeHash(data), nil
+}
+
+// getGrafanaSecretRefs 获取Grafana只在启动时读取的Secret键引用
+// 包括grafana.ini的configSecrets、数据源的secureJsonData、OAuth客户端密钥和LDAP配置文件
+func (r *MonitorStackReconciler) getGrafanaSecretRefs(monitorStack *monitoringv1.MonitorStack) []corev1.SecretKeySelector {
+	var refs []corev1.SecretKeySelector
+	if auth := monitorStack.Spec.Grafana.Auth; auth != nil {
+		if auth.GenericOAuth != nil {
+			refs = append(refs, auth.GenericOAuth.ClientSecret)
+		}
+		if auth.LDAP != nil {
+			refs = append(refs, auth.LDAP.Config)
+		}
+	}
+	for _, item := range monitorStack.Spec.Grafana.ConfigSecrets {
+		refs = append(refs, item.SecretKeyRef)
+	}
+	for _, ds := range r.getGrafanaDatasources(monitorStack) {
+		for _, key := range sortedSecureJSONDataKeys(ds.SecureJSONData) {
+			refs = append(refs, ds.SecureJSONData[key])
+		}
+	}
+	return refs
+}
+
+// getGrafanaSecretHash 计算Grafana引用的Secret键值的哈希，未引用Secret时返回空字符串
+// Secret或键不存在时容器无法启动，按空值计算，创建Secret后哈希变化触发滚动更新
+func (r *MonitorStackReconciler) getGrafanaSecretHash(ctx context.Context, monitorStack *monitoringv1.MonitorStack) (string, error) {
+	refs := r.getGrafanaSecretRefs(monitorStack)
+	if len(refs) == 0 {
+		return "", nil
+	}
+
+	secrets := map[string]*corev1.Secret{}
+	var b strings.Builder
+	for _, ref := range refs {
+		secret, ok := secrets[ref.Name]
+		if !ok {
+			secret = &corev1.Secret{}
+			err := r.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: monitorStack.Namespace}, secret)
+			if err != nil && !errors.IsNotFound(err) {
+				return "", err
+			}
+			secrets[ref.Name] = secret
+		}
+		fmt.Fprintf(&b, "%s/%s=%x\n", ref.Name, ref.Key, secret.Data[ref.Key])
+	}
+	return computeHash(b.String()), nil
+}
+
+// deleteGrafanaConfigMap 删除不再需要的grafana.ini ConfigMap
+func (r *MonitorStackReconciler) deleteGrafanaConfigMap(ctx context.Context, monitorStack *monitoringv1.MonitorStack) error {
+	return r.deleteOwnedObject(ctx, monitorStack, &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: r.getGrafanaConfigMapName(monitorStack), Namespace: monitorStack.Namespace},
+	})
+}
+
+// findMonitorStacksForSecret Secret变化后重新协调引用它的MonitorStack
+// 包括Grafana引用的Secret、Prometheus web配置引用的Secret以及联邦目标的web配置Secret
+// 只检查MonitorStack自身的spec，MonitorStackClass中引用的Secret在定期协调时更新
+func (r *MonitorStackReconciler) findMonitorStacksForSecret(ctx context.Context, obj client.Object) []reconcile.Request {
+	monitorStacks := &monitoringv1.MonitorStackList{}
+	if err := r.List(ctx, monitorStacks, client.InNamespace(obj.GetNamespace())); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list MonitorStacks for secret", "secret", obj.GetName())
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for i := range monitorStacks.Items {
+		monitorStack := &monitorStacks.Items[i]
+		refs := append(r.getGrafanaSecretRefs(monitorStack), r.getPrometheusWebSecretRefs(monitorStack)...)
+		for _, ref := range refs {
+			if ref.Name == obj.GetName() {
+				requests = append(requests, reconcile.Request{
+					NamespacedName: types.NamespacedName{Name: monitorStack.Name, Namespace: monitorStack.Namespace},
+				})
+				break
+			}
+		}
+	}
+	return append(requests, r.findMonitorStacksForFederationSecret(ctx, obj)...)
+}
+
+// validateGrafanaIniConfig 验证grafana.ini配置
+func (r *MonitorStackReconciler) validateGrafanaIniConfig(grafana monitoringv1.GrafanaSpec) error {
+	for section, values := range grafana.Config {
+		if strings.ContainsAny(section, "[]\n") {
+			return fmt.Errorf("invalid grafana.ini section name %q", section)
+		}
+		for k, v := range values {
+			if k == "" || strings.ContainsAny(k, "=\n") {
+				return fmt.Errorf("invalid grafana.ini key %q in section %q", k, section)
+			}
+			if strings.Contains(v, "\n") {
+				return fmt.Errorf("grafana.ini value for %s.%s cannot contain newlines", section, k)
+			}
+		}
+	}
+
+	envNames := map[string]string{}
+	for i, item := range grafana.ConfigSecrets {
+		if item.Key == "" {
+			return fmt.Errorf("configSecrets[%d] key cannot be empty", i)
+		}
+		if item.SecretKeyRef.Name == "" || item.SecretKeyRef.Key == "" {
+			return fmt.Errorf("configSecrets[%d] must reference a Secret name and key", i)
+		}
+		if _, ok := grafana.Config[item.Section][item.Key]; ok {
+			return fmt.Errorf("grafana.ini key %s.%s is set in both config and configSecrets", item.Section, item.Key)
+		}
+		// 特殊字符都转换为下划线，不同的section和key可能映射到相同的环境变量名
+		envName := grafanaConfigSecretEnvName(item.Section, item.Key)
+		if owner, ok := envNames[envName]; ok {
+			return fmt.Errorf("configSecrets[%d] %s.%s conflicts with %s", i, item.Section, item.Key, owner)
+		}
+		envNames[envName] = item.Section + "." + item.Key
+	}
+
+	return nil
+}
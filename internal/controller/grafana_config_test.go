@@ -0,0 +1,135 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	monitoringv1 "github.com/ciliverse/monitor-operator/api/v1"
+)
+
+var _ = Describe("Grafana ini config", func() {
+	r := &MonitorStackReconciler{}
+
+	DescribeTable("buildGrafanaIni",
+		func(config map[string]map[string]string, secrets []monitoringv1.GrafanaConfigSecret, expected string) {
+			monitorStack := newTestMonitorStack()
+			monitorStack.Spec.Grafana.Config = config
+			monitorStack.Spec.Grafana.ConfigSecrets = secrets
+			Expect(r.buildGrafanaIni(monitorStack)).To(Equal(expected))
+		},
+		Entry("renders only the header without config", nil, nil,
+			"# Managed by monitor-operator. DO NOT EDIT.\n"),
+		Entry("sorts sections and keys with global keys first",
+			map[string]map[string]string{
+				"server": {"root_url": "https://grafana.example.com", "domain": "grafana.example.com"},
+				"":       {"instance_name": "grafana"},
+				"auth":   {"disable_signout_menu": "true"},
+			}, nil,
+			"# Managed by monitor-operator. DO NOT EDIT.\n"+
+				"instance_name = grafana\n"+
+				"\n[auth]\ndisable_signout_menu = true\n"+
+				"\n[server]\ndomain = grafana.example.com\nroot_url = https://grafana.example.com\n"),
+		Entry("references secret values through environment variables",
+			map[string]map[string]string{"smtp": {"enabled": "true"}},
+			[]monitoringv1.GrafanaConfigSecret{
+				{Section: "smtp", Key: "password", SecretKeyRef: secretKey("smtp", "password")},
+			},
+			"# Managed by monitor-operator. DO NOT EDIT.\n"+
+				"\n[smtp]\nenabled = true\npassword = $__env{GRAFANA_INI_SMTP_PASSWORD}\n"),
+	)
+
+	DescribeTable("validateGrafanaIniConfig",
+		func(config map[string]map[string]string, secrets []monitoringv1.GrafanaConfigSecret, expectedError string) {
+			err := r.validateGrafanaIniConfig(monitoringv1.GrafanaSpec{Config: config, ConfigSecrets: secrets})
+			if expectedError == "" {
+				Expect(err).NotTo(HaveOccurred())
+			} else {
+				Expect(err).To(MatchError(ContainSubstring(expectedError)))
+			}
+		},
+		Entry("accepts a valid config", map[string]map[string]string{"server": {"domain": "example.com"}}, nil, ""),
+		Entry("rejects brackets in section names", map[string]map[string]string{"a]b": {"k": "v"}}, nil,
+			"invalid grafana.ini section name"),
+		Entry("rejects '=' in keys", map[string]map[string]string{"server": {"a=b": "v"}}, nil,
+			"invalid grafana.ini key"),
+		Entry("rejects newlines in values", map[string]map[string]string{"server": {"domain": "a\nb"}}, nil,
+			"cannot contain newlines"),
+		Entry("requires a key for secret items", nil,
+			[]monitoringv1.GrafanaConfigSecret{{Section: "smtp", SecretKeyRef: secretKey("smtp", "password")}},
+			"key cannot be empty"),
+		Entry("requires a Secret reference", nil,
+			[]monitoringv1.GrafanaConfigSecret{{Section: "smtp", Key: "password"}},
+			"must reference a Secret name and key"),
+		Entry("rejects keys set in both config and configSecrets",
+			map[string]map[string]string{"smtp": {"password": "plain"}},
+			[]monitoringv1.GrafanaConfigSecret{{Section: "smtp", Key: "password", SecretKeyRef: secretKey("smtp", "password")}},
+			"is set in both config and configSecrets"),
+		Entry("rejects items mapping to the same environment variable", nil,
+			[]monitoringv1.GrafanaConfigSecret{
+				{Section: "auth.generic_oauth", Key: "client_secret", SecretKeyRef: secretKey("oauth", "secret")},
+				{Section: "auth", Key: "generic_oauth_client_secret", SecretKeyRef: secretKey("oauth", "other")},
+			},
+			"auth.generic_oauth_client_secret conflicts with auth.generic_oauth.client_secret"),
+	)
+
+	It("changes the secret hash when a referenced Secret is rotated", func() {
+		ctx := context.Background()
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "smtp", Namespace: "monitoring"},
+			Data:       map[string][]byte{"password": []byte("old")},
+		}
+		reconciler := &MonitorStackReconciler{
+			Client: fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(secret).Build(),
+		}
+
+		monitorStack := newTestMonitorStack()
+		Expect(reconciler.getGrafanaSecretHash(ctx, monitorStack)).To(BeEmpty())
+
+		monitorStack.Spec.Grafana.ConfigSecrets = []monitoringv1.GrafanaConfigSecret{
+			{Section: "smtp", Key: "password", SecretKeyRef: secretKey("smtp", "password")},
+		}
+		before, err := reconciler.getGrafanaSecretHash(ctx, monitorStack)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(before).NotTo(BeEmpty())
+
+		secret.Data["password"] = []byte("new")
+		Expect(reconciler.Update(ctx, secret)).To(Succeed())
+		after, err := reconciler.getGrafanaSecretHash(ctx, monitorStack)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(after).NotTo(Equal(before))
+	})
+
+	It("includes the OAuth client secret and LDAP config in the secret hash", func() {
+		monitorStack := newTestMonitorStack()
+		monitorStack.Spec.Grafana.Auth = &monitoringv1.GrafanaAuthSpec{
+			GenericOAuth: &monitoringv1.GrafanaGenericOAuthSpec{ClientSecret: secretKey("oauth", "client-secret")},
+			LDAP:         &monitoringv1.GrafanaLDAPSpec{Config: secretKey("ldap", "ldap.toml")},
+		}
+		Expect(r.getGrafanaSecretRefs(monitorStack)).To(Equal([]corev1.SecretKeySelector{
+			secretKey("oauth", "client-secret"),
+			secretKey("ldap", "ldap.toml"),
+		}))
+	})
+})
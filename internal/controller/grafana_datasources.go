@@ -0,0 +1,311 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+
+	monitoringv1 "github.com/ciliverse/monitor-operator/api/v1"
+)
+
+// Grafana数据源供应 - 生成/etc/grafana/provisioning/datasources下的配置文件
+// 参考: https://grafana.com/docs/grafana/latest/administration/provisioning/#data-sources
+
+// grafanaDatasourcesFile Grafana数据源供应文件
+type grafanaDatasourcesFile struct {
+	APIVersion  int                 `json:"apiVersion"`
+	Datasources []grafanaDatasource `json:"datasources"`
+}
+
+// grafanaDatasource Grafana数据源供应文件中的单个数据源
+type grafanaDatasource struct {
+	Name           string            `json:"name"`
+	Type           string            `json:"type"`
+	UID            string            `json:"uid,omitempty"`
+	URL            string            `json:"url"`
+	Access         string            `json:"access"`
+	IsDefault      bool              `json:"isDefault"`
+	Editable       bool              `json:"editable"`
+	OrgID          int64             `json:"orgId,omitempty"`
+	BasicAuth      bool              `json:"basicAuth,omitempty"`
+	BasicAuthUser  string            `json:"basicAuthUser,omitempty"`
+	JSONData       json.RawMessage   `json:"jsonData,omitempty"`
+	SecureJSONData map[string]string `json:"secureJsonData,omitempty"`
+}
+
+// grafanaDatasourceSecretEnvName 获取secureJsonData配置项对应的环境变量名
+// 命名规则: GRAFANA_DS_{数据源名称}_{KEY}
+func grafanaDatasourceSecretEnvName(datasource, key string) string {
+	name := fmt.Sprintf("GRAFANA_DS_%s_%s", datasource, key)
+	return strings.ToUpper(envNameSanitizer.ReplaceAllString(name, "_"))
+}
+
+// sortedSecureJSONDataKeys 按字母顺序返回secureJsonData的键，保证生成结果稳定
+func sortedSecureJSONDataKeys(secureJSONData map[string]corev1.SecretKeySelector) []string {
+	keys := make([]string, 0, len(secureJSONData))
+	for k := range secureJSONData {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// isServiceURL 判断数据源URL是否指向指定的集群内Service
+// 兼容svc、svc.ns、svc.ns.svc、svc.ns.svc.cluster.local等集群内地址写法
+func isServiceURL(rawURL, service, namespace string, expectedPort int32) bool {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || u.Host == "" {
+		return false
+	}
+
+	port := u.Port()
+	if port == "" {
+		if u.Scheme == "https" {
+			port = "443"
+		} else {
+			port = "80"
+		}
+	}
+	if port != fmt.Sprintf("%d", expectedPort) {
+		return false
+	}
+
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	for _, candidate := range []string{
+		service,
+		service + "." + namespace,
+		service + "." + namespace + ".svc",
+		service + "." + namespace + ".svc.cluster.local",
+	} {
+		if host == candidate {
+			return true
+		}
+	}
+	return false
+}
+
+// isPrometheusServiceURL 判断数据源URL是否指向栈内Prometheus Service
+func (r *MonitorStackReconciler) isPrometheusServiceURL(monitorStack *monitoringv1.MonitorStack, rawURL string) bool {
+	expectedPort := monitorStack.Spec.Prometheus.Service.Port
+	if expectedPort == 0 {
+		expectedPort = 9090
+	}
+	return isServiceURL(rawURL, r.getPrometheusServiceName(monitorStack), monitorStack.Namespace, expectedPort)
+}
+
+// autoDatasourceUID 根据名称生成自动注册数据源的UID，Grafana限制UID最长40个字符
+func autoDatasourceUID(name string) string {
+	uid := strings.Trim(envNameSanitizer.ReplaceAllString(name, "-"), "-")
+	if len(uid) > 40 {
+		uid = uid[:40]
+	}
+	return uid
+}
+
+// getGrafanaDatasources 获取Grafana实际使用的数据源列表
+// 未设置disableAutoDatasource时，自动追加指向栈内Prometheus和Loki的数据源；
+// 用户已配置相同地址的数据源时不再重复添加。自动注册的数据源不设置isDefault，
+// 用户数据源中没有默认数据源时由buildGrafanaDatasourcesConfig选择第一个Prometheus类型的数据源，
+// 用户的数据源排在前面，升级后原有的默认数据源保持不变
+func (r *MonitorStackReconciler) getGrafanaDatasources(monitorStack *monitoringv1.MonitorStack) []monitoringv1.DatasourceSpec {
+	datasources := monitorStack.Spec.Grafana.Datasources
+	if monitorStack.Spec.Grafana.DisableAutoDatasource {
+		return datasources
+	}
+
+	result := r.appendPrometheusDatasources(monitorStack, datasources)
+	if loki := r.buildLokiDatasource(monitorStack, datasources); loki != nil {
+		// 限制容量，避免追加时修改spec中的切片
+		result = append(result[:len(result):len(result)], *loki)
+	}
+	return result
+}
+
+// appendPrometheusDatasources 追加指向栈内Prometheus的数据源
+// agent模式的Prometheus不提供查询，不自动注册；分片时为每个分片注册数据源，可以通过Grafana的Mixed数据源汇总查询
+func (r *MonitorStackReconciler) appendPrometheusDatasources(monitorStack *monitoringv1.MonitorStack, datasources []monitoringv1.DatasourceSpec) []monitoringv1.DatasourceSpec {
+	if !monitorStack.Spec.Prometheus.Enabled || isPrometheusAgentMode(monitorStack) {
+		return datasources
+	}
+
+	for _, ds := range datasources {
+		if r.isPrometheusServiceURL(monitorStack, ds.URL) {
+			return datasources
+		}
+	}
+
+	// 协议和认证与Prometheus的web配置保持一致，各分片使用相同的web配置
+	shards := getPrometheusShards(monitorStack)
+	result := make([]monitoringv1.DatasourceSpec, 0, len(datasources)+int(shards)+1)
+	result = append(result, datasources...)
+	for shard := int32(0); shard < shards; shard++ {
+		name := r.getPrometheusShardName(monitorStack, shard)
+		ds := monitoringv1.DatasourceSpec{
+			Name:   name,
+			Type:   "prometheus",
+			UID:    autoDatasourceUID(name),
+			URL:    r.getPrometheusShardURL(monitorStack, shard),
+			Access: "proxy",
+		}
+		applyPrometheusWebDatasource(&ds, monitorStack)
+		result = append(result, ds)
+	}
+	return result
+}
+
+// buildGrafanaDatasourcesConfig 构建Grafana数据源配置
+// 通过YAML序列化生成配置，避免名称等字段中的特殊字符破坏文件格式；
+// secureJsonData的值通过Grafana供应文件的环境变量展开（${VAR}）注入，不会写入ConfigMap
+func (r *MonitorStackReconciler) buildGrafanaDatasourcesConfig(monitorStack *monitoringv1.MonitorStack) (string, error) {
+	datasources := r.getGrafanaDatasources(monitorStack)
+
+	// 未显式指定默认数据源时，第一个Prometheus类型的数据源设为默认
+	defaultIndex := -1
+	for i, ds := range datasources {
+		if ds.IsDefault {
+			defaultIndex = i
+			break
+		}
+	}
+	if defaultIndex < 0 {
+		for i, ds := range datasources {
+			if ds.Type == "prometheus" {
+				defaultIndex = i
+				break
+			}
+		}
+	}
+
+	file := grafanaDatasourcesFile{
+		APIVersion:  1,
+		Datasources: make([]grafanaDatasource, 0, len(datasources)),
+	}
+	for i, ds := range datasources {
+		access := ds.Access
+		if access == "" {
+			access = "proxy"
+		}
+
+		item := grafanaDatasource{
+			Name:          ds.Name,
+			Type:          ds.Type,
+			UID:           ds.UID,
+			URL:           ds.URL,
+			Access:        access,
+			IsDefault:     i == defaultIndex,
+			Editable:      ds.Editable,
+			OrgID:         ds.OrgID,
+			BasicAuth:     ds.BasicAuth,
+			BasicAuthUser: ds.BasicAuthUser,
+		}
+		if ds.JSONData != nil && len(ds.JSONData.Raw) > 0 {
+			if !json.Valid(ds.JSONData.Raw) {
+				return "", fmt.Errorf("datasource %q has invalid jsonData", ds.Name)
+			}
+			item.JSONData = json.RawMessage(ds.JSONData.Raw)
+		}
+		if len(ds.SecureJSONData) > 0 {
+			item.SecureJSONData = map[string]string{}
+			for _, key := range sortedSecureJSONDataKeys(ds.SecureJSONData) {
+				item.SecureJSONData[key] = fmt.Sprintf("${%s}", grafanaDatasourceSecretEnvName(ds.Name, key))
+			}
+		}
+
+		file.Datasources = append(file.Datasources, item)
+	}
+
+	out, err := yaml.Marshal(file)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal Grafana datasources: %w", err)
+	}
+	return string(out), nil
+}
+
+// buildGrafanaDatasourceSecretEnv 构建secureJsonData引用的环境变量
+func (r *MonitorStackReconciler) buildGrafanaDatasourceSecretEnv(monitorStack *monitoringv1.MonitorStack) []corev1.EnvVar {
+	var env []corev1.EnvVar
+	for _, ds := range r.getGrafanaDatasources(monitorStack) {
+		for _, key := range sortedSecureJSONDataKeys(ds.SecureJSONData) {
+			ref := ds.SecureJSONData[key]
+			env = append(env, corev1.EnvVar{
+				Name: grafanaDatasourceSecretEnvName(ds.Name, key),
+				ValueFrom: &corev1.EnvVarSource{
+					SecretKeyRef: ref.DeepCopy(),
+				},
+			})
+		}
+	}
+	return env
+}
+
+// validateGrafanaDatasources 验证Grafana数据源配置
+func (r *MonitorStackReconciler) validateGrafanaDatasources(datasources []monitoringv1.DatasourceSpec) error {
+	names := map[string]bool{}
+	uids := map[string]bool{}
+	envNames := map[string]string{}
+	defaults := 0
+
+	for i, ds := range datasources {
+		if names[ds.Name] {
+			return fmt.Errorf("datasource name %q is used more than once", ds.Name)
+		}
+		names[ds.Name] = true
+
+		if ds.UID != "" {
+			if uids[ds.UID] {
+				return fmt.Errorf("datasource uid %q is used more than once", ds.UID)
+			}
+			uids[ds.UID] = true
+		}
+
+		if ds.IsDefault {
+			defaults++
+		}
+
+		if ds.JSONData != nil && len(ds.JSONData.Raw) > 0 {
+			var obj map[string]interface{}
+			if err := json.Unmarshal(ds.JSONData.Raw, &obj); err != nil {
+				return fmt.Errorf("datasource[%d] jsonData must be an object: %w", i, err)
+			}
+		}
+
+		for key, ref := range ds.SecureJSONData {
+			if ref.Name == "" || ref.Key == "" {
+				return fmt.Errorf("datasource[%d] secureJsonData.%s must reference a Secret name and key", i, key)
+			}
+			// 不同数据源的名称可能映射到相同的环境变量名
+			envName := grafanaDatasourceSecretEnvName(ds.Name, key)
+			if owner, ok := envNames[envName]; ok {
+				return fmt.Errorf("datasource %q secureJsonData.%s conflicts with datasource %q", ds.Name, key, owner)
+			}
+			envNames[envName] = ds.Name
+		}
+	}
+
+	if defaults > 1 {
+		return fmt.Errorf("only one datasource can be marked as default, got %d", defaults)
+	}
+
+	return nil
+}
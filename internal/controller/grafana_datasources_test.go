@@ -0,0 +1,175 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/yaml"
+
+	monitoringv1 "github.com/ciliverse/monitor-operator/api/v1"
+)
+
+var _ = Describe("Grafana datasources", func() {
+	r := &MonitorStackReconciler{}
+
+	DescribeTable("validateGrafanaDatasources",
+		func(datasources []monitoringv1.DatasourceSpec, expectedError string) {
+			err := r.validateGrafanaDatasources(datasources)
+			if expectedError == "" {
+				Expect(err).NotTo(HaveOccurred())
+			} else {
+				Expect(err).To(MatchError(ContainSubstring(expectedError)))
+			}
+		},
+		Entry("accepts distinct datasources", []monitoringv1.DatasourceSpec{
+			{Name: "a", Type: "prometheus", UID: "a", URL: "http://a", IsDefault: true},
+			{Name: "b", Type: "loki", UID: "b", URL: "http://b"},
+		}, ""),
+		Entry("rejects duplicate names", []monitoringv1.DatasourceSpec{
+			{Name: "a", Type: "prometheus", URL: "http://a"},
+			{Name: "a", Type: "loki", URL: "http://b"},
+		}, `datasource name "a" is used more than once`),
+		Entry("rejects duplicate uids", []monitoringv1.DatasourceSpec{
+			{Name: "a", Type: "prometheus", UID: "x", URL: "http://a"},
+			{Name: "b", Type: "loki", UID: "x", URL: "http://b"},
+		}, `datasource uid "x" is used more than once`),
+		Entry("rejects more than one default", []monitoringv1.DatasourceSpec{
+			{Name: "a", Type: "prometheus", URL: "http://a", IsDefault: true},
+			{Name: "b", Type: "prometheus", URL: "http://b", IsDefault: true},
+		}, "only one datasource can be marked as default"),
+		Entry("rejects jsonData that is not an object", []monitoringv1.DatasourceSpec{
+			{Name: "a", Type: "prometheus", URL: "http://a", JSONData: &runtime.RawExtension{Raw: []byte(`[1]`)}},
+		}, "jsonData must be an object"),
+		Entry("requires secureJsonData to reference a Secret key", []monitoringv1.DatasourceSpec{
+			{Name: "a", Type: "prometheus", URL: "http://a",
+				SecureJSONData: map[string]corev1.SecretKeySelector{"password": {}}},
+		}, "secureJsonData.password must reference a Secret name and key"),
+		Entry("rejects names mapping to the same environment variable", []monitoringv1.DatasourceSpec{
+			{Name: "a-b", Type: "prometheus", URL: "http://a",
+				SecureJSONData: map[string]corev1.SecretKeySelector{"password": secretKey("s", "p")}},
+			{Name: "a_b", Type: "prometheus", URL: "http://b",
+				SecureJSONData: map[string]corev1.SecretKeySelector{"password": secretKey("s", "p")}},
+		}, "conflicts with datasource"),
+		Entry("rejects keys of one datasource mapping to the same environment variable", []monitoringv1.DatasourceSpec{
+			{Name: "a", Type: "prometheus", URL: "http://a",
+				SecureJSONData: map[string]corev1.SecretKeySelector{
+					"tls.ca": secretKey("s", "ca"),
+					"tls_ca": secretKey("s", "ca"),
+				}},
+		}, `conflicts with datasource "a"`),
+	)
+
+	It("refuses two user datasources marked as default during validation", func() {
+		monitorStack := newTestMonitorStack()
+		monitorStack.Spec.Grafana.Datasources = []monitoringv1.DatasourceSpec{
+			{Name: "a", Type: "prometheus", URL: "http://a", IsDefault: true},
+			{Name: "b", Type: "prometheus", URL: "http://b", IsDefault: true},
+		}
+		Expect(r.validateMonitorStack(monitorStack)).To(MatchError(ContainSubstring("only one datasource can be marked as default")))
+	})
+
+	It("provisions secureJsonData through environment variables", func() {
+		monitorStack := newTestMonitorStack()
+		monitorStack.Spec.Grafana.DisableAutoDatasource = true
+		monitorStack.Spec.Grafana.Datasources = []monitoringv1.DatasourceSpec{
+			{
+				Name:          "elastic",
+				Type:          "elasticsearch",
+				URL:           "http://elasticsearch:9200",
+				BasicAuth:     true,
+				BasicAuthUser: "grafana",
+				JSONData:      &runtime.RawExtension{Raw: []byte(`{"index":"logs-*"}`)},
+				SecureJSONData: map[string]corev1.SecretKeySelector{
+					"basicAuthPassword": secretKey("es", "password"),
+				},
+			},
+		}
+
+		out, err := r.buildGrafanaDatasourcesConfig(monitorStack)
+		Expect(err).NotTo(HaveOccurred())
+		file := grafanaDatasourcesFile{}
+		Expect(yaml.Unmarshal([]byte(out), &file)).To(Succeed())
+		Expect(file.Datasources).To(HaveLen(1))
+		ds := file.Datasources[0]
+		Expect(ds.Access).To(Equal("proxy"))
+		Expect(ds.BasicAuthUser).To(Equal("grafana"))
+		Expect(string(ds.JSONData)).To(MatchJSON(`{"index":"logs-*"}`))
+		Expect(ds.SecureJSONData).To(Equal(map[string]string{
+			"basicAuthPassword": "${GRAFANA_DS_ELASTIC_BASICAUTHPASSWORD}",
+		}))
+
+		env := r.buildGrafanaDatasourceSecretEnv(monitorStack)
+		Expect(env).To(HaveLen(1))
+		Expect(env[0].Name).To(Equal("GRAFANA_DS_ELASTIC_BASICAUTHPASSWORD"))
+		Expect(env[0].ValueFrom.SecretKeyRef.Name).To(Equal("es"))
+	})
+})
+
+var _ = Describe("Auto-registered Prometheus datasource", func() {
+	r := &MonitorStackReconciler{}
+
+	defaultName := func(out string) string {
+		file := grafanaDatasourcesFile{}
+		Expect(yaml.Unmarshal([]byte(out), &file)).To(Succeed())
+		for _, ds := range file.Datasources {
+			if ds.IsDefault {
+				return ds.Name
+			}
+		}
+		return ""
+	}
+
+	It("becomes the default only when no user Prometheus datasource exists", func() {
+		monitorStack := newTestMonitorStack()
+		out, err := r.buildGrafanaDatasourcesConfig(monitorStack)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(defaultName(out)).To(Equal("test-prometheus"))
+	})
+
+	It("keeps the user's first Prometheus datasource as the default", func() {
+		monitorStack := newTestMonitorStack()
+		monitorStack.Spec.Grafana.Datasources = []monitoringv1.DatasourceSpec{
+			{Name: "loki", Type: "loki", URL: "http://loki:3100"},
+			{Name: "central", Type: "prometheus", URL: "http://thanos:9090"},
+		}
+		datasources := r.getGrafanaDatasources(monitorStack)
+		Expect(datasources).To(HaveLen(3))
+		Expect(datasources[2].Name).To(Equal("test-prometheus"))
+		Expect(datasources[2].IsDefault).To(BeFalse())
+
+		out, err := r.buildGrafanaDatasourcesConfig(monitorStack)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(defaultName(out)).To(Equal("central"))
+	})
+
+	It("is not added when a user datasource targets the same Service", func() {
+		monitorStack := newTestMonitorStack()
+		monitorStack.Spec.Grafana.Datasources = []monitoringv1.DatasourceSpec{
+			{Name: "prometheus", Type: "prometheus", URL: "http://test-prometheus.monitoring.svc.cluster.local:9090"},
+		}
+		Expect(r.getGrafanaDatasources(monitorStack)).To(HaveLen(1))
+	})
+
+	It("is not added when disabled", func() {
+		monitorStack := newTestMonitorStack()
+		monitorStack.Spec.Grafana.DisableAutoDatasource = true
+		Expect(r.getGrafanaDatasources(monitorStack)).To(BeEmpty())
+	})
+})
@@ -0,0 +1,221 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	monitoringv1 "github.com/ciliverse/monitor-operator/api/v1"
+)
+
+// Grafana插件管理 - 通过init容器在Grafana启动前安装插件，并将安装结果回报到状态中
+
+const (
+	// grafanaPluginsInitContainerName 插件安装init容器名称
+	grafanaPluginsInitContainerName = "install-plugins"
+	// grafanaPluginsDir 插件目录，与GF_PATHS_PLUGINS保持一致
+	grafanaPluginsDir = "/var/lib/grafana/plugins"
+)
+
+var (
+	// grafanaPluginIDPattern 插件ID的合法字符，与CRD校验规则一致
+	grafanaPluginIDPattern = regexp.MustCompile(`^[a-zA-Z0-9._-]+$`)
+	// grafanaPluginVersionPattern 插件版本的合法字符，与CRD校验规则一致
+	grafanaPluginVersionPattern = regexp.MustCompile(`^[a-zA-Z0-9.+-]+$`)
+)
+
+// shellQuote 使用单引号转义shell参数
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'"'"'`) + "'"
+}
+
+// buildGrafanaPluginsScript 构建插件安装脚本
+// termination log最多4096字节，只写入请求的插件: 安装成功的写入"<id> @ <版本>"，失败的写入"<id> failed"；
+// 任一插件安装失败时init容器以非零状态退出，Grafana不会在缺少插件的情况下启动
+func (r *MonitorStackReconciler) buildGrafanaPluginsScript(monitorStack *monitoringv1.MonitorStack) string {
+	grafana := monitorStack.Spec.Grafana
+	cli := fmt.Sprintf("grafana cli --pluginsDir %s", grafanaPluginsDir)
+
+	lines := []string{"failed=0", ": > /dev/termination-log"}
+	ids := make([]string, 0, len(grafana.Plugins))
+	for _, plugin := range grafana.Plugins {
+		cmd := cli
+		switch {
+		case plugin.URL != "":
+			// 直接从URL下载插件zip包
+			cmd += " --pluginUrl " + shellQuote(plugin.URL)
+		case grafana.PluginRepositoryURL != "":
+			// 使用内部插件仓库镜像
+			cmd += " --repo " + shellQuote(grafana.PluginRepositoryURL)
+		}
+		cmd += " plugins install " + shellQuote(plugin.ID)
+		if plugin.Version != "" && plugin.URL == "" {
+			cmd += " " + shellQuote(plugin.Version)
+		}
+		lines = append(lines, fmt.Sprintf("%s || { echo %s >> /dev/termination-log; failed=1; }",
+			cmd, shellQuote(plugin.ID+" failed")))
+		ids = append(ids, regexp.QuoteMeta(plugin.ID))
+	}
+	lines = append(lines,
+		fmt.Sprintf("%s plugins ls | grep -E %s >> /dev/termination-log || true",
+			cli, shellQuote("^("+strings.Join(ids, "|")+") @ ")),
+		"exit $failed",
+	)
+
+	return strings.Join(lines, "\n")
+}
+
+// addGrafanaPluginsInitContainer 添加插件安装init容器
+// init容器与Grafana容器共享grafana-storage卷，插件安装到其中的plugins目录；
+// 插件列表变化会改变Pod模板，从而触发滚动更新
+func (r *MonitorStackReconciler) addGrafanaPluginsInitContainer(deployment *appsv1.Deployment, monitorStack *monitoringv1.MonitorStack) {
+	grafanaContainer := deployment.Spec.Template.Spec.Containers[0]
+
+	initContainer := corev1.Container{
+		Name:    grafanaPluginsInitContainerName,
+		Image:   grafanaContainer.Image,
+		Command: []string{"/bin/sh", "-c"},
+		Args:    []string{r.buildGrafanaPluginsScript(monitorStack)},
+		VolumeMounts: []corev1.VolumeMount{
+			{
+				Name:      "grafana-storage",
+				MountPath: "/var/lib/grafana",
+			},
+			{
+				// 插件下载时使用的临时目录
+				Name:      "tmp",
+				MountPath: "/tmp",
+			},
+		},
+		Resources:                grafanaContainer.Resources,
+		SecurityContext:          r.buildContainerSecurityContext(monitorStack.Spec.Grafana.Security),
+		TerminationMessagePolicy: corev1.TerminationMessageReadFile,
+	}
+
+	deployment.Spec.Template.Spec.InitContainers = append(deployment.Spec.Template.Spec.InitContainers, initContainer)
+}
+
+// parseGrafanaPluginList 解析插件安装init容器的termination message
+// 每行一个插件: 安装成功为"<id> @ <version>"，安装失败为"<id> failed"
+// 返回安装成功的插件版本和安装失败的插件
+func parseGrafanaPluginList(output string) (map[string]string, map[string]bool) {
+	installed := map[string]string{}
+	failed := map[string]bool{}
+	for _, line := range strings.Split(output, "\n") {
+		if id, found := strings.CutSuffix(strings.TrimSpace(line), " failed"); found {
+			failed[id] = true
+			continue
+		}
+		id, version, found := strings.Cut(line, " @ ")
+		if !found {
+			continue
+		}
+		installed[strings.TrimSpace(id)] = strings.TrimSpace(version)
+	}
+	return installed, failed
+}
+
+// updateGrafanaPluginStatus 更新Grafana插件安装状态
+// 从最新的Grafana Pod的init容器termination message中读取实际安装的插件版本和安装失败的插件
+func (r *MonitorStackReconciler) updateGrafanaPluginStatus(ctx context.Context, monitorStack *monitoringv1.MonitorStack) error {
+	if len(monitorStack.Spec.Grafana.Plugins) == 0 {
+		monitorStack.Status.GrafanaPlugins = nil
+		return nil
+	}
+
+	pods := &corev1.PodList{}
+	if err := r.List(ctx, pods,
+		client.InNamespace(monitorStack.Namespace),
+		client.MatchingLabels(r.getLabels(monitorStack, "grafana")),
+	); err != nil {
+		return err
+	}
+
+	// 选择最新创建且插件安装容器已结束的Pod
+	var installed map[string]string
+	var failed map[string]bool
+	var newest *corev1.Pod
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.DeletionTimestamp != nil {
+			continue
+		}
+		for _, cs := range pod.Status.InitContainerStatuses {
+			// 安装失败后init容器会重启，上一次的结果保存在LastTerminationState中
+			terminated := cs.State.Terminated
+			if terminated == nil {
+				terminated = cs.LastTerminationState.Terminated
+			}
+			if cs.Name != grafanaPluginsInitContainerName || terminated == nil {
+				continue
+			}
+			if newest == nil || newest.CreationTimestamp.Before(&pod.CreationTimestamp) {
+				newest = pod
+				installed, failed = parseGrafanaPluginList(terminated.Message)
+			}
+		}
+	}
+
+	statuses := make([]monitoringv1.PluginStatus, 0, len(monitorStack.Spec.Grafana.Plugins))
+	for _, plugin := range monitorStack.Spec.Grafana.Plugins {
+		version, ok := installed[plugin.ID]
+		status := monitoringv1.PluginStatus{
+			ID:        plugin.ID,
+			Version:   version,
+			Installed: ok,
+		}
+		if failed[plugin.ID] {
+			status.Message = "Install failed"
+		}
+		statuses = append(statuses, status)
+	}
+	monitorStack.Status.GrafanaPlugins = statuses
+
+	return nil
+}
+
+// validateGrafanaPlugins 验证Grafana插件配置
+func (r *MonitorStackReconciler) validateGrafanaPlugins(grafana monitoringv1.GrafanaSpec) error {
+	seen := map[string]bool{}
+	for i, plugin := range grafana.Plugins {
+		if plugin.ID == "" {
+			return fmt.Errorf("plugins[%d] id cannot be empty", i)
+		}
+		// 插件ID和版本会拼接到安装脚本中，不依赖CRD校验再次检查
+		if !grafanaPluginIDPattern.MatchString(plugin.ID) {
+			return fmt.Errorf("plugins[%d] id %q contains invalid characters", i, plugin.ID)
+		}
+		if plugin.Version != "" && !grafanaPluginVersionPattern.MatchString(plugin.Version) {
+			return fmt.Errorf("plugin %q version %q contains invalid characters", plugin.ID, plugin.Version)
+		}
+		if seen[plugin.ID] {
+			return fmt.Errorf("plugin %q is listed more than once", plugin.ID)
+		}
+		seen[plugin.ID] = true
+		if plugin.URL != "" && plugin.Version != "" {
+			return fmt.Errorf("plugin %q cannot set both url and version", plugin.ID)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	monitoringv1 "github.com/ciliverse/monitor-operator/api/v1"
+)
+
+var _ = Describe("Grafana plugins", func() {
+	r := &MonitorStackReconciler{}
+
+	It("writes only the requested plugins to the termination log", func() {
+		monitorStack := newTestMonitorStack()
+		monitorStack.Spec.Grafana.Plugins = []monitoringv1.GrafanaPluginSpec{
+			{ID: "grafana-piechart-panel", Version: "1.6.4"},
+			{ID: "custom.panel", URL: "https://example.com/custom.zip"},
+		}
+
+		script := r.buildGrafanaPluginsScript(monitorStack)
+		Expect(script).To(ContainSubstring(
+			"plugins install 'grafana-piechart-panel' '1.6.4' || { echo 'grafana-piechart-panel failed' >> /dev/termination-log; failed=1; }"))
+		Expect(script).To(ContainSubstring("--pluginUrl 'https://example.com/custom.zip' plugins install 'custom.panel' ||"))
+		Expect(script).To(ContainSubstring(`plugins ls | grep -E '^(grafana-piechart-panel|custom\.panel) @ ' >> /dev/termination-log`))
+		Expect(script).NotTo(ContainSubstring("plugins ls > /dev/termination-log"))
+		Expect(script).To(HaveSuffix("exit $failed"))
+	})
+
+	It("parses installed versions and failed plugins", func() {
+		installed, failed := parseGrafanaPluginList("grafana-piechart-panel @ 1.6.4\ncustom.panel failed\n")
+		Expect(installed).To(Equal(map[string]string{"grafana-piechart-panel": "1.6.4"}))
+		Expect(failed).To(Equal(map[string]bool{"custom.panel": true}))
+	})
+
+	DescribeTable("validateGrafanaPlugins",
+		func(plugins []monitoringv1.GrafanaPluginSpec, expectedError string) {
+			err := r.validateGrafanaPlugins(monitoringv1.GrafanaSpec{Plugins: plugins})
+			if expectedError == "" {
+				Expect(err).NotTo(HaveOccurred())
+			} else {
+				Expect(err).To(MatchError(ContainSubstring(expectedError)))
+			}
+		},
+		Entry("accepts valid plugins", []monitoringv1.GrafanaPluginSpec{{ID: "grafana-clock-panel", Version: "2.1.0"}}, ""),
+		Entry("requires an id", []monitoringv1.GrafanaPluginSpec{{Version: "1.0.0"}}, "id cannot be empty"),
+		Entry("rejects invalid characters in the id", []monitoringv1.GrafanaPluginSpec{{ID: "a; rm -rf /"}},
+			"contains invalid characters"),
+		Entry("rejects invalid characters in the version", []monitoringv1.GrafanaPluginSpec{{ID: "a", Version: "1.0 $(id)"}},
+			"contains invalid characters"),
+		Entry("rejects duplicate ids", []monitoringv1.GrafanaPluginSpec{{ID: "a"}, {ID: "a"}}, "listed more than once"),
+		Entry("rejects url with version", []monitoringv1.GrafanaPluginSpec{{ID: "a", URL: "https://example.com/a.zip", Version: "1.0.0"}},
+			"cannot set both url and version"),
+	)
+})
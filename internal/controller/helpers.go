@@ -17,7 +17,14 @@ limitations under the License.
 package controller
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	monitoringv1 "github.com/ciliverse/monitor-operator/api/v1"
 )
@@ -49,6 +56,41 @@ func (r *MonitorStackReconciler) getPrometheusPVCName(monitorStack *monitoringv1
 	return fmt.Sprintf("%s-prometheus-data", monitorStack.Name)
 }
 
+// getPrometheusWebConfigSecretName 获取Prometheus web配置Secret的名称
+// 命名规则: {MonitorStack名称}-prometheus-web-config
+func (r *MonitorStackReconciler) getPrometheusWebConfigSecretName(monitorStack *monitoringv1.MonitorStack) string {
+	return fmt.Sprintf("%s-prometheus-web-config", monitorStack.Name)
+}
+
+// getPrometheusFederationSecretName 获取联邦抓取凭据Secret的名称
+// 命名规则: {MonitorStack名称}-prometheus-federation
+func (r *MonitorStackReconciler) getPrometheusFederationSecretName(monitorStack *monitoringv1.MonitorStack) string {
+	return fmt.Sprintf("%s-prometheus-federation", monitorStack.Name)
+}
+
+// getPrometheusURL 获取Prometheus Service的集群内访问地址
+// 格式: {http|https}://{Service名称}.{命名空间}.svc:{端口}
+func (r *MonitorStackReconciler) getPrometheusURL(monitorStack *monitoringv1.MonitorStack) string {
+	port := monitorStack.Spec.Prometheus.Service.Port
+	if port == 0 {
+		port = 9090
+	}
+	return fmt.Sprintf("%s://%s.%s.svc:%d", getPrometheusScheme(monitorStack),
+		r.getPrometheusServiceName(monitorStack), monitorStack.Namespace, port)
+}
+
+// getPrometheusBackupName 获取Prometheus备份CronJob的名称
+// 命名规则: {MonitorStack名称}-prometheus-backup
+func (r *MonitorStackReconciler) getPrometheusBackupName(monitorStack *monitoringv1.MonitorStack) string {
+	return fmt.Sprintf("%s-prometheus-backup", monitorStack.Name)
+}
+
+// getPrometheusServiceAccountName 获取Prometheus ServiceAccount的名称
+// 命名规则: {MonitorStack名称}-prometheus
+func (r *MonitorStackReconciler) getPrometheusServiceAccountName(monitorStack *monitoringv1.MonitorStack) string {
+	return fmt.Sprintf("%s-prometheus", monitorStack.Name)
+}
+
 // getGrafanaName 获取Grafana Deployment的名称
 // 命名规则: {MonitorStack名称}-grafana
 func (r *MonitorStackReconciler) getGrafanaName(monitorStack *monitoringv1.MonitorStack) string {
@@ -67,6 +109,30 @@ func (r *MonitorStackReconciler) getGrafanaDatasourcesConfigMapName(monitorStack
 	return fmt.Sprintf("%s-grafana-datasources", monitorStack.Name)
 }
 
+// getGrafanaConfigMapName 获取Grafana grafana.ini ConfigMap的名称
+// 命名规则: {MonitorStack名称}-grafana-config
+func (r *MonitorStackReconciler) getGrafanaConfigMapName(monitorStack *monitoringv1.MonitorStack) string {
+	return fmt.Sprintf("%s-grafana-config", monitorStack.Name)
+}
+
+// computeHash 计算配置内容的哈希值
+// 用于Pod模板注解，配置变化时触发滚动更新
+func computeHash(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+// deleteOwnedObject 删除由当前MonitorStack控制的对象，不存在时忽略
+func (r *MonitorStackReconciler) deleteOwnedObject(ctx context.Context, monitorStack *monitoringv1.MonitorStack, obj client.Object) error {
+	if err := r.Get(ctx, client.ObjectKeyFromObject(obj), obj); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if !metav1.IsControlledBy(obj, monitorStack) {
+		return nil
+	}
+	return client.IgnoreNotFound(r.Delete(ctx, obj))
+}
+
 // getLabels 获取资源标签
 // 生成标准的Kubernetes标签，包括应用名称、实例、组件等
 func (r *MonitorStackReconciler) getLabels(monitorStack *monitoringv1.MonitorStack, component string) map[string]string {
@@ -91,6 +157,12 @@ func (r *MonitorStackReconciler) getLabels(monitorStack *monitoringv1.MonitorSta
 // getPrometheusConfig 获取Prometheus配置
 // 如果用户提供了自定义配置，使用用户配置；否则使用默认配置
 func (r *MonitorStackReconciler) getPrometheusConfig(monitorStack *monitoringv1.MonitorStack) string {
+	return r.getPrometheusShardConfig(monitorStack, 0)
+}
+
+// getPrometheusShardConfig 获取指定分片的Prometheus配置
+// 分片时在全局配置中添加shard外部标签，并在除自监控以外的抓取任务中只保留属于该分片的目标
+func (r *MonitorStackReconciler) getPrometheusShardConfig(monitorStack *monitoringv1.MonitorStack, shard int32) string {
 	// 如果用户提供了自定义配置，直接使用
 	if monitorStack.Spec.Prometheus.Config != "" {
 		return monitorStack.Spec.Prometheus.Config
@@ -98,25 +170,74 @@ func (r *MonitorStackReconciler) getPrometheusConfig(monitorStack *monitoringv1.
 
 	// 使用默认的Prometheus配置
 	// 这个配置包含基本的监控目标和Kubernetes服务发现
-	return `# Prometheus默认配置
+	shards := getPrometheusShards(monitorStack)
+	config := defaultPrometheusGlobalConfig
+	if shards > 1 {
+		config += fmt.Sprintf(prometheusShardExternalLabels, shard)
+	}
+	config += fmt.Sprintf(defaultPrometheusSelfScrapeConfig, buildPrometheusScrapeAuth(monitorStack, "    "),
+		monitorStackLabel, getMonitorStackLabelValue(monitorStack))
+	if isClusterWideDiscovery(monitorStack) {
+		// ClusterMonitorStack未限制命名空间时发现整个集群的目标
+		config += addShardRelabelConfigs(fmt.Sprintf(defaultPrometheusPodsJob, ""), shards, shard) +
+			addShardRelabelConfigs(fmt.Sprintf(defaultPrometheusServicesJob, ""), shards, shard) +
+			addShardRelabelConfigs(defaultPrometheusNodesJob, shards, shard)
+	} else if namespaces := monitorStack.Status.TargetNamespaces; len(namespaces) > 0 {
+		// 限制服务发现的命名空间，节点是集群级资源，不发现节点
+		// namespaces为空时Prometheus会发现所有命名空间，所以没有匹配的命名空间时不添加服务发现任务
+		config += addShardRelabelConfigs(fmt.Sprintf(defaultPrometheusPodsJob, buildDiscoveryNamespaces(namespaces)), shards, shard) +
+			addShardRelabelConfigs(fmt.Sprintf(defaultPrometheusServicesJob, buildDiscoveryNamespaces(namespaces)), shards, shard)
+	}
+	config += r.buildPrometheusFederationJobs(monitorStack, shard)
+	config += r.buildPrometheusRemoteWriteConfig(monitorStack)
+
+	// agent模式不支持规则和告警配置
+	if isPrometheusAgentMode(monitorStack) {
+		return config
+	}
+	return config + defaultPrometheusRulesConfig
+}
+
+// monitorStackLabel 标识序列来自哪个MonitorStack的标签
+// 自监控任务和联邦抓取任务都设置该标签，资源建议据此区分本栈和联邦抓取的自监控序列
+const monitorStackLabel = "monitor_stack"
+
+// getMonitorStackLabelValue 获取monitorStackLabel的值，格式为{命名空间}/{名称}
+func getMonitorStackLabelValue(monitorStack *monitoringv1.MonitorStack) string {
+	return monitorStack.Namespace + "/" + monitorStack.Name
+}
+
+// 默认Prometheus配置的各个部分，服务发现任务中的%s为命名空间限制
+// 服务发现任务的最后一项为relabel_configs，分片时在末尾追加分片规则
+
+// defaultPrometheusGlobalConfig 全局配置
+const defaultPrometheusGlobalConfig = `# Prometheus默认配置
 # 全局配置
 global:
   scrape_interval: 15s        # 抓取间隔
   evaluation_interval: 15s    # 规则评估间隔
+`
 
+// defaultPrometheusSelfScrapeConfig Prometheus自监控，%s依次为访问Prometheus的协议和凭据、monitorStackLabel及其值
+const defaultPrometheusSelfScrapeConfig = `
 # 抓取配置
 scrape_configs:
-  # Prometheus自监控
+  # Prometheus自监控，启用HTTPS或Basic认证时使用web配置Secret中的凭据
   - job_name: 'prometheus'
-    static_configs:
+%s    static_configs:
       - targets: ['localhost:9090']
+        labels:
+          %s: '%s'
+
+`
 
-  # Kubernetes Pod监控
+// defaultPrometheusPodsJob Kubernetes Pod监控任务
+const defaultPrometheusPodsJob = `  # Kubernetes Pod监控
   # 通过注解prometheus.io/scrape=true来发现需要监控的Pod
   - job_name: 'kubernetes-pods'
     kubernetes_sd_configs:
       - role: pod
-    relabel_configs:
+%s    relabel_configs:
       # 只监控有prometheus.io/scrape=true注解的Pod
       - source_labels: [__meta_kubernetes_pod_annotation_prometheus_io_scrape]
         action: keep
@@ -141,11 +262,14 @@ scrape_configs:
         action: replace
         target_label: kubernetes_namespace
 
-  # Kubernetes Service监控
+`
+
+// defaultPrometheusServicesJob Kubernetes Service监控任务
+const defaultPrometheusServicesJob = `  # Kubernetes Service监控
   - job_name: 'kubernetes-services'
     kubernetes_sd_configs:
       - role: service
-    relabel_configs:
+%s    relabel_configs:
       # 只监控有prometheus.io/scrape=true注解的Service
       - source_labels: [__meta_kubernetes_service_annotation_prometheus_io_scrape]
         action: keep
@@ -170,7 +294,10 @@ scrape_configs:
         action: replace
         target_label: kubernetes_namespace
 
-  # Kubernetes Node监控
+`
+
+// defaultPrometheusNodesJob Kubernetes Node监控任务
+const defaultPrometheusNodesJob = `  # Kubernetes Node监控
   - job_name: 'kubernetes-nodes'
     kubernetes_sd_configs:
       - role: node
@@ -180,7 +307,10 @@ scrape_configs:
         action: replace
         target_label: kubernetes_node_name
 
-# 规则文件配置（可选）
+`
+
+// defaultPrometheusRulesConfig 规则文件和告警配置
+const defaultPrometheusRulesConfig = `# 规则文件配置（可选）
 rule_files:
   # - "first_rules.yml"
   # - "second_rules.yml"
@@ -191,14 +321,27 @@ rule_files:
 #     - static_configs:
 #         - targets:
 #           # - alertmanager:9093`
+
+// buildDiscoveryNamespaces 生成kubernetes_sd_configs的命名空间限制
+func buildDiscoveryNamespaces(namespaces []string) string {
+	var b strings.Builder
+	b.WriteString("        namespaces:\n")
+	b.WriteString("          names:\n")
+	for _, namespace := range namespaces {
+		fmt.Fprintf(&b, "            - %s\n", namespace)
+	}
+	return b.String()
 }
 
+// conditionTypeSpecValid spec验证状态条件
+const conditionTypeSpecValid = "SpecValid"
+
 // validateMonitorStack 验证MonitorStack配置
-// 检查配置的合理性，返回验证错误
+// 在继承MonitorStackClass并补全默认值后调用，检查配置的合理性，返回验证错误
 func (r *MonitorStackReconciler) validateMonitorStack(monitorStack *monitoringv1.MonitorStack) error {
 	// 验证至少启用一个组件
-	if !monitorStack.Spec.Prometheus.Enabled && !monitorStack.Spec.Grafana.Enabled {
-		return fmt.Errorf("at least one component (Prometheus or Grafana) must be enabled")
+	if !monitorStack.Spec.Prometheus.Enabled && !monitorStack.Spec.Grafana.Enabled && !isLokiEnabled(monitorStack) {
+		return fmt.Errorf("at least one component (Prometheus, Grafana or Loki) must be enabled")
 	}
 
 	// 验证Prometheus配置
@@ -215,6 +358,13 @@ func (r *MonitorStackReconciler) validateMonitorStack(monitorStack *monitoringv1
 		}
 	}
 
+	// 验证Loki配置
+	if isLokiEnabled(monitorStack) {
+		if err := r.validateLoki(monitorStack); err != nil {
+			return fmt.Errorf("loki configuration error: %w", err)
+		}
+	}
+
 	return nil
 }
 
@@ -239,8 +389,48 @@ func (r *MonitorStackReconciler) validatePrometheusConfig(monitorStack *monitori
 		return fmt.Errorf("prometheus image cannot be empty")
 	}
 
-	if prometheus.Tag == "" {
-		return fmt.Errorf("prometheus tag cannot be empty")
+	if prometheus.Tag == "" && prometheus.Digest == "" {
+		return fmt.Errorf("prometheus tag or digest must be set")
+	}
+
+	// 验证备份配置
+	if err := r.validatePrometheusBackup(monitorStack); err != nil {
+		return fmt.Errorf("backup configuration error: %w", err)
+	}
+
+	// 验证数据恢复配置
+	if err := r.validatePrometheusRestore(monitorStack); err != nil {
+		return fmt.Errorf("restore configuration error: %w", err)
+	}
+
+	// 验证agent模式配置
+	if err := r.validatePrometheusAgent(monitorStack); err != nil {
+		return fmt.Errorf("agent mode configuration error: %w", err)
+	}
+
+	// 验证分片配置
+	if err := r.validatePrometheusShards(monitorStack); err != nil {
+		return fmt.Errorf("shards configuration error: %w", err)
+	}
+
+	// 验证探针配置
+	if err := validateProbes(prometheus.Probes); err != nil {
+		return err
+	}
+
+	// 验证Web服务配置
+	if err := validatePrometheusWeb(prometheus.Web); err != nil {
+		return err
+	}
+
+	// 验证安全上下文
+	if err := validateSecurity(prometheus.Security); err != nil {
+		return err
+	}
+
+	// 验证Pod模板覆盖
+	if err := validatePodTemplateOverride(r.buildPrometheusDeployment(monitorStack), prometheus.PodTemplate, "prometheus"); err != nil {
+		return err
 	}
 
 	return nil
@@ -267,8 +457,8 @@ func (r *MonitorStackReconciler) validateGrafanaConfig(monitorStack *monitoringv
 		return fmt.Errorf("grafana image cannot be empty")
 	}
 
-	if grafana.Tag == "" {
-		return fmt.Errorf("grafana tag cannot be empty")
+	if grafana.Tag == "" && grafana.Digest == "" {
+		return fmt.Errorf("grafana tag or digest must be set")
 	}
 
 	// 验证管理员密码
@@ -288,6 +478,45 @@ func (r *MonitorStackReconciler) validateGrafanaConfig(monitorStack *monitoringv
 			return fmt.Errorf("datasource[%d] URL cannot be empty", i)
 		}
 	}
+	// 包含自动注册的栈内Prometheus数据源，避免名称或uid冲突
+	if err := r.validateGrafanaDatasources(r.getGrafanaDatasources(monitorStack)); err != nil {
+		return err
+	}
+
+	// 验证认证配置
+	if err := r.validateGrafanaAuth(grafana.Auth); err != nil {
+		return fmt.Errorf("auth configuration error: %w", err)
+	}
+
+	// 验证grafana.ini配置
+	if err := r.validateGrafanaIniConfig(grafana); err != nil {
+		return fmt.Errorf("grafana.ini configuration error: %w", err)
+	}
+
+	// 验证插件配置
+	if err := r.validateGrafanaPlugins(grafana); err != nil {
+		return fmt.Errorf("plugin configuration error: %w", err)
+	}
+
+	// 验证探针配置
+	if err := validateProbes(grafana.Probes); err != nil {
+		return err
+	}
+
+	// 验证安全上下文
+	if err := validateSecurity(grafana.Security); err != nil {
+		return err
+	}
+
+	// 验证自动扩缩容配置
+	if err := validateGrafanaAutoscaling(grafana); err != nil {
+		return fmt.Errorf("autoscaling configuration error: %w", err)
+	}
+
+	// 验证Pod模板覆盖
+	if err := validatePodTemplateOverride(r.buildGrafanaDeployment(monitorStack), grafana.PodTemplate, "grafana"); err != nil {
+		return err
+	}
 
 	return nil
 }
@@ -304,6 +533,11 @@ func (r *MonitorStackReconciler) setDefaultValues(monitorStack *monitoringv1.Mon
 	if monitorStack.Spec.Grafana.Enabled {
 		r.setGrafanaDefaults(&monitorStack.Spec.Grafana)
 	}
+
+	// 设置Loki默认值
+	if isLokiEnabled(monitorStack) {
+		r.setLokiDefaults(monitorStack.Spec.Loki)
+	}
 }
 
 // setPrometheusDefaults 设置Prometheus默认值
@@ -355,3 +589,28 @@ func (r *MonitorStackReconciler) setGrafanaDefaults(grafana *monitoringv1.Grafan
 		grafana.Resources.Requests.Memory = "128Mi"
 	}
 }
+
+// setLokiDefaults 设置Loki默认值
+func (r *MonitorStackReconciler) setLokiDefaults(loki *monitoringv1.LokiSpec) {
+	if loki.Image == "" {
+		loki.Image = "grafana/loki"
+	}
+	if loki.Tag == "" {
+		loki.Tag = defaultLokiTag
+	}
+	if loki.Service.Port == 0 {
+		loki.Service.Port = lokiPort
+	}
+	if loki.Service.Type == "" {
+		loki.Service.Type = "ClusterIP"
+	}
+	if loki.Retention == "" {
+		loki.Retention = "7d"
+	}
+	if loki.Promtail.Image == "" {
+		loki.Promtail.Image = "grafana/promtail"
+	}
+	if loki.Promtail.Tag == "" {
+		loki.Promtail.Tag = defaultPromtailTag
+	}
+}
@@ -0,0 +1,144 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	monitoringv1 "github.com/ciliverse/monitor-operator/api/v1"
+)
+
+// newTestMonitorStack 构建启用Prometheus和Grafana并补全默认值的MonitorStack，用于纯函数测试
+func newTestMonitorStack() *monitoringv1.MonitorStack {
+	monitorStack := &monitoringv1.MonitorStack{
+		ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "monitoring"},
+		Spec: monitoringv1.MonitorStackSpec{
+			Prometheus: monitoringv1.PrometheusSpec{Enabled: true},
+			Grafana:    monitoringv1.GrafanaSpec{Enabled: true},
+		},
+	}
+	(&MonitorStackReconciler{}).setDefaultValues(monitorStack)
+	return monitorStack
+}
+
+// newFakeReconciler 构建使用fake client的Reconciler，用于不依赖envtest的协调逻辑测试
+func newFakeReconciler(objs ...client.Object) *MonitorStackReconciler {
+	testScheme := runtime.NewScheme()
+	Expect(clientgoscheme.AddToScheme(testScheme)).To(Succeed())
+	Expect(monitoringv1.AddToScheme(testScheme)).To(Succeed())
+	return &MonitorStackReconciler{
+		Client: fake.NewClientBuilder().WithScheme(testScheme).WithObjects(objs...).
+			WithStatusSubresource(&monitoringv1.MonitorStack{}).Build(),
+		Scheme: testScheme,
+	}
+}
+
+// secretKey 构建Secret键引用
+func secretKey(name, key string) corev1.SecretKeySelector {
+	return corev1.SecretKeySelector{
+		LocalObjectReference: corev1.LocalObjectReference{Name: name},
+		Key:                  key,
+	}
+}
+
+var _ = Describe("validateMonitorStack", func() {
+	r := &MonitorStackReconciler{}
+
+	validOAuth := func() *monitoringv1.GrafanaGenericOAuthSpec {
+		return &monitoringv1.GrafanaGenericOAuthSpec{
+			ClientID:     "grafana",
+			ClientSecret: secretKey("oauth", "client-secret"),
+			AuthURL:      "https://sso.example.com/authorize",
+			TokenURL:     "https://sso.example.com/token",
+		}
+	}
+
+	DescribeTable("checks each rule",
+		func(mutate func(*monitoringv1.MonitorStack), expectedError string) {
+			monitorStack := newTestMonitorStack()
+			mutate(monitorStack)
+			err := r.validateMonitorStack(monitorStack)
+			if expectedError == "" {
+				Expect(err).NotTo(HaveOccurred())
+			} else {
+				Expect(err).To(MatchError(ContainSubstring(expectedError)))
+			}
+		},
+		Entry("accepts the defaulted spec", func(*monitoringv1.MonitorStack) {}, ""),
+		Entry("requires at least one component", func(ms *monitoringv1.MonitorStack) {
+			ms.Spec.Prometheus.Enabled = false
+			ms.Spec.Grafana.Enabled = false
+		}, "at least one component"),
+		Entry("rejects an out of range Prometheus port", func(ms *monitoringv1.MonitorStack) {
+			ms.Spec.Prometheus.Service.Port = 70000
+		}, "service port must be between 1 and 65535"),
+		Entry("rejects an out of range Grafana nodePort", func(ms *monitoringv1.MonitorStack) {
+			ms.Spec.Grafana.Service.Type = "NodePort"
+			ms.Spec.Grafana.Service.NodePort = 8080
+		}, "nodePort must be between 30000 and 32767"),
+		Entry("rejects an empty Grafana admin password", func(ms *monitoringv1.MonitorStack) {
+			ms.Spec.Grafana.AdminPassword = ""
+		}, "admin password cannot be empty"),
+		Entry("accepts generic OAuth", func(ms *monitoringv1.MonitorStack) {
+			ms.Spec.Grafana.Auth = &monitoringv1.GrafanaAuthSpec{GenericOAuth: validOAuth(), DisableLoginForm: true}
+		}, ""),
+		Entry("requires an OAuth clientId", func(ms *monitoringv1.MonitorStack) {
+			oauth := validOAuth()
+			oauth.ClientID = ""
+			ms.Spec.Grafana.Auth = &monitoringv1.GrafanaAuthSpec{GenericOAuth: oauth}
+		}, "clientId cannot be empty"),
+		Entry("requires an OAuth clientSecret reference", func(ms *monitoringv1.MonitorStack) {
+			oauth := validOAuth()
+			oauth.ClientSecret = corev1.SecretKeySelector{}
+			ms.Spec.Grafana.Auth = &monitoringv1.GrafanaAuthSpec{GenericOAuth: oauth}
+		}, "clientSecret must reference a Secret"),
+		Entry("requires OAuth endpoints", func(ms *monitoringv1.MonitorStack) {
+			oauth := validOAuth()
+			oauth.TokenURL = ""
+			ms.Spec.Grafana.Auth = &monitoringv1.GrafanaAuthSpec{GenericOAuth: oauth}
+		}, "authUrl and tokenUrl cannot be empty"),
+		Entry("requires an LDAP config reference", func(ms *monitoringv1.MonitorStack) {
+			ms.Spec.Grafana.Auth = &monitoringv1.GrafanaAuthSpec{LDAP: &monitoringv1.GrafanaLDAPSpec{}}
+		}, "LDAP config must reference a Secret"),
+		Entry("rejects disableLoginForm without OAuth", func(ms *monitoringv1.MonitorStack) {
+			ms.Spec.Grafana.Auth = &monitoringv1.GrafanaAuthSpec{
+				DisableLoginForm: true,
+				LDAP:             &monitoringv1.GrafanaLDAPSpec{Config: secretKey("ldap", "ldap.toml")},
+			}
+		}, "disableLoginForm requires genericOAuth"),
+		Entry("accepts a Loki-only stack", func(ms *monitoringv1.MonitorStack) {
+			ms.Spec.Prometheus.Enabled = false
+			ms.Spec.Grafana.Enabled = false
+			ms.Spec.Loki = &monitoringv1.LokiSpec{Enabled: true}
+			(&MonitorStackReconciler{}).setLokiDefaults(ms.Spec.Loki)
+		}, ""),
+		Entry("requires an S3 bucket for Loki", func(ms *monitoringv1.MonitorStack) {
+			ms.Spec.Loki = &monitoringv1.LokiSpec{Enabled: true, Storage: monitoringv1.LokiStorageSpec{
+				Type: "s3",
+				S3:   &monitoringv1.LokiS3Storage{Endpoint: "http://minio:9000"},
+			}}
+			(&MonitorStackReconciler{}).setLokiDefaults(ms.Spec.Loki)
+		}, "loki configuration error: s3 storage requires bucket"),
+	)
+})
@@ -0,0 +1,75 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"strings"
+)
+
+// 镜像地址 - 支持摘要固定镜像，以及把默认仓库（Docker Hub）的镜像改写到私有镜像仓库，
+// 离线集群只需在operator上配置--image-registry，不需要逐个修改MonitorStack
+
+// defaultRegistries 镜像地址中表示默认仓库的前缀
+var defaultRegistries = []string{"docker.io/", "index.docker.io/"}
+
+// buildImage 根据仓库、标签和摘要拼接镜像地址，设置摘要时忽略标签
+func buildImage(image, tag, digest string) string {
+	if digest != "" {
+		return fmt.Sprintf("%s@%s", image, digest)
+	}
+	return fmt.Sprintf("%s:%s", image, tag)
+}
+
+// hasRegistry 判断镜像地址是否显式指定了仓库
+// 第一段包含"."或":"或为localhost时视为仓库地址，与docker的解析规则一致
+func hasRegistry(image string) bool {
+	i := strings.Index(image, "/")
+	if i < 0 {
+		return false
+	}
+	host := image[:i]
+	return strings.ContainsAny(host, ".:") || host == "localhost"
+}
+
+// rewriteImage 把默认仓库的镜像改写到配置的镜像仓库，显式指定其他仓库的镜像保持不变
+func (r *MonitorStackReconciler) rewriteImage(image string) string {
+	registry := strings.TrimSuffix(r.ImageRegistry, "/")
+	if registry == "" {
+		return image
+	}
+
+	for _, prefix := range defaultRegistries {
+		if strings.HasPrefix(image, prefix) {
+			return registry + "/" + strings.TrimPrefix(image, prefix)
+		}
+	}
+	if hasRegistry(image) {
+		return image
+	}
+	return registry + "/" + image
+}
+
+// rewriteOperatorImage 改写operator内置的辅助镜像，无论位于哪个仓库都改写到配置的镜像仓库
+// 内置镜像由operator决定，用户无法修改，离线集群需要把它们同步到镜像仓库中的相同路径，
+// 例如ghcr.io/jimmidyson/configmap-reload改写为<镜像仓库>/jimmidyson/configmap-reload
+func (r *MonitorStackReconciler) rewriteOperatorImage(image string) string {
+	if r.ImageRegistry != "" && hasRegistry(image) {
+		image = image[strings.Index(image, "/")+1:]
+	}
+	return r.rewriteImage(image)
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Images", func() {
+	DescribeTable("buildImage",
+		func(image, tag, digest, expected string) {
+			Expect(buildImage(image, tag, digest)).To(Equal(expected))
+		},
+		Entry("uses the tag", "prom/prometheus", "v2.45.0", "", "prom/prometheus:v2.45.0"),
+		Entry("prefers the digest", "prom/prometheus", "v2.45.0", "sha256:abc", "prom/prometheus@sha256:abc"),
+	)
+
+	DescribeTable("hasRegistry",
+		func(image string, expected bool) {
+			Expect(hasRegistry(image)).To(Equal(expected))
+		},
+		Entry("official images", "busybox:1.36", false),
+		Entry("Docker Hub organizations", "prom/prometheus:v2.45.0", false),
+		Entry("registries with a domain", "quay.io/prometheus/prometheus", true),
+		Entry("registries with a port", "registry:5000/prometheus", true),
+		Entry("localhost", "localhost/prometheus", true),
+	)
+
+	DescribeTable("rewriteImage",
+		func(registry, image, expected string) {
+			r := &MonitorStackReconciler{ImageRegistry: registry}
+			Expect(r.rewriteImage(image)).To(Equal(expected))
+		},
+		Entry("keeps images without a registry configured", "", "prom/prometheus:v2.45.0", "prom/prometheus:v2.45.0"),
+		Entry("rewrites Docker Hub organizations", "mirror.example.com", "prom/prometheus:v2.45.0",
+			"mirror.example.com/prom/prometheus:v2.45.0"),
+		Entry("rewrites official images", "mirror.example.com/", "busybox:1.36", "mirror.example.com/busybox:1.36"),
+		Entry("rewrites explicit docker.io images", "mirror.example.com", "docker.io/grafana/grafana@sha256:abc",
+			"mirror.example.com/grafana/grafana@sha256:abc"),
+		Entry("rewrites index.docker.io images", "mirror.example.com", "index.docker.io/minio/mc:latest",
+			"mirror.example.com/minio/mc:latest"),
+		Entry("keeps images from other registries", "mirror.example.com", "quay.io/prometheus/prometheus:v2.45.0",
+			"quay.io/prometheus/prometheus:v2.45.0"),
+	)
+
+	DescribeTable("rewriteOperatorImage",
+		func(registry, expected string) {
+			r := &MonitorStackReconciler{ImageRegistry: registry}
+			Expect(r.rewriteOperatorImage(configReloaderImage)).To(Equal(expected))
+		},
+		Entry("keeps the image without a registry configured", "", configReloaderImage),
+		Entry("moves images from other registries to the mirror", "mirror.example.com/",
+			"mirror.example.com/jimmidyson/configmap-reload:v0.14.0"),
+	)
+
+	It("checks the config reloader image the pod actually uses against policies", func() {
+		r := &MonitorStackReconciler{ImageRegistry: "mirror.example.com"}
+		monitorStack := newTestMonitorStack()
+		reloader := r.buildPrometheusConfigReloader(monitorStack)
+		Expect(reloader.Image).To(Equal("mirror.example.com/jimmidyson/configmap-reload:v0.14.0"))
+		Expect(r.getPolicyImages(monitorStack)).To(ContainElement(reloader.Image))
+	})
+})
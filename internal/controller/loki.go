@@ -0,0 +1,1092 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	monitoringv1 "github.com/ciliverse/monitor-operator/api/v1"
+	"github.com/ciliverse/monitor-operator/internal/policy"
+)
+
+// Loki日志聚合 - 以单体模式部署Loki，通过Promtail DaemonSet采集各节点上Pod的日志
+// 参考: https://grafana.com/docs/loki/latest/get-started/deployment-modes/#monolithic-mode
+// Promtail需要在所有命名空间中发现Pod，通过ClusterRole授权，ClusterRole无法设置OwnerReference，
+// 通过标签跟踪并在禁用Loki或删除MonitorStack时删除
+// Promtail读取节点上所有Pod的日志文件，采集的命名空间与Prometheus服务发现一致：
+// 设置targetNamespaces时只采集status.targetNamespaces，未设置时只有ClusterMonitorStack生成的MonitorStack
+// 或者被MonitorStackPolicy的allowNodeLogCollection允许时才采集所有命名空间，否则只采集自身所在的命名空间
+
+const (
+	// lokiUID Loki镜像中的loki用户
+	lokiUID = int64(10001)
+	// lokiPort Loki的HTTP端口
+	lokiPort = 3100
+	// promtailPort Promtail的HTTP端口
+	promtailPort = 3101
+
+	// lokiStorageFilesystem 日志保存在本地卷中
+	lokiStorageFilesystem = "filesystem"
+	// lokiStorageS3 日志保存在S3兼容的对象存储中
+	lokiStorageS3 = "s3"
+
+	// defaultLokiTag Loki的默认版本
+	defaultLokiTag = "3.5.0"
+	// defaultPromtailTag Promtail的默认版本，Promtail已停止维护，固定使用与Loki相同的最后一个版本
+	defaultPromtailTag = "3.5.0"
+
+	// conditionTypeNodeLogCollectionAllowed 是否允许Promtail采集所有命名空间日志的状态条件
+	conditionTypeNodeLogCollectionAllowed = "NodeLogCollectionAllowed"
+)
+
+// lokiConfigTemplate Loki配置，依次为存储配置、对象存储类型、保留时间和删除请求的存储类型
+const lokiConfigTemplate = `# Loki配置 - 单体模式
+auth_enabled: false
+
+server:
+  http_listen_port: 3100
+  grpc_listen_port: 9095
+
+common:
+  path_prefix: /loki
+  replication_factor: 1
+  ring:
+    kvstore:
+      store: inmemory
+  storage:
+%s
+schema_config:
+  configs:
+    - from: "2024-01-01"
+      store: tsdb
+      object_store: %s
+      schema: v13
+      index:
+        prefix: index_
+        period: 24h
+
+# 由compactor删除超过保留时间的日志
+limits_config:
+  retention_period: %s
+
+compactor:
+  working_directory: /loki/compactor
+  retention_enabled: true
+  delete_request_store: %s
+
+analytics:
+  reporting_enabled: false
+`
+
+// lokiFilesystemStorage 本地卷存储配置
+const lokiFilesystemStorage = `    filesystem:
+      chunks_directory: /loki/chunks
+      rules_directory: /loki/rules
+`
+
+// promtailConfigTemplate Promtail配置，依次为Loki地址、命名空间限制和只保留这些命名空间的relabel规则
+// HOSTNAME为节点名称，由-config.expand-env展开，每个Promtail只发现所在节点上的Pod
+const promtailConfigTemplate = `# Promtail配置 - 采集当前节点上Pod的日志
+server:
+  http_listen_port: 3101
+  grpc_listen_port: 0
+
+positions:
+  filename: /run/promtail/positions.yaml
+
+clients:
+  - url: %s/loki/api/v1/push
+
+scrape_configs:
+  - job_name: kubernetes-pods
+    pipeline_stages:
+      - cri: {}
+    kubernetes_sd_configs:
+      - role: pod
+%s        selectors:
+          - role: pod
+            field: spec.nodeName=${HOSTNAME}
+    relabel_configs:
+%s      # 添加命名空间、Pod、容器和节点标签
+      - source_labels: [__meta_kubernetes_namespace]
+        target_label: namespace
+      - source_labels: [__meta_kubernetes_pod_name]
+        target_label: pod
+      - source_labels: [__meta_kubernetes_pod_container_name]
+        target_label: container
+      - source_labels: [__meta_kubernetes_pod_node_name]
+        target_label: node_name
+      # 使用app.kubernetes.io/name或app标签作为应用名称
+      - source_labels: [__meta_kubernetes_pod_label_app_kubernetes_io_name, __meta_kubernetes_pod_label_app]
+        regex: ^;*([^;]+)(;.*)?$
+        target_label: app
+      # 容器日志文件路径
+      - source_labels: [__meta_kubernetes_pod_uid, __meta_kubernetes_pod_container_name]
+        separator: /
+        replacement: /var/log/pods/*$1/*.log
+        target_label: __path__
+`
+
+// promtailClusterRoleRules Promtail发现Pod需要的权限
+var promtailClusterRoleRules = []rbacv1.PolicyRule{
+	{
+		APIGroups: []string{""},
+		Resources: []string{"pods"},
+		Verbs:     []string{"get", "list", "watch"},
+	},
+}
+
+// lokiDerivedField Grafana Loki数据源jsonData中的派生字段
+type lokiDerivedField struct {
+	Name            string `json:"name"`
+	MatcherRegex    string `json:"matcherRegex"`
+	URL             string `json:"url"`
+	DatasourceUID   string `json:"datasourceUid,omitempty"`
+	URLDisplayLabel string `json:"urlDisplayLabel,omitempty"`
+}
+
+// isLokiEnabled 判断是否启用Loki
+func isLokiEnabled(monitorStack *monitoringv1.MonitorStack) bool {
+	return monitorStack.Spec.Loki != nil && monitorStack.Spec.Loki.Enabled
+}
+
+// isPromtailEnabled 判断是否部署Promtail
+func isPromtailEnabled(monitorStack *monitoringv1.MonitorStack) bool {
+	return isLokiEnabled(monitorStack) && monitorStack.Spec.Loki.Promtail.Enabled
+}
+
+// getLokiName 获取Loki Deployment和Service的名称
+// 命名规则: {MonitorStack名称}-loki
+func (r *MonitorStackReconciler) getLokiName(monitorStack *monitoringv1.MonitorStack) string {
+	return fmt.Sprintf("%s-loki", monitorStack.Name)
+}
+
+// getLokiConfigMapName 获取Loki ConfigMap的名称
+// 命名规则: {MonitorStack名称}-loki-config
+func (r *MonitorStackReconciler) getLokiConfigMapName(monitorStack *monitoringv1.MonitorStack) string {
+	return fmt.Sprintf("%s-loki-config", monitorStack.Name)
+}
+
+// getLokiPVCName 获取Loki PVC的名称
+// 命名规则: {MonitorStack名称}-loki-data
+func (r *MonitorStackReconciler) getLokiPVCName(monitorStack *monitoringv1.MonitorStack) string {
+	return fmt.Sprintf("%s-loki-data", monitorStack.Name)
+}
+
+// getLokiURL 获取Loki Service的集群内访问地址
+// 格式: http://{Service名称}.{命名空间}.svc:{端口}
+func (r *MonitorStackReconciler) getLokiURL(monitorStack *monitoringv1.MonitorStack) string {
+	port := monitorStack.Spec.Loki.Service.Port
+	if port == 0 {
+		port = lokiPort
+	}
+	return fmt.Sprintf("http://%s.%s.svc:%d", r.getLokiName(monitorStack), monitorStack.Namespace, port)
+}
+
+// getPromtailName 获取Promtail DaemonSet和ServiceAccount的名称
+// 命名规则: {MonitorStack名称}-promtail
+func (r *MonitorStackReconciler) getPromtailName(monitorStack *monitoringv1.MonitorStack) string {
+	return fmt.Sprintf("%s-promtail", monitorStack.Name)
+}
+
+// getPromtailConfigMapName 获取Promtail ConfigMap的名称
+// 命名规则: {MonitorStack名称}-promtail-config
+func (r *MonitorStackReconciler) getPromtailConfigMapName(monitorStack *monitoringv1.MonitorStack) string {
+	return fmt.Sprintf("%s-promtail-config", monitorStack.Name)
+}
+
+// getPromtailClusterRoleName 获取Promtail ClusterRole和ClusterRoleBinding的名称
+// 命名规则: monitor-operator:{MonitorStack命名空间}:{MonitorStack名称}-promtail
+func (r *MonitorStackReconciler) getPromtailClusterRoleName(monitorStack *monitoringv1.MonitorStack) string {
+	return fmt.Sprintf("monitor-operator:%s:%s-promtail", monitorStack.Namespace, monitorStack.Name)
+}
+
+// getPromtailClusterRBACLabels 获取Promtail ClusterRole和ClusterRoleBinding的标签
+func (r *MonitorStackReconciler) getPromtailClusterRBACLabels(monitorStack *monitoringv1.MonitorStack) map[string]string {
+	labels := r.getLabels(monitorStack, "promtail")
+	labels[monitorStackNameLabel] = monitorStack.Name
+	labels[monitorStackNamespaceLabel] = monitorStack.Namespace
+	return labels
+}
+
+// getLokiStorageType 获取Loki存储类型，未设置时为filesystem
+func getLokiStorageType(loki *monitoringv1.LokiSpec) string {
+	if loki.Storage.Type == "" {
+		return lokiStorageFilesystem
+	}
+	return loki.Storage.Type
+}
+
+// validateLoki 验证Loki配置
+func (r *MonitorStackReconciler) validateLoki(monitorStack *monitoringv1.MonitorStack) error {
+	loki := monitorStack.Spec.Loki
+
+	// 验证端口范围
+	if loki.Service.Port < 1 || loki.Service.Port > 65535 {
+		return fmt.Errorf("service port must be between 1 and 65535, got %d", loki.Service.Port)
+	}
+
+	storage := loki.Storage
+
+	if storage.Size != "" {
+		if _, err := resource.ParseQuantity(storage.Size); err != nil {
+			return fmt.Errorf("invalid storage size %q: %w", storage.Size, err)
+		}
+	}
+
+	if getLokiStorageType(monitorStack.Spec.Loki) == lokiStorageS3 {
+		s3 := storage.S3
+		if s3 == nil {
+			return fmt.Errorf("s3 storage requires storage.s3")
+		}
+		if _, err := url.Parse(s3.Endpoint); err != nil {
+			return fmt.Errorf("invalid s3 endpoint %q: %w", s3.Endpoint, err)
+		}
+		if s3.Bucket == "" {
+			return fmt.Errorf("s3 storage requires bucket")
+		}
+		if s3.CredentialsSecret.Name == "" {
+			return fmt.Errorf("s3 storage requires credentialsSecret")
+		}
+	}
+
+	// 验证安全上下文
+	return validateSecurity(loki.Security)
+}
+
+// buildLokiConfig 生成Loki配置
+func (r *MonitorStackReconciler) buildLokiConfig(monitorStack *monitoringv1.MonitorStack) string {
+	loki := monitorStack.Spec.Loki
+	storageType := getLokiStorageType(loki)
+
+	storage := lokiFilesystemStorage
+	if storageType == lokiStorageS3 {
+		// 凭证通过环境变量注入，由-config.expand-env展开
+		s3 := loki.Storage.S3
+		endpoint, _ := url.Parse(s3.Endpoint)
+		storage = "    s3:\n" +
+			fmt.Sprintf("      endpoint: %q\n", endpoint.Host) +
+			fmt.Sprintf("      bucketnames: %q\n", s3.Bucket)
+		if s3.Region != "" {
+			storage += fmt.Sprintf("      region: %q\n", s3.Region)
+		}
+		storage += "      access_key_id: ${AWS_ACCESS_KEY_ID}\n" +
+			"      secret_access_key: ${AWS_SECRET_ACCESS_KEY}\n" +
+			fmt.Sprintf("      insecure: %t\n", endpoint.Scheme == "http") +
+			fmt.Sprintf("      s3forcepathstyle: %t\n", s3.ForcePathStyle)
+	}
+
+	return fmt.Sprintf(lokiConfigTemplate, storage, storageType, loki.Retention, storageType)
+}
+
+// buildPromtailConfig 生成Promtail配置，namespaces为nil时采集所有命名空间
+// 除服务发现的命名空间限制外，再通过relabel规则只保留这些命名空间中的目标，
+// namespaces为空时不保留任何目标
+func (r *MonitorStackReconciler) buildPromtailConfig(monitorStack *monitoringv1.MonitorStack, namespaces []string) string {
+	var discovery, keep string
+	if namespaces != nil {
+		quoted := make([]string, 0, len(namespaces))
+		for _, namespace := range namespaces {
+			quoted = append(quoted, regexp.QuoteMeta(namespace))
+		}
+		if len(namespaces) > 0 {
+			discovery = buildDiscoveryNamespaces(namespaces)
+		}
+		keep = "      # 只保留允许采集的命名空间\n" +
+			"      - source_labels: [__meta_kubernetes_namespace]\n" +
+			fmt.Sprintf("        regex: '%s'\n", strings.Join(quoted, "|")) +
+			"        action: keep\n"
+	}
+	return fmt.Sprintf(promtailConfigTemplate, r.getLokiURL(monitorStack), discovery, keep)
+}
+
+// resolvePromtailNamespaces 获取Promtail采集日志的命名空间，返回nil表示采集所有命名空间
+// 未设置targetNamespaces时需要由ClusterMonitorStack生成或者被策略允许，否则只采集自身所在的命名空间
+func (r *MonitorStackReconciler) resolvePromtailNamespaces(ctx context.Context, monitorStack *monitoringv1.MonitorStack) ([]string, error) {
+	if monitorStack.Spec.Prometheus.TargetNamespaces != nil {
+		meta.RemoveStatusCondition(&monitorStack.Status.Conditions, conditionTypeNodeLogCollectionAllowed)
+		return append([]string{}, monitorStack.Status.TargetNamespaces...), nil
+	}
+
+	allowed, err := r.isOwnedByClusterMonitorStack(ctx, monitorStack)
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
+		policies, err := policy.MatchingPolicies(ctx, r.Client, monitorStack.Namespace)
+		if err != nil {
+			return nil, err
+		}
+		allowed = policy.AllowsNodeLogCollection(policies)
+	}
+
+	if !allowed {
+		r.setCondition(monitorStack, conditionTypeNodeLogCollectionAllowed, metav1.ConditionFalse, "NotAllowed",
+			fmt.Sprintf("collecting logs from all namespaces requires a ClusterMonitorStack or a MonitorStackPolicy with allowNodeLogCollection, only namespace %s is collected",
+				monitorStack.Namespace))
+		return []string{monitorStack.Namespace}, nil
+	}
+	r.setCondition(monitorStack, conditionTypeNodeLogCollectionAllowed, metav1.ConditionTrue, "Allowed",
+		"logs from all namespaces are collected")
+	return nil, nil
+}
+
+// isOwnedByClusterMonitorStack 判断MonitorStack是否由ClusterMonitorStack生成
+// 同时检查ClusterMonitorStack的UID，用户无法通过伪造OwnerReference获得集群级权限
+func (r *MonitorStackReconciler) isOwnedByClusterMonitorStack(ctx context.Context, monitorStack *monitoringv1.MonitorStack) (bool, error) {
+	owner := metav1.GetControllerOf(monitorStack)
+	if owner == nil || owner.Kind != "ClusterMonitorStack" || owner.APIVersion != monitoringv1.GroupVersion.String() {
+		return false, nil
+	}
+	clusterStack := &monitoringv1.ClusterMonitorStack{}
+	if err := r.Get(ctx, types.NamespacedName{Name: owner.Name}, clusterStack); err != nil {
+		return false, client.IgnoreNotFound(err)
+	}
+	return clusterStack.UID == owner.UID, nil
+}
+
+// buildLokiDatasource 构建自动注册的Loki数据源，用户已配置指向栈内Loki的数据源时返回nil
+// datasources为用户配置的数据源，用于查找链路追踪数据源
+func (r *MonitorStackReconciler) buildLokiDatasource(monitorStack *monitoringv1.MonitorStack, datasources []monitoringv1.DatasourceSpec) *monitoringv1.DatasourceSpec {
+	if !isLokiEnabled(monitorStack) {
+		return nil
+	}
+	port := monitorStack.Spec.Loki.Service.Port
+	if port == 0 {
+		port = lokiPort
+	}
+	for _, ds := range datasources {
+		if isServiceURL(ds.URL, r.getLokiName(monitorStack), monitorStack.Namespace, port) {
+			return nil
+		}
+	}
+
+	derivedFields := make([]lokiDerivedField, 0, len(monitorStack.Spec.Loki.DerivedFields))
+	for _, field := range monitorStack.Spec.Loki.DerivedFields {
+		derivedFields = append(derivedFields, lokiDerivedField{
+			Name:            field.Name,
+			MatcherRegex:    field.MatcherRegex,
+			URL:             field.URL,
+			DatasourceUID:   field.DatasourceUID,
+			URLDisplayLabel: field.URLDisplayLabel,
+		})
+	}
+
+	// 未配置派生字段时，从日志中的trace ID跳转到第一个链路追踪数据源
+	if len(derivedFields) == 0 {
+		for _, ds := range datasources {
+			if (ds.Type == "tempo" || ds.Type == "jaeger" || ds.Type == "zipkin") && ds.UID != "" {
+				derivedFields = append(derivedFields, lokiDerivedField{
+					Name:          "TraceID",
+					MatcherRegex:  `(?:traceID|trace_id|traceId)=(\w+)`,
+					URL:           "${__value.raw}",
+					DatasourceUID: ds.UID,
+				})
+				break
+			}
+		}
+	}
+
+	jsonData := map[string]any{"maxLines": 1000}
+	if len(derivedFields) > 0 {
+		jsonData["derivedFields"] = derivedFields
+	}
+	// 只包含字符串和数字字段，序列化不会失败
+	raw, _ := json.Marshal(jsonData)
+
+	name := r.getLokiName(monitorStack)
+	return &monitoringv1.DatasourceSpec{
+		Name:     name,
+		Type:     "loki",
+		UID:      autoDatasourceUID(name),
+		URL:      r.getLokiURL(monitorStack),
+		Access:   "proxy",
+		JSONData: &runtime.RawExtension{Raw: raw},
+	}
+}
+
+// buildLokiDeployment 构建Loki Deployment
+func (r *MonitorStackReconciler) buildLokiDeployment(monitorStack *monitoringv1.MonitorStack) *appsv1.Deployment {
+	loki := monitorStack.Spec.Loki
+	labels := r.getLabels(monitorStack, "loki")
+	replicas := int32(1) // 单体模式只运行一个副本
+
+	container := corev1.Container{
+		Name:  "loki",
+		Image: r.rewriteImage(buildImage(loki.Image, loki.Tag, "")),
+		Args: []string{
+			"-config.file=/etc/loki/loki.yaml", // 配置文件路径
+			"-config.expand-env=true",          // 展开配置中的环境变量
+			"-target=all",                      // 单体模式
+		},
+		Ports: []corev1.ContainerPort{
+			{Name: "http", ContainerPort: lokiPort, Protocol: corev1.ProtocolTCP},
+			{Name: "grpc", ContainerPort: 9095, Protocol: corev1.ProtocolTCP},
+		},
+		SecurityContext: r.buildContainerSecurityContext(loki.Security),
+		VolumeMounts: []corev1.VolumeMount{
+			{Name: "config", MountPath: "/etc/loki", ReadOnly: true},
+			{Name: "data", MountPath: "/loki"},
+		},
+		Resources: r.buildResourceRequirements(loki.Resources),
+		// 启动后ingester需要等待一段时间才就绪，存活探针只检查端口
+		LivenessProbe: &corev1.Probe{
+			ProbeHandler: corev1.ProbeHandler{
+				TCPSocket: &corev1.TCPSocketAction{Port: intstr.FromInt(lokiPort)},
+			},
+			InitialDelaySeconds: 30,
+			PeriodSeconds:       10,
+			TimeoutSeconds:      5,
+			FailureThreshold:    3,
+		},
+		ReadinessProbe: &corev1.Probe{
+			ProbeHandler: corev1.ProbeHandler{
+				HTTPGet: &corev1.HTTPGetAction{Path: "/ready", Port: intstr.FromInt(lokiPort)},
+			},
+			InitialDelaySeconds: 15,
+			PeriodSeconds:       10,
+			TimeoutSeconds:      3,
+			FailureThreshold:    3,
+		},
+	}
+	if getLokiStorageType(loki) == lokiStorageS3 {
+		container.EnvFrom = []corev1.EnvFromSource{
+			{
+				SecretRef: &corev1.SecretEnvSource{
+					LocalObjectReference: loki.Storage.S3.CredentialsSecret,
+				},
+			},
+		}
+	}
+
+	// 数据卷 - 设置了大小时使用PVC，否则使用临时存储
+	dataVolume := corev1.Volume{
+		Name: "data",
+		VolumeSource: corev1.VolumeSource{
+			EmptyDir: &corev1.EmptyDirVolumeSource{},
+		},
+	}
+	if loki.Storage.Size != "" {
+		dataVolume.VolumeSource = corev1.VolumeSource{
+			PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+				ClaimName: r.getLokiPVCName(monitorStack),
+			},
+		}
+	}
+
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      r.getLokiName(monitorStack),
+			Namespace: monitorStack.Namespace,
+			Labels:    labels,
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: labels,
+			},
+			// 新旧Pod不能同时使用同一个数据目录
+			Strategy: appsv1.DeploymentStrategy{
+				Type: appsv1.RecreateDeploymentStrategyType,
+			},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+					// 配置变化时触发滚动更新
+					Annotations: map[string]string{
+						configHashAnnotation: computeHash(r.buildLokiConfig(monitorStack)),
+					},
+				},
+				Spec: corev1.PodSpec{
+					SecurityContext: r.buildPodSecurityContext(loki.Security, lokiUID),
+					Containers:      []corev1.Container{container},
+					Volumes: []corev1.Volume{
+						{
+							Name: "config",
+							VolumeSource: corev1.VolumeSource{
+								ConfigMap: &corev1.ConfigMapVolumeSource{
+									LocalObjectReference: corev1.LocalObjectReference{
+										Name: r.getLokiConfigMapName(monitorStack),
+									},
+								},
+							},
+						},
+						dataVolume,
+					},
+				},
+			},
+		},
+	}
+}
+
+// buildLokiService 构建Loki Service
+func (r *MonitorStackReconciler) buildLokiService(monitorStack *monitoringv1.MonitorStack) *corev1.Service {
+	loki := monitorStack.Spec.Loki
+	labels := r.getLabels(monitorStack, "loki")
+
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      r.getLokiName(monitorStack),
+			Namespace: monitorStack.Namespace,
+			Labels:    r.getLabels(monitorStack, "loki"),
+		},
+		Spec: corev1.ServiceSpec{
+			Type:     corev1.ServiceType(loki.Service.Type),
+			Selector: labels,
+			Ports: []corev1.ServicePort{
+				{
+					Name:       "http",
+					Port:       loki.Service.Port,
+					TargetPort: intstr.FromInt(lokiPort),
+					Protocol:   corev1.ProtocolTCP,
+				},
+			},
+		},
+	}
+
+	// 如果是NodePort类型且指定了NodePort，设置它
+	if loki.Service.Type == "NodePort" && loki.Service.NodePort > 0 {
+		service.Spec.Ports[0].NodePort = loki.Service.NodePort
+	}
+
+	// 合并用户自定义的服务标签
+	for k, v := range loki.Service.Labels {
+		service.Labels[k] = v
+	}
+
+	return service
+}
+
+// buildPromtailDaemonSet 构建Promtail DaemonSet，config为Promtail配置，用于配置变化时触发滚动更新
+// Promtail需要读取节点上root用户的日志文件，以root运行但丢弃所有capabilities
+func (r *MonitorStackReconciler) buildPromtailDaemonSet(monitorStack *monitoringv1.MonitorStack, config string) *appsv1.DaemonSet {
+	promtail := monitorStack.Spec.Loki.Promtail
+	labels := r.getLabels(monitorStack, "promtail")
+
+	return &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      r.getPromtailName(monitorStack),
+			Namespace: monitorStack.Namespace,
+			Labels:    labels,
+		},
+		Spec: appsv1.DaemonSetSpec{
+			Selector: &metav1.LabelSelector{
+				MatchLabels: labels,
+			},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+					// 配置变化时触发滚动更新
+					Annotations: map[string]string{
+						configHashAnnotation: computeHash(config),
+					},
+				},
+				Spec: corev1.PodSpec{
+					ServiceAccountName: r.getPromtailName(monitorStack),
+					SecurityContext: &corev1.PodSecurityContext{
+						RunAsUser:  &[]int64{0}[0],
+						RunAsGroup: &[]int64{0}[0],
+						SeccompProfile: &corev1.SeccompProfile{
+							Type: corev1.SeccompProfileTypeRuntimeDefault,
+						},
+					},
+					Tolerations: promtail.Tolerations,
+					Containers: []corev1.Container{
+						{
+							Name:  "promtail",
+							Image: r.rewriteImage(buildImage(promtail.Image, promtail.Tag, "")),
+							Args: []string{
+								"-config.file=/etc/promtail/promtail.yaml", // 配置文件路径
+								"-config.expand-env=true",                  // 展开配置中的环境变量
+							},
+							Env: []corev1.EnvVar{
+								{
+									Name: "HOSTNAME",
+									ValueFrom: &corev1.EnvVarSource{
+										FieldRef: &corev1.ObjectFieldSelector{FieldPath: "spec.nodeName"},
+									},
+								},
+							},
+							Ports: []corev1.ContainerPort{
+								{Name: "http-metrics", ContainerPort: promtailPort, Protocol: corev1.ProtocolTCP},
+							},
+							SecurityContext: &corev1.SecurityContext{
+								AllowPrivilegeEscalation: &[]bool{false}[0],
+								ReadOnlyRootFilesystem:   &[]bool{true}[0],
+								Capabilities: &corev1.Capabilities{
+									Drop: []corev1.Capability{"ALL"},
+								},
+							},
+							VolumeMounts: []corev1.VolumeMount{
+								{Name: "config", MountPath: "/etc/promtail", ReadOnly: true},
+								{Name: "positions", MountPath: "/run/promtail"},
+								{Name: "pods", MountPath: "/var/log/pods", ReadOnly: true},
+							},
+							Resources: r.buildResourceRequirements(promtail.Resources),
+							ReadinessProbe: &corev1.Probe{
+								ProbeHandler: corev1.ProbeHandler{
+									HTTPGet: &corev1.HTTPGetAction{Path: "/ready", Port: intstr.FromInt(promtailPort)},
+								},
+								InitialDelaySeconds: 10,
+								PeriodSeconds:       10,
+								TimeoutSeconds:      3,
+								FailureThreshold:    5,
+							},
+						},
+					},
+					Volumes: []corev1.Volume{
+						{
+							Name: "config",
+							VolumeSource: corev1.VolumeSource{
+								ConfigMap: &corev1.ConfigMapVolumeSource{
+									LocalObjectReference: corev1.LocalObjectReference{
+										Name: r.getPromtailConfigMapName(monitorStack),
+									},
+								},
+							},
+						},
+						// 读取位置只在Pod的生命周期内保存，不在节点上写入文件
+						// Pod重建后会重新推送仍在节点上的日志，Loki丢弃时间戳和内容都相同的重复日志
+						{
+							Name:         "positions",
+							VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+						},
+						{
+							Name: "pods",
+							VolumeSource: corev1.VolumeSource{
+								HostPath: &corev1.HostPathVolumeSource{
+									Path: "/var/log/pods",
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// createConfigMap 创建或更新ConfigMap
+func (r *MonitorStackReconciler) createConfigMap(ctx context.Context, monitorStack *monitoringv1.MonitorStack, name, component string, data map[string]string) error {
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: monitorStack.Namespace,
+			Labels:    r.getLabels(monitorStack, component),
+		},
+		Data: data,
+	}
+
+	// 设置OwnerReference，确保级联删除
+	if err := controllerutil.SetControllerReference(monitorStack, configMap, r.Scheme); err != nil {
+		return err
+	}
+
+	existing := &corev1.ConfigMap{}
+	err := r.Get(ctx, types.NamespacedName{Name: configMap.Name, Namespace: configMap.Namespace}, existing)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return r.Create(ctx, configMap)
+		}
+		return err
+	}
+
+	existing.Data = configMap.Data
+	existing.Labels = configMap.Labels
+	return r.Update(ctx, existing)
+}
+
+// createLokiPVC 创建Loki的PVC，已存在时只允许扩容
+func (r *MonitorStackReconciler) createLokiPVC(ctx context.Context, monitorStack *monitoringv1.MonitorStack) error {
+	storage := monitorStack.Spec.Loki.Storage
+	desired, err := resource.ParseQuantity(storage.Size)
+	if err != nil {
+		return fmt.Errorf("invalid storage size %q: %w", storage.Size, err)
+	}
+
+	pvc := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      r.getLokiPVCName(monitorStack),
+			Namespace: monitorStack.Namespace,
+			Labels:    r.getLabels(monitorStack, "loki"),
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes: []corev1.PersistentVolumeAccessMode{
+				corev1.ReadWriteOnce,
+			},
+			Resources: corev1.VolumeResourceRequirements{
+				Requests: corev1.ResourceList{
+					corev1.ResourceStorage: desired,
+				},
+			},
+		},
+	}
+
+	// 如果指定了StorageClass，设置它
+	if storage.StorageClass != "" {
+		pvc.Spec.StorageClassName = &storage.StorageClass
+	}
+
+	// 设置OwnerReference
+	if err := controllerutil.SetControllerReference(monitorStack, pvc, r.Scheme); err != nil {
+		return err
+	}
+
+	existing := &corev1.PersistentVolumeClaim{}
+	err = r.Get(ctx, types.NamespacedName{Name: pvc.Name, Namespace: pvc.Namespace}, existing)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return r.Create(ctx, pvc)
+		}
+		return err
+	}
+	// 重新创建MonitorStack后接管之前保留下来的PVC
+	if err := r.adoptPVC(ctx, monitorStack, existing); err != nil {
+		return err
+	}
+	return r.expandPVC(ctx, existing, desired)
+}
+
+// cleanupLokiPVC 按保留策略处理Loki的PVC
+// deleting表示MonitorStack正在被删除，否则为禁用Loki或不再使用本地卷
+func (r *MonitorStackReconciler) cleanupLokiPVC(ctx context.Context, monitorStack *monitoringv1.MonitorStack, deleting bool) error {
+	pvc := &corev1.PersistentVolumeClaim{}
+	err := r.Get(ctx, types.NamespacedName{
+		Name:      r.getLokiPVCName(monitorStack),
+		Namespace: monitorStack.Namespace,
+	}, pvc)
+	if err != nil {
+		return client.IgnoreNotFound(err)
+	}
+
+	var retentionPolicy string
+	if monitorStack.Spec.Loki != nil {
+		retentionPolicy = monitorStack.Spec.Loki.Storage.RetentionPolicy
+	}
+	return r.applyPVCRetentionPolicy(ctx, monitorStack, pvc, retentionPolicy, deleting)
+}
+
+// createLokiDeployment 创建或更新Loki Deployment
+func (r *MonitorStackReconciler) createLokiDeployment(ctx context.Context, monitorStack *monitoringv1.MonitorStack) error {
+	deployment := r.buildLokiDeployment(monitorStack)
+
+	// 设置OwnerReference
+	if err := controllerutil.SetControllerReference(monitorStack, deployment, r.Scheme); err != nil {
+		return err
+	}
+
+	existing := &appsv1.Deployment{}
+	err := r.Get(ctx, types.NamespacedName{Name: deployment.Name, Namespace: deployment.Namespace}, existing)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return r.Create(ctx, deployment)
+		}
+		return err
+	}
+
+	existing.Spec = deployment.Spec
+	existing.Labels = deployment.Labels
+	return r.Update(ctx, existing)
+}
+
+// createLokiService 创建或更新Loki Service
+func (r *MonitorStackReconciler) createLokiService(ctx context.Context, monitorStack *monitoringv1.MonitorStack) error {
+	service := r.buildLokiService(monitorStack)
+
+	// 设置OwnerReference
+	if err := controllerutil.SetControllerReference(monitorStack, service, r.Scheme); err != nil {
+		return err
+	}
+
+	existing := &corev1.Service{}
+	err := r.Get(ctx, types.NamespacedName{Name: service.Name, Namespace: service.Namespace}, existing)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return r.Create(ctx, service)
+		}
+		return err
+	}
+
+	existing.Spec.Ports = service.Spec.Ports
+	existing.Spec.Type = service.Spec.Type
+	existing.Labels = service.Labels
+	return r.Update(ctx, existing)
+}
+
+// createPromtailServiceAccount 创建Promtail ServiceAccount
+func (r *MonitorStackReconciler) createPromtailServiceAccount(ctx context.Context, monitorStack *monitoringv1.MonitorStack) error {
+	serviceAccount := &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      r.getPromtailName(monitorStack),
+			Namespace: monitorStack.Namespace,
+			Labels:    r.getLabels(monitorStack, "promtail"),
+		},
+	}
+
+	// 设置OwnerReference
+	if err := controllerutil.SetControllerReference(monitorStack, serviceAccount, r.Scheme); err != nil {
+		return err
+	}
+
+	existing := &corev1.ServiceAccount{}
+	err := r.Get(ctx, types.NamespacedName{Name: serviceAccount.Name, Namespace: serviceAccount.Namespace}, existing)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return r.Create(ctx, serviceAccount)
+		}
+		return err
+	}
+
+	existing.Labels = serviceAccount.Labels
+	return r.Update(ctx, existing)
+}
+
+// createPromtailClusterRBAC 创建Promtail的ClusterRole和ClusterRoleBinding
+func (r *MonitorStackReconciler) createPromtailClusterRBAC(ctx context.Context, monitorStack *monitoringv1.MonitorStack) error {
+	name := r.getPromtailClusterRoleName(monitorStack)
+	labels := r.getPromtailClusterRBACLabels(monitorStack)
+
+	clusterRole := &rbacv1.ClusterRole{}
+	err := r.Get(ctx, types.NamespacedName{Name: name}, clusterRole)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	clusterRole.Name = name
+	clusterRole.Labels = labels
+	clusterRole.Rules = promtailClusterRoleRules
+	if errors.IsNotFound(err) {
+		if err := r.Create(ctx, clusterRole); err != nil {
+			return err
+		}
+	} else if err := r.Update(ctx, clusterRole); err != nil {
+		return err
+	}
+
+	binding := &rbacv1.ClusterRoleBinding{}
+	err = r.Get(ctx, types.NamespacedName{Name: name}, binding)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	binding.Name = name
+	binding.Labels = labels
+	binding.Subjects = []rbacv1.Subject{
+		{
+			Kind:      rbacv1.ServiceAccountKind,
+			Name:      r.getPromtailName(monitorStack),
+			Namespace: monitorStack.Namespace,
+		},
+	}
+	if errors.IsNotFound(err) {
+		binding.RoleRef = rbacv1.RoleRef{
+			APIGroup: rbacv1.GroupName,
+			Kind:     "ClusterRole",
+			Name:     name,
+		}
+		return r.Create(ctx, binding)
+	}
+	// roleRef不可修改，只更新subjects
+	return r.Update(ctx, binding)
+}
+
+// createPromtailDaemonSet 创建或更新Promtail DaemonSet
+func (r *MonitorStackReconciler) createPromtailDaemonSet(ctx context.Context, monitorStack *monitoringv1.MonitorStack, config string) error {
+	daemonSet := r.buildPromtailDaemonSet(monitorStack, config)
+
+	// 设置OwnerReference
+	if err := controllerutil.SetControllerReference(monitorStack, daemonSet, r.Scheme); err != nil {
+		return err
+	}
+
+	existing := &appsv1.DaemonSet{}
+	err := r.Get(ctx, types.NamespacedName{Name: daemonSet.Name, Namespace: daemonSet.Namespace}, existing)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return r.Create(ctx, daemonSet)
+		}
+		return err
+	}
+
+	existing.Spec = daemonSet.Spec
+	existing.Labels = daemonSet.Labels
+	return r.Update(ctx, existing)
+}
+
+// reconcileLoki 协调Loki和Promtail资源
+func (r *MonitorStackReconciler) reconcileLoki(ctx context.Context, monitorStack *monitoringv1.MonitorStack) error {
+	if err := r.createConfigMap(ctx, monitorStack, r.getLokiConfigMapName(monitorStack), "loki",
+		map[string]string{"loki.yaml": r.buildLokiConfig(monitorStack)}); err != nil {
+		return fmt.Errorf("failed to create Loki ConfigMap: %w", err)
+	}
+
+	if monitorStack.Spec.Loki.Storage.Size != "" {
+		if err := r.createLokiPVC(ctx, monitorStack); err != nil {
+			return fmt.Errorf("failed to create Loki PVC: %w", err)
+		}
+	} else if err := r.cleanupLokiPVC(ctx, monitorStack, false); err != nil {
+		return fmt.Errorf("failed to cleanup Loki PVC: %w", err)
+	}
+
+	if err := r.createLokiDeployment(ctx, monitorStack); err != nil {
+		return fmt.Errorf("failed to create Loki Deployment: %w", err)
+	}
+
+	if err := r.createLokiService(ctx, monitorStack); err != nil {
+		return fmt.Errorf("failed to create Loki Service: %w", err)
+	}
+
+	if isPromtailEnabled(monitorStack) {
+		namespaces, err := r.resolvePromtailNamespaces(ctx, monitorStack)
+		if err != nil {
+			return fmt.Errorf("failed to resolve Promtail namespaces: %w", err)
+		}
+		config := r.buildPromtailConfig(monitorStack, namespaces)
+		if err := r.createPromtailServiceAccount(ctx, monitorStack); err != nil {
+			return fmt.Errorf("failed to create Promtail ServiceAccount: %w", err)
+		}
+		if err := r.createPromtailClusterRBAC(ctx, monitorStack); err != nil {
+			return fmt.Errorf("failed to create Promtail RBAC: %w", err)
+		}
+		if err := r.createConfigMap(ctx, monitorStack, r.getPromtailConfigMapName(monitorStack), "promtail",
+			map[string]string{"promtail.yaml": config}); err != nil {
+			return fmt.Errorf("failed to create Promtail ConfigMap: %w", err)
+		}
+		if err := r.createPromtailDaemonSet(ctx, monitorStack, config); err != nil {
+			return fmt.Errorf("failed to create Promtail DaemonSet: %w", err)
+		}
+	} else {
+		meta.RemoveStatusCondition(&monitorStack.Status.Conditions, conditionTypeNodeLogCollectionAllowed)
+		if err := r.cleanupPromtailResources(ctx, monitorStack); err != nil {
+			return fmt.Errorf("failed to cleanup Promtail resources: %w", err)
+		}
+	}
+
+	return r.updateLokiStatus(ctx, monitorStack)
+}
+
+// updateLokiStatus 根据Deployment和DaemonSet更新Loki和Promtail状态
+func (r *MonitorStackReconciler) updateLokiStatus(ctx context.Context, monitorStack *monitoringv1.MonitorStack) error {
+	if err := r.refreshComponentStatus(ctx, monitorStack, r.getLokiName(monitorStack), &monitorStack.Status.LokiStatus); err != nil {
+		return err
+	}
+	if monitorStack.Status.LokiStatus.Ready {
+		monitorStack.Status.LokiStatus.Endpoint = r.getLokiURL(monitorStack)
+	}
+
+	if !isPromtailEnabled(monitorStack) {
+		monitorStack.Status.PromtailStatus = monitoringv1.ComponentStatus{}
+		return nil
+	}
+
+	status := &monitorStack.Status.PromtailStatus
+	daemonSet := &appsv1.DaemonSet{}
+	if err := r.Get(ctx, types.NamespacedName{Name: r.getPromtailName(monitorStack), Namespace: monitorStack.Namespace}, daemonSet); err != nil {
+		if errors.IsNotFound(err) {
+			*status = monitoringv1.ComponentStatus{Message: "Not Found"}
+			return nil
+		}
+		return err
+	}
+	status.Replicas = daemonSet.Status.NumberReady
+	status.Ready = daemonSet.Status.DesiredNumberScheduled > 0 &&
+		daemonSet.Status.NumberReady == daemonSet.Status.DesiredNumberScheduled
+	if status.Ready {
+		status.Message = "Ready"
+	} else {
+		status.Message = fmt.Sprintf("%d/%d nodes ready", daemonSet.Status.NumberReady, daemonSet.Status.DesiredNumberScheduled)
+	}
+	return nil
+}
+
+// isLokiReady 判断Loki和Promtail是否就绪，未启用Loki时视为就绪
+func isLokiReady(monitorStack *monitoringv1.MonitorStack) bool {
+	if !isLokiEnabled(monitorStack) {
+		return true
+	}
+	return monitorStack.Status.LokiStatus.Ready &&
+		(!isPromtailEnabled(monitorStack) || monitorStack.Status.PromtailStatus.Ready)
+}
+
+// cleanupLokiResources 删除Loki和Promtail资源，用于禁用Loki和删除MonitorStack
+// PVC由cleanupLokiPVC按保留策略处理
+func (r *MonitorStackReconciler) cleanupLokiResources(ctx context.Context, monitorStack *monitoringv1.MonitorStack) error {
+	for _, obj := range []client.Object{
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: r.getLokiName(monitorStack), Namespace: monitorStack.Namespace}},
+		&corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: r.getLokiName(monitorStack), Namespace: monitorStack.Namespace}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: r.getLokiConfigMapName(monitorStack), Namespace: monitorStack.Namespace}},
+	} {
+		if err := r.deleteOwnedObject(ctx, monitorStack, obj); err != nil {
+			return err
+		}
+	}
+	return r.cleanupPromtailResources(ctx, monitorStack)
+}
+
+// cleanupPromtailResources 删除Promtail资源，包括不会被垃圾回收的ClusterRole和ClusterRoleBinding
+func (r *MonitorStackReconciler) cleanupPromtailResources(ctx context.Context, monitorStack *monitoringv1.MonitorStack) error {
+	for _, obj := range []client.Object{
+		&appsv1.DaemonSet{ObjectMeta: metav1.ObjectMeta{Name: r.getPromtailName(monitorStack), Namespace: monitorStack.Namespace}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: r.getPromtailConfigMapName(monitorStack), Namespace: monitorStack.Namespace}},
+		&corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: r.getPromtailName(monitorStack), Namespace: monitorStack.Namespace}},
+	} {
+		if err := r.deleteOwnedObject(ctx, monitorStack, obj); err != nil {
+			return err
+		}
+	}
+
+	selector := client.MatchingLabels{
+		monitorStackNameLabel:         monitorStack.Name,
+		monitorStackNamespaceLabel:    monitorStack.Namespace,
+		"app.kubernetes.io/component": "promtail",
+	}
+	bindings := &rbacv1.ClusterRoleBindingList{}
+	if err := r.List(ctx, bindings, selector); err != nil {
+		return err
+	}
+	for i := range bindings.Items {
+		if err := client.IgnoreNotFound(r.Delete(ctx, &bindings.Items[i])); err != nil {
+			return err
+		}
+	}
+	clusterRoles := &rbacv1.ClusterRoleList{}
+	if err := r.List(ctx, clusterRoles, selector); err != nil {
+		return err
+	}
+	for i := range clusterRoles.Items {
+		if err := client.IgnoreNotFound(r.Delete(ctx, &clusterRoles.Items[i])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
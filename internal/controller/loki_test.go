@@ -0,0 +1,224 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	monitoringv1 "github.com/ciliverse/monitor-operator/api/v1"
+)
+
+var _ = Describe("Loki", func() {
+	r := &MonitorStackReconciler{}
+
+	newLokiMonitorStack := func() *monitoringv1.MonitorStack {
+		monitorStack := newTestMonitorStack()
+		monitorStack.Spec.Loki = &monitoringv1.LokiSpec{Enabled: true}
+		r.setLokiDefaults(monitorStack.Spec.Loki)
+		return monitorStack
+	}
+
+	It("registers a Loki datasource after the Prometheus datasource", func() {
+		monitorStack := newLokiMonitorStack()
+
+		datasources := r.getGrafanaDatasources(monitorStack)
+		Expect(datasources).To(HaveLen(2))
+		Expect(datasources[0].Type).To(Equal("prometheus"))
+		Expect(datasources[1].Name).To(Equal("test-loki"))
+		Expect(datasources[1].Type).To(Equal("loki"))
+		Expect(datasources[1].URL).To(Equal("http://test-loki.monitoring.svc:3100"))
+		Expect(datasources[1].IsDefault).To(BeFalse())
+
+		By("not registering datasources when disableAutoDatasource is set")
+		monitorStack.Spec.Grafana.DisableAutoDatasource = true
+		Expect(r.getGrafanaDatasources(monitorStack)).To(BeEmpty())
+	})
+
+	It("links trace IDs to the first tracing datasource", func() {
+		monitorStack := newLokiMonitorStack()
+		monitorStack.Spec.Grafana.Datasources = []monitoringv1.DatasourceSpec{
+			{Name: "Tempo", Type: "tempo", UID: "tempo", URL: "http://tempo:3200"},
+		}
+
+		datasources := r.getGrafanaDatasources(monitorStack)
+		Expect(datasources).To(HaveLen(3))
+		Expect(string(datasources[2].JSONData.Raw)).To(ContainSubstring(`"datasourceUid":"tempo"`))
+		// 不修改spec中的数据源
+		Expect(monitorStack.Spec.Grafana.Datasources).To(HaveLen(1))
+	})
+
+	It("does not duplicate a Loki datasource configured by the user", func() {
+		monitorStack := newLokiMonitorStack()
+		monitorStack.Spec.Grafana.Datasources = []monitoringv1.DatasourceSpec{
+			{Name: "Logs", Type: "loki", URL: "http://test-loki.monitoring:3100"},
+		}
+
+		datasources := r.getGrafanaDatasources(monitorStack)
+		Expect(datasources).To(HaveLen(2))
+		Expect(datasources[0].Name).To(Equal("Logs"))
+		Expect(datasources[1].Type).To(Equal("prometheus"))
+	})
+})
+
+var _ = Describe("Loki PVC retention", func() {
+	ctx := context.Background()
+
+	newLokiMonitorStack := func(retentionPolicy string) *monitoringv1.MonitorStack {
+		monitorStack := newTestMonitorStack()
+		monitorStack.UID = "test-uid"
+		monitorStack.Spec.Loki = &monitoringv1.LokiSpec{
+			Enabled: true,
+			Storage: monitoringv1.LokiStorageSpec{Size: "10Gi", RetentionPolicy: retentionPolicy},
+		}
+		return monitorStack
+	}
+
+	DescribeTable("cleanupLokiPVC",
+		func(policy string, deleting bool, expectDeleted, expectOwned bool) {
+			monitorStack := newLokiMonitorStack(policy)
+			r := newFakeReconciler()
+			Expect(r.createLokiPVC(ctx, monitorStack)).To(Succeed())
+
+			Expect(r.cleanupLokiPVC(ctx, monitorStack, deleting)).To(Succeed())
+
+			current := &corev1.PersistentVolumeClaim{}
+			err := r.Get(ctx, types.NamespacedName{Name: r.getLokiPVCName(monitorStack), Namespace: monitorStack.Namespace}, current)
+			if expectDeleted {
+				Expect(errors.IsNotFound(err)).To(BeTrue())
+				return
+			}
+			Expect(err).NotTo(HaveOccurred())
+			Expect(metav1.IsControlledBy(current, monitorStack)).To(Equal(expectOwned))
+		},
+		Entry("orphans the PVC by default when the stack is deleted", "", true, false, false),
+		Entry("keeps the PVC by default when Loki is disabled", "", false, false, true),
+		Entry("leaves RetainOnDisable PVCs to garbage collection", retentionPolicyRetainOnDisable, true, false, true),
+		Entry("deletes the PVC with Delete", retentionPolicyDelete, false, true, false),
+	)
+
+	It("adopts a retained PVC when the stack is recreated", func() {
+		monitorStack := newLokiMonitorStack("")
+		r := newFakeReconciler()
+		Expect(r.createLokiPVC(ctx, monitorStack)).To(Succeed())
+		Expect(r.cleanupLokiPVC(ctx, monitorStack, true)).To(Succeed())
+
+		monitorStack.UID = "recreated-uid"
+		Expect(r.createLokiPVC(ctx, monitorStack)).To(Succeed())
+
+		current := &corev1.PersistentVolumeClaim{}
+		Expect(r.Get(ctx, types.NamespacedName{Name: r.getLokiPVCName(monitorStack), Namespace: monitorStack.Namespace}, current)).To(Succeed())
+		Expect(metav1.IsControlledBy(current, monitorStack)).To(BeTrue())
+	})
+
+	It("refuses to adopt a PVC managed by something else", func() {
+		monitorStack := newLokiMonitorStack("")
+		r := newFakeReconciler()
+		pvc := &corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: r.getLokiPVCName(monitorStack), Namespace: monitorStack.Namespace},
+		}
+		Expect(r.Create(ctx, pvc)).To(Succeed())
+
+		Expect(r.createLokiPVC(ctx, monitorStack)).To(MatchError(ContainSubstring("not managed by this MonitorStack")))
+		Expect(controllerutil.HasControllerReference(pvc)).To(BeFalse())
+	})
+})
+
+var _ = Describe("Promtail", func() {
+	ctx := context.Background()
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "monitoring"}}
+
+	newPromtailMonitorStack := func() *monitoringv1.MonitorStack {
+		monitorStack := newTestMonitorStack()
+		monitorStack.Spec.Loki = &monitoringv1.LokiSpec{Enabled: true, Promtail: monitoringv1.PromtailSpec{Enabled: true}}
+		(&MonitorStackReconciler{}).setDefaultValues(monitorStack)
+		return monitorStack
+	}
+
+	It("pins the Promtail image and keeps positions off the node", func() {
+		monitorStack := newPromtailMonitorStack()
+		Expect(monitorStack.Spec.Loki.Promtail.Tag).To(Equal(defaultPromtailTag))
+
+		r := &MonitorStackReconciler{}
+		daemonSet := r.buildPromtailDaemonSet(monitorStack, r.buildPromtailConfig(monitorStack, nil))
+		Expect(daemonSet.Spec.Template.Spec.Containers[0].Image).To(Equal("grafana/promtail:" + defaultPromtailTag))
+		for _, volume := range daemonSet.Spec.Template.Spec.Volumes {
+			if volume.Name == "positions" {
+				Expect(volume.HostPath).To(BeNil())
+				Expect(volume.EmptyDir).NotTo(BeNil())
+			}
+		}
+	})
+
+	It("keeps only the allowed namespaces", func() {
+		r := &MonitorStackReconciler{}
+		monitorStack := newPromtailMonitorStack()
+
+		config := r.buildPromtailConfig(monitorStack, []string{"team-a", "team-b"})
+		Expect(config).To(ContainSubstring("            - team-a\n"))
+		Expect(config).To(ContainSubstring("regex: 'team-a|team-b'\n        action: keep"))
+
+		Expect(r.buildPromtailConfig(monitorStack, nil)).NotTo(ContainSubstring("action: keep"))
+		Expect(r.buildPromtailConfig(monitorStack, []string{})).To(ContainSubstring("regex: ''\n        action: keep"))
+	})
+
+	It("collects only the own namespace unless node-level collection is allowed", func() {
+		monitorStack := newPromtailMonitorStack()
+
+		By("defaulting to the MonitorStack namespace")
+		namespaces, err := newFakeReconciler(namespace).resolvePromtailNamespaces(ctx, monitorStack)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(namespaces).To(Equal([]string{"monitoring"}))
+
+		By("allowing all namespaces through a MonitorStackPolicy")
+		allow := &monitoringv1.MonitorStackPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: "logs"},
+			Spec:       monitoringv1.MonitorStackPolicySpec{AllowNodeLogCollection: true},
+		}
+		namespaces, err = newFakeReconciler(namespace, allow).resolvePromtailNamespaces(ctx, monitorStack)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(namespaces).To(BeNil())
+
+		By("allowing all namespaces for a ClusterMonitorStack")
+		clusterStack := &monitoringv1.ClusterMonitorStack{ObjectMeta: metav1.ObjectMeta{Name: "test", UID: "cluster-uid"}}
+		r := newFakeReconciler(namespace, clusterStack)
+		Expect(controllerutil.SetControllerReference(clusterStack, monitorStack, r.Scheme)).To(Succeed())
+		namespaces, err = r.resolvePromtailNamespaces(ctx, monitorStack)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(namespaces).To(BeNil())
+
+		By("rejecting an owner reference with a different UID")
+		monitorStack.OwnerReferences[0].UID = "forged-uid"
+		namespaces, err = r.resolvePromtailNamespaces(ctx, monitorStack)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(namespaces).To(Equal([]string{"monitoring"}))
+
+		By("following the resolved target namespaces")
+		monitorStack.Spec.Prometheus.TargetNamespaces = &monitoringv1.TargetNamespacesSpec{Names: []string{"team-a"}}
+		monitorStack.Status.TargetNamespaces = []string{"team-a"}
+		namespaces, err = r.resolvePromtailNamespaces(ctx, monitorStack)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(namespaces).To(Equal([]string{"team-a"}))
+	})
+})
@@ -22,16 +22,24 @@ import (
 	"time"
 
 	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 
 	monitoringv1 "github.com/ciliverse/monitor-operator/api/v1"
 )
@@ -41,15 +49,30 @@ import (
 type MonitorStackReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
+
+	// ImageRegistry 私有镜像仓库地址，默认仓库的镜像会改写到该仓库
+	ImageRegistry string
+
+	// Recorder 记录MonitorStack相关的事件
+	Recorder record.EventRecorder
 }
 
 //+kubebuilder:rbac:groups=monitoring.cillian.website,resources=monitorstacks,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=monitoring.cillian.website,resources=monitorstacks/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=monitoring.cillian.website,resources=monitorstacks/finalizers,verbs=update
 //+kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=apps,resources=daemonsets,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups="",resources=services,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups="",resources=persistentvolumeclaims,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups="",resources=serviceaccounts,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=storage.k8s.io,resources=storageclasses,verbs=get;list;watch
+//+kubebuilder:rbac:groups=batch,resources=cronjobs,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch
+//+kubebuilder:rbac:groups=autoscaling,resources=horizontalpodautoscalers,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=policy,resources=poddisruptionbudgets,verbs=get;list;watch;create;update;patch;delete
 
 // Reconcile 是主要的kubernetes协调循环的一部分
 // 它负责确保MonitorStack资源的实际状态与期望状态一致
@@ -90,7 +113,54 @@ func (r *MonitorStackReconciler) Reconcile(ctx context.Context, req ctrl.Request
 		}
 	}
 
-	// 步骤5: 协调Prometheus组件
+	// 步骤5: 暂停协调时只刷新状态，不修改任何子资源
+	if isPaused(&monitorStack) {
+		logger.Info("Reconciliation is paused, only refreshing status")
+		if err := r.updatePausedStatus(ctx, &monitorStack); err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{RequeueAfter: time.Minute * 5}, nil
+	}
+	r.markResumed(&monitorStack)
+
+	// 步骤6: 继承MonitorStackClass中的配置，再补全默认值
+	if err := r.applyMonitorStackClass(ctx, &monitorStack); err != nil {
+		logger.Error(err, "Failed to apply MonitorStackClass")
+		r.updateStatus(ctx, &monitorStack, "Failed", fmt.Sprintf("MonitorStackClass resolution failed: %v", err))
+		return ctrl.Result{RequeueAfter: time.Minute}, err
+	}
+	r.setDefaultValues(&monitorStack)
+
+	// 配置无效时不修改子资源，等待用户修改spec后重新协调
+	if err := r.validateMonitorStack(&monitorStack); err != nil {
+		logger.Info("MonitorStack spec is invalid, skipping reconciliation", "reason", err.Error())
+		r.setCondition(&monitorStack, conditionTypeSpecValid, metav1.ConditionFalse, "InvalidSpec", err.Error())
+		r.updateStatus(ctx, &monitorStack, "Failed", fmt.Sprintf("Invalid spec: %v", err))
+		return ctrl.Result{}, nil
+	}
+	r.setCondition(&monitorStack, conditionTypeSpecValid, metav1.ConditionTrue, "Valid", "Spec passed validation")
+
+	// 步骤7: 检查租户策略，违反策略时不修改子资源
+	compliant, err := r.enforcePolicies(ctx, &monitorStack)
+	if err != nil {
+		logger.Error(err, "Failed to check MonitorStackPolicy")
+		r.updateStatus(ctx, &monitorStack, "Failed", fmt.Sprintf("Policy check failed: %v", err))
+		return ctrl.Result{RequeueAfter: time.Minute}, err
+	}
+	if !compliant {
+		logger.Info("MonitorStack violates MonitorStackPolicy, skipping reconciliation")
+		r.updateStatus(ctx, &monitorStack, "Failed", "MonitorStack violates MonitorStackPolicy, see the PolicyCompliant condition")
+		return ctrl.Result{RequeueAfter: time.Minute * 5}, nil
+	}
+
+	// 步骤8: 规划镜像升级，确定各组件本次部署的镜像
+	if err := r.planUpgrades(ctx, &monitorStack); err != nil {
+		logger.Error(err, "Failed to plan upgrades")
+		r.updateStatus(ctx, &monitorStack, "Failed", fmt.Sprintf("Upgrade planning failed: %v", err))
+		return ctrl.Result{RequeueAfter: time.Minute}, err
+	}
+
+	// 步骤9: 协调Prometheus组件
 	if monitorStack.Spec.Prometheus.Enabled {
 		logger.Info("Reconciling Prometheus component")
 		if err := r.reconcilePrometheus(ctx, &monitorStack); err != nil {
@@ -104,9 +174,39 @@ func (r *MonitorStackReconciler) Reconcile(ctx context.Context, req ctrl.Request
 		if err := r.cleanupPrometheusResources(ctx, &monitorStack); err != nil {
 			logger.Error(err, "Failed to cleanup Prometheus resources")
 		}
+		if err := r.cleanupPrometheusPVC(ctx, &monitorStack, false); err != nil {
+			logger.Error(err, "Failed to cleanup Prometheus PVC")
+		}
+		if err := r.deletePrometheusDiscoveryRBAC(ctx, &monitorStack, nil); err != nil {
+			logger.Error(err, "Failed to cleanup Prometheus discovery RBAC")
+		}
+		monitorStack.Status.PrometheusStatus = monitoringv1.ComponentStatus{}
+		monitorStack.Status.PrometheusShards = nil
+		monitorStack.Status.TargetNamespaces = nil
+		meta.RemoveStatusCondition(&monitorStack.Status.Conditions, conditionTypeTargetNamespacesAllowed)
+	}
+
+	// 步骤10: 协调Loki组件，Grafana的Loki数据源依赖Loki的配置
+	if isLokiEnabled(&monitorStack) {
+		logger.Info("Reconciling Loki component")
+		if err := r.reconcileLoki(ctx, &monitorStack); err != nil {
+			logger.Error(err, "Failed to reconcile Loki")
+			r.updateStatus(ctx, &monitorStack, "Failed", fmt.Sprintf("Loki reconciliation failed: %v", err))
+			return ctrl.Result{RequeueAfter: time.Minute}, err
+		}
+	} else {
+		// 如果Loki被禁用，清理相关资源
+		if err := r.cleanupLokiResources(ctx, &monitorStack); err != nil {
+			logger.Error(err, "Failed to cleanup Loki resources")
+		}
+		if err := r.cleanupLokiPVC(ctx, &monitorStack, false); err != nil {
+			logger.Error(err, "Failed to cleanup Loki PVC")
+		}
+		monitorStack.Status.LokiStatus = monitoringv1.ComponentStatus{}
+		monitorStack.Status.PromtailStatus = monitoringv1.ComponentStatus{}
 	}
 
-	// 步骤6: 协调Grafana组件
+	// 步骤11: 协调Grafana组件
 	if monitorStack.Spec.Grafana.Enabled {
 		logger.Info("Reconciling Grafana component")
 		if err := r.reconcileGrafana(ctx, &monitorStack); err != nil {
@@ -120,14 +220,19 @@ func (r *MonitorStackReconciler) Reconcile(ctx context.Context, req ctrl.Request
 		if err := r.cleanupGrafanaResources(ctx, &monitorStack); err != nil {
 			logger.Error(err, "Failed to cleanup Grafana resources")
 		}
+		monitorStack.Status.GrafanaStatus = monitoringv1.ComponentStatus{}
 	}
 
-	// 步骤7: 更新整体状态
+	// 步骤12: 更新整体状态
 	if err := r.updateOverallStatus(ctx, &monitorStack); err != nil {
 		return ctrl.Result{}, err
 	}
 
 	logger.Info("Successfully reconciled MonitorStack")
+	// 升级进行中时频繁检查，及时发现超时并回滚
+	if isUpgrading(&monitorStack) {
+		return ctrl.Result{RequeueAfter: upgradeRequeueInterval}, nil
+	}
 	// 每5分钟重新协调一次，确保状态同步
 	return ctrl.Result{RequeueAfter: time.Minute * 5}, nil
 }
@@ -144,6 +249,28 @@ func (r *MonitorStackReconciler) handleDeletion(ctx context.Context, monitorStac
 		return ctrl.Result{RequeueAfter: time.Second * 30}, err
 	}
 
+	// 按保留策略处理PVC
+	if err := r.cleanupPrometheusPVC(ctx, monitorStack, true); err != nil {
+		logger.Error(err, "Failed to cleanup Prometheus PVC during deletion")
+		return ctrl.Result{RequeueAfter: time.Second * 30}, err
+	}
+
+	// 其他命名空间中的服务发现权限不会被垃圾回收，需要主动删除
+	if err := r.deletePrometheusDiscoveryRBAC(ctx, monitorStack, nil); err != nil {
+		logger.Error(err, "Failed to cleanup Prometheus discovery RBAC during deletion")
+		return ctrl.Result{RequeueAfter: time.Second * 30}, err
+	}
+
+	// Promtail的ClusterRole和ClusterRoleBinding不会被垃圾回收，需要主动删除
+	if err := r.cleanupLokiResources(ctx, monitorStack); err != nil {
+		logger.Error(err, "Failed to cleanup Loki resources during deletion")
+		return ctrl.Result{RequeueAfter: time.Second * 30}, err
+	}
+	if err := r.cleanupLokiPVC(ctx, monitorStack, true); err != nil {
+		logger.Error(err, "Failed to cleanup Loki PVC during deletion")
+		return ctrl.Result{RequeueAfter: time.Second * 30}, err
+	}
+
 	// 清理Grafana资源
 	if err := r.cleanupGrafanaResources(ctx, monitorStack); err != nil {
 		logger.Error(err, "Failed to cleanup Grafana resources during deletion")
@@ -161,28 +288,104 @@ func (r *MonitorStackReconciler) reconcilePrometheus(ctx context.Context, monito
 	logger := log.FromContext(ctx)
 	logger.Info("Reconciling Prometheus resources")
 
+	// 验证agent模式配置
+	if err := r.validatePrometheusAgent(monitorStack); err != nil {
+		return fmt.Errorf("invalid agent mode configuration: %w", err)
+	}
+
+	// 验证分片配置
+	if err := r.validatePrometheusShards(monitorStack); err != nil {
+		return fmt.Errorf("invalid shards configuration: %w", err)
+	}
+
+	// 解析服务发现的命名空间，默认配置和服务发现权限都依赖该结果
+	if err := r.resolveTargetNamespaces(ctx, monitorStack); err != nil {
+		return fmt.Errorf("failed to resolve target namespaces: %w", err)
+	}
+
+	// 解析联邦抓取的MonitorStack
+	if err := r.resolveFederationTargets(ctx, monitorStack); err != nil {
+		return fmt.Errorf("failed to resolve federation targets: %w", err)
+	}
+
 	// 创建Prometheus配置ConfigMap
-	if err := r.createPrometheusConfigMap(ctx, monitorStack); err != nil {
+	if err := r.createPrometheusConfigMap(ctx, monitorStack, 0); err != nil {
 		return fmt.Errorf("failed to create Prometheus ConfigMap: %w", err)
 	}
 
-	// 如果配置了持久化存储，创建PVC
-	if monitorStack.Spec.Prometheus.Storage.Size != "" {
+	// 如果配置了持久化存储，创建PVC，agent模式只使用临时存储
+	if monitorStack.Spec.Prometheus.Storage.Size != "" && !isPrometheusAgentMode(monitorStack) {
 		if err := r.createPrometheusPVC(ctx, monitorStack); err != nil {
 			return fmt.Errorf("failed to create Prometheus PVC: %w", err)
 		}
+	} else {
+		// 不再使用持久化存储，按保留策略处理PVC
+		if err := r.cleanupPrometheusPVC(ctx, monitorStack, false); err != nil {
+			return fmt.Errorf("failed to cleanup Prometheus PVC: %w", err)
+		}
+		monitorStack.Status.PrometheusStorage = nil
+		meta.RemoveStatusCondition(&monitorStack.Status.Conditions, conditionTypePrometheusStorage)
 	}
 
+	// 创建Prometheus ServiceAccount
+	if err := r.createPrometheusServiceAccount(ctx, monitorStack); err != nil {
+		return fmt.Errorf("failed to create Prometheus ServiceAccount: %w", err)
+	}
+
+	// 创建或删除web配置Secret
+	if err := r.reconcilePrometheusWebConfig(ctx, monitorStack); err != nil {
+		return fmt.Errorf("failed to reconcile Prometheus web config: %w", err)
+	}
+
+	// 创建或删除联邦凭据Secret
+	if err := r.reconcilePrometheusFederationSecret(ctx, monitorStack); err != nil {
+		return fmt.Errorf("failed to reconcile Prometheus federation secret: %w", err)
+	}
+
+	// 在服务发现的命名空间中授予权限
+	if err := r.reconcilePrometheusDiscoveryRBAC(ctx, monitorStack); err != nil {
+		return fmt.Errorf("failed to reconcile Prometheus discovery RBAC: %w", err)
+	}
+
+	// 根据上次协调时的就绪状态查询资源使用情况，自动应用的建议值在本次构建Deployment时生效
+	r.updatePrometheusSizing(ctx, monitorStack)
+
 	// 创建Prometheus Deployment
-	if err := r.createPrometheusDeployment(ctx, monitorStack); err != nil {
+	if err := r.createPrometheusDeployment(ctx, monitorStack, 0); err != nil {
 		return fmt.Errorf("failed to create Prometheus Deployment: %w", err)
 	}
 
+	// 创建或删除Prometheus PodDisruptionBudget
+	if err := r.reconcilePodDisruptionBudget(ctx, monitorStack, r.getPrometheusName(monitorStack), "prometheus",
+		monitorStack.Spec.Prometheus.PodDisruptionBudget); err != nil {
+		return fmt.Errorf("failed to reconcile Prometheus PodDisruptionBudget: %w", err)
+	}
+
 	// 创建Prometheus Service
-	if err := r.createPrometheusService(ctx, monitorStack); err != nil {
+	if err := r.createPrometheusService(ctx, monitorStack, 0); err != nil {
 		return fmt.Errorf("failed to create Prometheus Service: %w", err)
 	}
 
+	// 创建其余分片，删除多出的分片
+	if err := r.reconcilePrometheusShards(ctx, monitorStack); err != nil {
+		return fmt.Errorf("failed to reconcile Prometheus shards: %w", err)
+	}
+
+	// 如果配置了备份，创建备份CronJob
+	if monitorStack.Spec.Prometheus.Backup != nil && monitorStack.Spec.Prometheus.Storage.Size != "" && !isPrometheusAgentMode(monitorStack) {
+		if err := r.createPrometheusBackupCronJob(ctx, monitorStack); err != nil {
+			return fmt.Errorf("failed to create Prometheus backup CronJob: %w", err)
+		}
+		if err := r.updatePrometheusBackupStatus(ctx, monitorStack); err != nil {
+			return fmt.Errorf("failed to update Prometheus backup status: %w", err)
+		}
+	} else {
+		if err := r.deletePrometheusBackupCronJob(ctx, monitorStack); err != nil {
+			return fmt.Errorf("failed to delete Prometheus backup CronJob: %w", err)
+		}
+		monitorStack.Status.Backup = nil
+	}
+
 	// 检查Deployment状态并更新MonitorStack状态
 	deployment := &appsv1.Deployment{}
 	err := r.Get(ctx, types.NamespacedName{
@@ -198,12 +401,22 @@ func (r *MonitorStackReconciler) reconcilePrometheus(ctx context.Context, monito
 	monitorStack.Status.PrometheusStatus.Replicas = deployment.Status.Replicas
 	if deployment.Status.ReadyReplicas > 0 {
 		monitorStack.Status.PrometheusStatus.Message = "Ready"
-		monitorStack.Status.PrometheusStatus.Endpoint = fmt.Sprintf("http://%s:%d",
+		monitorStack.Status.PrometheusStatus.Endpoint = fmt.Sprintf("%s://%s:%d", getPrometheusScheme(monitorStack),
 			r.getPrometheusServiceName(monitorStack), monitorStack.Spec.Prometheus.Service.Port)
 	} else {
 		monitorStack.Status.PrometheusStatus.Message = "Not Ready"
 	}
 
+	// 更新分片状态
+	if err := r.updatePrometheusShardStatus(ctx, monitorStack); err != nil {
+		return fmt.Errorf("failed to update Prometheus shard status: %w", err)
+	}
+
+	// 更新数据恢复状态
+	if err := r.updatePrometheusRestoreStatus(ctx, monitorStack); err != nil {
+		return fmt.Errorf("failed to update Prometheus restore status: %w", err)
+	}
+
 	return nil
 }
 
@@ -213,8 +426,17 @@ func (r *MonitorStackReconciler) reconcileGrafana(ctx context.Context, monitorSt
 	logger := log.FromContext(ctx)
 	logger.Info("Reconciling Grafana resources")
 
+	// 如果配置了grafana.ini，创建配置ConfigMap，否则删除之前创建的ConfigMap
+	if r.hasGrafanaIniConfig(monitorStack) {
+		if err := r.createGrafanaConfigMap(ctx, monitorStack); err != nil {
+			return fmt.Errorf("failed to create Grafana config ConfigMap: %w", err)
+		}
+	} else if err := r.deleteGrafanaConfigMap(ctx, monitorStack); err != nil {
+		return fmt.Errorf("failed to delete Grafana config ConfigMap: %w", err)
+	}
+
 	// 如果配置了数据源，创建数据源ConfigMap
-	if len(monitorStack.Spec.Grafana.Datasources) > 0 {
+	if len(r.getGrafanaDatasources(monitorStack)) > 0 {
 		if err := r.createGrafanaDatasourcesConfigMap(ctx, monitorStack); err != nil {
 			return fmt.Errorf("failed to create Grafana datasources ConfigMap: %w", err)
 		}
@@ -225,6 +447,17 @@ func (r *MonitorStackReconciler) reconcileGrafana(ctx context.Context, monitorSt
 		return fmt.Errorf("failed to create Grafana Deployment: %w", err)
 	}
 
+	// 创建或删除Grafana HPA
+	if err := r.reconcileGrafanaAutoscaling(ctx, monitorStack); err != nil {
+		return fmt.Errorf("failed to reconcile Grafana HorizontalPodAutoscaler: %w", err)
+	}
+
+	// 创建或删除Grafana PodDisruptionBudget
+	if err := r.reconcilePodDisruptionBudget(ctx, monitorStack, r.getGrafanaName(monitorStack), "grafana",
+		monitorStack.Spec.Grafana.PodDisruptionBudget); err != nil {
+		return fmt.Errorf("failed to reconcile Grafana PodDisruptionBudget: %w", err)
+	}
+
 	// 创建Grafana Service
 	if err := r.createGrafanaService(ctx, monitorStack); err != nil {
 		return fmt.Errorf("failed to create Grafana Service: %w", err)
@@ -251,19 +484,25 @@ func (r *MonitorStackReconciler) reconcileGrafana(ctx context.Context, monitorSt
 		monitorStack.Status.GrafanaStatus.Message = "Not Ready"
 	}
 
+	// 更新插件安装状态
+	if err := r.updateGrafanaPluginStatus(ctx, monitorStack); err != nil {
+		return fmt.Errorf("failed to update Grafana plugin status: %w", err)
+	}
+
 	return nil
 }
 
 // createPrometheusConfigMap 创建Prometheus配置ConfigMap
-func (r *MonitorStackReconciler) createPrometheusConfigMap(ctx context.Context, monitorStack *monitoringv1.MonitorStack) error {
+// shard为分片序号，未分片时为0
+func (r *MonitorStackReconciler) createPrometheusConfigMap(ctx context.Context, monitorStack *monitoringv1.MonitorStack, shard int32) error {
 	configMap := &corev1.ConfigMap{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      r.getPrometheusConfigMapName(monitorStack),
+			Name:      r.getPrometheusShardConfigMapName(monitorStack, shard),
 			Namespace: monitorStack.Namespace,
-			Labels:    r.getLabels(monitorStack, "prometheus"),
+			Labels:    r.getPrometheusShardLabels(monitorStack, shard),
 		},
 		Data: map[string]string{
-			"prometheus.yml": r.getPrometheusConfig(monitorStack),
+			"prometheus.yml": r.getPrometheusShardConfig(monitorStack, shard),
 		},
 	}
 
@@ -312,6 +551,9 @@ func (r *MonitorStackReconciler) createPrometheusPVC(ctx context.Context, monito
 		pvc.Spec.StorageClassName = &monitorStack.Spec.Prometheus.Storage.StorageClass
 	}
 
+	// 从VolumeSnapshot恢复数据
+	pvc.Spec.DataSource = getPrometheusPVCDataSource(monitorStack.Spec.Prometheus.Storage)
+
 	// 设置OwnerReference
 	if err := controllerutil.SetControllerReference(monitorStack, pvc, r.Scheme); err != nil {
 		return err
@@ -327,13 +569,24 @@ func (r *MonitorStackReconciler) createPrometheusPVC(ctx context.Context, monito
 		return err
 	}
 
-	// PVC已存在，不需要更新（PVC通常不允许修改）
-	return nil
+	// 接管之前保留下来的PVC
+	if err := r.adoptPVC(ctx, monitorStack, existing); err != nil {
+		return err
+	}
+
+	// PVC已存在，只允许扩容
+	return r.reconcilePrometheusPVCSize(ctx, monitorStack, existing)
 }
 
 // createPrometheusDeployment 创建Prometheus Deployment
-func (r *MonitorStackReconciler) createPrometheusDeployment(ctx context.Context, monitorStack *monitoringv1.MonitorStack) error {
-	deployment := r.buildPrometheusDeployment(monitorStack)
+// shard为分片序号，未分片时为0
+func (r *MonitorStackReconciler) createPrometheusDeployment(ctx context.Context, monitorStack *monitoringv1.MonitorStack, shard int32) error {
+	deployment := r.buildPrometheusShardDeployment(monitorStack, shard)
+
+	// 合并Pod模板覆盖
+	if err := applyPodTemplateOverride(deployment, monitorStack.Spec.Prometheus.PodTemplate, "prometheus"); err != nil {
+		return err
+	}
 
 	// 设置OwnerReference
 	if err := controllerutil.SetControllerReference(monitorStack, deployment, r.Scheme); err != nil {
@@ -357,8 +610,9 @@ func (r *MonitorStackReconciler) createPrometheusDeployment(ctx context.Context,
 }
 
 // createPrometheusService 创建Prometheus Service
-func (r *MonitorStackReconciler) createPrometheusService(ctx context.Context, monitorStack *monitoringv1.MonitorStack) error {
-	service := r.buildPrometheusService(monitorStack)
+// shard为分片序号，未分片时为0
+func (r *MonitorStackReconciler) createPrometheusService(ctx context.Context, monitorStack *monitoringv1.MonitorStack, shard int32) error {
+	service := r.buildPrometheusShardService(monitorStack, shard)
 
 	// 设置OwnerReference
 	if err := controllerutil.SetControllerReference(monitorStack, service, r.Scheme); err != nil {
@@ -393,14 +647,32 @@ func (r *MonitorStackReconciler) updateStatus(ctx context.Context, monitorStack
 	r.Status().Update(ctx, monitorStack)
 }
 
+// setCondition 设置MonitorStack的状态条件
+func (r *MonitorStackReconciler) setCondition(monitorStack *monitoringv1.MonitorStack, conditionType string, status metav1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(&monitorStack.Status.Conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		ObservedGeneration: monitorStack.Generation,
+		Reason:             reason,
+		Message:            message,
+	})
+}
+
 // updateOverallStatus 更新整体状态
 func (r *MonitorStackReconciler) updateOverallStatus(ctx context.Context, monitorStack *monitoringv1.MonitorStack) error {
 	// 检查各组件状态
-	prometheusReady := !monitorStack.Spec.Prometheus.Enabled || monitorStack.Status.PrometheusStatus.Ready
+	prometheusReady := !monitorStack.Spec.Prometheus.Enabled || arePrometheusShardsReady(monitorStack)
 	grafanaReady := !monitorStack.Spec.Grafana.Enabled || monitorStack.Status.GrafanaStatus.Ready
+	lokiReady := isLokiReady(monitorStack)
 
 	// 根据组件状态设置整体状态
-	if prometheusReady && grafanaReady {
+	// 首次部署不算作升级
+	upgrading := (monitorStack.Status.PrometheusStatus.UpgradeStartedAt != nil && monitorStack.Status.PrometheusStatus.LastKnownGoodImage != "") ||
+		(monitorStack.Status.GrafanaStatus.UpgradeStartedAt != nil && monitorStack.Status.GrafanaStatus.LastKnownGoodImage != "")
+	if upgrading {
+		monitorStack.Status.Phase = "Updating"
+		monitorStack.Status.Message = "Rolling out new component images"
+	} else if prometheusReady && grafanaReady && lokiReady {
 		monitorStack.Status.Phase = "Ready"
 		monitorStack.Status.Message = "All enabled components are ready"
 	} else {
@@ -447,6 +719,26 @@ func (r *MonitorStackReconciler) cleanupPrometheusResources(ctx context.Context,
 		r.Delete(ctx, configMap)
 	}
 
+	// 删除备份CronJob
+	r.deletePrometheusBackupCronJob(ctx, monitorStack)
+
+	// 删除PodDisruptionBudget
+	r.deletePodDisruptionBudget(ctx, monitorStack, r.getPrometheusName(monitorStack))
+	r.deletePodDisruptionBudget(ctx, monitorStack, r.getPrometheusName(monitorStack)+"-shards")
+
+	// 删除分片0以外的分片
+	r.deletePrometheusShards(ctx, monitorStack, 1)
+
+	// 删除ServiceAccount
+	serviceAccount := &corev1.ServiceAccount{}
+	err = r.Get(ctx, types.NamespacedName{
+		Name:      r.getPrometheusServiceAccountName(monitorStack),
+		Namespace: monitorStack.Namespace,
+	}, serviceAccount)
+	if err == nil {
+		r.Delete(ctx, serviceAccount)
+	}
+
 	return nil
 }
 
@@ -472,17 +764,54 @@ func (r *MonitorStackReconciler) cleanupGrafanaResources(ctx context.Context, mo
 		r.Delete(ctx, service)
 	}
 
+	// 删除grafana.ini ConfigMap
+	configMap := &corev1.ConfigMap{}
+	err = r.Get(ctx, types.NamespacedName{
+		Name:      r.getGrafanaConfigMapName(monitorStack),
+		Namespace: monitorStack.Namespace,
+	}, configMap)
+	if err == nil {
+		r.Delete(ctx, configMap)
+	}
+
+	// 删除HPA和PodDisruptionBudget
+	r.deleteGrafanaHPA(ctx, monitorStack)
+	r.deletePodDisruptionBudget(ctx, monitorStack, r.getGrafanaName(monitorStack))
+
 	return nil
 }
 
 // SetupWithManager 设置控制器与Manager的关系
 // 配置控制器监听的资源类型和拥有的资源类型
 func (r *MonitorStackReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	// 按className索引MonitorStack，类修改时只需查找引用它的MonitorStack
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &monitoringv1.MonitorStack{},
+		classNameIndexField, indexMonitorStackClassName); err != nil {
+		return err
+	}
+
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&monitoringv1.MonitorStack{}).     // 监听MonitorStack资源
 		Owns(&appsv1.Deployment{}).            // 拥有Deployment资源
 		Owns(&corev1.Service{}).               // 拥有Service资源
 		Owns(&corev1.ConfigMap{}).             // 拥有ConfigMap资源
 		Owns(&corev1.PersistentVolumeClaim{}). // 拥有PVC资源
+		Owns(&corev1.ServiceAccount{}).        // 拥有ServiceAccount资源
+		Owns(&appsv1.DaemonSet{}).             // 拥有Promtail DaemonSet资源
+		Owns(&batchv1.CronJob{}).              // 拥有备份CronJob资源
+		// 拥有HPA和PDB资源
+		Owns(&autoscalingv2.HorizontalPodAutoscaler{}).
+		Owns(&policyv1.PodDisruptionBudget{}).
+		// 引用的Secret轮换后滚动更新Grafana，只缓存元数据，避免缓存集群中所有Secret的内容
+		WatchesMetadata(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(r.findMonitorStacksForSecret)).
+		// 类修改后重新协调引用它的MonitorStack
+		Watches(&monitoringv1.MonitorStackClass{}, handler.EnqueueRequestsFromMapFunc(r.findMonitorStacksForClass)).
+		// 策略修改后重新检查MonitorStack
+		Watches(&monitoringv1.MonitorStackPolicy{}, handler.EnqueueRequestsFromMapFunc(r.findMonitorStacksForPolicy)).
+		// 命名空间增减后更新服务发现的命名空间
+		Watches(&corev1.Namespace{}, handler.EnqueueRequestsFromMapFunc(r.findMonitorStacksForNamespace)).
+		// 被引用的MonitorStack的spec或标签变化后更新联邦抓取配置，忽略只修改status的事件
+		Watches(&monitoringv1.MonitorStack{}, handler.EnqueueRequestsFromMapFunc(r.findMonitorStacksForFederation),
+			builder.WithPredicates(predicate.Or(predicate.GenerationChangedPredicate{}, predicate.LabelChangedPredicate{}))).
 		Complete(r)
 }
@@ -0,0 +1,104 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	monitoringv1 "github.com/ciliverse/monitor-operator/api/v1"
+)
+
+// 暂停协调 - 事故处理期间允许手动修改生成的资源，暂停期间只刷新状态
+
+const (
+	// pausedAnnotation 暂停协调的注解
+	pausedAnnotation = "monitoring.cillian.website/paused"
+	// conditionTypePaused 暂停状态条件
+	conditionTypePaused = "Paused"
+)
+
+// isPaused 判断MonitorStack是否暂停协调
+func isPaused(monitorStack *monitoringv1.MonitorStack) bool {
+	return monitorStack.Spec.Paused || monitorStack.Annotations[pausedAnnotation] == "true"
+}
+
+// refreshComponentStatus 根据Deployment刷新组件状态，不修改Deployment
+func (r *MonitorStackReconciler) refreshComponentStatus(ctx context.Context, monitorStack *monitoringv1.MonitorStack, name string, status *monitoringv1.ComponentStatus) error {
+	deployment := &appsv1.Deployment{}
+	if err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: monitorStack.Namespace}, deployment); err != nil {
+		if errors.IsNotFound(err) {
+			status.Ready = false
+			status.Replicas = 0
+			status.Message = "Not Found"
+			return nil
+		}
+		return err
+	}
+
+	status.Ready = deployment.Status.ReadyReplicas > 0
+	status.Replicas = deployment.Status.Replicas
+	if status.Ready {
+		status.Message = "Ready"
+	} else {
+		status.Message = "Not Ready"
+	}
+	return nil
+}
+
+// updatePausedStatus 暂停期间刷新状态
+func (r *MonitorStackReconciler) updatePausedStatus(ctx context.Context, monitorStack *monitoringv1.MonitorStack) error {
+	if monitorStack.Spec.Prometheus.Enabled {
+		if err := r.refreshComponentStatus(ctx, monitorStack, r.getPrometheusName(monitorStack), &monitorStack.Status.PrometheusStatus); err != nil {
+			return err
+		}
+	}
+	if monitorStack.Spec.Grafana.Enabled {
+		if err := r.refreshComponentStatus(ctx, monitorStack, r.getGrafanaName(monitorStack), &monitorStack.Status.GrafanaStatus); err != nil {
+			return err
+		}
+	}
+	if isLokiEnabled(monitorStack) {
+		if err := r.refreshComponentStatus(ctx, monitorStack, r.getLokiName(monitorStack), &monitorStack.Status.LokiStatus); err != nil {
+			return err
+		}
+	}
+
+	message := "Reconciliation is paused by spec.paused"
+	if !monitorStack.Spec.Paused {
+		message = "Reconciliation is paused by the " + pausedAnnotation + " annotation"
+	}
+	r.setCondition(monitorStack, conditionTypePaused, metav1.ConditionTrue, "Paused", message)
+
+	monitorStack.Status.Phase = "Paused"
+	monitorStack.Status.Message = message
+	monitorStack.Status.LastUpdated = metav1.Now()
+	return r.Status().Update(ctx, monitorStack)
+}
+
+// markResumed 恢复协调时更新暂停条件
+func (r *MonitorStackReconciler) markResumed(monitorStack *monitoringv1.MonitorStack) {
+	if meta.FindStatusCondition(monitorStack.Status.Conditions, conditionTypePaused) == nil {
+		return
+	}
+	r.setCondition(monitorStack, conditionTypePaused, metav1.ConditionFalse, "Resumed", "Reconciliation is active")
+}
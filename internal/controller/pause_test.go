@@ -0,0 +1,74 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("Pause", func() {
+	r := &MonitorStackReconciler{}
+
+	DescribeTable("isPaused",
+		func(paused bool, annotation string, expected bool) {
+			monitorStack := newTestMonitorStack()
+			monitorStack.Spec.Paused = paused
+			if annotation != "" {
+				monitorStack.Annotations = map[string]string{pausedAnnotation: annotation}
+			}
+			Expect(isPaused(monitorStack)).To(Equal(expected))
+		},
+		Entry("is active by default", false, "", false),
+		Entry("is paused by spec.paused", true, "", true),
+		Entry("is paused by the annotation", false, "true", true),
+		Entry("ignores other annotation values", false, "yes", false),
+	)
+
+	It("only refreshes status while paused", func() {
+		ctx := context.Background()
+		monitorStack := newTestMonitorStack()
+		monitorStack.Annotations = map[string]string{pausedAnnotation: "true"}
+		prometheus := &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: r.getPrometheusName(monitorStack), Namespace: monitorStack.Namespace},
+			Status:     appsv1.DeploymentStatus{Replicas: 1, ReadyReplicas: 1},
+		}
+		reconciler := newFakeReconciler(monitorStack, prometheus)
+
+		Expect(reconciler.updatePausedStatus(ctx, monitorStack)).To(Succeed())
+		Expect(monitorStack.Status.Phase).To(Equal("Paused"))
+		Expect(monitorStack.Status.PrometheusStatus.Ready).To(BeTrue())
+		Expect(monitorStack.Status.GrafanaStatus.Message).To(Equal("Not Found"))
+		condition := meta.FindStatusCondition(monitorStack.Status.Conditions, conditionTypePaused)
+		Expect(condition.Status).To(Equal(metav1.ConditionTrue))
+		Expect(condition.Message).To(ContainSubstring("annotation"))
+
+		reconciler.markResumed(monitorStack)
+		Expect(meta.IsStatusConditionFalse(monitorStack.Status.Conditions, conditionTypePaused)).To(BeTrue())
+	})
+
+	It("does not add a Paused condition to stacks that were never paused", func() {
+		monitorStack := newTestMonitorStack()
+		r.markResumed(monitorStack)
+		Expect(meta.FindStatusCondition(monitorStack.Status.Conditions, conditionTypePaused)).To(BeNil())
+	})
+})
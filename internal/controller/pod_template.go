@@ -0,0 +1,208 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+)
+
+// Pod模板覆盖 - 将用户提供的podTemplate以strategic merge patch的方式合并到生成的PodTemplateSpec
+// containers、volumes等列表按name合并，因此可以修改生成的容器，也可以追加sidecar容器
+// 主容器的镜像、资源、ServiceAccount以及Pod安全上下文由operator管理，不允许通过覆盖修改，
+// 也不允许通过覆盖提升Pod的权限
+
+// applyPodTemplateOverride 将podTemplate覆盖合并到Deployment的Pod模板
+// container为组件主容器名称，合并后主容器保持在第一个位置；
+// 选择器使用的标签会被重新设置，避免覆盖后Deployment选择不到自己的Pod
+func applyPodTemplateOverride(deployment *appsv1.Deployment, override *runtime.RawExtension, container string) error {
+	if override == nil || len(override.Raw) == 0 {
+		return nil
+	}
+
+	original, err := json.Marshal(deployment.Spec.Template)
+	if err != nil {
+		return fmt.Errorf("failed to marshal pod template: %w", err)
+	}
+
+	patched, err := strategicpatch.StrategicMergePatch(original, override.Raw, corev1.PodTemplateSpec{})
+	if err != nil {
+		return fmt.Errorf("failed to apply podTemplate: %w", err)
+	}
+
+	template := corev1.PodTemplateSpec{}
+	if err := json.Unmarshal(patched, &template); err != nil {
+		return fmt.Errorf("failed to unmarshal patched pod template: %w", err)
+	}
+
+	// 重新设置选择器标签
+	if template.Labels == nil {
+		template.Labels = map[string]string{}
+	}
+	for k, v := range deployment.Spec.Selector.MatchLabels {
+		template.Labels[k] = v
+	}
+
+	// 主容器保持在第一个位置
+	for i := range template.Spec.Containers {
+		if template.Spec.Containers[i].Name == container && i != 0 {
+			main := template.Spec.Containers[i]
+			copy(template.Spec.Containers[1:i+1], template.Spec.Containers[:i])
+			template.Spec.Containers[0] = main
+			break
+		}
+	}
+	if len(template.Spec.Containers) == 0 || template.Spec.Containers[0].Name != container {
+		return fmt.Errorf("podTemplate must not remove the %q container", container)
+	}
+	if err := checkManagedPodFields(&deployment.Spec.Template.Spec, &template.Spec); err != nil {
+		return err
+	}
+
+	deployment.Spec.Template = template
+	return nil
+}
+
+// checkManagedPodFields 检查覆盖是否修改了operator管理的字段或提升了Pod的权限
+// 镜像和资源通过对应的spec字段设置，ServiceAccount和令牌挂载决定Pod的API权限，
+// Pod安全上下文通过security字段设置，均不允许通过覆盖修改
+func checkManagedPodFields(original, patched *corev1.PodSpec) error {
+	// serviceAccount是serviceAccountName的旧字段，serviceAccountName为空时API服务器会使用它
+	if patched.ServiceAccountName != original.ServiceAccountName ||
+		patched.DeprecatedServiceAccount != original.DeprecatedServiceAccount {
+		return fmt.Errorf("podTemplate must not override serviceAccountName or serviceAccount")
+	}
+	if !equality.Semantic.DeepEqual(patched.AutomountServiceAccountToken, original.AutomountServiceAccountToken) {
+		return fmt.Errorf("podTemplate must not override automountServiceAccountToken")
+	}
+	if !equality.Semantic.DeepEqual(patched.SecurityContext, original.SecurityContext) {
+		return fmt.Errorf("podTemplate must not override the pod securityContext, use security.podSecurityContext instead")
+	}
+
+	main := original.Containers[0]
+	if patched.Containers[0].Image != main.Image {
+		return fmt.Errorf("podTemplate must not override the image of the %q container", main.Name)
+	}
+	if !equality.Semantic.DeepEqual(patched.Containers[0].Resources, main.Resources) {
+		return fmt.Errorf("podTemplate must not override the resources of the %q container", main.Name)
+	}
+	if err := checkPodPrivileges(patched); err != nil {
+		return fmt.Errorf("podTemplate %w", err)
+	}
+	return nil
+}
+
+// validatePodTemplateOverride 验证podTemplate覆盖
+// 将覆盖合并到生成的Deployment上，提前发现无法合并的配置
+func validatePodTemplateOverride(deployment *appsv1.Deployment, override *runtime.RawExtension, container string) error {
+	if override == nil || len(override.Raw) == 0 {
+		return nil
+	}
+
+	var obj map[string]interface{}
+	if err := json.Unmarshal(override.Raw, &obj); err != nil {
+		return fmt.Errorf("podTemplate must be an object: %w", err)
+	}
+
+	return applyPodTemplateOverride(deployment, override, container)
+}
+
+// checkPodPrivileges 检查Pod是否使用了提升权限的配置，参考PodSecurity baseline标准
+// 禁止使用宿主机的网络、PID和IPC命名空间、hostPath卷、宿主机端口以及特权容器，
+// 避免命名空间用户借助operator的权限创建特权Pod
+func checkPodPrivileges(spec *corev1.PodSpec) error {
+	if spec.HostNetwork || spec.HostPID || spec.HostIPC {
+		return fmt.Errorf("must not use hostNetwork, hostPID or hostIPC")
+	}
+	for _, volume := range spec.Volumes {
+		if volume.HostPath != nil {
+			return fmt.Errorf("must not use hostPath volume %q", volume.Name)
+		}
+	}
+	if err := checkPodSecurityContext(spec.SecurityContext); err != nil {
+		return fmt.Errorf("securityContext %w", err)
+	}
+
+	containers := make([]corev1.Container, 0, len(spec.InitContainers)+len(spec.Containers))
+	containers = append(containers, spec.InitContainers...)
+	containers = append(containers, spec.Containers...)
+	for _, container := range containers {
+		for _, port := range container.Ports {
+			if port.HostPort != 0 {
+				return fmt.Errorf("container %q must not use hostPort", container.Name)
+			}
+		}
+		if err := checkContainerSecurityContext(container.SecurityContext); err != nil {
+			return fmt.Errorf("container %q securityContext %w", container.Name, err)
+		}
+	}
+	return nil
+}
+
+// checkPodSecurityContext 检查Pod安全上下文是否提升了权限
+func checkPodSecurityContext(sc *corev1.PodSecurityContext) error {
+	if sc == nil {
+		return nil
+	}
+	if sc.WindowsOptions != nil && sc.WindowsOptions.HostProcess != nil && *sc.WindowsOptions.HostProcess {
+		return fmt.Errorf("must not use hostProcess")
+	}
+	if sc.SeccompProfile != nil && sc.SeccompProfile.Type == corev1.SeccompProfileTypeUnconfined {
+		return fmt.Errorf("must not use an Unconfined seccomp profile")
+	}
+	if sc.AppArmorProfile != nil && sc.AppArmorProfile.Type == corev1.AppArmorProfileTypeUnconfined {
+		return fmt.Errorf("must not use an Unconfined AppArmor profile")
+	}
+	return nil
+}
+
+// checkContainerSecurityContext 检查容器安全上下文是否提升了权限
+// 只允许添加NET_BIND_SERVICE，与PodSecurity restricted标准一致
+func checkContainerSecurityContext(sc *corev1.SecurityContext) error {
+	if sc == nil {
+		return nil
+	}
+	if sc.Privileged != nil && *sc.Privileged {
+		return fmt.Errorf("must not be privileged")
+	}
+	if sc.Capabilities != nil {
+		for _, capability := range sc.Capabilities.Add {
+			if capability != "NET_BIND_SERVICE" {
+				return fmt.Errorf("must not add capability %s", capability)
+			}
+		}
+	}
+	if sc.ProcMount != nil && *sc.ProcMount == corev1.UnmaskedProcMount {
+		return fmt.Errorf("must not use an Unmasked procMount")
+	}
+	if sc.WindowsOptions != nil && sc.WindowsOptions.HostProcess != nil && *sc.WindowsOptions.HostProcess {
+		return fmt.Errorf("must not use hostProcess")
+	}
+	if sc.SeccompProfile != nil && sc.SeccompProfile.Type == corev1.SeccompProfileTypeUnconfined {
+		return fmt.Errorf("must not use an Unconfined seccomp profile")
+	}
+	if sc.AppArmorProfile != nil && sc.AppArmorProfile.Type == corev1.AppArmorProfileTypeUnconfined {
+		return fmt.Errorf("must not use an Unconfined AppArmor profile")
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+var _ = Describe("Pod template override", func() {
+	r := &MonitorStackReconciler{}
+
+	raw := func(s string) *runtime.RawExtension {
+		return &runtime.RawExtension{Raw: []byte(s)}
+	}
+
+	It("merges scheduling fields and sidecars while keeping the main container first", func() {
+		deployment := r.buildGrafanaDeployment(newTestMonitorStack())
+		override := raw(`{
+			"metadata": {"labels": {"app.kubernetes.io/name": "other", "team": "obs"}},
+			"spec": {
+				"nodeSelector": {"role": "infra"},
+				"containers": [
+					{"name": "log-shipper", "image": "fluent/fluent-bit:2.1"},
+					{"name": "grafana", "env": [{"name": "GF_LOG_LEVEL", "value": "debug"}]}
+				]
+			}
+		}`)
+		Expect(applyPodTemplateOverride(deployment, override, "grafana")).To(Succeed())
+
+		spec := deployment.Spec.Template.Spec
+		Expect(spec.NodeSelector).To(HaveKeyWithValue("role", "infra"))
+		Expect(spec.Containers).To(HaveLen(2))
+		Expect(spec.Containers[0].Name).To(Equal("grafana"))
+		Expect(spec.Containers[1].Name).To(Equal("log-shipper"))
+		Expect(deployment.Spec.Template.Labels).To(HaveKeyWithValue("team", "obs"))
+		for k, v := range deployment.Spec.Selector.MatchLabels {
+			Expect(deployment.Spec.Template.Labels).To(HaveKeyWithValue(k, v))
+		}
+	})
+
+	DescribeTable("validatePodTemplateOverride",
+		func(override string, expectedError string) {
+			deployment := r.buildPrometheusDeployment(newTestMonitorStack())
+			err := validatePodTemplateOverride(deployment, raw(override), "prometheus")
+			if expectedError == "" {
+				Expect(err).NotTo(HaveOccurred())
+			} else {
+				Expect(err).To(MatchError(ContainSubstring(expectedError)))
+			}
+		},
+		Entry("accepts scheduling overrides", `{"spec": {"priorityClassName": "system-cluster-critical"}}`, ""),
+		Entry("accepts env on the main container",
+			`{"spec": {"containers": [{"name": "prometheus", "env": [{"name": "A", "value": "b"}]}]}}`, ""),
+		Entry("rejects a non-object", `[]`, "podTemplate must be an object"),
+		Entry("rejects removing the main container",
+			`{"spec": {"containers": [{"name": "prometheus", "$patch": "delete"}]}}`, `must not remove the "prometheus" container`),
+		Entry("rejects overriding the main image",
+			`{"spec": {"containers": [{"name": "prometheus", "image": "evil/prometheus:latest"}]}}`, "must not override the image"),
+		Entry("rejects overriding the main resources",
+			`{"spec": {"containers": [{"name": "prometheus", "resources": {"limits": {"memory": "64Gi"}}}]}}`,
+			"must not override the resources"),
+		Entry("rejects overriding the service account",
+			`{"spec": {"serviceAccountName": "cluster-admin"}}`, "must not override serviceAccountName"),
+		Entry("rejects the deprecated serviceAccount field",
+			`{"spec": {"serviceAccount": "cluster-admin"}}`, "must not override serviceAccountName or serviceAccount"),
+		Entry("rejects overriding automountServiceAccountToken",
+			`{"spec": {"automountServiceAccountToken": true}}`, "must not override automountServiceAccountToken"),
+		Entry("rejects overriding the pod securityContext",
+			`{"spec": {"securityContext": {"runAsUser": 0}}}`, "must not override the pod securityContext"),
+		Entry("rejects host namespaces", `{"spec": {"hostPID": true}}`, "must not use hostNetwork, hostPID or hostIPC"),
+		Entry("rejects hostPath volumes",
+			`{"spec": {"volumes": [{"name": "host", "hostPath": {"path": "/"}}]}}`, `must not use hostPath volume "host"`),
+		Entry("rejects privileged sidecars",
+			`{"spec": {"containers": [{"name": "debug", "image": "busybox", "securityContext": {"privileged": true}}]}}`,
+			`container "debug" securityContext must not be privileged`),
+		Entry("rejects added capabilities on the main container",
+			`{"spec": {"containers": [{"name": "prometheus", "securityContext": {"capabilities": {"add": ["SYS_ADMIN"]}}}]}}`,
+			"must not add capability SYS_ADMIN"),
+		Entry("rejects host ports",
+			`{"spec": {"containers": [{"name": "prometheus", "ports": [{"containerPort": 9090, "hostPort": 9090}]}]}}`,
+			`container "prometheus" must not use hostPort`),
+	)
+})
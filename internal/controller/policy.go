@@ -0,0 +1,128 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	monitoringv1 "github.com/ciliverse/monitor-operator/api/v1"
+	"github.com/ciliverse/monitor-operator/internal/policy"
+)
+
+// 租户策略 - 准入Webhook在创建和修改时拦截违反策略的MonitorStack，
+// 控制器在继承MonitorStackClass并补全默认值后再次检查，覆盖策略创建前已存在的MonitorStack
+// 违反策略时不再修改子资源，已有的工作负载保持不变
+
+//+kubebuilder:rbac:groups=monitoring.cillian.website,resources=monitorstackpolicies,verbs=get;list;watch
+
+// conditionTypePolicyCompliant 租户策略检查状态条件
+const conditionTypePolicyCompliant = "PolicyCompliant"
+
+// getPolicyImages 获取要检查仓库的镜像，使用实际部署的镜像地址
+func (r *MonitorStackReconciler) getPolicyImages(monitorStack *monitoringv1.MonitorStack) []string {
+	var images []string
+	if monitorStack.Spec.Prometheus.Enabled {
+		images = append(images, r.getPrometheusDesiredImage(monitorStack), r.getConfigReloaderImage())
+		// 备份和恢复使用的辅助镜像
+		storage := monitorStack.Spec.Prometheus.Storage
+		backup := monitorStack.Spec.Prometheus.Backup
+		if backup != nil {
+			images = append(images, r.rewriteImage(backupSnapshotImage))
+		}
+		if backup != nil || needsPrometheusRestoreInitContainer(storage) {
+			images = append(images, r.rewriteImage(backupToolsImage))
+		}
+		if (backup != nil && backup.Destination.S3 != nil) ||
+			(needsPrometheusRestoreInitContainer(storage) && storage.RestoreFrom.S3 != nil) {
+			images = append(images, r.rewriteImage(backupS3Image))
+		}
+		if backup != nil && backup.Image != "" {
+			images = append(images, r.rewriteImage(backup.Image))
+		}
+		images = append(images, policy.PodTemplateImages(monitorStack.Spec.Prometheus.PodTemplate)...)
+	}
+	if monitorStack.Spec.Grafana.Enabled {
+		images = append(images, r.getGrafanaDesiredImage(monitorStack))
+		images = append(images, policy.PodTemplateImages(monitorStack.Spec.Grafana.PodTemplate)...)
+	}
+	if isLokiEnabled(monitorStack) {
+		loki := monitorStack.Spec.Loki
+		images = append(images, r.rewriteImage(buildImage(loki.Image, loki.Tag, "")))
+		if isPromtailEnabled(monitorStack) {
+			images = append(images, r.rewriteImage(buildImage(loki.Promtail.Image, loki.Promtail.Tag, "")))
+		}
+	}
+	return images
+}
+
+// enforcePolicies 检查MonitorStack是否符合所在命名空间的策略，返回是否符合
+func (r *MonitorStackReconciler) enforcePolicies(ctx context.Context, monitorStack *monitoringv1.MonitorStack) (bool, error) {
+	policies, err := policy.MatchingPolicies(ctx, r.Client, monitorStack.Namespace)
+	if err != nil {
+		return false, err
+	}
+	if len(policies) == 0 {
+		meta.RemoveStatusCondition(&monitorStack.Status.Conditions, conditionTypePolicyCompliant)
+		return true, nil
+	}
+
+	// 默认值只设置requests，策略限制最大资源时把未设置的limits补全为策略的最大值
+	policy.DefaultLimits(policies, &monitorStack.Spec)
+
+	images := r.getPolicyImages(monitorStack)
+	var violations []string
+	for i := range policies {
+		violations = append(violations, policy.Violations(&policies[i], &monitorStack.Spec, images)...)
+	}
+
+	if len(violations) > 0 {
+		r.setCondition(monitorStack, conditionTypePolicyCompliant, metav1.ConditionFalse, "PolicyViolation",
+			strings.Join(violations, "; "))
+		return false, nil
+	}
+
+	r.setCondition(monitorStack, conditionTypePolicyCompliant, metav1.ConditionTrue, "Compliant",
+		fmt.Sprintf("complies with %d MonitorStackPolicy", len(policies)))
+	return true, nil
+}
+
+// findMonitorStacksForPolicy 策略修改后重新检查所有MonitorStack
+// 策略通过命名空间标签选择，命名空间较少时直接全部重新协调
+func (r *MonitorStackReconciler) findMonitorStacksForPolicy(ctx context.Context, obj client.Object) []reconcile.Request {
+	monitorStacks := &monitoringv1.MonitorStackList{}
+	if err := r.List(ctx, monitorStacks); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list MonitorStacks for policy", "policy", obj.GetName())
+		return nil
+	}
+
+	requests := make([]reconcile.Request, 0, len(monitorStacks.Items))
+	for _, monitorStack := range monitorStacks.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Name: monitorStack.Name, Namespace: monitorStack.Namespace},
+		})
+	}
+	return requests
+}
@@ -0,0 +1,166 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	monitoringv1 "github.com/ciliverse/monitor-operator/api/v1"
+)
+
+var _ = Describe("enforcePolicies", func() {
+	ctx := context.Background()
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "monitoring"}}
+
+	newPolicy := func(spec monitoringv1.MonitorStackPolicySpec) *monitoringv1.MonitorStackPolicy {
+		return &monitoringv1.MonitorStackPolicy{ObjectMeta: metav1.ObjectMeta{Name: "tenant"}, Spec: spec}
+	}
+
+	It("defaults missing limits to the policy maximum", func() {
+		monitorStack := newTestMonitorStack()
+		reconciler := newFakeReconciler(namespace, newPolicy(monitoringv1.MonitorStackPolicySpec{
+			MaxResources: monitoringv1.ResourceList{CPU: "2", Memory: "4Gi"},
+		}))
+
+		compliant, err := reconciler.enforcePolicies(ctx, monitorStack)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(compliant).To(BeTrue())
+		Expect(monitorStack.Spec.Prometheus.Resources.Limits).To(Equal(monitoringv1.ResourceList{CPU: "2", Memory: "4Gi"}))
+		Expect(monitorStack.Spec.Grafana.Resources.Limits).To(Equal(monitoringv1.ResourceList{CPU: "2", Memory: "4Gi"}))
+	})
+
+	It("checks podTemplate sidecar resources against the policy maximum", func() {
+		monitorStack := newTestMonitorStack()
+		monitorStack.Spec.Prometheus.PodTemplate = &runtime.RawExtension{Raw: []byte(
+			`{"spec":{"containers":[{"name":"sidecar","image":"sidecar:1.0","resources":{"limits":{"memory":"8Gi"}}}]}}`)}
+		reconciler := newFakeReconciler(namespace, newPolicy(monitoringv1.MonitorStackPolicySpec{
+			MaxResources: monitoringv1.ResourceList{CPU: "2", Memory: "4Gi"},
+		}))
+
+		compliant, err := reconciler.enforcePolicies(ctx, monitorStack)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(compliant).To(BeFalse())
+		condition := meta.FindStatusCondition(monitorStack.Status.Conditions, conditionTypePolicyCompliant)
+		Expect(condition).NotTo(BeNil())
+		Expect(condition.Message).To(ContainSubstring(`prometheus container "sidecar" limits memory`))
+		Expect(condition.Message).To(ContainSubstring(`prometheus container "sidecar" limits cpu must be set`))
+	})
+
+	It("limits the total number of replicas", func() {
+		monitorStack := newTestMonitorStack()
+		reconciler := newFakeReconciler(namespace, newPolicy(monitoringv1.MonitorStackPolicySpec{
+			MaxReplicas: &[]int32{1}[0],
+		}))
+
+		compliant, err := reconciler.enforcePolicies(ctx, monitorStack)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(compliant).To(BeFalse())
+		condition := meta.FindStatusCondition(monitorStack.Status.Conditions, conditionTypePolicyCompliant)
+		Expect(condition.Message).To(ContainSubstring("total replicas 2 exceeds the maximum of 1"))
+
+		monitorStack.Spec.Grafana.Enabled = false
+		compliant, err = reconciler.enforcePolicies(ctx, monitorStack)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(compliant).To(BeTrue())
+	})
+
+	It("counts the maximum Grafana replicas when autoscaling", func() {
+		monitorStack := newTestMonitorStack()
+		monitorStack.Spec.Grafana.Autoscaling = &monitoringv1.AutoscalingSpec{MaxReplicas: 4}
+		reconciler := newFakeReconciler(namespace, newPolicy(monitoringv1.MonitorStackPolicySpec{
+			MaxReplicas: &[]int32{4}[0],
+		}))
+
+		compliant, err := reconciler.enforcePolicies(ctx, monitorStack)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(compliant).To(BeFalse())
+		condition := meta.FindStatusCondition(monitorStack.Status.Conditions, conditionTypePolicyCompliant)
+		Expect(condition.Message).To(ContainSubstring("total replicas 5 exceeds the maximum of 4"))
+	})
+
+	It("counts every Prometheus shard and limits the number of shards", func() {
+		monitorStack := newTestMonitorStack()
+		monitorStack.Spec.Prometheus.Shards = &[]int32{3}[0]
+		reconciler := newFakeReconciler(namespace, newPolicy(monitoringv1.MonitorStackPolicySpec{
+			MaxReplicas: &[]int32{3}[0],
+			MaxShards:   &[]int32{2}[0],
+		}))
+
+		compliant, err := reconciler.enforcePolicies(ctx, monitorStack)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(compliant).To(BeFalse())
+		condition := meta.FindStatusCondition(monitorStack.Status.Conditions, conditionTypePolicyCompliant)
+		Expect(condition.Message).To(ContainSubstring("total replicas 4 exceeds the maximum of 3"))
+		Expect(condition.Message).To(ContainSubstring("prometheus shards 3 exceeds the maximum of 2"))
+
+		monitorStack.Spec.Prometheus.Shards = &[]int32{2}[0]
+		compliant, err = reconciler.enforcePolicies(ctx, monitorStack)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(compliant).To(BeTrue())
+	})
+
+	It("applies the policy to Loki and Promtail", func() {
+		monitorStack := newTestMonitorStack()
+		monitorStack.Spec.Loki = &monitoringv1.LokiSpec{Enabled: true, Promtail: monitoringv1.PromtailSpec{Enabled: true}}
+		(&MonitorStackReconciler{}).setLokiDefaults(monitorStack.Spec.Loki)
+		reconciler := newFakeReconciler(namespace, newPolicy(monitoringv1.MonitorStackPolicySpec{
+			MaxResources:           monitoringv1.ResourceList{CPU: "2", Memory: "4Gi"},
+			MaxReplicas:            &[]int32{2}[0],
+			AllowedImageRegistries: []string{"docker.io"},
+		}))
+
+		compliant, err := reconciler.enforcePolicies(ctx, monitorStack)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(compliant).To(BeFalse())
+		Expect(monitorStack.Spec.Loki.Resources.Limits).To(Equal(monitoringv1.ResourceList{CPU: "2", Memory: "4Gi"}))
+		Expect(monitorStack.Spec.Loki.Promtail.Resources.Limits).To(Equal(monitoringv1.ResourceList{CPU: "2", Memory: "4Gi"}))
+		condition := meta.FindStatusCondition(monitorStack.Status.Conditions, conditionTypePolicyCompliant)
+		// Promtail是DaemonSet，不计入副本总数
+		Expect(condition.Message).To(ContainSubstring("total replicas 3 exceeds the maximum of 2"))
+
+		monitorStack.Spec.Loki.Promtail.Image = "quay.io/grafana/promtail"
+		_, err = reconciler.enforcePolicies(ctx, monitorStack)
+		Expect(err).NotTo(HaveOccurred())
+		condition = meta.FindStatusCondition(monitorStack.Status.Conditions, conditionTypePolicyCompliant)
+		Expect(condition.Message).To(ContainSubstring("image quay.io/grafana/promtail"))
+	})
+
+	It("checks the backup and restore helper images against allowed registries", func() {
+		monitorStack := newTestMonitorStack()
+		monitorStack.Spec.Grafana.Enabled = false
+		monitorStack.Spec.Prometheus.Backup = &monitoringv1.BackupSpec{
+			Schedule:    "0 2 * * *",
+			Destination: monitoringv1.BackupDestination{S3: &monitoringv1.S3BackupDestination{Endpoint: "https://s3.example.com", Bucket: "backup"}},
+		}
+		reconciler := newFakeReconciler(namespace)
+		reconciler.ImageRegistry = "registry.example.com"
+
+		images := reconciler.getPolicyImages(monitorStack)
+		Expect(images).To(ContainElements(
+			"registry.example.com/"+backupSnapshotImage,
+			"registry.example.com/"+backupToolsImage,
+			"registry.example.com/"+backupS3Image,
+		))
+	})
+})
@@ -0,0 +1,190 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	monitoringv1 "github.com/ciliverse/monitor-operator/api/v1"
+)
+
+// 健康检查 - 启动探针和探针参数覆盖
+
+const (
+	// startupProbePeriodSeconds 启动探针检查间隔
+	startupProbePeriodSeconds = int32(15)
+	// minStartupFailureThreshold 启动探针最小失败次数（5分钟）
+	minStartupFailureThreshold = int32(20)
+	// startupFailureThresholdPerGi 每GiB存储增加的失败次数（30秒），用于WAL回放
+	startupFailureThresholdPerGi = int64(2)
+	// maxStartupFailureThreshold 启动探针最大失败次数（6小时），避免超大存储时探针永远不失败
+	maxStartupFailureThreshold = int64(1440)
+)
+
+// getPrometheusStartupFailureThreshold 根据存储大小计算Prometheus启动探针的失败次数
+// WAL回放时间与TSDB大小相关，每GiB预留30秒，最少5分钟；使用emptyDir时使用最小值
+func (r *MonitorStackReconciler) getPrometheusStartupFailureThreshold(monitorStack *monitoringv1.MonitorStack) int32 {
+	size, err := resource.ParseQuantity(monitorStack.Spec.Prometheus.Storage.Size)
+	if err != nil {
+		return minStartupFailureThreshold
+	}
+
+	gi := (size.Value() + (1 << 30) - 1) >> 30
+	threshold := gi * startupFailureThresholdPerGi
+	if threshold < int64(minStartupFailureThreshold) {
+		return minStartupFailureThreshold
+	}
+	if threshold > maxStartupFailureThreshold {
+		threshold = maxStartupFailureThreshold
+	}
+	return int32(threshold)
+}
+
+// buildPrometheusStartupProbe 构建Prometheus启动探针
+func (r *MonitorStackReconciler) buildPrometheusStartupProbe(monitorStack *monitoringv1.MonitorStack) *corev1.Probe {
+	return &corev1.Probe{
+		ProbeHandler: corev1.ProbeHandler{
+			HTTPGet: &corev1.HTTPGetAction{
+				Path: "/-/ready",
+				Port: intstr.FromInt(9090),
+			},
+		},
+		PeriodSeconds:    startupProbePeriodSeconds,
+		TimeoutSeconds:   3,
+		FailureThreshold: r.getPrometheusStartupFailureThreshold(monitorStack),
+	}
+}
+
+// buildGrafanaStartupProbe 构建Grafana启动探针
+// 首次启动时Grafana需要执行数据库迁移
+func (r *MonitorStackReconciler) buildGrafanaStartupProbe() *corev1.Probe {
+	return &corev1.Probe{
+		ProbeHandler: corev1.ProbeHandler{
+			HTTPGet: &corev1.HTTPGetAction{
+				Path: "/api/health",
+				Port: intstr.FromInt(3000),
+			},
+		},
+		PeriodSeconds:    startupProbePeriodSeconds,
+		TimeoutSeconds:   3,
+		FailureThreshold: minStartupFailureThreshold,
+	}
+}
+
+// applyProbeSpec 将用户配置的探针参数覆盖到探针上
+func applyProbeSpec(probe *corev1.Probe, spec *monitoringv1.ProbeSpec) {
+	if probe == nil || spec == nil {
+		return
+	}
+	if spec.InitialDelaySeconds != nil {
+		probe.InitialDelaySeconds = *spec.InitialDelaySeconds
+	}
+	if spec.PeriodSeconds != nil {
+		probe.PeriodSeconds = *spec.PeriodSeconds
+	}
+	if spec.TimeoutSeconds != nil {
+		probe.TimeoutSeconds = *spec.TimeoutSeconds
+	}
+	if spec.FailureThreshold != nil {
+		probe.FailureThreshold = *spec.FailureThreshold
+	}
+	if spec.SuccessThreshold != nil {
+		probe.SuccessThreshold = *spec.SuccessThreshold
+	}
+}
+
+// applyProbeOverrides 将探针参数覆盖应用到容器
+// scheme为根据组件配置推断的探针协议，为空时使用HTTP
+func applyProbeOverrides(container *corev1.Container, probes *monitoringv1.ProbesSpec, scheme corev1.URIScheme) {
+	if scheme != "" {
+		for _, probe := range []*corev1.Probe{container.LivenessProbe, container.ReadinessProbe, container.StartupProbe} {
+			if probe != nil && probe.HTTPGet != nil {
+				probe.HTTPGet.Scheme = scheme
+			}
+		}
+	}
+
+	if probes == nil {
+		return
+	}
+	applyProbeSpec(container.LivenessProbe, probes.Liveness)
+	applyProbeSpec(container.ReadinessProbe, probes.Readiness)
+	applyProbeSpec(container.StartupProbe, probes.Startup)
+}
+
+// getGrafanaProbeScheme 根据grafana.ini的server.protocol推断探针协议
+func (r *MonitorStackReconciler) getGrafanaProbeScheme(monitorStack *monitoringv1.MonitorStack) corev1.URIScheme {
+	switch monitorStack.Spec.Grafana.Config["server"]["protocol"] {
+	case "https", "h2":
+		return corev1.URISchemeHTTPS
+	}
+	return ""
+}
+
+// validateProbes 验证探针配置
+// 时间参数不能小于kubelet允许的最小值，存活探针和启动探针的successThreshold只能为1
+func validateProbes(probes *monitoringv1.ProbesSpec) error {
+	if probes == nil {
+		return nil
+	}
+	if err := validateProbeSpec(probes.Liveness); err != nil {
+		return fmt.Errorf("liveness probe %w", err)
+	}
+	if err := validateProbeSpec(probes.Readiness); err != nil {
+		return fmt.Errorf("readiness probe %w", err)
+	}
+	if err := validateProbeSpec(probes.Startup); err != nil {
+		return fmt.Errorf("startup probe %w", err)
+	}
+
+	if probes.Liveness != nil && probes.Liveness.SuccessThreshold != nil && *probes.Liveness.SuccessThreshold != 1 {
+		return fmt.Errorf("liveness probe successThreshold must be 1")
+	}
+	if probes.Startup != nil && probes.Startup.SuccessThreshold != nil && *probes.Startup.SuccessThreshold != 1 {
+		return fmt.Errorf("startup probe successThreshold must be 1")
+	}
+	return nil
+}
+
+// validateProbeSpec 验证单个探针的时间参数
+func validateProbeSpec(spec *monitoringv1.ProbeSpec) error {
+	if spec == nil {
+		return nil
+	}
+	if spec.InitialDelaySeconds != nil && *spec.InitialDelaySeconds < 0 {
+		return fmt.Errorf("initialDelaySeconds must not be negative")
+	}
+	fields := []struct {
+		name  string
+		value *int32
+	}{
+		{"periodSeconds", spec.PeriodSeconds},
+		{"timeoutSeconds", spec.TimeoutSeconds},
+		{"failureThreshold", spec.FailureThreshold},
+		{"successThreshold", spec.SuccessThreshold},
+	}
+	for _, field := range fields {
+		if field.value != nil && *field.value < 1 {
+			return fmt.Errorf("%s must be at least 1", field.name)
+		}
+	}
+	return nil
+}
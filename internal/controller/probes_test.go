@@ -0,0 +1,97 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+
+	monitoringv1 "github.com/ciliverse/monitor-operator/api/v1"
+)
+
+var _ = Describe("Probes", func() {
+	r := &MonitorStackReconciler{}
+
+	int32Ptr := func(v int32) *int32 { return &v }
+
+	DescribeTable("getPrometheusStartupFailureThreshold",
+		func(size string, expected int32) {
+			monitorStack := newTestMonitorStack()
+			monitorStack.Spec.Prometheus.Storage.Size = size
+			Expect(r.getPrometheusStartupFailureThreshold(monitorStack)).To(Equal(expected))
+		},
+		Entry("uses the minimum for small volumes", "1Gi", minStartupFailureThreshold),
+		Entry("uses the minimum for unparsable sizes", "", minStartupFailureThreshold),
+		Entry("scales with storage size", "50Gi", int32(100)),
+		Entry("rounds partial GiB up", "50.5Gi", int32(102)),
+		Entry("caps very large volumes", "10Ti", int32(maxStartupFailureThreshold)),
+	)
+
+	DescribeTable("validateProbes",
+		func(probes *monitoringv1.ProbesSpec, expectedError string) {
+			err := validateProbes(probes)
+			if expectedError == "" {
+				Expect(err).NotTo(HaveOccurred())
+			} else {
+				Expect(err).To(MatchError(ContainSubstring(expectedError)))
+			}
+		},
+		Entry("accepts no overrides", nil, ""),
+		Entry("accepts valid overrides", &monitoringv1.ProbesSpec{
+			Readiness: &monitoringv1.ProbeSpec{SuccessThreshold: int32Ptr(2), FailureThreshold: int32Ptr(5)},
+		}, ""),
+		Entry("rejects a zero failureThreshold", &monitoringv1.ProbesSpec{
+			Startup: &monitoringv1.ProbeSpec{FailureThreshold: int32Ptr(0)},
+		}, "startup probe failureThreshold must be at least 1"),
+		Entry("rejects a zero periodSeconds", &monitoringv1.ProbesSpec{
+			Readiness: &monitoringv1.ProbeSpec{PeriodSeconds: int32Ptr(0)},
+		}, "readiness probe periodSeconds must be at least 1"),
+		Entry("rejects a negative initialDelaySeconds", &monitoringv1.ProbesSpec{
+			Liveness: &monitoringv1.ProbeSpec{InitialDelaySeconds: int32Ptr(-1)},
+		}, "liveness probe initialDelaySeconds must not be negative"),
+		Entry("rejects liveness successThreshold other than 1", &monitoringv1.ProbesSpec{
+			Liveness: &monitoringv1.ProbeSpec{SuccessThreshold: int32Ptr(2)},
+		}, "liveness probe successThreshold must be 1"),
+	)
+
+	It("rejects invalid probes during stack validation", func() {
+		monitorStack := newTestMonitorStack()
+		monitorStack.Spec.Prometheus.Probes = &monitoringv1.ProbesSpec{
+			Liveness: &monitoringv1.ProbeSpec{FailureThreshold: int32Ptr(0)},
+		}
+		Expect(r.validateMonitorStack(monitorStack)).To(MatchError(ContainSubstring("failureThreshold must be at least 1")))
+	})
+
+	It("applies timing overrides", func() {
+		monitorStack := newTestMonitorStack()
+		monitorStack.Spec.Prometheus.Probes = &monitoringv1.ProbesSpec{
+			Liveness: &monitoringv1.ProbeSpec{TimeoutSeconds: int32Ptr(10)},
+		}
+		container := r.buildPrometheusDeployment(monitorStack).Spec.Template.Spec.Containers[0]
+		Expect(container.LivenessProbe.TimeoutSeconds).To(Equal(int32(10)))
+		Expect(container.ReadinessProbe.HTTPGet.Scheme).To(BeEmpty())
+	})
+
+	It("switches Grafana probes to HTTPS when grafana.ini enables TLS", func() {
+		monitorStack := newTestMonitorStack()
+		monitorStack.Spec.Grafana.Config = map[string]map[string]string{"server": {"protocol": "https"}}
+		container := r.buildGrafanaDeployment(monitorStack).Spec.Template.Spec.Containers[0]
+		Expect(container.ReadinessProbe.HTTPGet.Scheme).To(Equal(corev1.URISchemeHTTPS))
+		Expect(container.StartupProbe.HTTPGet.Scheme).To(Equal(corev1.URISchemeHTTPS))
+	})
+})
@@ -0,0 +1,547 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/yaml"
+
+	monitoringv1 "github.com/ciliverse/monitor-operator/api/v1"
+)
+
+// Prometheus Web配置 - 根据spec.prometheus.web生成web.config.file，启用HTTPS和Basic认证
+// 参考: https://prometheus.io/docs/prometheus/latest/configuration/https/
+// Prometheus处理请求时重新读取web.config.file和证书，Secret更新后无需重启Pod。
+// operator中所有访问Prometheus的地方（探针、Grafana数据源、自监控抓取、配置热加载、备份等客户端容器以及operator自身的查询）
+// 都通过本文件的函数获取协议和凭据
+
+const (
+	// prometheusWebConfigDir operator生成的web配置Secret在Prometheus容器中的挂载目录
+	prometheusWebConfigDir = "/etc/prometheus/web"
+	// prometheusWebTLSDir 服务端证书Secret在Prometheus容器中的挂载目录
+	prometheusWebTLSDir = "/etc/prometheus/web-tls"
+
+	// web配置Secret中的键：web.config.file、Basic认证密码、CA证书和reload地址
+	// 密码和CA证书供Prometheus自监控等需要访问本栈Prometheus的容器使用
+	// reload地址中包含Basic认证凭据，供配置热加载sidecar通过环境变量引用
+	prometheusWebConfigKey    = "web-config.yml"
+	prometheusWebPasswordKey  = "password"
+	prometheusWebCAKey        = "ca.crt"
+	prometheusWebReloadURLKey = "reload-url"
+
+	// prometheusClientDir 访问Prometheus API的客户端容器中挂载密码和CA证书的目录
+	prometheusClientDir = "/etc/prometheus-client"
+
+	// prometheusHTTPMaxBodySize operator读取Prometheus响应的最大长度
+	prometheusHTTPMaxBodySize = 32 * 1024 * 1024
+)
+
+// prometheusCurlScript 定义prometheus_curl函数，按addPrometheusClient设置的环境变量校验CA证书并携带Basic认证凭据
+// 凭据以curl配置的形式通过标准输入传入，不出现在进程参数中
+const prometheusCurlScript = `escape_curl() { printf '%s' "$1" | sed 's/[\\"]/\\&/g'; }
+prometheus_curl() {
+  {
+    if [ -n "$PROMETHEUS_CA_FILE" ]; then
+      printf 'cacert = "%s"\n' "$(escape_curl "$PROMETHEUS_CA_FILE")"
+    fi
+    if [ -n "$PROMETHEUS_USERNAME" ]; then
+      printf 'user = "%s:%s"\n' "$(escape_curl "$PROMETHEUS_USERNAME")" "$(escape_curl "$(cat "$PROMETHEUS_PASSWORD_FILE")")"
+    fi
+  } | curl -fsS -K - "$@"
+}
+`
+
+// prometheusWebConfig Prometheus的web.config.file
+type prometheusWebConfig struct {
+	TLSServerConfig *prometheusWebTLSServerConfig `json:"tls_server_config,omitempty"`
+	BasicAuthUsers  map[string]string             `json:"basic_auth_users,omitempty"`
+}
+
+// prometheusWebTLSServerConfig web.config.file中的服务端TLS配置
+type prometheusWebTLSServerConfig struct {
+	CertFile string `json:"cert_file"`
+	KeyFile  string `json:"key_file"`
+}
+
+// isPrometheusWebTLSEnabled 判断Prometheus是否启用HTTPS
+func isPrometheusWebTLSEnabled(monitorStack *monitoringv1.MonitorStack) bool {
+	web := monitorStack.Spec.Prometheus.Web
+	return web != nil && web.TLS != nil
+}
+
+// isPrometheusWebAuthEnabled 判断Prometheus是否启用Basic认证
+func isPrometheusWebAuthEnabled(monitorStack *monitoringv1.MonitorStack) bool {
+	web := monitorStack.Spec.Prometheus.Web
+	return web != nil && web.BasicAuth != nil
+}
+
+// isPrometheusWebConfigEnabled 判断是否需要为Prometheus生成web.config.file
+func isPrometheusWebConfigEnabled(monitorStack *monitoringv1.MonitorStack) bool {
+	return isPrometheusWebTLSEnabled(monitorStack) || isPrometheusWebAuthEnabled(monitorStack)
+}
+
+// getPrometheusScheme 获取访问Prometheus使用的协议
+func getPrometheusScheme(monitorStack *monitoringv1.MonitorStack) string {
+	if isPrometheusWebTLSEnabled(monitorStack) {
+		return "https"
+	}
+	return "http"
+}
+
+// getPrometheusProbeScheme 获取Prometheus HTTP探针的协议，kubelet不校验探针的服务端证书
+func getPrometheusProbeScheme(monitorStack *monitoringv1.MonitorStack) corev1.URIScheme {
+	if isPrometheusWebTLSEnabled(monitorStack) {
+		return corev1.URISchemeHTTPS
+	}
+	return ""
+}
+
+// getPrometheusWebSecretRefs 获取web配置引用的Secret键，Secret变化后需要重新生成web配置Secret
+func (r *MonitorStackReconciler) getPrometheusWebSecretRefs(monitorStack *monitoringv1.MonitorStack) []corev1.SecretKeySelector {
+	web := monitorStack.Spec.Prometheus.Web
+	if web == nil {
+		return nil
+	}
+	var refs []corev1.SecretKeySelector
+	if web.BasicAuth != nil {
+		refs = append(refs, web.BasicAuth.Password)
+	}
+	if web.TLS != nil && web.TLS.CA != nil {
+		refs = append(refs, *web.TLS.CA)
+	}
+	return refs
+}
+
+// addPrometheusWebConfig 为Prometheus Deployment添加web.config.file参数并挂载web配置和证书
+// 启用Basic认证时把HTTP探针改为TCP探针，探针不携带凭据，避免在Pod中保存密码
+func (r *MonitorStackReconciler) addPrometheusWebConfig(deployment *appsv1.Deployment, monitorStack *monitoringv1.MonitorStack) {
+	if !isPrometheusWebConfigEnabled(monitorStack) {
+		return
+	}
+
+	podSpec := &deployment.Spec.Template.Spec
+	container := &podSpec.Containers[0]
+	container.Args = append(container.Args,
+		fmt.Sprintf("--web.config.file=%s/%s", prometheusWebConfigDir, prometheusWebConfigKey))
+	container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+		Name:      "web-config",
+		MountPath: prometheusWebConfigDir,
+		ReadOnly:  true,
+	})
+	podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+		Name: "web-config",
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{SecretName: r.getPrometheusWebConfigSecretName(monitorStack)},
+		},
+	})
+
+	if tls := monitorStack.Spec.Prometheus.Web.TLS; tls != nil {
+		container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+			Name:      "web-tls",
+			MountPath: prometheusWebTLSDir,
+			ReadOnly:  true,
+		})
+		podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+			Name: "web-tls",
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName: tls.SecretName,
+					Items: []corev1.KeyToPath{
+						{Key: corev1.TLSCertKey, Path: corev1.TLSCertKey},
+						{Key: corev1.TLSPrivateKeyKey, Path: corev1.TLSPrivateKeyKey},
+					},
+				},
+			},
+		})
+	}
+
+	if isPrometheusWebAuthEnabled(monitorStack) {
+		for _, probe := range []*corev1.Probe{container.LivenessProbe, container.ReadinessProbe, container.StartupProbe} {
+			if probe != nil && probe.HTTPGet != nil {
+				probe.ProbeHandler = corev1.ProbeHandler{
+					TCPSocket: &corev1.TCPSocketAction{Port: intstr.FromInt(9090)},
+				}
+			}
+		}
+	}
+}
+
+// addPrometheusClient 为访问Prometheus API的容器设置PROMETHEUS_URL环境变量
+// 启用Basic认证或配置了CA证书时，挂载web配置Secret中的密码和CA证书，
+// 并设置PROMETHEUS_USERNAME、PROMETHEUS_PASSWORD_FILE和PROMETHEUS_CA_FILE，供prometheusCurlScript使用
+func (r *MonitorStackReconciler) addPrometheusClient(podSpec *corev1.PodSpec, container *corev1.Container,
+	monitorStack *monitoringv1.MonitorStack, url string) {
+	container.Env = append(container.Env, corev1.EnvVar{Name: "PROMETHEUS_URL", Value: url})
+
+	web := monitorStack.Spec.Prometheus.Web
+	var items []corev1.KeyToPath
+	if web != nil && web.BasicAuth != nil {
+		items = append(items, corev1.KeyToPath{Key: prometheusWebPasswordKey, Path: prometheusWebPasswordKey})
+		container.Env = append(container.Env,
+			corev1.EnvVar{Name: "PROMETHEUS_USERNAME", Value: web.BasicAuth.Username},
+			corev1.EnvVar{Name: "PROMETHEUS_PASSWORD_FILE", Value: prometheusClientDir + "/" + prometheusWebPasswordKey},
+		)
+	}
+	if web != nil && web.TLS != nil && web.TLS.CA != nil {
+		items = append(items, corev1.KeyToPath{Key: prometheusWebCAKey, Path: prometheusWebCAKey})
+		container.Env = append(container.Env,
+			corev1.EnvVar{Name: "PROMETHEUS_CA_FILE", Value: prometheusClientDir + "/" + prometheusWebCAKey})
+	}
+	if len(items) == 0 {
+		return
+	}
+
+	container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+		Name:      "prometheus-client",
+		MountPath: prometheusClientDir,
+		ReadOnly:  true,
+	})
+	podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+		Name: "prometheus-client",
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName: r.getPrometheusWebConfigSecretName(monitorStack),
+				Items:      items,
+			},
+		},
+	})
+}
+
+// getPrometheusReloadURL 获取配置热加载sidecar调用的reload地址，启用Basic认证时地址中包含凭据
+// sidecar与Prometheus在同一个Pod中，通过localhost访问，启用HTTPS时证书需要包含localhost
+func getPrometheusReloadURL(monitorStack *monitoringv1.MonitorStack, password []byte) string {
+	reloadURL := url.URL{Scheme: getPrometheusScheme(monitorStack), Host: "localhost:9090", Path: "/-/reload"}
+	if isPrometheusWebAuthEnabled(monitorStack) {
+		reloadURL.User = url.UserPassword(monitorStack.Spec.Prometheus.Web.BasicAuth.Username, string(password))
+	}
+	return reloadURL.String()
+}
+
+// addPrometheusReloadClient 为配置热加载sidecar设置reload地址
+// 启用web配置时地址从web配置Secret注入，避免凭据出现在Pod spec中，修改密码后Pod重建时才使用新地址；
+// 配置了CA证书时挂载Pod中已有的web配置卷，通过SSL_CERT_FILE校验Prometheus的证书
+func (r *MonitorStackReconciler) addPrometheusReloadClient(container *corev1.Container, monitorStack *monitoringv1.MonitorStack) {
+	if !isPrometheusWebConfigEnabled(monitorStack) {
+		container.Args = append(container.Args, "--webhook-url="+getPrometheusReloadURL(monitorStack, nil))
+		return
+	}
+
+	container.Args = append(container.Args, "--webhook-url=$(RELOAD_URL)")
+	container.Env = append(container.Env, corev1.EnvVar{
+		Name: "RELOAD_URL",
+		ValueFrom: &corev1.EnvVarSource{
+			SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: r.getPrometheusWebConfigSecretName(monitorStack)},
+				Key:                  prometheusWebReloadURLKey,
+			},
+		},
+	})
+	if tls := monitorStack.Spec.Prometheus.Web.TLS; tls != nil && tls.CA != nil {
+		container.Env = append(container.Env,
+			corev1.EnvVar{Name: "SSL_CERT_FILE", Value: prometheusClientDir + "/" + prometheusWebCAKey})
+		container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+			Name:      "web-config",
+			MountPath: prometheusClientDir,
+			ReadOnly:  true,
+		})
+	}
+}
+
+// prometheusHTTPClient operator访问Prometheus HTTP API的客户端
+type prometheusHTTPClient struct {
+	baseURL  string
+	client   *http.Client
+	username string
+	password string
+}
+
+// newPrometheusHTTPClient 构建operator访问Prometheus的客户端，baseURL为Prometheus的访问地址
+// 与客户端容器一样从web配置Secret读取密码和CA证书，未配置CA证书时使用系统根证书
+func (r *MonitorStackReconciler) newPrometheusHTTPClient(ctx context.Context, monitorStack *monitoringv1.MonitorStack, baseURL string) (*prometheusHTTPClient, error) {
+	c := &prometheusHTTPClient{baseURL: baseURL}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// 客户端只在一次协调中使用，不保留空闲连接
+	transport.DisableKeepAlives = true
+	c.client = &http.Client{Transport: transport}
+
+	web := monitorStack.Spec.Prometheus.Web
+	if web == nil {
+		return c, nil
+	}
+	ref := func(key string) corev1.SecretKeySelector {
+		return corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: r.getPrometheusWebConfigSecretName(monitorStack)},
+			Key:                  key,
+		}
+	}
+	if web.BasicAuth != nil {
+		password, err := r.getSecretKey(ctx, monitorStack.Namespace, ref(prometheusWebPasswordKey))
+		if err != nil {
+			return nil, err
+		}
+		c.username = web.BasicAuth.Username
+		c.password = string(password)
+	}
+	if web.TLS != nil && web.TLS.CA != nil {
+		ca, err := r.getSecretKey(ctx, monitorStack.Namespace, ref(prometheusWebCAKey))
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("invalid CA certificate for Prometheus web TLS")
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+	return c, nil
+}
+
+// get 发送GET请求并返回响应内容，timeout为单次请求的超时时间
+// 状态码不是200时同时返回响应内容和错误，调用方可以从响应内容中解析错误信息
+func (c *prometheusHTTPClient) get(ctx context.Context, path string, timeout time.Duration) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, prometheusHTTPMaxBodySize))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return body, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return body, nil
+}
+
+// buildPrometheusWebConfig 构建web.config.file内容，passwordHash为Basic认证密码的bcrypt哈希
+func buildPrometheusWebConfig(monitorStack *monitoringv1.MonitorStack, passwordHash string) (string, error) {
+	config := prometheusWebConfig{}
+	if isPrometheusWebTLSEnabled(monitorStack) {
+		config.TLSServerConfig = &prometheusWebTLSServerConfig{
+			CertFile: prometheusWebTLSDir + "/" + corev1.TLSCertKey,
+			KeyFile:  prometheusWebTLSDir + "/" + corev1.TLSPrivateKeyKey,
+		}
+	}
+	if isPrometheusWebAuthEnabled(monitorStack) {
+		config.BasicAuthUsers = map[string]string{
+			monitorStack.Spec.Prometheus.Web.BasicAuth.Username: passwordHash,
+		}
+	}
+	out, err := yaml.Marshal(config)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// buildPrometheusScrapeAuth 构建抓取本栈Prometheus时使用的scheme、basic_auth和tls_config
+// 文件路径为Prometheus容器中web配置Secret的挂载路径，indent为每行的缩进
+func buildPrometheusScrapeAuth(monitorStack *monitoringv1.MonitorStack, indent string) string {
+	var b strings.Builder
+	if isPrometheusWebTLSEnabled(monitorStack) {
+		fmt.Fprintf(&b, "%sscheme: https\n", indent)
+		if monitorStack.Spec.Prometheus.Web.TLS.CA != nil {
+			fmt.Fprintf(&b, "%stls_config:\n%s  ca_file: %s/%s\n", indent, indent, prometheusWebConfigDir, prometheusWebCAKey)
+		}
+	}
+	if isPrometheusWebAuthEnabled(monitorStack) {
+		fmt.Fprintf(&b, "%sbasic_auth:\n%s  username: %s\n%s  password_file: %s/%s\n",
+			indent, indent, quoteYAMLString(monitorStack.Spec.Prometheus.Web.BasicAuth.Username),
+			indent, prometheusWebConfigDir, prometheusWebPasswordKey)
+	}
+	return b.String()
+}
+
+// quoteYAMLString 将字符串转换为YAML单引号字符串
+func quoteYAMLString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// applyPrometheusWebDatasource 按Prometheus的web配置设置自动注册数据源的Basic认证和CA证书
+// 密码和证书写入secureJsonData，与用户数据源一样通过环境变量从Secret注入
+func applyPrometheusWebDatasource(ds *monitoringv1.DatasourceSpec, monitorStack *monitoringv1.MonitorStack) {
+	web := monitorStack.Spec.Prometheus.Web
+	if web == nil {
+		return
+	}
+	secureJSONData := map[string]corev1.SecretKeySelector{}
+	if web.BasicAuth != nil {
+		ds.BasicAuth = true
+		ds.BasicAuthUser = web.BasicAuth.Username
+		secureJSONData["basicAuthPassword"] = web.BasicAuth.Password
+	}
+	if web.TLS != nil && web.TLS.CA != nil {
+		// 只包含布尔值，序列化不会失败
+		raw, _ := json.Marshal(map[string]any{"tlsAuthWithCACert": true})
+		ds.JSONData = &runtime.RawExtension{Raw: raw}
+		secureJSONData["tlsCACert"] = *web.TLS.CA
+	}
+	if len(secureJSONData) > 0 {
+		ds.SecureJSONData = secureJSONData
+	}
+}
+
+// reconcilePrometheusWebConfig 创建或更新web配置Secret，未配置web时删除之前创建的Secret
+func (r *MonitorStackReconciler) reconcilePrometheusWebConfig(ctx context.Context, monitorStack *monitoringv1.MonitorStack) error {
+	name := r.getPrometheusWebConfigSecretName(monitorStack)
+	if !isPrometheusWebConfigEnabled(monitorStack) {
+		return r.deleteOwnedObject(ctx, monitorStack, &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: monitorStack.Namespace},
+		})
+	}
+
+	existing := &corev1.Secret{}
+	err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: monitorStack.Namespace}, existing)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	found := err == nil
+
+	data := map[string][]byte{}
+	web := monitorStack.Spec.Prometheus.Web
+	passwordHash := ""
+	var password []byte
+	if web.BasicAuth != nil {
+		password, err = r.getSecretKey(ctx, monitorStack.Namespace, web.BasicAuth.Password)
+		if err != nil {
+			return err
+		}
+		// bcrypt每次生成的哈希都不同，密码未变化时沿用原有哈希，避免每次协调都更新Secret
+		passwordHash = getExistingPasswordHash(existing, web.BasicAuth.Username, password)
+		if passwordHash == "" {
+			hash, err := bcrypt.GenerateFromPassword(password, bcrypt.DefaultCost)
+			if err != nil {
+				return err
+			}
+			passwordHash = string(hash)
+		}
+		data[prometheusWebPasswordKey] = password
+	}
+	if web.TLS != nil && web.TLS.CA != nil {
+		ca, err := r.getSecretKey(ctx, monitorStack.Namespace, *web.TLS.CA)
+		if err != nil {
+			return err
+		}
+		data[prometheusWebCAKey] = ca
+	}
+	config, err := buildPrometheusWebConfig(monitorStack, passwordHash)
+	if err != nil {
+		return err
+	}
+	data[prometheusWebConfigKey] = []byte(config)
+	data[prometheusWebReloadURLKey] = []byte(getPrometheusReloadURL(monitorStack, password))
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: monitorStack.Namespace,
+			Labels:    r.getLabels(monitorStack, "prometheus"),
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: data,
+	}
+	if err := controllerutil.SetControllerReference(monitorStack, secret, r.Scheme); err != nil {
+		return err
+	}
+	if !found {
+		return r.Create(ctx, secret)
+	}
+	existing.Labels = secret.Labels
+	existing.Data = secret.Data
+	return r.Update(ctx, existing)
+}
+
+// getExistingPasswordHash 从已有的web配置Secret中读取密码哈希，哈希与当前密码不匹配时返回空字符串
+func getExistingPasswordHash(existing *corev1.Secret, username string, password []byte) string {
+	config := prometheusWebConfig{}
+	if err := yaml.Unmarshal(existing.Data[prometheusWebConfigKey], &config); err != nil {
+		return ""
+	}
+	hash := config.BasicAuthUsers[username]
+	if hash == "" || bcrypt.CompareHashAndPassword([]byte(hash), password) != nil {
+		return ""
+	}
+	return hash
+}
+
+// getSecretKey 读取MonitorStack所在命名空间中Secret的键值
+func (r *MonitorStackReconciler) getSecretKey(ctx context.Context, namespace string, ref corev1.SecretKeySelector) ([]byte, error) {
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: namespace}, secret); err != nil {
+		return nil, fmt.Errorf("failed to get secret %q: %w", ref.Name, err)
+	}
+	value, ok := secret.Data[ref.Key]
+	if !ok {
+		return nil, fmt.Errorf("secret %q has no key %q", ref.Name, ref.Key)
+	}
+	return value, nil
+}
+
+// validatePrometheusWeb 验证Prometheus的web配置
+func validatePrometheusWeb(web *monitoringv1.PrometheusWebSpec) error {
+	if web == nil {
+		return nil
+	}
+	if tls := web.TLS; tls != nil {
+		if tls.SecretName == "" {
+			return fmt.Errorf("web tls secretName cannot be empty")
+		}
+		if tls.CA != nil && (tls.CA.Name == "" || tls.CA.Key == "") {
+			return fmt.Errorf("web tls ca must reference a Secret name and key")
+		}
+	}
+	if auth := web.BasicAuth; auth != nil {
+		if auth.Username == "" || strings.ContainsAny(auth.Username, ": \t\r\n") {
+			return fmt.Errorf("web basicAuth username must be non-empty and must not contain colons or whitespace")
+		}
+		if auth.Password.Name == "" || auth.Password.Key == "" {
+			return fmt.Errorf("web basicAuth password must reference a Secret name and key")
+		}
+	}
+	return nil
+}
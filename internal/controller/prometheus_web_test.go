@@ -0,0 +1,179 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"golang.org/x/crypto/bcrypt"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/yaml"
+
+	monitoringv1 "github.com/ciliverse/monitor-operator/api/v1"
+)
+
+var _ = Describe("Prometheus web config", func() {
+	r := &MonitorStackReconciler{}
+
+	newWebMonitorStack := func() *monitoringv1.MonitorStack {
+		monitorStack := newTestMonitorStack()
+		ca := secretKey("prometheus-tls", "ca.crt")
+		monitorStack.Spec.Prometheus.Web = &monitoringv1.PrometheusWebSpec{
+			TLS:       &monitoringv1.PrometheusWebTLSSpec{SecretName: "prometheus-tls", CA: &ca},
+			BasicAuth: &monitoringv1.PrometheusWebBasicAuthSpec{Username: "admin", Password: secretKey("prometheus-auth", "password")},
+		}
+		return monitorStack
+	}
+
+	It("leaves the Deployment unchanged without web config", func() {
+		container := r.buildPrometheusDeployment(newTestMonitorStack()).Spec.Template.Spec.Containers[0]
+		Expect(container.Args).NotTo(ContainElement(HavePrefix("--web.config.file")))
+		Expect(container.ReadinessProbe.HTTPGet.Scheme).To(BeEmpty())
+		Expect(r.getPrometheusURL(newTestMonitorStack())).To(HavePrefix("http://"))
+	})
+
+	It("mounts the web config and certificate and probes over HTTPS with TLS only", func() {
+		monitorStack := newWebMonitorStack()
+		monitorStack.Spec.Prometheus.Web.BasicAuth = nil
+		podSpec := r.buildPrometheusDeployment(monitorStack).Spec.Template.Spec
+		container := podSpec.Containers[0]
+		Expect(container.Args).To(ContainElement("--web.config.file=/etc/prometheus/web/web-config.yml"))
+		Expect(container.VolumeMounts).To(ContainElements(
+			HaveField("MountPath", prometheusWebConfigDir),
+			HaveField("MountPath", prometheusWebTLSDir),
+		))
+		Expect(podSpec.Volumes).To(ContainElement(HaveField("Secret.SecretName", "prometheus-tls")))
+		for _, probe := range []*corev1.Probe{container.LivenessProbe, container.ReadinessProbe, container.StartupProbe} {
+			Expect(probe.HTTPGet.Scheme).To(Equal(corev1.URISchemeHTTPS))
+		}
+	})
+
+	It("switches to TCP probes with basic auth so no credentials are stored in the pod spec", func() {
+		container := r.buildPrometheusDeployment(newWebMonitorStack()).Spec.Template.Spec.Containers[0]
+		for _, probe := range []*corev1.Probe{container.LivenessProbe, container.ReadinessProbe, container.StartupProbe} {
+			Expect(probe.HTTPGet).To(BeNil())
+			Expect(probe.TCPSocket.Port.IntValue()).To(Equal(9090))
+		}
+		Expect(container.Env).To(BeEmpty())
+	})
+
+	It("renders the web config file", func() {
+		config, err := buildPrometheusWebConfig(newWebMonitorStack(), "$2y$10$hash")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config).To(MatchYAML(`
+tls_server_config:
+  cert_file: /etc/prometheus/web-tls/tls.crt
+  key_file: /etc/prometheus/web-tls/tls.key
+basic_auth_users:
+  admin: $2y$10$hash
+`))
+	})
+
+	It("uses the web scheme and credentials for the self-scrape job", func() {
+		config := r.getPrometheusConfig(newWebMonitorStack())
+		Expect(config).To(ContainSubstring(`  - job_name: 'prometheus'
+    scheme: https
+    tls_config:
+      ca_file: /etc/prometheus/web/ca.crt
+    basic_auth:
+      username: 'admin'
+      password_file: /etc/prometheus/web/password
+    static_configs:`))
+		Expect(r.getPrometheusConfig(newTestMonitorStack())).To(ContainSubstring(`  - job_name: 'prometheus'
+    static_configs:`))
+	})
+
+	It("derives the auto-registered datasource scheme and auth from the web config", func() {
+		datasources := r.getGrafanaDatasources(newWebMonitorStack())
+		Expect(datasources).To(HaveLen(1))
+		ds := datasources[0]
+		Expect(ds.URL).To(Equal("https://test-prometheus.monitoring.svc:9090"))
+		Expect(ds.BasicAuth).To(BeTrue())
+		Expect(ds.BasicAuthUser).To(Equal("admin"))
+		Expect(string(ds.JSONData.Raw)).To(MatchJSON(`{"tlsAuthWithCACert":true}`))
+		Expect(ds.SecureJSONData).To(Equal(map[string]corev1.SecretKeySelector{
+			"basicAuthPassword": secretKey("prometheus-auth", "password"),
+			"tlsCACert":         secretKey("prometheus-tls", "ca.crt"),
+		}))
+	})
+
+	It("creates the web config Secret and keeps the password hash while the password is unchanged", func() {
+		ctx := context.Background()
+		monitorStack := newWebMonitorStack()
+		monitorStack.UID = "uid"
+		reconciler := &MonitorStackReconciler{
+			Client: fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{Name: "prometheus-auth", Namespace: "monitoring"},
+					Data:       map[string][]byte{"password": []byte("s3cret")},
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{Name: "prometheus-tls", Namespace: "monitoring"},
+					Data:       map[string][]byte{"ca.crt": []byte("CA")},
+				},
+			).Build(),
+			Scheme: scheme.Scheme,
+		}
+		key := types.NamespacedName{Name: "test-prometheus-web-config", Namespace: "monitoring"}
+
+		Expect(reconciler.reconcilePrometheusWebConfig(ctx, monitorStack)).To(Succeed())
+		secret := &corev1.Secret{}
+		Expect(reconciler.Get(ctx, key, secret)).To(Succeed())
+		Expect(secret.Data[prometheusWebPasswordKey]).To(Equal([]byte("s3cret")))
+		Expect(secret.Data[prometheusWebCAKey]).To(Equal([]byte("CA")))
+		config := prometheusWebConfig{}
+		Expect(yaml.Unmarshal(secret.Data[prometheusWebConfigKey], &config)).To(Succeed())
+		hash := config.BasicAuthUsers["admin"]
+		Expect(bcrypt.CompareHashAndPassword([]byte(hash), []byte("s3cret"))).To(Succeed())
+
+		Expect(reconciler.reconcilePrometheusWebConfig(ctx, monitorStack)).To(Succeed())
+		Expect(reconciler.Get(ctx, key, secret)).To(Succeed())
+		Expect(yaml.Unmarshal(secret.Data[prometheusWebConfigKey], &config)).To(Succeed())
+		Expect(config.BasicAuthUsers["admin"]).To(Equal(hash))
+
+		monitorStack.Spec.Prometheus.Web = nil
+		Expect(reconciler.reconcilePrometheusWebConfig(ctx, monitorStack)).To(Succeed())
+		Expect(reconciler.Get(ctx, key, secret)).NotTo(Succeed())
+	})
+
+	DescribeTable("validatePrometheusWeb",
+		func(web *monitoringv1.PrometheusWebSpec, expectedError string) {
+			err := validatePrometheusWeb(web)
+			if expectedError == "" {
+				Expect(err).NotTo(HaveOccurred())
+			} else {
+				Expect(err).To(MatchError(ContainSubstring(expectedError)))
+			}
+		},
+		Entry("accepts no web config", nil, ""),
+		Entry("requires a TLS secret", &monitoringv1.PrometheusWebSpec{
+			TLS: &monitoringv1.PrometheusWebTLSSpec{},
+		}, "secretName cannot be empty"),
+		Entry("rejects a colon in the username", &monitoringv1.PrometheusWebSpec{
+			BasicAuth: &monitoringv1.PrometheusWebBasicAuthSpec{Username: "a:b", Password: secretKey("s", "p")},
+		}, "must not contain colons"),
+		Entry("requires a password reference", &monitoringv1.PrometheusWebSpec{
+			BasicAuth: &monitoringv1.PrometheusWebBasicAuthSpec{Username: "admin"},
+		}, "password must reference a Secret"),
+	)
+})
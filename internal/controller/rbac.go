@@ -0,0 +1,99 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	monitoringv1 "github.com/ciliverse/monitor-operator/api/v1"
+)
+
+// 服务发现权限 - Prometheus使用独立的ServiceAccount，kubernetes_sd_configs需要的权限通过Role或ClusterRole授予
+
+// operator授予Prometheus的权限必须自己也拥有，否则Kubernetes会拒绝创建Role/ClusterRole
+//+kubebuilder:rbac:groups="",resources=nodes;nodes/metrics;endpoints,verbs=get;list;watch
+//+kubebuilder:rbac:groups=discovery.k8s.io,resources=endpointslices,verbs=get;list;watch
+//+kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses,verbs=get;list;watch
+//+kubebuilder:rbac:urls=/metrics,verbs=get
+
+// prometheusNamespacedDiscoveryRules 命名空间内服务发现需要的权限
+var prometheusNamespacedDiscoveryRules = []rbacv1.PolicyRule{
+	{
+		APIGroups: []string{""},
+		Resources: []string{"services", "endpoints", "pods"},
+		Verbs:     []string{"get", "list", "watch"},
+	},
+	{
+		APIGroups: []string{"discovery.k8s.io"},
+		Resources: []string{"endpointslices"},
+		Verbs:     []string{"get", "list", "watch"},
+	},
+	{
+		APIGroups: []string{"networking.k8s.io"},
+		Resources: []string{"ingresses"},
+		Verbs:     []string{"get", "list", "watch"},
+	},
+}
+
+// prometheusClusterDiscoveryRules 集群范围服务发现需要的权限，在命名空间权限的基础上增加节点和/metrics
+var prometheusClusterDiscoveryRules = append([]rbacv1.PolicyRule{
+	{
+		APIGroups: []string{""},
+		Resources: []string{"nodes", "nodes/metrics"},
+		Verbs:     []string{"get", "list", "watch"},
+	},
+	{
+		NonResourceURLs: []string{"/metrics"},
+		Verbs:           []string{"get"},
+	},
+}, prometheusNamespacedDiscoveryRules...)
+
+// createPrometheusServiceAccount 创建Prometheus ServiceAccount
+func (r *MonitorStackReconciler) createPrometheusServiceAccount(ctx context.Context, monitorStack *monitoringv1.MonitorStack) error {
+	serviceAccount := &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      r.getPrometheusServiceAccountName(monitorStack),
+			Namespace: monitorStack.Namespace,
+			Labels:    r.getLabels(monitorStack, "prometheus"),
+		},
+	}
+
+	// 设置OwnerReference
+	if err := controllerutil.SetControllerReference(monitorStack, serviceAccount, r.Scheme); err != nil {
+		return err
+	}
+
+	// 创建或更新ServiceAccount
+	existing := &corev1.ServiceAccount{}
+	err := r.Get(ctx, types.NamespacedName{Name: serviceAccount.Name, Namespace: serviceAccount.Namespace}, existing)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return r.Create(ctx, serviceAccount)
+		}
+		return err
+	}
+
+	existing.Labels = serviceAccount.Labels
+	return r.Update(ctx, existing)
+}
@@ -57,16 +57,14 @@ func (r *MonitorStackReconciler) buildPrometheusDeployment(monitorStack *monitor
 					Labels: labels,
 				},
 				Spec: corev1.PodSpec{
-					// 安全上下文 - 以非root用户运行
-					SecurityContext: &corev1.PodSecurityContext{
-						RunAsNonRoot: &[]bool{true}[0],
-						RunAsUser:    &[]int64{65534}[0], // nobody用户
-						FSGroup:      &[]int64{65534}[0],
-					},
+					// 服务发现使用的ServiceAccount
+					ServiceAccountName: r.getPrometheusServiceAccountName(monitorStack),
+					// 安全上下文 - 以非root用户运行（nobody用户）
+					SecurityContext: r.buildPodSecurityContext(monitorStack.Spec.Prometheus.Security, prometheusUID),
 					Containers: []corev1.Container{
 						{
 							Name:  "prometheus",
-							Image: fmt.Sprintf("%s:%s", monitorStack.Spec.Prometheus.Image, monitorStack.Spec.Prometheus.Tag),
+							Image: r.getPrometheusImage(monitorStack),
 							Ports: []corev1.ContainerPort{
 								{
 									Name:          "web",
@@ -76,6 +74,8 @@ func (r *MonitorStackReconciler) buildPrometheusDeployment(monitorStack *monitor
 							},
 							// Prometheus启动参数
 							Args: r.buildPrometheusArgs(monitorStack),
+							// 容器安全上下文
+							SecurityContext: r.buildContainerSecurityContext(monitorStack.Spec.Prometheus.Security),
 							// 卷挂载 - 配置文件和数据目录
 							VolumeMounts: []corev1.VolumeMount{
 								{
@@ -85,7 +85,7 @@ func (r *MonitorStackReconciler) buildPrometheusDeployment(monitorStack *monitor
 								},
 							},
 							// 资源配置
-							Resources: r.buildResourceRequirements(monitorStack.Spec.Prometheus.Resources),
+							Resources: r.buildResourceRequirements(r.getPrometheusResources(monitorStack)),
 							// 健康检查 - 存活探针
 							LivenessProbe: &corev1.Probe{
 								ProbeHandler: corev1.ProbeHandler{
@@ -112,6 +112,8 @@ func (r *MonitorStackReconciler) buildPrometheusDeployment(monitorStack *monitor
 								TimeoutSeconds:      3,
 								FailureThreshold:    3,
 							},
+							// 健康检查 - 启动探针，等待WAL回放完成
+							StartupProbe: r.buildPrometheusStartupProbe(monitorStack),
 						},
 					},
 					// 卷定义 - 配置文件卷
@@ -135,6 +137,41 @@ func (r *MonitorStackReconciler) buildPrometheusDeployment(monitorStack *monitor
 	// 添加数据存储卷
 	r.addPrometheusDataVolume(deployment, monitorStack)
 
+	// 启用HTTPS或Basic认证时挂载web配置
+	r.addPrometheusWebConfig(deployment, monitorStack)
+
+	// 配置联邦时挂载联邦凭据
+	r.addPrometheusFederationCredentials(deployment, monitorStack)
+
+	// ReadWriteOnce的PVC无法同时挂载到新旧Pod，滚动更新会一直等待新Pod就绪，需要先停止旧Pod
+	for _, volume := range deployment.Spec.Template.Spec.Volumes {
+		if volume.Name == "data" && volume.PersistentVolumeClaim != nil {
+			deployment.Spec.Strategy = appsv1.DeploymentStrategy{
+				Type: appsv1.RecreateDeploymentStrategyType,
+			}
+		}
+	}
+
+	// 如果配置了数据恢复，添加数据恢复init容器
+	if !isPrometheusAgentMode(monitorStack) && needsPrometheusRestoreInitContainer(monitorStack.Spec.Prometheus.Storage) {
+		r.addPrometheusRestoreInitContainer(deployment, monitorStack)
+	}
+
+	// 应用探针参数覆盖
+	applyProbeOverrides(&deployment.Spec.Template.Spec.Containers[0], monitorStack.Spec.Prometheus.Probes, getPrometheusProbeScheme(monitorStack))
+
+	// 配置变化由sidecar热加载，不触发滚动更新
+	deployment.Spec.Template.Spec.Containers = append(deployment.Spec.Template.Spec.Containers,
+		r.buildPrometheusConfigReloader(monitorStack))
+
+	// 文件系统扩容需要重启Pod时，通过注解触发滚动更新
+	if monitorStack.Status.PrometheusStorage != nil && monitorStack.Status.PrometheusStorage.RestartedAt != "" {
+		if deployment.Spec.Template.Annotations == nil {
+			deployment.Spec.Template.Annotations = map[string]string{}
+		}
+		deployment.Spec.Template.Annotations[restartedAtAnnotation] = monitorStack.Status.PrometheusStorage.RestartedAt
+	}
+
 	return deployment
 }
 
@@ -148,7 +185,19 @@ func (r *MonitorStackReconciler) addPrometheusDataVolume(deployment *appsv1.Depl
 
 	var dataVolume corev1.Volume
 
-	if monitorStack.Spec.Prometheus.Storage.Size != "" {
+	if isPrometheusAgentMode(monitorStack) {
+		// agent模式只保存WAL，使用临时存储，存储大小用于限制WAL占用的空间
+		emptyDir := &corev1.EmptyDirVolumeSource{}
+		if size, err := resource.ParseQuantity(monitorStack.Spec.Prometheus.Storage.Size); err == nil {
+			emptyDir.SizeLimit = &size
+		}
+		dataVolume = corev1.Volume{
+			Name: "data",
+			VolumeSource: corev1.VolumeSource{
+				EmptyDir: emptyDir,
+			},
+		}
+	} else if monitorStack.Spec.Prometheus.Storage.Size != "" {
 		// 使用持久化存储
 		dataVolume = corev1.Volume{
 			Name: "data",
@@ -240,15 +289,11 @@ func (r *MonitorStackReconciler) buildGrafanaDeployment(monitorStack *monitoring
 				},
 				Spec: corev1.PodSpec{
 					// 安全上下文 - 以grafana用户运行
-					SecurityContext: &corev1.PodSecurityContext{
-						RunAsNonRoot: &[]bool{true}[0],
-						RunAsUser:    &[]int64{472}[0], // grafana用户
-						FSGroup:      &[]int64{472}[0],
-					},
+					SecurityContext: r.buildPodSecurityContext(monitorStack.Spec.Grafana.Security, grafanaUID),
 					Containers: []corev1.Container{
 						{
 							Name:  "grafana",
-							Image: fmt.Sprintf("%s:%s", monitorStack.Spec.Grafana.Image, monitorStack.Spec.Grafana.Tag),
+							Image: r.getGrafanaImage(monitorStack),
 							Ports: []corev1.ContainerPort{
 								{
 									Name:          "grafana",
@@ -258,12 +303,22 @@ func (r *MonitorStackReconciler) buildGrafanaDeployment(monitorStack *monitoring
 							},
 							// 环境变量配置
 							Env: r.buildGrafanaEnv(monitorStack),
-							// 卷挂载 - 数据目录
+							// 容器安全上下文
+							SecurityContext: r.buildContainerSecurityContext(monitorStack.Spec.Grafana.Security),
+							// 卷挂载 - 数据目录，以及只读根文件系统下需要写入的日志和临时目录
 							VolumeMounts: []corev1.VolumeMount{
 								{
 									Name:      "grafana-storage",
 									MountPath: "/var/lib/grafana",
 								},
+								{
+									Name:      "grafana-logs",
+									MountPath: "/var/log/grafana",
+								},
+								{
+									Name:      "tmp",
+									MountPath: "/tmp",
+								},
 							},
 							// 资源配置
 							Resources: r.buildResourceRequirements(monitorStack.Spec.Grafana.Resources),
@@ -293,9 +348,11 @@ func (r *MonitorStackReconciler) buildGrafanaDeployment(monitorStack *monitoring
 								TimeoutSeconds:      3,
 								FailureThreshold:    3,
 							},
+							// 健康检查 - 启动探针
+							StartupProbe: r.buildGrafanaStartupProbe(),
 						},
 					},
-					// 卷定义 - 数据存储卷（使用emptyDir）
+					// 卷定义 - 数据存储卷、日志和临时目录（使用emptyDir）
 					Volumes: []corev1.Volume{
 						{
 							Name: "grafana-storage",
@@ -303,17 +360,52 @@ func (r *MonitorStackReconciler) buildGrafanaDeployment(monitorStack *monitoring
 								EmptyDir: &corev1.EmptyDirVolumeSource{},
 							},
 						},
+						{
+							Name: "grafana-logs",
+							VolumeSource: corev1.VolumeSource{
+								EmptyDir: &corev1.EmptyDirVolumeSource{},
+							},
+						},
+						{
+							Name: "tmp",
+							VolumeSource: corev1.VolumeSource{
+								EmptyDir: &corev1.EmptyDirVolumeSource{},
+							},
+						},
 					},
 				},
 			},
 		},
 	}
 
+	// 应用探针参数覆盖
+	applyProbeOverrides(&deployment.Spec.Template.Spec.Containers[0], monitorStack.Spec.Grafana.Probes, r.getGrafanaProbeScheme(monitorStack))
+
 	// 如果配置了数据源，添加数据源配置卷
-	if len(monitorStack.Spec.Grafana.Datasources) > 0 {
+	if len(r.getGrafanaDatasources(monitorStack)) > 0 {
 		r.addGrafanaDatasourceVolume(deployment, monitorStack)
 	}
 
+	// 如果配置了grafana.ini，添加配置卷和配置哈希
+	if r.hasGrafanaIniConfig(monitorStack) {
+		r.addGrafanaConfigVolume(deployment, monitorStack)
+	}
+
+	// 如果配置了插件，添加插件安装init容器
+	if len(monitorStack.Spec.Grafana.Plugins) > 0 {
+		r.addGrafanaPluginsInitContainer(deployment, monitorStack)
+	}
+
+	// 如果配置了LDAP认证，添加LDAP配置卷
+	if monitorStack.Spec.Grafana.Auth != nil && monitorStack.Spec.Grafana.Auth.LDAP != nil {
+		r.addGrafanaLDAPVolume(deployment, monitorStack)
+	}
+
+	// 启用自动扩缩容时不设置副本数，由HPA管理
+	if isGrafanaAutoscalingEnabled(monitorStack) {
+		deployment.Spec.Replicas = nil
+	}
+
 	return deployment
 }
 
@@ -418,6 +510,17 @@ func (r *MonitorStackReconciler) buildResourceRequirements(resources monitoringv
 // buildPrometheusArgs 构建Prometheus启动参数
 // 根据配置生成Prometheus容器的启动参数
 func (r *MonitorStackReconciler) buildPrometheusArgs(monitorStack *monitoringv1.MonitorStack) []string {
+	// agent模式只保留WAL，不使用TSDB和保留时间参数，也不提供依赖TSDB的管理API
+	if isPrometheusAgentMode(monitorStack) {
+		agentFlag := prometheusAgentFlag(r.getPrometheusImage(monitorStack), getPrometheusTag(monitorStack))
+		return []string{
+			"--config.file=/etc/prometheus/prometheus.yml", // 配置文件路径
+			agentFlag,                          // 以agent模式运行
+			"--storage.agent.path=/prometheus", // WAL存储路径
+			"--web.enable-lifecycle",           // 启用生命周期API
+		}
+	}
+
 	args := []string{
 		"--config.file=/etc/prometheus/prometheus.yml",              // 配置文件路径
 		"--storage.tsdb.path=/prometheus",                           // 数据存储路径
@@ -465,11 +568,25 @@ func (r *MonitorStackReconciler) buildGrafanaEnv(monitorStack *monitoringv1.Moni
 		},
 	}
 
+	// 追加认证相关环境变量（OAuth/OIDC、LDAP）
+	env = append(env, r.buildGrafanaAuthEnv(monitorStack)...)
+
+	// 追加grafana.ini中引用的Secret配置项
+	env = append(env, r.buildGrafanaConfigSecretEnv(monitorStack)...)
+
+	// 追加数据源secureJsonData引用的Secret配置项
+	env = append(env, r.buildGrafanaDatasourceSecretEnv(monitorStack)...)
+
 	return env
 }
 
 // createGrafanaDatasourcesConfigMap 创建Grafana数据源配置ConfigMap
 func (r *MonitorStackReconciler) createGrafanaDatasourcesConfigMap(ctx context.Context, monitorStack *monitoringv1.MonitorStack) error {
+	datasourcesConfig, err := r.buildGrafanaDatasourcesConfig(monitorStack)
+	if err != nil {
+		return err
+	}
+
 	configMap := &corev1.ConfigMap{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      r.getGrafanaDatasourcesConfigMapName(monitorStack),
@@ -477,7 +594,7 @@ func (r *MonitorStackReconciler) createGrafanaDatasourcesConfigMap(ctx context.C
 			Labels:    r.getLabels(monitorStack, "grafana"),
 		},
 		Data: map[string]string{
-			"datasources.yaml": r.buildGrafanaDatasourcesConfig(monitorStack),
+			"datasources.yaml": datasourcesConfig,
 		},
 	}
 
@@ -488,7 +605,7 @@ func (r *MonitorStackReconciler) createGrafanaDatasourcesConfigMap(ctx context.C
 
 	// 创建或更新ConfigMap
 	existing := &corev1.ConfigMap{}
-	err := r.Get(ctx, types.NamespacedName{Name: configMap.Name, Namespace: configMap.Namespace}, existing)
+	err = r.Get(ctx, types.NamespacedName{Name: configMap.Name, Namespace: configMap.Namespace}, existing)
 	if err != nil {
 		if errors.IsNotFound(err) {
 			return r.Create(ctx, configMap)
@@ -505,6 +622,35 @@ func (r *MonitorStackReconciler) createGrafanaDatasourcesConfigMap(ctx context.C
 func (r *MonitorStackReconciler) createGrafanaDeployment(ctx context.Context, monitorStack *monitoringv1.MonitorStack) error {
 	deployment := r.buildGrafanaDeployment(monitorStack)
 
+	// 配置哈希 - grafana.ini或数据源配置变化时滚动更新Pod
+	configHash, err := r.getGrafanaConfigHash(monitorStack)
+	if err != nil {
+		return err
+	}
+	if configHash != "" {
+		if deployment.Spec.Template.Annotations == nil {
+			deployment.Spec.Template.Annotations = map[string]string{}
+		}
+		deployment.Spec.Template.Annotations[configHashAnnotation] = configHash
+	}
+
+	// Secret哈希 - 轮换configSecrets或secureJsonData引用的Secret时滚动更新Pod
+	secretHash, err := r.getGrafanaSecretHash(ctx, monitorStack)
+	if err != nil {
+		return err
+	}
+	if secretHash != "" {
+		if deployment.Spec.Template.Annotations == nil {
+			deployment.Spec.Template.Annotations = map[string]string{}
+		}
+		deployment.Spec.Template.Annotations[secretHashAnnotation] = secretHash
+	}
+
+	// 合并Pod模板覆盖
+	if err := applyPodTemplateOverride(deployment, monitorStack.Spec.Grafana.PodTemplate, "grafana"); err != nil {
+		return err
+	}
+
 	// 设置OwnerReference
 	if err := controllerutil.SetControllerReference(monitorStack, deployment, r.Scheme); err != nil {
 		return err
@@ -512,7 +658,7 @@ func (r *MonitorStackReconciler) createGrafanaDeployment(ctx context.Context, mo
 
 	// 创建或更新Deployment
 	existing := &appsv1.Deployment{}
-	err := r.Get(ctx, types.NamespacedName{Name: deployment.Name, Namespace: deployment.Namespace}, existing)
+	err = r.Get(ctx, types.NamespacedName{Name: deployment.Name, Namespace: deployment.Namespace}, existing)
 	if err != nil {
 		if errors.IsNotFound(err) {
 			return r.Create(ctx, deployment)
@@ -520,6 +666,11 @@ func (r *MonitorStackReconciler) createGrafanaDeployment(ctx context.Context, mo
 		return err
 	}
 
+	// 启用自动扩缩容时副本数由HPA管理，保留当前副本数
+	if isGrafanaAutoscalingEnabled(monitorStack) {
+		deployment.Spec.Replicas = existing.Spec.Replicas
+	}
+
 	// 更新现有Deployment
 	existing.Spec = deployment.Spec
 	existing.Labels = deployment.Labels
@@ -554,24 +705,3 @@ func (r *MonitorStackReconciler) createGrafanaService(ctx context.Context, monit
 	}
 	return r.Update(ctx, existing)
 }
-
-// buildGrafanaDatasourcesConfig 构建Grafana数据源配置
-// 生成Grafana数据源的YAML配置
-func (r *MonitorStackReconciler) buildGrafanaDatasourcesConfig(monitorStack *monitoringv1.MonitorStack) string {
-	config := `apiVersion: 1
-datasources:`
-
-	for i, ds := range monitorStack.Spec.Grafana.Datasources {
-		// 第一个Prometheus数据源设为默认
-		isDefault := i == 0 && ds.Type == "prometheus"
-
-		config += fmt.Sprintf(`
-  - name: %s
-    type: %s
-    url: %s
-    access: proxy
-    isDefault: %t`, ds.Name, ds.Type, ds.URL, isDefault)
-	}
-
-	return config
-}
@@ -0,0 +1,283 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	monitoringv1 "github.com/ciliverse/monitor-operator/api/v1"
+)
+
+// 数据恢复 - 新建的MonitorStack从备份、已有PVC或VolumeSnapshot恢复Prometheus数据
+// S3和PVC来源通过init容器在Prometheus启动前复制数据，init容器完成前Pod不会就绪；
+// VolumeSnapshot来源在创建PVC时通过dataSource由存储驱动恢复
+
+const (
+	// conditionTypePrometheusRestored Prometheus数据恢复状态条件
+	conditionTypePrometheusRestored = "PrometheusRestored"
+	// prometheusRestoreInitContainerName 数据恢复init容器名称
+	prometheusRestoreInitContainerName = "restore"
+	// volumeSnapshotAPIGroup VolumeSnapshot的API组
+	volumeSnapshotAPIGroup = "snapshot.storage.k8s.io"
+)
+
+// restorePrepareScript 恢复前检查：已恢复过或已有数据时跳过，避免覆盖现有数据
+const restorePrepareScript = `set -e
+if [ -f /prometheus/.restored ]; then
+  echo "data already restored"
+  exit 0
+fi
+if [ -d /prometheus/wal ]; then
+  echo "existing data found, skipping restore"
+  touch /prometheus/.restored
+  exit 0
+fi
+`
+
+// restoreS3Script 从S3兼容对象存储下载快照
+const restoreS3Script = restorePrepareScript + `chmod +x /work/mc
+MC="/work/mc --config-dir /work/.mc $MC_FLAGS"
+$MC alias set restore "$S3_ENDPOINT" "$AWS_ACCESS_KEY_ID" "$AWS_SECRET_ACCESS_KEY" >/dev/null
+$MC cp --recursive "restore/$S3_BUCKET/$S3_PATH/" /prometheus/
+touch /prometheus/.restored
+echo "restored from s3://$S3_BUCKET/$S3_PATH"`
+
+// restorePVCScript 从已有PVC复制数据
+const restorePVCScript = restorePrepareScript + `cp -R "/restore/$RESTORE_PATH/." /prometheus/
+touch /prometheus/.restored
+echo "restored from PVC path /$RESTORE_PATH"`
+
+// needsPrometheusRestoreInitContainer 判断是否需要通过init容器恢复数据
+func needsPrometheusRestoreInitContainer(storage monitoringv1.StorageSpec) bool {
+	return storage.Size != "" && storage.RestoreFrom != nil &&
+		(storage.RestoreFrom.S3 != nil || storage.RestoreFrom.PVC != nil)
+}
+
+// addPrometheusRestoreInitContainer 添加数据恢复init容器
+// 恢复完成后在数据目录写入标记文件，Pod重启时不会重复恢复
+func (r *MonitorStackReconciler) addPrometheusRestoreInitContainer(deployment *appsv1.Deployment, monitorStack *monitoringv1.MonitorStack) {
+	restoreFrom := monitorStack.Spec.Prometheus.Storage.RestoreFrom
+	workMount := corev1.VolumeMount{Name: "restore-work", MountPath: "/work"}
+	containerSecurityContext := r.buildContainerSecurityContext(monitorStack.Spec.Prometheus.Security)
+
+	initContainer := corev1.Container{
+		Name:    prometheusRestoreInitContainerName,
+		Command: []string{"/bin/sh", "-c"},
+		Env: []corev1.EnvVar{
+			{Name: "HOME", Value: "/work"},
+		},
+		VolumeMounts: []corev1.VolumeMount{
+			{Name: "data", MountPath: "/prometheus"},
+			workMount,
+		},
+		SecurityContext:          containerSecurityContext,
+		TerminationMessagePolicy: corev1.TerminationMessageFallbackToLogsOnError,
+	}
+	deployment.Spec.Template.Spec.Volumes = append(deployment.Spec.Template.Spec.Volumes, corev1.Volume{
+		Name:         "restore-work",
+		VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+	})
+
+	if s3 := restoreFrom.S3; s3 != nil {
+		mcFlags := ""
+		if s3.Insecure {
+			mcFlags = "--insecure"
+		}
+		// mc镜像不保证包含shell，先复制mc二进制，再在busybox中运行恢复脚本
+		deployment.Spec.Template.Spec.InitContainers = append(deployment.Spec.Template.Spec.InitContainers,
+			r.buildMCInstallContainer(workMount, containerSecurityContext))
+		initContainer.Image = r.rewriteImage(backupToolsImage)
+		initContainer.Args = []string{restoreS3Script}
+		initContainer.Env = append(initContainer.Env,
+			corev1.EnvVar{Name: "S3_ENDPOINT", Value: s3.Endpoint},
+			corev1.EnvVar{Name: "S3_BUCKET", Value: s3.Bucket},
+			corev1.EnvVar{Name: "S3_PATH", Value: strings.Trim(s3.Path, "/")},
+			corev1.EnvVar{Name: "MC_FLAGS", Value: mcFlags},
+		)
+		initContainer.EnvFrom = []corev1.EnvFromSource{
+			{
+				SecretRef: &corev1.SecretEnvSource{
+					LocalObjectReference: s3.CredentialsSecret,
+				},
+			},
+		}
+	} else if pvc := restoreFrom.PVC; pvc != nil {
+		initContainer.Image = r.rewriteImage(backupToolsImage)
+		initContainer.Args = []string{restorePVCScript}
+		initContainer.Env = append(initContainer.Env,
+			corev1.EnvVar{Name: "RESTORE_PATH", Value: strings.Trim(pvc.Path, "/")},
+		)
+		initContainer.VolumeMounts = append(initContainer.VolumeMounts, corev1.VolumeMount{
+			Name:      "restore-source",
+			MountPath: "/restore",
+			ReadOnly:  true,
+		})
+		deployment.Spec.Template.Spec.Volumes = append(deployment.Spec.Template.Spec.Volumes, corev1.Volume{
+			Name: "restore-source",
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+					ClaimName: pvc.ClaimName,
+					ReadOnly:  true,
+				},
+			},
+		})
+	}
+
+	deployment.Spec.Template.Spec.InitContainers = append(deployment.Spec.Template.Spec.InitContainers, initContainer)
+}
+
+// getPrometheusPVCDataSource 获取从VolumeSnapshot恢复时PVC的数据来源
+func getPrometheusPVCDataSource(storage monitoringv1.StorageSpec) *corev1.TypedLocalObjectReference {
+	if storage.RestoreFrom == nil || storage.RestoreFrom.VolumeSnapshot == nil {
+		return nil
+	}
+	return &corev1.TypedLocalObjectReference{
+		APIGroup: &[]string{volumeSnapshotAPIGroup}[0],
+		Kind:     "VolumeSnapshot",
+		Name:     storage.RestoreFrom.VolumeSnapshot.Name,
+	}
+}
+
+// updatePrometheusRestoreStatus 更新数据恢复状态条件
+func (r *MonitorStackReconciler) updatePrometheusRestoreStatus(ctx context.Context, monitorStack *monitoringv1.MonitorStack) error {
+	storage := monitorStack.Spec.Prometheus.Storage
+	if storage.Size == "" || storage.RestoreFrom == nil {
+		meta.RemoveStatusCondition(&monitorStack.Status.Conditions, conditionTypePrometheusRestored)
+		return nil
+	}
+
+	// 每次协调都重新计算，恢复来源变化或Pod重建后条件反映当前状态
+	restored := meta.IsStatusConditionTrue(monitorStack.Status.Conditions, conditionTypePrometheusRestored)
+
+	// VolumeSnapshot: PVC绑定后即恢复完成
+	if storage.RestoreFrom.VolumeSnapshot != nil {
+		pvc := &corev1.PersistentVolumeClaim{}
+		if err := r.Get(ctx, types.NamespacedName{
+			Name:      r.getPrometheusPVCName(monitorStack),
+			Namespace: monitorStack.Namespace,
+		}, pvc); err != nil {
+			return client.IgnoreNotFound(err)
+		}
+		if pvc.Status.Phase == corev1.ClaimBound {
+			r.setCondition(monitorStack, conditionTypePrometheusRestored, metav1.ConditionTrue, "Restored",
+				fmt.Sprintf("PVC %s was provisioned from VolumeSnapshot %s", pvc.Name, storage.RestoreFrom.VolumeSnapshot.Name))
+		} else {
+			r.setCondition(monitorStack, conditionTypePrometheusRestored, metav1.ConditionFalse, "Restoring",
+				fmt.Sprintf("waiting for PVC %s to be provisioned from VolumeSnapshot %s", pvc.Name, storage.RestoreFrom.VolumeSnapshot.Name))
+		}
+		return nil
+	}
+
+	// S3/PVC: 根据Prometheus Pod中init容器的状态判断
+	pods := &corev1.PodList{}
+	if err := r.List(ctx, pods,
+		client.InNamespace(monitorStack.Namespace),
+		client.MatchingLabels(r.getLabels(monitorStack, "prometheus")),
+	); err != nil {
+		return err
+	}
+
+	reason, message := "Pending", "waiting for the Prometheus pod to start the restore"
+	found := false
+	for _, pod := range pods.Items {
+		if pod.DeletionTimestamp != nil {
+			continue
+		}
+		for _, cs := range pod.Status.InitContainerStatuses {
+			if cs.Name != prometheusRestoreInitContainerName {
+				continue
+			}
+			found = true
+			switch {
+			case cs.State.Terminated != nil && cs.State.Terminated.ExitCode == 0:
+				r.setCondition(monitorStack, conditionTypePrometheusRestored, metav1.ConditionTrue, "Restored",
+					fmt.Sprintf("data restored in pod %s", pod.Name))
+				return nil
+			case cs.State.Running != nil:
+				reason, message = "Restoring", fmt.Sprintf("restoring data in pod %s", pod.Name)
+			case cs.LastTerminationState.Terminated != nil:
+				reason, message = "RestoreFailed", fmt.Sprintf("restore in pod %s failed: %s",
+					pod.Name, strings.TrimSpace(cs.LastTerminationState.Terminated.Message))
+			}
+		}
+	}
+
+	// 恢复完成后Pod重建期间没有init容器状态，保持已恢复状态；恢复标记文件保证不会重复恢复
+	if restored && !found {
+		return nil
+	}
+
+	r.setCondition(monitorStack, conditionTypePrometheusRestored, metav1.ConditionFalse, reason, message)
+	return nil
+}
+
+// validatePrometheusRestore 验证数据恢复配置
+func (r *MonitorStackReconciler) validatePrometheusRestore(monitorStack *monitoringv1.MonitorStack) error {
+	storage := monitorStack.Spec.Prometheus.Storage
+	restoreFrom := storage.RestoreFrom
+	if restoreFrom == nil {
+		return nil
+	}
+
+	if storage.Size == "" {
+		return fmt.Errorf("restoreFrom requires persistent storage (storage.size)")
+	}
+
+	sources := 0
+	for _, set := range []bool{restoreFrom.S3 != nil, restoreFrom.PVC != nil, restoreFrom.VolumeSnapshot != nil} {
+		if set {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return fmt.Errorf("exactly one restore source (s3, pvc or volumeSnapshot) must be set")
+	}
+
+	if s3 := restoreFrom.S3; s3 != nil {
+		if s3.Endpoint == "" || s3.Bucket == "" || strings.Trim(s3.Path, "/") == "" {
+			return fmt.Errorf("s3 restore source requires endpoint, bucket and path")
+		}
+		if s3.CredentialsSecret.Name == "" {
+			return fmt.Errorf("s3 restore source requires credentialsSecret")
+		}
+	}
+	if pvc := restoreFrom.PVC; pvc != nil {
+		if pvc.ClaimName == "" {
+			return fmt.Errorf("pvc restore source requires claimName")
+		}
+		if pvc.ClaimName == r.getPrometheusPVCName(monitorStack) {
+			return fmt.Errorf("restore PVC cannot be the Prometheus data PVC")
+		}
+		if strings.Contains(pvc.Path, "..") {
+			return fmt.Errorf("pvc restore path cannot contain '..'")
+		}
+	}
+	if vs := restoreFrom.VolumeSnapshot; vs != nil && vs.Name == "" {
+		return fmt.Errorf("volumeSnapshot restore source requires name")
+	}
+
+	return nil
+}
@@ -0,0 +1,146 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	monitoringv1 "github.com/ciliverse/monitor-operator/api/v1"
+)
+
+var _ = Describe("Prometheus restore", func() {
+	r := &MonitorStackReconciler{}
+
+	s3Source := func() *monitoringv1.S3RestoreSource {
+		return &monitoringv1.S3RestoreSource{
+			Endpoint:          "http://minio:9000",
+			Bucket:            "backups",
+			Path:              "20250101T000000Z-abc",
+			CredentialsSecret: corev1.LocalObjectReference{Name: "s3"},
+		}
+	}
+
+	newRestoreStack := func(source monitoringv1.RestoreSource) *monitoringv1.MonitorStack {
+		monitorStack := newTestMonitorStack()
+		monitorStack.Spec.Prometheus.Storage.Size = "50Gi"
+		monitorStack.Spec.Prometheus.Storage.RestoreFrom = &source
+		return monitorStack
+	}
+
+	DescribeTable("validatePrometheusRestore",
+		func(source monitoringv1.RestoreSource, expectedError string) {
+			err := r.validateMonitorStack(newRestoreStack(source))
+			if expectedError == "" {
+				Expect(err).NotTo(HaveOccurred())
+			} else {
+				Expect(err).To(MatchError(ContainSubstring(expectedError)))
+			}
+		},
+		Entry("accepts an S3 source", monitoringv1.RestoreSource{S3: s3Source()}, ""),
+		Entry("accepts a VolumeSnapshot source",
+			monitoringv1.RestoreSource{VolumeSnapshot: &monitoringv1.VolumeSnapshotRestoreSource{Name: "snap"}}, ""),
+		Entry("requires a source", monitoringv1.RestoreSource{}, "exactly one restore source"),
+		Entry("rejects two sources", monitoringv1.RestoreSource{
+			S3:             s3Source(),
+			VolumeSnapshot: &monitoringv1.VolumeSnapshotRestoreSource{Name: "snap"},
+		}, "exactly one restore source"),
+		Entry("requires an S3 path", monitoringv1.RestoreSource{S3: &monitoringv1.S3RestoreSource{
+			Endpoint: "http://minio:9000", Bucket: "backups", Path: "/", CredentialsSecret: corev1.LocalObjectReference{Name: "s3"},
+		}}, "requires endpoint, bucket and path"),
+		Entry("rejects '..' in the PVC path", monitoringv1.RestoreSource{
+			PVC: &monitoringv1.PVCRestoreSource{ClaimName: "old", Path: "../etc"},
+		}, "cannot contain '..'"),
+		Entry("rejects the data PVC as source", monitoringv1.RestoreSource{
+			PVC: &monitoringv1.PVCRestoreSource{ClaimName: "test-prometheus-data"},
+		}, "cannot be the Prometheus data PVC"),
+	)
+
+	It("restores from S3 in a shell image with mc copied from the mc image", func() {
+		deployment := r.buildPrometheusDeployment(newRestoreStack(monitoringv1.RestoreSource{S3: s3Source()}))
+		initContainers := deployment.Spec.Template.Spec.InitContainers
+		Expect(initContainers).To(HaveLen(2))
+		Expect(initContainers[0].Image).To(Equal(backupS3Image))
+		Expect(initContainers[0].Command[0]).To(Equal("mc"))
+		Expect(initContainers[1].Name).To(Equal(prometheusRestoreInitContainerName))
+		Expect(initContainers[1].Image).To(Equal(backupToolsImage))
+		Expect(initContainers[1].Args[0]).To(ContainSubstring(`MC="/work/mc --config-dir /work/.mc $MC_FLAGS"`))
+	})
+
+	Describe("updatePrometheusRestoreStatus", func() {
+		ctx := context.Background()
+
+		restorePod := func(monitorStack *monitoringv1.MonitorStack, state corev1.ContainerState) *corev1.Pod {
+			return &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test-prometheus-abc",
+					Namespace: monitorStack.Namespace,
+					Labels:    r.getLabels(monitorStack, "prometheus"),
+				},
+				Status: corev1.PodStatus{
+					InitContainerStatuses: []corev1.ContainerStatus{{Name: prometheusRestoreInitContainerName, State: state}},
+				},
+			}
+		}
+
+		It("recomputes the condition on every reconcile", func() {
+			monitorStack := newRestoreStack(monitoringv1.RestoreSource{S3: s3Source()})
+			reconciler := newFakeReconciler(restorePod(monitorStack, corev1.ContainerState{
+				Terminated: &corev1.ContainerStateTerminated{ExitCode: 0},
+			}))
+			r.setCondition(monitorStack, conditionTypePrometheusRestored, metav1.ConditionFalse, "Restoring", "restoring")
+
+			Expect(reconciler.updatePrometheusRestoreStatus(ctx, monitorStack)).To(Succeed())
+			Expect(meta.IsStatusConditionTrue(monitorStack.Status.Conditions, conditionTypePrometheusRestored)).To(BeTrue())
+		})
+
+		It("reports a failed restore after it was restored before", func() {
+			monitorStack := newRestoreStack(monitoringv1.RestoreSource{S3: s3Source()})
+			reconciler := newFakeReconciler(restorePod(monitorStack, corev1.ContainerState{
+				Running: &corev1.ContainerStateRunning{},
+			}))
+			r.setCondition(monitorStack, conditionTypePrometheusRestored, metav1.ConditionTrue, "Restored", "restored")
+
+			Expect(reconciler.updatePrometheusRestoreStatus(ctx, monitorStack)).To(Succeed())
+			condition := meta.FindStatusCondition(monitorStack.Status.Conditions, conditionTypePrometheusRestored)
+			Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+			Expect(condition.Reason).To(Equal("Restoring"))
+		})
+
+		It("keeps the restored condition while no pod reports the restore", func() {
+			monitorStack := newRestoreStack(monitoringv1.RestoreSource{S3: s3Source()})
+			r.setCondition(monitorStack, conditionTypePrometheusRestored, metav1.ConditionTrue, "Restored", "restored")
+
+			Expect(newFakeReconciler().updatePrometheusRestoreStatus(ctx, monitorStack)).To(Succeed())
+			Expect(meta.IsStatusConditionTrue(monitorStack.Status.Conditions, conditionTypePrometheusRestored)).To(BeTrue())
+		})
+
+		It("removes the condition when restoreFrom is removed", func() {
+			monitorStack := newRestoreStack(monitoringv1.RestoreSource{S3: s3Source()})
+			r.setCondition(monitorStack, conditionTypePrometheusRestored, metav1.ConditionFalse, "Pending", "pending")
+			monitorStack.Spec.Prometheus.Storage.RestoreFrom = nil
+
+			Expect(newFakeReconciler().updatePrometheusRestoreStatus(ctx, monitorStack)).To(Succeed())
+			Expect(meta.FindStatusCondition(monitorStack.Status.Conditions, conditionTypePrometheusRestored)).To(BeNil())
+		})
+	})
+})
@@ -0,0 +1,90 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+
+	monitoringv1 "github.com/ciliverse/monitor-operator/api/v1"
+)
+
+// 安全上下文 - 默认生成符合PodSecurity restricted标准的安全上下文
+// 参考: https://kubernetes.io/docs/concepts/security/pod-security-standards/#restricted
+
+const (
+	// prometheusUID Prometheus镜像中的nobody用户
+	prometheusUID = int64(65534)
+	// grafanaUID Grafana镜像中的grafana用户
+	grafanaUID = int64(472)
+)
+
+// buildPodSecurityContext 构建Pod安全上下文
+// uid为镜像默认用户，设置omitFixedUIDs时不指定runAsUser/fsGroup，由平台分配
+func (r *MonitorStackReconciler) buildPodSecurityContext(security *monitoringv1.SecuritySpec, uid int64) *corev1.PodSecurityContext {
+	if security != nil && security.PodSecurityContext != nil {
+		return security.PodSecurityContext.DeepCopy()
+	}
+
+	podSecurityContext := &corev1.PodSecurityContext{
+		RunAsNonRoot: &[]bool{true}[0],
+		SeccompProfile: &corev1.SeccompProfile{
+			Type: corev1.SeccompProfileTypeRuntimeDefault,
+		},
+	}
+	if security == nil || !security.OmitFixedUIDs {
+		podSecurityContext.RunAsUser = &[]int64{uid}[0]
+		podSecurityContext.FSGroup = &[]int64{uid}[0]
+	}
+
+	return podSecurityContext
+}
+
+// buildContainerSecurityContext 构建容器安全上下文
+// 默认禁止提权、丢弃所有capabilities并使用只读根文件系统，需要写入的目录通过卷挂载
+func (r *MonitorStackReconciler) buildContainerSecurityContext(security *monitoringv1.SecuritySpec) *corev1.SecurityContext {
+	if security != nil && security.ContainerSecurityContext != nil {
+		return security.ContainerSecurityContext.DeepCopy()
+	}
+
+	return &corev1.SecurityContext{
+		AllowPrivilegeEscalation: &[]bool{false}[0],
+		ReadOnlyRootFilesystem:   &[]bool{true}[0],
+		RunAsNonRoot:             &[]bool{true}[0],
+		Capabilities: &corev1.Capabilities{
+			Drop: []corev1.Capability{"ALL"},
+		},
+		SeccompProfile: &corev1.SeccompProfile{
+			Type: corev1.SeccompProfileTypeRuntimeDefault,
+		},
+	}
+}
+
+// validateSecurity 验证用户设置的安全上下文，不允许提升权限
+func validateSecurity(security *monitoringv1.SecuritySpec) error {
+	if security == nil {
+		return nil
+	}
+	if err := checkPodSecurityContext(security.PodSecurityContext); err != nil {
+		return fmt.Errorf("security.podSecurityContext %w", err)
+	}
+	if err := checkContainerSecurityContext(security.ContainerSecurityContext); err != nil {
+		return fmt.Errorf("security.containerSecurityContext %w", err)
+	}
+	return nil
+}
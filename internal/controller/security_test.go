@@ -0,0 +1,94 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+
+	monitoringv1 "github.com/ciliverse/monitor-operator/api/v1"
+)
+
+var _ = Describe("Security contexts", func() {
+	r := &MonitorStackReconciler{}
+
+	DescribeTable("buildPodSecurityContext",
+		func(security *monitoringv1.SecuritySpec, expectedUID *int64) {
+			podSecurityContext := r.buildPodSecurityContext(security, grafanaUID)
+			Expect(*podSecurityContext.RunAsNonRoot).To(BeTrue())
+			Expect(podSecurityContext.SeccompProfile.Type).To(Equal(corev1.SeccompProfileTypeRuntimeDefault))
+			Expect(podSecurityContext.RunAsUser).To(Equal(expectedUID))
+			Expect(podSecurityContext.FSGroup).To(Equal(expectedUID))
+		},
+		Entry("sets the image UID by default", nil, &[]int64{grafanaUID}[0]),
+		Entry("omits fixed UIDs when requested", &monitoringv1.SecuritySpec{OmitFixedUIDs: true}, nil),
+	)
+
+	It("replaces the defaults with explicit security contexts", func() {
+		security := &monitoringv1.SecuritySpec{
+			PodSecurityContext:       &corev1.PodSecurityContext{RunAsUser: &[]int64{1000}[0]},
+			ContainerSecurityContext: &corev1.SecurityContext{Privileged: &[]bool{false}[0]},
+		}
+		Expect(r.buildPodSecurityContext(security, grafanaUID)).To(Equal(security.PodSecurityContext))
+		Expect(r.buildContainerSecurityContext(security)).To(Equal(security.ContainerSecurityContext))
+	})
+
+	DescribeTable("validateSecurity",
+		func(security *monitoringv1.SecuritySpec, expectedError string) {
+			err := validateSecurity(security)
+			if expectedError == "" {
+				Expect(err).NotTo(HaveOccurred())
+			} else {
+				Expect(err).To(MatchError(ContainSubstring(expectedError)))
+			}
+		},
+		Entry("accepts the defaults", nil, ""),
+		Entry("accepts NET_BIND_SERVICE", &monitoringv1.SecuritySpec{
+			ContainerSecurityContext: &corev1.SecurityContext{
+				Capabilities: &corev1.Capabilities{Add: []corev1.Capability{"NET_BIND_SERVICE"}},
+			},
+		}, ""),
+		Entry("rejects privileged containers", &monitoringv1.SecuritySpec{
+			ContainerSecurityContext: &corev1.SecurityContext{Privileged: &[]bool{true}[0]},
+		}, "containerSecurityContext must not be privileged"),
+		Entry("rejects unconfined seccomp profiles", &monitoringv1.SecuritySpec{
+			PodSecurityContext: &corev1.PodSecurityContext{
+				SeccompProfile: &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeUnconfined},
+			},
+		}, "podSecurityContext must not use an Unconfined seccomp profile"),
+	)
+
+	It("builds restricted container security contexts", func() {
+		securityContext := r.buildContainerSecurityContext(nil)
+		Expect(*securityContext.AllowPrivilegeEscalation).To(BeFalse())
+		Expect(*securityContext.ReadOnlyRootFilesystem).To(BeTrue())
+		Expect(securityContext.Capabilities.Drop).To(ConsistOf(corev1.Capability("ALL")))
+	})
+
+	It("mounts writable volumes for Grafana's read-only root filesystem", func() {
+		deployment := r.buildGrafanaDeployment(newTestMonitorStack())
+		container := deployment.Spec.Template.Spec.Containers[0]
+		Expect(*container.SecurityContext.ReadOnlyRootFilesystem).To(BeTrue())
+
+		mountPaths := []string{}
+		for _, mount := range container.VolumeMounts {
+			mountPaths = append(mountPaths, mount.MountPath)
+		}
+		Expect(mountPaths).To(ContainElements("/var/lib/grafana", "/var/log/grafana", "/tmp"))
+	})
+})
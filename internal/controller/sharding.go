@@ -0,0 +1,450 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/yaml"
+
+	monitoringv1 "github.com/ciliverse/monitor-operator/api/v1"
+)
+
+// 抓取分片 - 单个Prometheus无法承载所有抓取目标时，按__address__的哈希把目标分配到多个Prometheus
+// 分片0沿用原有的资源名称，从单实例扩展到多个分片时已有的数据和访问地址不变
+// 其余分片的资源通过标签跟踪，减少分片数量时删除多出的分片，PVC按保留策略处理
+
+const (
+	// prometheusShardLabel 分片资源上记录分片序号的标签
+	prometheusShardLabel = "monitoring.cillian.website/prometheus-shard"
+	// prometheusShardComponent 分片0以外的分片资源的组件标签，与分片0的Service选择器区分
+	prometheusShardComponent = "prometheus-shard"
+)
+
+// prometheusShardExternalLabels 分片时添加到全局配置的外部标签，%d为分片序号
+const prometheusShardExternalLabels = `  external_labels:
+    shard: "%d"
+`
+
+// relabelConfig Prometheus配置文件中的relabel规则
+type relabelConfig struct {
+	SourceLabels []string `json:"source_labels,omitempty"`
+	Modulus      uint64   `json:"modulus,omitempty"`
+	TargetLabel  string   `json:"target_label,omitempty"`
+	Regex        string   `json:"regex,omitempty"`
+	Action       string   `json:"action"`
+}
+
+// getPrometheusShards 获取Prometheus分片数量，未设置时为1
+func getPrometheusShards(monitorStack *monitoringv1.MonitorStack) int32 {
+	shards := monitorStack.Spec.Prometheus.Shards
+	if shards == nil || *shards < 1 {
+		return 1
+	}
+	return *shards
+}
+
+// getPrometheusShardName 获取分片Deployment和Service的名称
+// 命名规则: 分片0为{MonitorStack名称}-prometheus，其余为{MonitorStack名称}-prometheus-shard-{序号}
+func (r *MonitorStackReconciler) getPrometheusShardName(monitorStack *monitoringv1.MonitorStack, shard int32) string {
+	if shard == 0 {
+		return r.getPrometheusName(monitorStack)
+	}
+	return fmt.Sprintf("%s-prometheus-shard-%d", monitorStack.Name, shard)
+}
+
+// getPrometheusShardConfigMapName 获取分片ConfigMap的名称
+// 命名规则: {分片名称}-config
+func (r *MonitorStackReconciler) getPrometheusShardConfigMapName(monitorStack *monitoringv1.MonitorStack, shard int32) string {
+	if shard == 0 {
+		return r.getPrometheusConfigMapName(monitorStack)
+	}
+	return r.getPrometheusShardName(monitorStack, shard) + "-config"
+}
+
+// getPrometheusShardPVCName 获取分片PVC的名称
+// 命名规则: {分片名称}-data
+func (r *MonitorStackReconciler) getPrometheusShardPVCName(monitorStack *monitoringv1.MonitorStack, shard int32) string {
+	if shard == 0 {
+		return r.getPrometheusPVCName(monitorStack)
+	}
+	return r.getPrometheusShardName(monitorStack, shard) + "-data"
+}
+
+// getPrometheusShardLabels 获取分片资源的标签，分片0与未分片时相同
+func (r *MonitorStackReconciler) getPrometheusShardLabels(monitorStack *monitoringv1.MonitorStack, shard int32) map[string]string {
+	if shard == 0 {
+		return r.getLabels(monitorStack, "prometheus")
+	}
+	labels := r.getLabels(monitorStack, prometheusShardComponent)
+	labels[prometheusShardLabel] = strconv.Itoa(int(shard))
+	return labels
+}
+
+// getPrometheusShardAddress 获取分片Service的集群内地址
+// 格式: {分片名称}.{命名空间}.svc:{端口}
+func (r *MonitorStackReconciler) getPrometheusShardAddress(monitorStack *monitoringv1.MonitorStack, shard int32) string {
+	port := monitorStack.Spec.Prometheus.Service.Port
+	if port == 0 {
+		port = 9090
+	}
+	return fmt.Sprintf("%s.%s.svc:%d", r.getPrometheusShardName(monitorStack, shard), monitorStack.Namespace, port)
+}
+
+// getPrometheusShardURL 获取分片Service的访问地址，协议与Prometheus的web配置一致
+// 格式: {http|https}://{分片名称}.{命名空间}.svc:{端口}
+func (r *MonitorStackReconciler) getPrometheusShardURL(monitorStack *monitoringv1.MonitorStack, shard int32) string {
+	return getPrometheusScheme(monitorStack) + "://" + r.getPrometheusShardAddress(monitorStack, shard)
+}
+
+// buildShardRelabelConfigs 生成只保留属于指定分片的目标的relabel规则，未分片时返回nil
+func buildShardRelabelConfigs(shards, shard int32) []relabelConfig {
+	if shards <= 1 {
+		return nil
+	}
+	return []relabelConfig{
+		{
+			SourceLabels: []string{"__address__"},
+			Modulus:      uint64(shards),
+			TargetLabel:  "__tmp_shard",
+			Action:       "hashmod",
+		},
+		{
+			SourceLabels: []string{"__tmp_shard"},
+			Regex:        strconv.Itoa(int(shard)),
+			Action:       "keep",
+		},
+	}
+}
+
+// addShardRelabelConfigs 在服务发现任务的relabel_configs末尾追加分片规则
+// job的最后一项必须是relabel_configs，未分片时原样返回
+func addShardRelabelConfigs(job string, shards, shard int32) string {
+	relabelConfigs := buildShardRelabelConfigs(shards, shard)
+	if relabelConfigs == nil {
+		return job
+	}
+
+	// 只包含字符串和数字字段，序列化不会失败
+	data, _ := yaml.Marshal(relabelConfigs)
+
+	// 作为relabel_configs的列表项缩进
+	var b strings.Builder
+	b.WriteString(strings.TrimSuffix(job, "\n"))
+	b.WriteString("      # 只保留属于当前分片的目标\n")
+	for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+		b.WriteString("      " + line + "\n")
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+// validatePrometheusShards 验证分片配置
+// 分片规则只能注入默认配置；备份和恢复只针对单个PVC，不支持分片
+func (r *MonitorStackReconciler) validatePrometheusShards(monitorStack *monitoringv1.MonitorStack) error {
+	if getPrometheusShards(monitorStack) == 1 {
+		return nil
+	}
+	prometheus := monitorStack.Spec.Prometheus
+
+	if prometheus.Config != "" {
+		return fmt.Errorf("shards requires the default Prometheus config")
+	}
+	if prometheus.Backup != nil {
+		return fmt.Errorf("backup is not supported with shards")
+	}
+	if prometheus.Storage.RestoreFrom != nil {
+		return fmt.Errorf("restoreFrom is not supported with shards")
+	}
+	return nil
+}
+
+// buildPrometheusShardDeployment 构建分片的Prometheus Deployment
+// 在分片0的基础上替换名称、标签、配置和数据卷
+func (r *MonitorStackReconciler) buildPrometheusShardDeployment(monitorStack *monitoringv1.MonitorStack, shard int32) *appsv1.Deployment {
+	deployment := r.buildPrometheusDeployment(monitorStack)
+	if shard == 0 {
+		return deployment
+	}
+
+	labels := r.getPrometheusShardLabels(monitorStack, shard)
+	deployment.Name = r.getPrometheusShardName(monitorStack, shard)
+	deployment.Labels = labels
+	deployment.Spec.Selector = &metav1.LabelSelector{MatchLabels: labels}
+	deployment.Spec.Template.Labels = labels
+
+	for i := range deployment.Spec.Template.Spec.Volumes {
+		volume := &deployment.Spec.Template.Spec.Volumes[i]
+		switch {
+		case volume.Name == "config" && volume.ConfigMap != nil:
+			volume.ConfigMap.Name = r.getPrometheusShardConfigMapName(monitorStack, shard)
+		case volume.Name == "data" && volume.PersistentVolumeClaim != nil:
+			volume.PersistentVolumeClaim.ClaimName = r.getPrometheusShardPVCName(monitorStack, shard)
+		}
+	}
+
+	return deployment
+}
+
+// buildPrometheusShardService 构建分片的Prometheus Service
+// 多个Service不能使用同一个NodePort，分片0以外的分片由Kubernetes分配NodePort
+func (r *MonitorStackReconciler) buildPrometheusShardService(monitorStack *monitoringv1.MonitorStack, shard int32) *corev1.Service {
+	service := r.buildPrometheusService(monitorStack)
+	if shard == 0 {
+		return service
+	}
+
+	labels := r.getPrometheusShardLabels(monitorStack, shard)
+	service.Name = r.getPrometheusShardName(monitorStack, shard)
+	service.Spec.Selector = labels
+	service.Spec.Ports[0].NodePort = 0
+	service.Labels = r.getPrometheusShardLabels(monitorStack, shard)
+	for k, v := range monitorStack.Spec.Prometheus.Service.Labels {
+		service.Labels[k] = v
+	}
+	return service
+}
+
+// createPrometheusShardPVC 创建分片的PVC
+// 分片0以外的分片不支持数据恢复，已存在时只允许扩容
+func (r *MonitorStackReconciler) createPrometheusShardPVC(ctx context.Context, monitorStack *monitoringv1.MonitorStack, shard int32) error {
+	storage := monitorStack.Spec.Prometheus.Storage
+	desired, err := resource.ParseQuantity(storage.Size)
+	if err != nil {
+		return fmt.Errorf("invalid storage size %q: %w", storage.Size, err)
+	}
+
+	pvc := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      r.getPrometheusShardPVCName(monitorStack, shard),
+			Namespace: monitorStack.Namespace,
+			Labels:    r.getPrometheusShardLabels(monitorStack, shard),
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes: []corev1.PersistentVolumeAccessMode{
+				corev1.ReadWriteOnce,
+			},
+			Resources: corev1.VolumeResourceRequirements{
+				Requests: corev1.ResourceList{
+					corev1.ResourceStorage: desired,
+				},
+			},
+		},
+	}
+
+	// 如果指定了StorageClass，设置它
+	if storage.StorageClass != "" {
+		pvc.Spec.StorageClassName = &storage.StorageClass
+	}
+
+	// 设置OwnerReference
+	if err := controllerutil.SetControllerReference(monitorStack, pvc, r.Scheme); err != nil {
+		return err
+	}
+
+	// 检查PVC是否已存在
+	existing := &corev1.PersistentVolumeClaim{}
+	err = r.Get(ctx, types.NamespacedName{Name: pvc.Name, Namespace: pvc.Namespace}, existing)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return r.Create(ctx, pvc)
+		}
+		return err
+	}
+
+	// 接管之前缩容或禁用时保留下来的PVC
+	if err := r.adoptPVC(ctx, monitorStack, existing); err != nil {
+		return err
+	}
+
+	// 等待文件系统扩容时重启分片以重新挂载数据卷
+	if pending, since := isFileSystemResizePending(existing); pending {
+		r.requestPrometheusRestart(ctx, monitorStack, existing, since)
+	}
+
+	// PVC已存在，只允许扩容
+	return r.expandPVC(ctx, existing, desired)
+}
+
+// reconcilePrometheusShards 协调分片0以外的分片，并删除超出分片数量的分片
+func (r *MonitorStackReconciler) reconcilePrometheusShards(ctx context.Context, monitorStack *monitoringv1.MonitorStack) error {
+	shards := getPrometheusShards(monitorStack)
+	usePVC := monitorStack.Spec.Prometheus.Storage.Size != "" && !isPrometheusAgentMode(monitorStack)
+
+	for shard := int32(1); shard < shards; shard++ {
+		if err := r.createPrometheusConfigMap(ctx, monitorStack, shard); err != nil {
+			return fmt.Errorf("failed to create ConfigMap of shard %d: %w", shard, err)
+		}
+		if usePVC {
+			if err := r.createPrometheusShardPVC(ctx, monitorStack, shard); err != nil {
+				return fmt.Errorf("failed to create PVC of shard %d: %w", shard, err)
+			}
+		}
+		if err := r.createPrometheusDeployment(ctx, monitorStack, shard); err != nil {
+			return fmt.Errorf("failed to create Deployment of shard %d: %w", shard, err)
+		}
+		if err := r.createPrometheusService(ctx, monitorStack, shard); err != nil {
+			return fmt.Errorf("failed to create Service of shard %d: %w", shard, err)
+		}
+	}
+
+	// 所有分片共用一个PodDisruptionBudget，分片0沿用原有的PodDisruptionBudget
+	var pdbSpec *monitoringv1.PodDisruptionBudgetSpec
+	if shards > 1 {
+		pdbSpec = monitorStack.Spec.Prometheus.PodDisruptionBudget
+	}
+	if err := r.reconcilePodDisruptionBudget(ctx, monitorStack, r.getPrometheusName(monitorStack)+"-shards",
+		prometheusShardComponent, pdbSpec); err != nil {
+		return fmt.Errorf("failed to reconcile PodDisruptionBudget of shards: %w", err)
+	}
+
+	// 删除多出的分片，不再使用的PVC按保留策略处理
+	if err := r.deletePrometheusShards(ctx, monitorStack, shards); err != nil {
+		return err
+	}
+	return r.cleanupPrometheusShardPVCs(ctx, monitorStack, shards, false)
+}
+
+// getPrometheusShardIndex 从分片资源的标签中解析分片序号
+func getPrometheusShardIndex(obj client.Object) (int32, bool) {
+	shard, err := strconv.ParseInt(obj.GetLabels()[prometheusShardLabel], 10, 32)
+	if err != nil {
+		return 0, false
+	}
+	return int32(shard), true
+}
+
+// prometheusShardSelector 选择当前MonitorStack分片0以外的分片资源
+func prometheusShardSelector(monitorStack *monitoringv1.MonitorStack) client.ListOption {
+	return client.MatchingLabels{
+		"app.kubernetes.io/instance":  monitorStack.Name,
+		"app.kubernetes.io/component": prometheusShardComponent,
+	}
+}
+
+// deletePrometheusShards 删除序号不小于from的分片的Deployment、Service和ConfigMap
+// from为1时删除分片0以外的所有分片，用于禁用Prometheus和删除MonitorStack
+func (r *MonitorStackReconciler) deletePrometheusShards(ctx context.Context, monitorStack *monitoringv1.MonitorStack, from int32) error {
+	logger := log.FromContext(ctx)
+	namespace := client.InNamespace(monitorStack.Namespace)
+	selector := prometheusShardSelector(monitorStack)
+
+	var objects []client.Object
+	deployments := &appsv1.DeploymentList{}
+	if err := r.List(ctx, deployments, namespace, selector); err != nil {
+		return err
+	}
+	for i := range deployments.Items {
+		objects = append(objects, &deployments.Items[i])
+	}
+	services := &corev1.ServiceList{}
+	if err := r.List(ctx, services, namespace, selector); err != nil {
+		return err
+	}
+	for i := range services.Items {
+		objects = append(objects, &services.Items[i])
+	}
+	configMaps := &corev1.ConfigMapList{}
+	if err := r.List(ctx, configMaps, namespace, selector); err != nil {
+		return err
+	}
+	for i := range configMaps.Items {
+		objects = append(objects, &configMaps.Items[i])
+	}
+
+	for _, obj := range objects {
+		shard, ok := getPrometheusShardIndex(obj)
+		if !ok || shard < from || !metav1.IsControlledBy(obj, monitorStack) {
+			continue
+		}
+		logger.Info("Deleting Prometheus shard resource", "name", obj.GetName(), "shard", shard)
+		if err := client.IgnoreNotFound(r.Delete(ctx, obj)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cleanupPrometheusShardPVCs 按保留策略处理序号不小于from的分片的PVC
+func (r *MonitorStackReconciler) cleanupPrometheusShardPVCs(ctx context.Context, monitorStack *monitoringv1.MonitorStack, from int32, deleting bool) error {
+	pvcs := &corev1.PersistentVolumeClaimList{}
+	if err := r.List(ctx, pvcs, client.InNamespace(monitorStack.Namespace), prometheusShardSelector(monitorStack)); err != nil {
+		return err
+	}
+	for i := range pvcs.Items {
+		shard, ok := getPrometheusShardIndex(&pvcs.Items[i])
+		if !ok || shard < from {
+			continue
+		}
+		if err := r.applyPrometheusPVCRetentionPolicy(ctx, monitorStack, &pvcs.Items[i], deleting); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updatePrometheusShardStatus 更新各分片的状态，未分片时清空
+func (r *MonitorStackReconciler) updatePrometheusShardStatus(ctx context.Context, monitorStack *monitoringv1.MonitorStack) error {
+	shards := getPrometheusShards(monitorStack)
+	if shards == 1 {
+		monitorStack.Status.PrometheusShards = nil
+		return nil
+	}
+
+	statuses := make([]monitoringv1.ShardStatus, 0, shards)
+	for shard := int32(0); shard < shards; shard++ {
+		status := monitoringv1.ShardStatus{
+			Shard:    shard,
+			Name:     r.getPrometheusShardName(monitorStack, shard),
+			Endpoint: r.getPrometheusShardURL(monitorStack, shard),
+		}
+		deployment := &appsv1.Deployment{}
+		err := r.Get(ctx, types.NamespacedName{Name: status.Name, Namespace: monitorStack.Namespace}, deployment)
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		if err == nil {
+			status.Ready = deployment.Status.ReadyReplicas > 0
+			status.Replicas = deployment.Status.Replicas
+		}
+		statuses = append(statuses, status)
+	}
+	monitorStack.Status.PrometheusShards = statuses
+	return nil
+}
+
+// arePrometheusShardsReady 判断所有分片是否就绪，未分片时只看分片0
+func arePrometheusShardsReady(monitorStack *monitoringv1.MonitorStack) bool {
+	for _, shard := range monitorStack.Status.PrometheusShards {
+		if !shard.Ready {
+			return false
+		}
+	}
+	return monitorStack.Status.PrometheusStatus.Ready
+}
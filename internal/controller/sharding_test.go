@@ -0,0 +1,182 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	monitoringv1 "github.com/ciliverse/monitor-operator/api/v1"
+)
+
+var _ = Describe("Prometheus shard Deployments", func() {
+	r := &MonitorStackReconciler{}
+
+	DescribeTable("deployment strategy",
+		func(size string, agent bool, expected appsv1.DeploymentStrategyType) {
+			monitorStack := newTestMonitorStack()
+			monitorStack.Spec.Prometheus.Storage.Size = size
+			if agent {
+				monitorStack.Spec.Prometheus.Mode = prometheusModeAgent
+			}
+			deployment := r.buildPrometheusShardDeployment(monitorStack, 1)
+			Expect(deployment.Spec.Strategy.Type).To(Equal(expected))
+		},
+		Entry("recreates pods that mount a PVC", "50Gi", false, appsv1.RecreateDeploymentStrategyType),
+		Entry("rolls pods that use emptyDir", "", false, appsv1.DeploymentStrategyType("")),
+		Entry("rolls agent pods", "50Gi", true, appsv1.DeploymentStrategyType("")),
+	)
+
+	It("keeps the restart annotation on every shard", func() {
+		monitorStack := newTestMonitorStack()
+		monitorStack.Spec.Prometheus.Storage.Size = "50Gi"
+		monitorStack.Spec.Prometheus.Shards = &[]int32{3}[0]
+		monitorStack.Status.PrometheusStorage = &monitoringv1.StorageStatus{RestartedAt: "2025-01-01T00:00:00Z"}
+
+		for shard := int32(0); shard < 3; shard++ {
+			deployment := r.buildPrometheusShardDeployment(monitorStack, shard)
+			Expect(deployment.Spec.Template.Annotations).To(HaveKeyWithValue(restartedAtAnnotation, "2025-01-01T00:00:00Z"))
+			Expect(deployment.Spec.Template.Spec.Volumes).To(ContainElement(HaveField("PersistentVolumeClaim.ClaimName",
+				r.getPrometheusShardPVCName(monitorStack, shard))))
+		}
+	})
+})
+
+var _ = Describe("Prometheus sharding", func() {
+	ctx := context.Background()
+	r := &MonitorStackReconciler{}
+
+	newShardedMonitorStack := func(shards int32) *monitoringv1.MonitorStack {
+		monitorStack := newTestMonitorStack()
+		monitorStack.Spec.Prometheus.Shards = &shards
+		monitorStack.Status.TargetNamespaces = []string{monitorStack.Namespace}
+		return monitorStack
+	}
+
+	It("adds the shard external label and hashmod relabeling to every discovery job", func() {
+		monitorStack := newShardedMonitorStack(3)
+
+		config := r.getPrometheusShardConfig(monitorStack, 1)
+		Expect(config).To(ContainSubstring("external_labels:\n    shard: \"1\""))
+		// pods和services两个服务发现任务，自监控任务不分片
+		Expect(strings.Count(config, "action: hashmod")).To(Equal(2))
+		Expect(strings.Count(config, "modulus: 3")).To(Equal(2))
+		Expect(strings.Count(config, `regex: "1"`)).To(Equal(2))
+
+		By("keeping the config unchanged without shards")
+		config = r.getPrometheusConfig(newTestMonitorStack())
+		Expect(config).NotTo(ContainSubstring("external_labels"))
+		Expect(config).NotTo(ContainSubstring("hashmod"))
+	})
+
+	It("lets Kubernetes assign NodePorts to the other shards", func() {
+		monitorStack := newShardedMonitorStack(2)
+		monitorStack.Spec.Prometheus.Service.Type = string(corev1.ServiceTypeNodePort)
+		monitorStack.Spec.Prometheus.Service.NodePort = 30090
+
+		Expect(r.buildPrometheusShardService(monitorStack, 0).Spec.Ports[0].NodePort).To(Equal(int32(30090)))
+		service := r.buildPrometheusShardService(monitorStack, 1)
+		Expect(service.Name).To(Equal("test-prometheus-shard-1"))
+		Expect(service.Spec.Ports[0].NodePort).To(BeZero())
+		Expect(service.Spec.Selector).To(HaveKeyWithValue(prometheusShardLabel, "1"))
+	})
+
+	It("creates and removes shards when rescaling", func() {
+		monitorStack := newShardedMonitorStack(3)
+		reconciler := newFakeReconciler(monitorStack)
+		Expect(reconciler.reconcilePrometheusShards(ctx, monitorStack)).To(Succeed())
+
+		exists := func(obj client.Object, name string) bool {
+			err := reconciler.Get(ctx, types.NamespacedName{Name: name, Namespace: monitorStack.Namespace}, obj)
+			if errors.IsNotFound(err) {
+				return false
+			}
+			Expect(err).NotTo(HaveOccurred())
+			return true
+		}
+		for _, name := range []string{"test-prometheus-shard-1", "test-prometheus-shard-2"} {
+			Expect(exists(&appsv1.Deployment{}, name)).To(BeTrue())
+			Expect(exists(&corev1.Service{}, name)).To(BeTrue())
+			Expect(exists(&corev1.ConfigMap{}, name+"-config")).To(BeTrue())
+		}
+
+		monitorStack.Spec.Prometheus.Shards = &[]int32{2}[0]
+		Expect(reconciler.reconcilePrometheusShards(ctx, monitorStack)).To(Succeed())
+		Expect(exists(&appsv1.Deployment{}, "test-prometheus-shard-1")).To(BeTrue())
+		Expect(exists(&appsv1.Deployment{}, "test-prometheus-shard-2")).To(BeFalse())
+		Expect(exists(&corev1.Service{}, "test-prometheus-shard-2")).To(BeFalse())
+		Expect(exists(&corev1.ConfigMap{}, "test-prometheus-shard-2-config")).To(BeFalse())
+
+		configMap := &corev1.ConfigMap{}
+		Expect(exists(configMap, "test-prometheus-shard-1-config")).To(BeTrue())
+		Expect(configMap.Data["prometheus.yml"]).To(ContainSubstring("modulus: 2"))
+	})
+
+	It("reports every shard in status", func() {
+		monitorStack := newShardedMonitorStack(2)
+		ready := &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-prometheus-shard-1", Namespace: monitorStack.Namespace},
+			Status:     appsv1.DeploymentStatus{Replicas: 1, ReadyReplicas: 1},
+		}
+		reconciler := newFakeReconciler(monitorStack, ready)
+
+		Expect(reconciler.updatePrometheusShardStatus(ctx, monitorStack)).To(Succeed())
+		Expect(monitorStack.Status.PrometheusShards).To(Equal([]monitoringv1.ShardStatus{
+			{Shard: 0, Name: "test-prometheus", Endpoint: "http://test-prometheus.monitoring.svc:9090"},
+			{Shard: 1, Name: "test-prometheus-shard-1", Endpoint: "http://test-prometheus-shard-1.monitoring.svc:9090",
+				Ready: true, Replicas: 1},
+		}))
+
+		monitorStack.Status.PrometheusStatus.Ready = true
+		Expect(arePrometheusShardsReady(monitorStack)).To(BeFalse())
+		monitorStack.Status.PrometheusShards[0].Ready = true
+		Expect(arePrometheusShardsReady(monitorStack)).To(BeTrue())
+	})
+
+	DescribeTable("validatePrometheusShards",
+		func(mutate func(*monitoringv1.MonitorStack), expectedError string) {
+			monitorStack := newShardedMonitorStack(2)
+			mutate(monitorStack)
+			err := r.validatePrometheusShards(monitorStack)
+			if expectedError == "" {
+				Expect(err).NotTo(HaveOccurred())
+			} else {
+				Expect(err).To(MatchError(ContainSubstring(expectedError)))
+			}
+		},
+		Entry("accepts the default config", func(*monitoringv1.MonitorStack) {}, ""),
+		Entry("rejects a custom config", func(m *monitoringv1.MonitorStack) {
+			m.Spec.Prometheus.Config = "scrape_configs: []\n"
+		}, "requires the default Prometheus config"),
+		Entry("rejects backups", func(m *monitoringv1.MonitorStack) {
+			m.Spec.Prometheus.Backup = &monitoringv1.BackupSpec{}
+		}, "backup is not supported"),
+		Entry("ignores a custom config without shards", func(m *monitoringv1.MonitorStack) {
+			m.Spec.Prometheus.Shards = nil
+			m.Spec.Prometheus.Config = "scrape_configs: []\n"
+		}, ""),
+	)
+})
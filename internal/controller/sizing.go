@@ -0,0 +1,399 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	monitoringv1 "github.com/ciliverse/monitor-operator/api/v1"
+	"github.com/ciliverse/monitor-operator/internal/policy"
+)
+
+// 资源建议 - 通过Prometheus HTTP API查询自身的内存和head序列数，计算建议的内存requests和limits
+// 建议值取最近1小时峰值内存和按序列数估算的内存中的较大值，并预留余量
+// 使用自定义配置时不一定有自监控任务，改为直接读取/metrics中的当前值
+// 查询在协调中同步执行，每次请求都有较短的超时时间，并按sizingInterval限制频率
+// 查询失败不影响协调，只更新状态条件
+
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+
+const (
+	// conditionTypePrometheusSizing 资源建议状态条件
+	conditionTypePrometheusSizing = "PrometheusSizingAvailable"
+
+	// sizingInterval 两次查询指标的最小间隔
+	sizingInterval = 5 * time.Minute
+	// sizingQueryTimeout 单次请求Prometheus的超时时间
+	sizingQueryTimeout = 2 * time.Second
+	// sizingBytesPerSeries head中每个序列的大致内存开销
+	sizingBytesPerSeries = 4096
+	// sizingRequestHeadroom requests相对于估算内存的余量
+	sizingRequestHeadroom = 1.3
+	// sizingLimitFactor limits相对于requests的倍数
+	sizingLimitFactor = 1.5
+	// sizingMemoryStep 建议值按64Mi向上取整
+	sizingMemoryStep = 64 * 1024 * 1024
+	// sizingChangeThreshold 建议值与已应用值的相差比例超过该值时才重新应用
+	sizingChangeThreshold = 0.2
+	// defaultSizingWarningThreshold 默认的内存警告阈值（百分比）
+	defaultSizingWarningThreshold = int32(90)
+)
+
+const (
+	// sizingMemoryQuery 最近1小时的峰值常驻内存，%s为getSizingSelector返回的选择器
+	sizingMemoryQuery = `max(max_over_time(process_resident_memory_bytes%s[1h]))`
+	// sizingSeriesQuery 最近1小时的峰值head序列数，%s为getSizingSelector返回的选择器
+	sizingSeriesQuery = `max(max_over_time(prometheus_tsdb_head_series%s[1h]))`
+
+	// /metrics中的常驻内存和head序列数指标，agent模式没有head，使用活跃序列数
+	sizingMemoryMetric      = "process_resident_memory_bytes"
+	sizingSeriesMetric      = "prometheus_tsdb_head_series"
+	sizingAgentSeriesMetric = "prometheus_agent_active_series"
+)
+
+// promQueryResponse Prometheus即时查询API的响应
+type promQueryResponse struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	Data   struct {
+		Result []struct {
+			Value []any `json:"value"`
+		} `json:"result"`
+	} `json:"data"`
+}
+
+// isSizingEnabled 判断是否启用了资源建议
+func isSizingEnabled(monitorStack *monitoringv1.MonitorStack) bool {
+	return monitorStack.Spec.Prometheus.Sizing != nil && monitorStack.Spec.Prometheus.Sizing.Enabled
+}
+
+// hasPrometheusSelfScrape 判断能否查询Prometheus自身的指标，只有默认配置包含自监控任务，agent模式不支持查询
+func hasPrometheusSelfScrape(monitorStack *monitoringv1.MonitorStack) bool {
+	return monitorStack.Spec.Prometheus.Config == "" && !isPrometheusAgentMode(monitorStack)
+}
+
+// getSizingSelector 获取本栈自监控序列的选择器
+// 联邦抓取时保留了目标的job和monitor_stack标签，只按job过滤会把其他MonitorStack的Prometheus也统计进来
+func getSizingSelector(monitorStack *monitoringv1.MonitorStack) string {
+	return fmt.Sprintf(`{job="prometheus",%s="%s"}`, monitorStackLabel, getMonitorStackLabelValue(monitorStack))
+}
+
+// queryPrometheusScalar 执行即时查询并返回第一个结果，没有结果时found为false
+func queryPrometheusScalar(ctx context.Context, client *prometheusHTTPClient, query string) (value float64, found bool, err error) {
+	body, err := client.get(ctx, "/api/v1/query?query="+url.QueryEscape(query), sizingQueryTimeout)
+	var result promQueryResponse
+	if err != nil {
+		// 查询出错时响应中包含错误信息
+		if json.Unmarshal(body, &result) == nil && result.Error != "" {
+			return 0, false, fmt.Errorf("%w: %s", err, result.Error)
+		}
+		return 0, false, err
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return 0, false, fmt.Errorf("failed to decode query response: %w", err)
+	}
+	if result.Status != "success" {
+		return 0, false, fmt.Errorf("query failed: %s", result.Error)
+	}
+	if len(result.Data.Result) == 0 || len(result.Data.Result[0].Value) != 2 {
+		return 0, false, nil
+	}
+
+	// 结果格式为[时间戳, "值"]
+	raw, ok := result.Data.Result[0].Value[1].(string)
+	if !ok {
+		return 0, false, fmt.Errorf("unexpected sample value %v", result.Data.Result[0].Value[1])
+	}
+	value, err = strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return 0, false, err
+	}
+	return value, true, nil
+}
+
+// queryPrometheusUsage 查询selector选中的序列最近1小时的峰值内存和head序列数，没有自监控数据时found为false
+func queryPrometheusUsage(ctx context.Context, client *prometheusHTTPClient, selector string) (memory, series float64, found bool, err error) {
+	memory, found, err = queryPrometheusScalar(ctx, client, fmt.Sprintf(sizingMemoryQuery, selector))
+	if err != nil || !found {
+		return 0, 0, false, err
+	}
+	series, _, err = queryPrometheusScalar(ctx, client, fmt.Sprintf(sizingSeriesQuery, selector))
+	if err != nil {
+		return 0, 0, false, err
+	}
+	return memory, series, true, nil
+}
+
+// scrapePrometheusUsage 从/metrics读取当前的常驻内存和序列数
+func scrapePrometheusUsage(ctx context.Context, client *prometheusHTTPClient) (memory, series float64, err error) {
+	body, err := client.get(ctx, "/metrics", sizingQueryTimeout)
+	if err != nil {
+		return 0, 0, err
+	}
+	memory, found := parseMetricValue(body, sizingMemoryMetric)
+	if !found {
+		return 0, 0, fmt.Errorf("metric %s not found", sizingMemoryMetric)
+	}
+	series, found = parseMetricValue(body, sizingSeriesMetric)
+	if !found {
+		series, _ = parseMetricValue(body, sizingAgentSeriesMetric)
+	}
+	return memory, series, nil
+}
+
+// parseMetricValue 从文本格式的指标中读取没有标签的指标值
+func parseMetricValue(metrics []byte, name string) (float64, bool) {
+	for _, line := range strings.Split(string(metrics), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[0] != name {
+			continue
+		}
+		value, err := strconv.ParseFloat(fields[1], 64)
+		return value, err == nil
+	}
+	return 0, false
+}
+
+// roundUpMemory 把内存向上取整到sizingMemoryStep
+func roundUpMemory(bytes float64) int64 {
+	steps := math.Ceil(bytes / sizingMemoryStep)
+	if steps < 1 {
+		steps = 1
+	}
+	return int64(steps) * sizingMemoryStep
+}
+
+// formatMemory 把内存字节数格式化为Kubernetes资源数量
+func formatMemory(bytes int64) string {
+	return resource.NewQuantity(bytes, resource.BinarySI).String()
+}
+
+// parseMemory 解析内存数量，为空或无效时返回0
+func parseMemory(value string) int64 {
+	if value == "" {
+		return 0
+	}
+	quantity, err := resource.ParseQuantity(value)
+	if err != nil {
+		return 0
+	}
+	return quantity.Value()
+}
+
+// getPrometheusResources 获取Prometheus实际使用的资源配置，自动应用时用建议值覆盖内存
+func (r *MonitorStackReconciler) getPrometheusResources(monitorStack *monitoringv1.MonitorStack) monitoringv1.ResourceRequirements {
+	resources := monitorStack.Spec.Prometheus.Resources
+	status := monitorStack.Status.PrometheusSizing
+	if !isSizingEnabled(monitorStack) || !monitorStack.Spec.Prometheus.Sizing.AutoApply || status == nil {
+		return resources
+	}
+	if status.AppliedRequests != nil && status.AppliedRequests.Memory != "" {
+		resources.Requests.Memory = status.AppliedRequests.Memory
+	}
+	if status.AppliedLimits != nil && status.AppliedLimits.Memory != "" {
+		resources.Limits.Memory = status.AppliedLimits.Memory
+	}
+	return resources
+}
+
+// clampMemory 把内存限制在自动应用的上下限之间
+func clampMemory(bytes int64, sizing *monitoringv1.SizingSpec) int64 {
+	if minMemory := parseMemory(sizing.MinMemory); minMemory > 0 && bytes < minMemory {
+		bytes = minMemory
+	}
+	if maxMemory := parseMemory(sizing.MaxMemory); maxMemory > 0 && bytes > maxMemory {
+		bytes = maxMemory
+	}
+	return bytes
+}
+
+// getPolicyMaxMemory 获取生效策略中最小的内存上限，没有上限时返回0
+// 自动应用的值不经过准入检查，需要在应用前限制在租户策略之内
+func (r *MonitorStackReconciler) getPolicyMaxMemory(ctx context.Context, monitorStack *monitoringv1.MonitorStack) (int64, error) {
+	policies, err := policy.MatchingPolicies(ctx, r.Client, monitorStack.Namespace)
+	if err != nil {
+		return 0, err
+	}
+	var maxMemory int64
+	for _, p := range policies {
+		if memory := parseMemory(p.Spec.MaxResources.Memory); memory > 0 && (maxMemory == 0 || memory < maxMemory) {
+			maxMemory = memory
+		}
+	}
+	return maxMemory, nil
+}
+
+// shouldApplySizing 判断建议值与已应用值相差是否足够大
+func shouldApplySizing(applied *monitoringv1.ResourceList, recommended int64) bool {
+	if applied == nil {
+		return true
+	}
+	current := parseMemory(applied.Memory)
+	if current == 0 {
+		return true
+	}
+	return math.Abs(float64(recommended-current))/float64(current) > sizingChangeThreshold
+}
+
+// updatePrometheusSizing 查询Prometheus的资源使用情况，更新资源建议和自动应用的值
+func (r *MonitorStackReconciler) updatePrometheusSizing(ctx context.Context, monitorStack *monitoringv1.MonitorStack) {
+	logger := log.FromContext(ctx)
+
+	if !isSizingEnabled(monitorStack) {
+		monitorStack.Status.PrometheusSizing = nil
+		meta.RemoveStatusCondition(&monitorStack.Status.Conditions, conditionTypePrometheusSizing)
+		return
+	}
+	sizing := monitorStack.Spec.Prometheus.Sizing
+
+	status := monitorStack.Status.PrometheusSizing
+	if status == nil {
+		status = &monitoringv1.SizingStatus{}
+		monitorStack.Status.PrometheusSizing = status
+	}
+	if !sizing.AutoApply {
+		status.AppliedRequests = nil
+		status.AppliedLimits = nil
+	}
+
+	// Prometheus就绪后才能查询，并限制查询频率
+	if !monitorStack.Status.PrometheusStatus.Ready {
+		return
+	}
+	if status.LastObservedTime != nil && time.Since(status.LastObservedTime.Time) < sizingInterval {
+		return
+	}
+	now := metav1.Now()
+	status.LastObservedTime = &now
+
+	client, err := r.newPrometheusHTTPClient(ctx, monitorStack, r.getPrometheusURL(monitorStack))
+	if err != nil {
+		logger.Error(err, "Failed to create Prometheus client for sizing")
+		r.setCondition(monitorStack, conditionTypePrometheusSizing, metav1.ConditionFalse, "QueryFailed",
+			fmt.Sprintf("failed to create Prometheus client: %v", err))
+		return
+	}
+
+	// 逐个查询分片，取估算内存最大的分片，各分片使用相同的web配置
+	usage := "peak"
+	if !hasPrometheusSelfScrape(monitorStack) {
+		// 没有自监控数据或agent模式，只能使用当前值
+		usage = "current"
+	}
+	selector := getSizingSelector(monitorStack)
+	var memory, series, estimated float64
+	for shard := int32(0); shard < getPrometheusShards(monitorStack); shard++ {
+		client.baseURL = r.getPrometheusShardURL(monitorStack, shard)
+		var shardMemory, shardSeries float64
+		if hasPrometheusSelfScrape(monitorStack) {
+			var found bool
+			shardMemory, shardSeries, found, err = queryPrometheusUsage(ctx, client, selector)
+			if err == nil && !found {
+				r.setCondition(monitorStack, conditionTypePrometheusSizing, metav1.ConditionFalse, "NoData",
+					fmt.Sprintf("no samples for %s in shard %d, the self-scrape job is required for sizing", selector, shard))
+				return
+			}
+		} else {
+			shardMemory, shardSeries, err = scrapePrometheusUsage(ctx, client)
+		}
+		if err != nil {
+			logger.Error(err, "Failed to query Prometheus resource usage", "shard", shard)
+			r.setCondition(monitorStack, conditionTypePrometheusSizing, metav1.ConditionFalse, "QueryFailed",
+				fmt.Sprintf("failed to query Prometheus shard %d: %v", shard, err))
+			return
+		}
+		if shardEstimated := math.Max(shardMemory, shardSeries*sizingBytesPerSeries); shardEstimated >= estimated {
+			memory, series, estimated = shardMemory, shardSeries, shardEstimated
+		}
+	}
+
+	// 计算建议值
+	request := roundUpMemory(estimated * sizingRequestHeadroom)
+	limit := roundUpMemory(float64(request) * sizingLimitFactor)
+
+	status.MemoryUsage = formatMemory(roundUpMemory(memory))
+	status.HeadSeries = int64(series)
+	status.RecommendedRequests = monitoringv1.ResourceList{Memory: formatMemory(request)}
+	status.RecommendedLimits = monitoringv1.ResourceList{Memory: formatMemory(limit)}
+
+	// 在上下限和租户策略内自动应用
+	if sizing.AutoApply {
+		maxMemory, err := r.getPolicyMaxMemory(ctx, monitorStack)
+		if err != nil {
+			logger.Error(err, "Failed to get MonitorStackPolicy for sizing")
+			r.setCondition(monitorStack, conditionTypePrometheusSizing, metav1.ConditionFalse, "PolicyCheckFailed",
+				fmt.Sprintf("failed to get MonitorStackPolicy: %v", err))
+			return
+		}
+		appliedLimit := clampMemory(limit, sizing)
+		if maxMemory > 0 && appliedLimit > maxMemory {
+			appliedLimit = maxMemory
+		}
+		appliedRequest := min(clampMemory(request, sizing), appliedLimit)
+		// 已应用的值超过策略上限时立即收紧
+		overPolicy := maxMemory > 0 && status.AppliedLimits != nil && parseMemory(status.AppliedLimits.Memory) > maxMemory
+		if overPolicy || shouldApplySizing(status.AppliedRequests, appliedRequest) || shouldApplySizing(status.AppliedLimits, appliedLimit) {
+			logger.Info("Applying Prometheus sizing recommendation",
+				"requests", formatMemory(appliedRequest), "limits", formatMemory(appliedLimit))
+			status.AppliedRequests = &monitoringv1.ResourceList{Memory: formatMemory(appliedRequest)}
+			status.AppliedLimits = &monitoringv1.ResourceList{Memory: formatMemory(appliedLimit)}
+		}
+	}
+
+	r.setCondition(monitorStack, conditionTypePrometheusSizing, metav1.ConditionTrue, "Recommended",
+		fmt.Sprintf("%s memory %s with %d head series, recommended requests %s and limits %s",
+			usage, status.MemoryUsage, status.HeadSeries, status.RecommendedRequests.Memory, status.RecommendedLimits.Memory))
+
+	// 内存接近limits时发出警告事件
+	r.warnPrometheusMemoryUsage(monitorStack, memory)
+}
+
+// warnPrometheusMemoryUsage 内存使用量接近当前limits时发出警告事件
+func (r *MonitorStackReconciler) warnPrometheusMemoryUsage(monitorStack *monitoringv1.MonitorStack, memory float64) {
+	if r.Recorder == nil {
+		return
+	}
+	limit := parseMemory(r.getPrometheusResources(monitorStack).Limits.Memory)
+	if limit == 0 {
+		return
+	}
+
+	threshold := defaultSizingWarningThreshold
+	if monitorStack.Spec.Prometheus.Sizing.WarningThresholdPercent != nil {
+		threshold = *monitorStack.Spec.Prometheus.Sizing.WarningThresholdPercent
+	}
+	percent := memory / float64(limit) * 100
+	if percent >= float64(threshold) {
+		r.Recorder.Eventf(monitorStack, corev1.EventTypeWarning, "PrometheusMemoryNearLimit",
+			"Prometheus memory %s is %.0f%% of the %s limit, recommended limit is %s",
+			monitorStack.Status.PrometheusSizing.MemoryUsage, percent, formatMemory(limit),
+			monitorStack.Status.PrometheusSizing.RecommendedLimits.Memory)
+	}
+}
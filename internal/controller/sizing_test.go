@@ -0,0 +1,271 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	monitoringv1 "github.com/ciliverse/monitor-operator/api/v1"
+)
+
+var _ = Describe("Prometheus sizing", func() {
+	ctx := context.Background()
+	r := &MonitorStackReconciler{}
+
+	// newClient 构建访问测试服务器的客户端，未配置web时不需要读取Secret
+	newClient := func(server *httptest.Server) *prometheusHTTPClient {
+		client, err := r.newPrometheusHTTPClient(ctx, newTestMonitorStack(), server.URL)
+		Expect(err).NotTo(HaveOccurred())
+		return client
+	}
+
+	Context("queryPrometheusUsage", func() {
+		selector := getSizingSelector(newTestMonitorStack())
+		memoryQuery := fmt.Sprintf(sizingMemoryQuery, selector)
+		seriesQuery := fmt.Sprintf(sizingSeriesQuery, selector)
+
+		serve := func(results map[string]string) *httptest.Server {
+			return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				Expect(req.URL.Path).To(Equal("/api/v1/query"))
+				query := req.URL.Query().Get("query")
+				Expect(query).To(ContainSubstring(`{job="prometheus",monitor_stack="monitoring/test"}`))
+				body, ok := results[query]
+				Expect(ok).To(BeTrue(), "unexpected query %s", query)
+				if strings.Contains(body, `"error"`) {
+					w.WriteHeader(http.StatusBadRequest)
+				}
+				fmt.Fprint(w, body)
+			}))
+		}
+
+		It("returns the peak memory and head series of the stack's own Prometheus", func() {
+			server := serve(map[string]string{
+				memoryQuery: `{"status":"success","data":{"result":[{"value":[1700000000,"536870912"]}]}}`,
+				seriesQuery: `{"status":"success","data":{"result":[{"value":[1700000000,"100000"]}]}}`,
+			})
+			defer server.Close()
+
+			memory, series, found, err := queryPrometheusUsage(ctx, newClient(server), selector)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(found).To(BeTrue())
+			Expect(memory).To(Equal(float64(536870912)))
+			Expect(series).To(Equal(float64(100000)))
+		})
+
+		It("reports missing samples", func() {
+			server := serve(map[string]string{
+				memoryQuery: `{"status":"success","data":{"result":[]}}`,
+			})
+			defer server.Close()
+
+			_, _, found, err := queryPrometheusUsage(ctx, newClient(server), selector)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(found).To(BeFalse())
+		})
+
+		It("returns the status and the error of failed queries", func() {
+			server := serve(map[string]string{
+				memoryQuery: `{"status":"error","error":"parse error"}`,
+			})
+			defer server.Close()
+
+			_, _, _, err := queryPrometheusUsage(ctx, newClient(server), selector)
+			Expect(err).To(MatchError(ContainSubstring("400 Bad Request")))
+			Expect(err).To(MatchError(ContainSubstring("parse error")))
+		})
+	})
+
+	It("returns an error instead of decoding a non-200 response", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprint(w, "Service Unavailable")
+		}))
+		defer server.Close()
+
+		_, _, _, err := queryPrometheusUsage(ctx, newClient(server), getSizingSelector(newTestMonitorStack()))
+		Expect(err).To(MatchError(ContainSubstring("503 Service Unavailable")))
+	})
+
+	It("labels the self-scrape job with the stack and queries every shard", func() {
+		monitorStack := newTestMonitorStack()
+		Expect(r.getPrometheusConfig(monitorStack)).To(ContainSubstring("monitor_stack: 'monitoring/test'"))
+		Expect(getSizingSelector(monitorStack)).To(Equal(`{job="prometheus",monitor_stack="monitoring/test"}`))
+
+		monitorStack.Spec.Prometheus.Shards = &[]int32{2}[0]
+		Expect(r.getPrometheusShardConfig(monitorStack, 1)).To(ContainSubstring("monitor_stack: 'monitoring/test'"))
+		Expect(r.getPrometheusShardURL(monitorStack, 0)).To(Equal("http://test-prometheus.monitoring.svc:9090"))
+		Expect(r.getPrometheusShardURL(monitorStack, 1)).To(Equal("http://test-prometheus-shard-1.monitoring.svc:9090"))
+
+		monitorStack.Spec.Prometheus.Web = &monitoringv1.PrometheusWebSpec{
+			TLS: &monitoringv1.PrometheusWebTLSSpec{SecretName: "prometheus-tls"},
+		}
+		Expect(r.getPrometheusShardURL(monitorStack, 1)).To(Equal("https://test-prometheus-shard-1.monitoring.svc:9090"))
+	})
+
+	It("reads the current usage from /metrics without the self-scrape job", func() {
+		monitorStack := newTestMonitorStack()
+		Expect(hasPrometheusSelfScrape(monitorStack)).To(BeTrue())
+		monitorStack.Spec.Prometheus.Config = "scrape_configs: []\n"
+		Expect(hasPrometheusSelfScrape(monitorStack)).To(BeFalse())
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			Expect(req.URL.Path).To(Equal("/metrics"))
+			fmt.Fprint(w, "# TYPE process_resident_memory_bytes gauge\n"+
+				"process_resident_memory_bytes 5.36870912e+08\n"+
+				"prometheus_tsdb_head_series_created_total 12\n"+
+				"prometheus_tsdb_head_series 100000\n")
+		}))
+		defer server.Close()
+
+		memory, series, err := scrapePrometheusUsage(ctx, newClient(server))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(memory).To(Equal(float64(536870912)))
+		Expect(series).To(Equal(float64(100000)))
+	})
+
+	It("reads the active series from /metrics in agent mode", func() {
+		monitorStack := newTestMonitorStack()
+		monitorStack.Spec.Prometheus.Mode = prometheusModeAgent
+		Expect(hasPrometheusSelfScrape(monitorStack)).To(BeFalse())
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			fmt.Fprint(w, "process_resident_memory_bytes 2.68435456e+08\n"+
+				"prometheus_agent_active_series 5000\n")
+		}))
+		defer server.Close()
+
+		memory, series, err := scrapePrometheusUsage(ctx, newClient(server))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(memory).To(Equal(float64(268435456)))
+		Expect(series).To(Equal(float64(5000)))
+	})
+
+	It("queries Prometheus with the web scheme, CA and credentials", func() {
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			username, password, ok := req.BasicAuth()
+			if !ok || username != "admin" || password != "s3cret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprint(w, "process_resident_memory_bytes 1024\n")
+		}))
+		defer server.Close()
+		ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+
+		monitorStack := newTestMonitorStack()
+		caRef := secretKey("prometheus-tls", "ca.crt")
+		monitorStack.Spec.Prometheus.Web = &monitoringv1.PrometheusWebSpec{
+			TLS:       &monitoringv1.PrometheusWebTLSSpec{SecretName: "prometheus-tls", CA: &caRef},
+			BasicAuth: &monitoringv1.PrometheusWebBasicAuthSpec{Username: "admin", Password: secretKey("prometheus-auth", "password")},
+		}
+		reconciler := newFakeReconciler(&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-prometheus-web-config", Namespace: "monitoring"},
+			Data:       map[string][]byte{prometheusWebPasswordKey: []byte("s3cret"), prometheusWebCAKey: ca},
+		})
+
+		client, err := reconciler.newPrometheusHTTPClient(ctx, monitorStack, server.URL)
+		Expect(err).NotTo(HaveOccurred())
+		memory, _, err := scrapePrometheusUsage(ctx, client)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(memory).To(Equal(float64(1024)))
+	})
+
+	DescribeTable("roundUpMemory",
+		func(bytes float64, expected string) {
+			Expect(formatMemory(roundUpMemory(bytes))).To(Equal(expected))
+		},
+		Entry("rounds up to 64Mi", float64(100*1024*1024), "128Mi"),
+		Entry("keeps exact steps", float64(1024*1024*1024), "1Gi"),
+		Entry("never returns zero", float64(0), "64Mi"),
+	)
+
+	DescribeTable("clampMemory",
+		func(value string, expected string) {
+			sizing := &monitoringv1.SizingSpec{MinMemory: "256Mi", MaxMemory: "2Gi"}
+			Expect(formatMemory(clampMemory(parseMemory(value), sizing))).To(Equal(expected))
+		},
+		Entry("raises to the minimum", "128Mi", "256Mi"),
+		Entry("keeps values within bounds", "1Gi", "1Gi"),
+		Entry("lowers to the maximum", "4Gi", "2Gi"),
+	)
+
+	DescribeTable("shouldApplySizing",
+		func(applied *monitoringv1.ResourceList, recommended string, expected bool) {
+			Expect(shouldApplySizing(applied, parseMemory(recommended))).To(Equal(expected))
+		},
+		Entry("applies when nothing was applied", nil, "1Gi", true),
+		Entry("ignores small changes", &monitoringv1.ResourceList{Memory: "1Gi"}, "1088Mi", false),
+		Entry("applies large changes", &monitoringv1.ResourceList{Memory: "1Gi"}, "2Gi", true),
+	)
+
+	It("overrides the memory resources with the applied values", func() {
+		monitorStack := newTestMonitorStack()
+		monitorStack.Spec.Prometheus.Resources.Limits.Memory = "1Gi"
+		monitorStack.Status.PrometheusSizing = &monitoringv1.SizingStatus{
+			AppliedRequests: &monitoringv1.ResourceList{Memory: "1536Mi"},
+			AppliedLimits:   &monitoringv1.ResourceList{Memory: "2Gi"},
+		}
+
+		By("ignoring applied values without autoApply")
+		monitorStack.Spec.Prometheus.Sizing = &monitoringv1.SizingSpec{Enabled: true}
+		Expect(r.getPrometheusResources(monitorStack).Limits.Memory).To(Equal("1Gi"))
+
+		By("using applied values with autoApply")
+		monitorStack.Spec.Prometheus.Sizing.AutoApply = true
+		resources := r.getPrometheusResources(monitorStack)
+		Expect(resources.Requests.Memory).To(Equal("1536Mi"))
+		Expect(resources.Limits.Memory).To(Equal("2Gi"))
+		Expect(resources.Requests.CPU).To(Equal(monitorStack.Spec.Prometheus.Resources.Requests.CPU))
+	})
+
+	It("caps auto-applied memory at the strictest MonitorStackPolicy", func() {
+		monitorStack := newTestMonitorStack()
+		namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: monitorStack.Namespace}}
+		reconciler := newFakeReconciler(namespace,
+			&monitoringv1.MonitorStackPolicy{
+				ObjectMeta: metav1.ObjectMeta{Name: "loose"},
+				Spec:       monitoringv1.MonitorStackPolicySpec{MaxResources: monitoringv1.ResourceList{Memory: "8Gi"}},
+			},
+			&monitoringv1.MonitorStackPolicy{
+				ObjectMeta: metav1.ObjectMeta{Name: "strict"},
+				Spec:       monitoringv1.MonitorStackPolicySpec{MaxResources: monitoringv1.ResourceList{Memory: "2Gi"}},
+			},
+			&monitoringv1.MonitorStackPolicy{
+				ObjectMeta: metav1.ObjectMeta{Name: "cpu-only"},
+				Spec:       monitoringv1.MonitorStackPolicySpec{MaxResources: monitoringv1.ResourceList{CPU: "2"}},
+			},
+		)
+
+		maxMemory, err := reconciler.getPolicyMaxMemory(ctx, monitorStack)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(formatMemory(maxMemory)).To(Equal("2Gi"))
+
+		maxMemory, err = newFakeReconciler(namespace).getPolicyMaxMemory(ctx, monitorStack)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(maxMemory).To(BeZero())
+	})
+})
@@ -0,0 +1,192 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	monitoringv1 "github.com/ciliverse/monitor-operator/api/v1"
+)
+
+// 监控栈模板 - MonitorStack通过spec.className引用MonitorStackClass，未设置的字段从类中继承
+// 合并只在协调时于内存中进行，不写回MonitorStack的spec，类修改后所有引用它的MonitorStack重新协调
+
+//+kubebuilder:rbac:groups=monitoring.cillian.website,resources=monitorstackclasses,verbs=get;list;watch
+
+const (
+	// conditionTypeClassResolved MonitorStackClass解析状态条件
+	conditionTypeClassResolved = "ClassResolved"
+	// classNameIndexField 按className查找MonitorStack的索引字段
+	classNameIndexField = ".spec.className"
+)
+
+// applyMonitorStackClass 把引用的MonitorStackClass合并到MonitorStack的spec中
+func (r *MonitorStackReconciler) applyMonitorStackClass(ctx context.Context, monitorStack *monitoringv1.MonitorStack) error {
+	className := monitorStack.Spec.ClassName
+	if className == "" {
+		monitorStack.Status.ObservedClassGeneration = 0
+		meta.RemoveStatusCondition(&monitorStack.Status.Conditions, conditionTypeClassResolved)
+		return nil
+	}
+
+	class := &monitoringv1.MonitorStackClass{}
+	if err := r.Get(ctx, types.NamespacedName{Name: className}, class); err != nil {
+		if errors.IsNotFound(err) {
+			r.setCondition(monitorStack, conditionTypeClassResolved, metav1.ConditionFalse, "ClassNotFound",
+				fmt.Sprintf("MonitorStackClass %s not found", className))
+			return fmt.Errorf("MonitorStackClass %s not found", className)
+		}
+		return err
+	}
+
+	ownStorageClass := monitorStack.Spec.Prometheus.Storage.StorageClass
+	mergeMonitorStackClass(&monitorStack.Spec, &class.Spec)
+
+	// PVC的StorageClass创建后不可修改，继承的storageClass只用于新建的PVC，已有PVC保持原来的StorageClass
+	if ownStorageClass == "" && monitorStack.Spec.Prometheus.Storage.StorageClass != "" {
+		pvc := &corev1.PersistentVolumeClaim{}
+		err := r.Get(ctx, types.NamespacedName{Name: r.getPrometheusPVCName(monitorStack), Namespace: monitorStack.Namespace}, pvc)
+		if err == nil {
+			monitorStack.Spec.Prometheus.Storage.StorageClass = ""
+			if pvc.Spec.StorageClassName != nil {
+				monitorStack.Spec.Prometheus.Storage.StorageClass = *pvc.Spec.StorageClassName
+			}
+		} else if !errors.IsNotFound(err) {
+			return err
+		}
+	}
+
+	monitorStack.Status.ObservedClassGeneration = class.Generation
+	r.setCondition(monitorStack, conditionTypeClassResolved, metav1.ConditionTrue, "ClassApplied",
+		fmt.Sprintf("inherited defaults from MonitorStackClass %s (generation %d)", className, class.Generation))
+	return nil
+}
+
+// mergeMonitorStackClass 用类中的配置填充MonitorStack中未设置的字段
+func mergeMonitorStackClass(spec *monitoringv1.MonitorStackSpec, class *monitoringv1.MonitorStackClassSpec) {
+	prometheus := &spec.Prometheus
+	mergeString(&prometheus.Image, class.Prometheus.Image)
+	mergeString(&prometheus.Tag, class.Prometheus.Tag)
+	mergeResources(&prometheus.Resources, class.Prometheus.Resources)
+	mergeString(&prometheus.Storage.StorageClass, class.Prometheus.StorageClass)
+	mergeString(&prometheus.Retention, class.Prometheus.Retention)
+
+	grafana := &spec.Grafana
+	mergeString(&grafana.Image, class.Grafana.Image)
+	mergeString(&grafana.Tag, class.Grafana.Tag)
+	mergeResources(&grafana.Resources, class.Grafana.Resources)
+	grafana.Datasources = mergeDatasources(class.Grafana.Datasources, grafana.Datasources)
+	grafana.Dashboards = mergeDashboards(class.Grafana.Dashboards, grafana.Dashboards)
+
+	if len(class.Labels) > 0 {
+		labels := make(map[string]string, len(class.Labels)+len(spec.Labels))
+		for k, v := range class.Labels {
+			labels[k] = v
+		}
+		for k, v := range spec.Labels {
+			labels[k] = v
+		}
+		spec.Labels = labels
+	}
+}
+
+// mergeString 字段未设置时使用类中的值
+func mergeString(value *string, classValue string) {
+	if *value == "" {
+		*value = classValue
+	}
+}
+
+// mergeResources 按CPU和内存分别合并资源配置
+func mergeResources(resources *monitoringv1.ResourceRequirements, class monitoringv1.ResourceRequirements) {
+	mergeString(&resources.Requests.CPU, class.Requests.CPU)
+	mergeString(&resources.Requests.Memory, class.Requests.Memory)
+	mergeString(&resources.Limits.CPU, class.Limits.CPU)
+	mergeString(&resources.Limits.Memory, class.Limits.Memory)
+}
+
+// mergeDatasources 合并数据源，MonitorStack中同名的数据源覆盖类中的数据源
+func mergeDatasources(class, own []monitoringv1.DatasourceSpec) []monitoringv1.DatasourceSpec {
+	if len(class) == 0 {
+		return own
+	}
+	names := make(map[string]bool, len(own))
+	for _, ds := range own {
+		names[ds.Name] = true
+	}
+	merged := make([]monitoringv1.DatasourceSpec, 0, len(class)+len(own))
+	for _, ds := range class {
+		if !names[ds.Name] {
+			merged = append(merged, *ds.DeepCopy())
+		}
+	}
+	return append(merged, own...)
+}
+
+// mergeDashboards 合并仪表板，MonitorStack中同名的仪表板覆盖类中的仪表板
+func mergeDashboards(class, own []monitoringv1.DashboardSpec) []monitoringv1.DashboardSpec {
+	if len(class) == 0 {
+		return own
+	}
+	names := make(map[string]bool, len(own))
+	for _, dashboard := range own {
+		names[dashboard.Name] = true
+	}
+	merged := make([]monitoringv1.DashboardSpec, 0, len(class)+len(own))
+	for _, dashboard := range class {
+		if !names[dashboard.Name] {
+			merged = append(merged, dashboard)
+		}
+	}
+	return append(merged, own...)
+}
+
+// findMonitorStacksForClass 类修改后找出所有引用它的MonitorStack
+func (r *MonitorStackReconciler) findMonitorStacksForClass(ctx context.Context, obj client.Object) []reconcile.Request {
+	monitorStacks := &monitoringv1.MonitorStackList{}
+	if err := r.List(ctx, monitorStacks, client.MatchingFields{classNameIndexField: obj.GetName()}); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list MonitorStacks for class", "class", obj.GetName())
+		return nil
+	}
+
+	requests := make([]reconcile.Request, 0, len(monitorStacks.Items))
+	for _, monitorStack := range monitorStacks.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Name: monitorStack.Name, Namespace: monitorStack.Namespace},
+		})
+	}
+	return requests
+}
+
+// indexMonitorStackClassName 为MonitorStack建立className索引
+func indexMonitorStackClassName(obj client.Object) []string {
+	monitorStack := obj.(*monitoringv1.MonitorStack)
+	if monitorStack.Spec.ClassName == "" {
+		return nil
+	}
+	return []string{monitorStack.Spec.ClassName}
+}
@@ -0,0 +1,132 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	monitoringv1 "github.com/ciliverse/monitor-operator/api/v1"
+)
+
+var _ = Describe("MonitorStackClass", func() {
+	class := func() *monitoringv1.MonitorStackClassSpec {
+		return &monitoringv1.MonitorStackClassSpec{
+			Prometheus: monitoringv1.PrometheusClassSpec{
+				Image:        "mirror/prometheus",
+				Tag:          "v2.45.0",
+				StorageClass: "standard",
+				Retention:    "30d",
+				Resources: monitoringv1.ResourceRequirements{
+					Requests: monitoringv1.ResourceList{CPU: "500m", Memory: "2Gi"},
+					Limits:   monitoringv1.ResourceList{CPU: "1", Memory: "4Gi"},
+				},
+			},
+			Grafana: monitoringv1.GrafanaClassSpec{
+				Datasources: []monitoringv1.DatasourceSpec{
+					{Name: "central", Type: "prometheus", URL: "http://thanos:9090"},
+					{Name: "loki", Type: "loki", URL: "http://loki:3100"},
+				},
+			},
+			Labels: map[string]string{"team": "platform", "tier": "shared"},
+		}
+	}
+
+	DescribeTable("mergeMonitorStackClass precedence",
+		func(spec monitoringv1.MonitorStackSpec, check func(monitoringv1.MonitorStackSpec)) {
+			mergeMonitorStackClass(&spec, class())
+			check(spec)
+		},
+		Entry("inherits unset fields", monitoringv1.MonitorStackSpec{}, func(spec monitoringv1.MonitorStackSpec) {
+			Expect(spec.Prometheus.Image).To(Equal("mirror/prometheus"))
+			Expect(spec.Prometheus.Storage.StorageClass).To(Equal("standard"))
+			Expect(spec.Prometheus.Retention).To(Equal("30d"))
+			Expect(spec.Prometheus.Resources.Limits.Memory).To(Equal("4Gi"))
+		}),
+		Entry("keeps fields set on the stack", monitoringv1.MonitorStackSpec{
+			Prometheus: monitoringv1.PrometheusSpec{
+				Tag:       "v2.46.0",
+				Retention: "7d",
+				Storage:   monitoringv1.StorageSpec{StorageClass: "fast"},
+			},
+		}, func(spec monitoringv1.MonitorStackSpec) {
+			Expect(spec.Prometheus.Tag).To(Equal("v2.46.0"))
+			Expect(spec.Prometheus.Retention).To(Equal("7d"))
+			Expect(spec.Prometheus.Storage.StorageClass).To(Equal("fast"))
+		}),
+		Entry("merges CPU and memory separately", monitoringv1.MonitorStackSpec{
+			Prometheus: monitoringv1.PrometheusSpec{
+				Resources: monitoringv1.ResourceRequirements{Limits: monitoringv1.ResourceList{Memory: "8Gi"}},
+			},
+		}, func(spec monitoringv1.MonitorStackSpec) {
+			Expect(spec.Prometheus.Resources.Limits).To(Equal(monitoringv1.ResourceList{CPU: "1", Memory: "8Gi"}))
+			Expect(spec.Prometheus.Resources.Requests).To(Equal(monitoringv1.ResourceList{CPU: "500m", Memory: "2Gi"}))
+		}),
+		Entry("lets stack datasources override class datasources by name", monitoringv1.MonitorStackSpec{
+			Grafana: monitoringv1.GrafanaSpec{Datasources: []monitoringv1.DatasourceSpec{
+				{Name: "central", Type: "prometheus", URL: "http://central:9090"},
+			}},
+		}, func(spec monitoringv1.MonitorStackSpec) {
+			Expect(spec.Grafana.Datasources).To(HaveLen(2))
+			Expect(spec.Grafana.Datasources[0].Name).To(Equal("loki"))
+			Expect(spec.Grafana.Datasources[1].URL).To(Equal("http://central:9090"))
+		}),
+		Entry("lets stack labels override class labels", monitoringv1.MonitorStackSpec{
+			Labels: map[string]string{"team": "payments"},
+		}, func(spec monitoringv1.MonitorStackSpec) {
+			Expect(spec.Labels).To(Equal(map[string]string{"team": "payments", "tier": "shared"}))
+		}),
+	)
+
+	Describe("applyMonitorStackClass", func() {
+		ctx := context.Background()
+		stackClass := func() *monitoringv1.MonitorStackClass {
+			return &monitoringv1.MonitorStackClass{
+				ObjectMeta: metav1.ObjectMeta{Name: "shared"},
+				Spec:       *class(),
+			}
+		}
+
+		It("applies the inherited storage class to new PVCs", func() {
+			monitorStack := newTestMonitorStack()
+			monitorStack.Spec.ClassName = "shared"
+			Expect(newFakeReconciler(stackClass()).applyMonitorStackClass(ctx, monitorStack)).To(Succeed())
+			Expect(monitorStack.Spec.Prometheus.Storage.StorageClass).To(Equal("standard"))
+		})
+
+		It("keeps the storage class of an existing PVC", func() {
+			monitorStack := newTestMonitorStack()
+			monitorStack.Spec.ClassName = "shared"
+			pvc := &corev1.PersistentVolumeClaim{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-prometheus-data", Namespace: monitorStack.Namespace},
+				Spec:       corev1.PersistentVolumeClaimSpec{StorageClassName: &[]string{"legacy"}[0]},
+			}
+			Expect(newFakeReconciler(stackClass(), pvc).applyMonitorStackClass(ctx, monitorStack)).To(Succeed())
+			Expect(monitorStack.Spec.Prometheus.Storage.StorageClass).To(Equal("legacy"))
+		})
+
+		It("reports a missing class", func() {
+			monitorStack := newTestMonitorStack()
+			monitorStack.Spec.ClassName = "missing"
+			Expect(newFakeReconciler().applyMonitorStackClass(ctx, monitorStack)).To(MatchError(ContainSubstring("not found")))
+		})
+	})
+})
@@ -0,0 +1,296 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	monitoringv1 "github.com/ciliverse/monitor-operator/api/v1"
+)
+
+// PVC扩容 - 存储大小增加时原地扩容Prometheus的PVC
+// 参考: https://kubernetes.io/docs/concepts/storage/persistent-volumes/#expanding-persistent-volumes-claims
+
+const (
+	// conditionTypePrometheusStorage Prometheus存储状态条件
+	conditionTypePrometheusStorage = "PrometheusStorageReady"
+	// restartedAtAnnotation Pod模板上的重启注解，修改后触发滚动更新
+	restartedAtAnnotation = "monitoring.cillian.website/restartedAt"
+)
+
+// isFileSystemResizePending 判断PVC是否在等待文件系统扩容
+// 不支持在线扩容的存储驱动需要重新挂载卷（即重启Pod）才能完成扩容
+func isFileSystemResizePending(pvc *corev1.PersistentVolumeClaim) (bool, metav1.Time) {
+	for _, condition := range pvc.Status.Conditions {
+		if condition.Type == corev1.PersistentVolumeClaimFileSystemResizePending && condition.Status == corev1.ConditionTrue {
+			return true, condition.LastTransitionTime
+		}
+	}
+	return false, metav1.Time{}
+}
+
+// reconcilePrometheusPVCSize 协调已存在的Prometheus PVC的大小
+// 只支持扩容：缩容和更换StorageClass无法原地完成，通过状态条件提示用户，不中断其他资源的协调
+func (r *MonitorStackReconciler) reconcilePrometheusPVCSize(ctx context.Context, monitorStack *monitoringv1.MonitorStack, pvc *corev1.PersistentVolumeClaim) error {
+	logger := log.FromContext(ctx)
+	storage := monitorStack.Spec.Prometheus.Storage
+
+	desired, err := resource.ParseQuantity(storage.Size)
+	if err != nil {
+		return fmt.Errorf("invalid storage size %q: %w", storage.Size, err)
+	}
+	requested := pvc.Spec.Resources.Requests[corev1.ResourceStorage]
+	capacity := pvc.Status.Capacity[corev1.ResourceStorage]
+
+	if monitorStack.Status.PrometheusStorage == nil {
+		monitorStack.Status.PrometheusStorage = &monitoringv1.StorageStatus{}
+	}
+	monitorStack.Status.PrometheusStorage.Size = desired.String()
+	monitorStack.Status.PrometheusStorage.Capacity = capacity.String()
+
+	// StorageClass无法修改
+	currentClass := ""
+	if pvc.Spec.StorageClassName != nil {
+		currentClass = *pvc.Spec.StorageClassName
+	}
+	if storage.StorageClass != "" && storage.StorageClass != currentClass {
+		r.setCondition(monitorStack, conditionTypePrometheusStorage, metav1.ConditionFalse, "StorageClassChangeNotSupported",
+			fmt.Sprintf("PVC %s uses storage class %q, changing it to %q requires migrating the data to a new PVC", pvc.Name, currentClass, storage.StorageClass))
+		return nil
+	}
+
+	switch desired.Cmp(requested) {
+	case -1:
+		// PVC不支持缩容
+		r.setCondition(monitorStack, conditionTypePrometheusStorage, metav1.ConditionFalse, "ShrinkNotSupported",
+			fmt.Sprintf("PVC %s cannot be shrunk from %s to %s", pvc.Name, requested.String(), desired.String()))
+		return nil
+
+	case 1:
+		// 扩容前检查StorageClass是否允许扩容
+		allowed, err := r.isVolumeExpansionAllowed(ctx, currentClass)
+		if err != nil {
+			return err
+		}
+		if !allowed {
+			r.setCondition(monitorStack, conditionTypePrometheusStorage, metav1.ConditionFalse, "ExpansionNotSupported",
+				fmt.Sprintf("storage class %q of PVC %s does not allow volume expansion", currentClass, pvc.Name))
+			return nil
+		}
+
+		logger.Info("Expanding Prometheus PVC", "pvc", pvc.Name, "from", requested.String(), "to", desired.String())
+		if pvc.Spec.Resources.Requests == nil {
+			pvc.Spec.Resources.Requests = corev1.ResourceList{}
+		}
+		pvc.Spec.Resources.Requests[corev1.ResourceStorage] = desired
+		if err := r.Update(ctx, pvc); err != nil {
+			return err
+		}
+		r.setCondition(monitorStack, conditionTypePrometheusStorage, metav1.ConditionFalse, "Resizing",
+			fmt.Sprintf("expanding PVC %s from %s to %s", pvc.Name, requested.String(), desired.String()))
+		return nil
+	}
+
+	// 请求大小已经一致，等待存储驱动完成扩容
+	if pending, since := isFileSystemResizePending(pvc); pending {
+		r.requestPrometheusRestart(ctx, monitorStack, pvc, since)
+		r.setCondition(monitorStack, conditionTypePrometheusStorage, metav1.ConditionFalse, "FileSystemResizePending",
+			fmt.Sprintf("PVC %s is waiting for the file system to be resized, Prometheus pod is restarted to remount the volume", pvc.Name))
+		return nil
+	}
+
+	if pvc.Status.Phase != corev1.ClaimBound {
+		r.setCondition(monitorStack, conditionTypePrometheusStorage, metav1.ConditionFalse, "Pending",
+			fmt.Sprintf("PVC %s is %s", pvc.Name, pvc.Status.Phase))
+		return nil
+	}
+
+	if capacity.Cmp(desired) < 0 {
+		r.setCondition(monitorStack, conditionTypePrometheusStorage, metav1.ConditionFalse, "Resizing",
+			fmt.Sprintf("waiting for PVC %s to be expanded from %s to %s", pvc.Name, capacity.String(), desired.String()))
+		return nil
+	}
+
+	r.setCondition(monitorStack, conditionTypePrometheusStorage, metav1.ConditionTrue, "Bound",
+		fmt.Sprintf("PVC %s has %s of storage", pvc.Name, capacity.String()))
+	return nil
+}
+
+// requestPrometheusRestart 记录重启时间，Pod模板上的重启注解变化后所有分片重新挂载数据卷
+// 每次等待文件系统扩容只重启一次Pod
+func (r *MonitorStackReconciler) requestPrometheusRestart(ctx context.Context, monitorStack *monitoringv1.MonitorStack,
+	pvc *corev1.PersistentVolumeClaim, since metav1.Time) {
+	if monitorStack.Status.PrometheusStorage == nil {
+		monitorStack.Status.PrometheusStorage = &monitoringv1.StorageStatus{}
+	}
+	restartedAt := monitorStack.Status.PrometheusStorage.RestartedAt
+	restarted, err := time.Parse(time.RFC3339, restartedAt)
+	if restartedAt == "" || err != nil || restarted.Before(since.Time) {
+		log.FromContext(ctx).Info("Restarting Prometheus to finish file system resize", "pvc", pvc.Name)
+		monitorStack.Status.PrometheusStorage.RestartedAt = time.Now().UTC().Format(time.RFC3339)
+	}
+}
+
+// expandPVC 请求大小小于desired时扩容PVC，用于不记录存储状态的PVC
+// 不支持缩容；StorageClass不允许扩容时保持原大小
+func (r *MonitorStackReconciler) expandPVC(ctx context.Context, pvc *corev1.PersistentVolumeClaim, desired resource.Quantity) error {
+	requested := pvc.Spec.Resources.Requests[corev1.ResourceStorage]
+	if desired.Cmp(requested) <= 0 {
+		return nil
+	}
+	storageClass := ""
+	if pvc.Spec.StorageClassName != nil {
+		storageClass = *pvc.Spec.StorageClassName
+	}
+	allowed, err := r.isVolumeExpansionAllowed(ctx, storageClass)
+	if err != nil || !allowed {
+		return err
+	}
+
+	log.FromContext(ctx).Info("Expanding PVC", "pvc", pvc.Name, "from", requested.String(), "to", desired.String())
+	if pvc.Spec.Resources.Requests == nil {
+		pvc.Spec.Resources.Requests = corev1.ResourceList{}
+	}
+	pvc.Spec.Resources.Requests[corev1.ResourceStorage] = desired
+	return r.Update(ctx, pvc)
+}
+
+// isVolumeExpansionAllowed 判断StorageClass是否允许扩容
+func (r *MonitorStackReconciler) isVolumeExpansionAllowed(ctx context.Context, storageClassName string) (bool, error) {
+	if storageClassName == "" {
+		return false, nil
+	}
+
+	storageClass := &storagev1.StorageClass{}
+	if err := r.Get(ctx, types.NamespacedName{Name: storageClassName}, storageClass); err != nil {
+		if errors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return storageClass.AllowVolumeExpansion != nil && *storageClass.AllowVolumeExpansion, nil
+}
+
+// PVC保留策略 - 控制禁用组件或删除MonitorStack时如何处理PVC
+
+const (
+	// retentionPolicyDelete 禁用组件或删除MonitorStack时删除PVC
+	retentionPolicyDelete = "Delete"
+	// retentionPolicyRetain 始终保留PVC
+	retentionPolicyRetain = "Retain"
+	// retentionPolicyRetainOnDisable 禁用组件时保留PVC，删除MonitorStack时删除
+	retentionPolicyRetainOnDisable = "RetainOnDisable"
+)
+
+// getStorageRetentionPolicy 获取PVC保留策略，未设置时为Retain
+func getStorageRetentionPolicy(retentionPolicy string) string {
+	if retentionPolicy == "" {
+		return retentionPolicyRetain
+	}
+	return retentionPolicy
+}
+
+// adoptPVC 接管之前保留下来的PVC
+// 只接管没有控制者且实例标签匹配的PVC，避免抢占其他资源的PVC
+func (r *MonitorStackReconciler) adoptPVC(ctx context.Context, monitorStack *monitoringv1.MonitorStack, pvc *corev1.PersistentVolumeClaim) error {
+	if metav1.IsControlledBy(pvc, monitorStack) {
+		return nil
+	}
+	if owner := metav1.GetControllerOf(pvc); owner != nil {
+		return fmt.Errorf("PVC %s is controlled by %s %s", pvc.Name, owner.Kind, owner.Name)
+	}
+	if pvc.Labels["app.kubernetes.io/instance"] != monitorStack.Name ||
+		pvc.Labels["app.kubernetes.io/managed-by"] != "monitor-operator" {
+		return fmt.Errorf("PVC %s already exists and is not managed by this MonitorStack", pvc.Name)
+	}
+
+	log.FromContext(ctx).Info("Adopting retained PVC", "pvc", pvc.Name)
+	if err := controllerutil.SetControllerReference(monitorStack, pvc, r.Scheme); err != nil {
+		return err
+	}
+	return r.Update(ctx, pvc)
+}
+
+// cleanupPrometheusPVC 按保留策略处理Prometheus的PVC
+// deleting表示MonitorStack正在被删除，否则为禁用组件或不再使用持久化存储
+func (r *MonitorStackReconciler) cleanupPrometheusPVC(ctx context.Context, monitorStack *monitoringv1.MonitorStack, deleting bool) error {
+	pvc := &corev1.PersistentVolumeClaim{}
+	err := r.Get(ctx, types.NamespacedName{
+		Name:      r.getPrometheusPVCName(monitorStack),
+		Namespace: monitorStack.Namespace,
+	}, pvc)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			return err
+		}
+	} else if err := r.applyPrometheusPVCRetentionPolicy(ctx, monitorStack, pvc, deleting); err != nil {
+		return err
+	}
+
+	// 分片0以外的分片的PVC
+	return r.cleanupPrometheusShardPVCs(ctx, monitorStack, 1, deleting)
+}
+
+// applyPrometheusPVCRetentionPolicy 按保留策略处理不再使用的Prometheus PVC
+func (r *MonitorStackReconciler) applyPrometheusPVCRetentionPolicy(ctx context.Context, monitorStack *monitoringv1.MonitorStack,
+	pvc *corev1.PersistentVolumeClaim, deleting bool) error {
+	return r.applyPVCRetentionPolicy(ctx, monitorStack, pvc, monitorStack.Spec.Prometheus.Storage.RetentionPolicy, deleting)
+}
+
+// applyPVCRetentionPolicy 按保留策略处理不再使用的PVC
+func (r *MonitorStackReconciler) applyPVCRetentionPolicy(ctx context.Context, monitorStack *monitoringv1.MonitorStack,
+	pvc *corev1.PersistentVolumeClaim, retentionPolicy string, deleting bool) error {
+	logger := log.FromContext(ctx)
+
+	// 只处理由当前MonitorStack控制的PVC
+	if !metav1.IsControlledBy(pvc, monitorStack) {
+		return nil
+	}
+
+	switch getStorageRetentionPolicy(retentionPolicy) {
+	case retentionPolicyDelete:
+		logger.Info("Deleting PVC", "pvc", pvc.Name)
+		return client.IgnoreNotFound(r.Delete(ctx, pvc))
+
+	case retentionPolicyRetain:
+		if !deleting {
+			return nil
+		}
+		// 解除OwnerReference，避免垃圾回收删除PVC
+		logger.Info("Orphaning PVC", "pvc", pvc.Name)
+		if err := controllerutil.RemoveControllerReference(monitorStack, pvc, r.Scheme); err != nil {
+			return err
+		}
+		return r.Update(ctx, pvc)
+	}
+
+	// RetainOnDisable: 禁用时保留，删除MonitorStack时由垃圾回收删除
+	return nil
+}
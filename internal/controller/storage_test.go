@@ -0,0 +1,88 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	monitoringv1 "github.com/ciliverse/monitor-operator/api/v1"
+)
+
+var _ = Describe("Prometheus PVC resize", func() {
+	r := &MonitorStackReconciler{}
+
+	It("recreates the pod when the data volume is a PVC", func() {
+		monitorStack := newTestMonitorStack()
+		monitorStack.Spec.Prometheus.Storage.Size = "10Gi"
+		Expect(r.buildPrometheusDeployment(monitorStack).Spec.Strategy.Type).To(Equal(appsv1.RecreateDeploymentStrategyType))
+
+		monitorStack.Spec.Prometheus.Storage.Size = ""
+		Expect(r.buildPrometheusDeployment(monitorStack).Spec.Strategy.Type).To(BeEmpty())
+	})
+
+	It("adds the restart annotation to the pod template", func() {
+		monitorStack := newTestMonitorStack()
+		monitorStack.Spec.Prometheus.Storage.Size = "10Gi"
+		monitorStack.Status.PrometheusStorage = &monitoringv1.StorageStatus{RestartedAt: "2025-01-01T00:00:00Z"}
+		annotations := r.buildPrometheusDeployment(monitorStack).Spec.Template.Annotations
+		Expect(annotations).To(HaveKeyWithValue(restartedAtAnnotation, "2025-01-01T00:00:00Z"))
+	})
+})
+
+var _ = Describe("Prometheus PVC retention", func() {
+	DescribeTable("cleanupPrometheusPVC",
+		func(policy string, deleting bool, expectDeleted, expectOwned bool) {
+			ctx := context.Background()
+			monitorStack := newTestMonitorStack()
+			monitorStack.UID = "test-uid"
+			monitorStack.Spec.Prometheus.Storage.RetentionPolicy = policy
+
+			r := newFakeReconciler()
+			pvc := &corev1.PersistentVolumeClaim{
+				ObjectMeta: metav1.ObjectMeta{Name: r.getPrometheusPVCName(monitorStack), Namespace: monitorStack.Namespace},
+			}
+			Expect(controllerutil.SetControllerReference(monitorStack, pvc, r.Scheme)).To(Succeed())
+			Expect(r.Create(ctx, pvc)).To(Succeed())
+
+			Expect(r.cleanupPrometheusPVC(ctx, monitorStack, deleting)).To(Succeed())
+
+			current := &corev1.PersistentVolumeClaim{}
+			err := r.Get(ctx, types.NamespacedName{Name: pvc.Name, Namespace: pvc.Namespace}, current)
+			if expectDeleted {
+				Expect(errors.IsNotFound(err)).To(BeTrue())
+				return
+			}
+			Expect(err).NotTo(HaveOccurred())
+			Expect(metav1.IsControlledBy(current, monitorStack)).To(Equal(expectOwned))
+		},
+		Entry("orphans the PVC by default when the stack is deleted", "", true, false, false),
+		Entry("keeps the PVC by default when the component is disabled", "", false, false, true),
+		Entry("orphans the PVC with Retain", retentionPolicyRetain, true, false, false),
+		Entry("leaves RetainOnDisable PVCs to garbage collection", retentionPolicyRetainOnDisable, true, false, true),
+		Entry("keeps RetainOnDisable PVCs when the component is disabled", retentionPolicyRetainOnDisable, false, false, true),
+		Entry("deletes the PVC with Delete", retentionPolicyDelete, false, true, false),
+	)
+})
@@ -0,0 +1,295 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	monitoringv1 "github.com/ciliverse/monitor-operator/api/v1"
+	"github.com/ciliverse/monitor-operator/internal/policy"
+)
+
+// 多租户隔离 - 通过targetNamespaces限制Prometheus服务发现的命名空间，
+// 只在这些命名空间中通过Role/RoleBinding授予服务发现权限，避免租户抓取其他租户的工作负载
+// 未设置targetNamespaces时只发现MonitorStack所在的命名空间，
+// 只有ClusterMonitorStack生成的MonitorStack才发现整个集群，集群级权限由ClusterMonitorStack授予
+// Role位于其他命名空间，无法设置OwnerReference，通过标签跟踪并在不再需要时删除
+// 授予权限的同时也让租户能读取其他命名空间的Pod和Service，所以除自身所在的命名空间外，
+// 只允许发现MonitorStackPolicy的allowedTargetNamespaces列出的命名空间
+
+//+kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
+//+kubebuilder:rbac:groups=rbac.authorization.k8s.io,resources=roles;rolebindings,verbs=get;list;watch;create;update;patch;delete
+
+const (
+	// conditionTypeTargetNamespacesAllowed 服务发现命名空间是否都被策略允许的状态条件
+	conditionTypeTargetNamespacesAllowed = "TargetNamespacesAllowed"
+	// monitorStackNameLabel 服务发现Role上记录所属MonitorStack名称的标签
+	monitorStackNameLabel = "monitoring.cillian.website/monitor-stack"
+	// monitorStackNamespaceLabel 服务发现Role上记录所属MonitorStack命名空间的标签
+	monitorStackNamespaceLabel = "monitoring.cillian.website/monitor-stack-namespace"
+)
+
+// getPrometheusDiscoveryRoleName 获取服务发现Role和RoleBinding的名称
+// 命名规则: monitor-operator:{MonitorStack命名空间}:{MonitorStack名称}-prometheus
+func (r *MonitorStackReconciler) getPrometheusDiscoveryRoleName(monitorStack *monitoringv1.MonitorStack) string {
+	return fmt.Sprintf("monitor-operator:%s:%s-prometheus", monitorStack.Namespace, monitorStack.Name)
+}
+
+// getPrometheusDiscoveryLabels 获取服务发现Role和RoleBinding的标签
+func (r *MonitorStackReconciler) getPrometheusDiscoveryLabels(monitorStack *monitoringv1.MonitorStack) map[string]string {
+	labels := r.getLabels(monitorStack, "prometheus")
+	labels[monitorStackNameLabel] = monitorStack.Name
+	labels[monitorStackNamespaceLabel] = monitorStack.Namespace
+	return labels
+}
+
+// isClusterWideDiscovery 判断Prometheus是否发现整个集群的目标
+// 只有ClusterMonitorStack生成且未设置targetNamespaces的MonitorStack才发现整个集群
+func isClusterWideDiscovery(monitorStack *monitoringv1.MonitorStack) bool {
+	if monitorStack.Spec.Prometheus.TargetNamespaces != nil {
+		return false
+	}
+	owner := metav1.GetControllerOf(monitorStack)
+	return owner != nil && owner.Kind == "ClusterMonitorStack" &&
+		owner.APIVersion == monitoringv1.GroupVersion.String()
+}
+
+// resolveTargetNamespaces 解析Prometheus服务发现的命名空间，结果记录在status中
+// 只包含已存在、未在删除中并且被策略允许的命名空间，被拒绝的命名空间记录在状态条件中
+// 未设置targetNamespaces时为MonitorStack所在的命名空间
+func (r *MonitorStackReconciler) resolveTargetNamespaces(ctx context.Context, monitorStack *monitoringv1.MonitorStack) error {
+	target := monitorStack.Spec.Prometheus.TargetNamespaces
+	if target == nil {
+		meta.RemoveStatusCondition(&monitorStack.Status.Conditions, conditionTypeTargetNamespacesAllowed)
+		if isClusterWideDiscovery(monitorStack) {
+			monitorStack.Status.TargetNamespaces = nil
+		} else {
+			monitorStack.Status.TargetNamespaces = []string{monitorStack.Namespace}
+		}
+		return nil
+	}
+
+	resolved := map[string]bool{}
+	for _, name := range target.Names {
+		namespace := &corev1.Namespace{}
+		if err := r.Get(ctx, types.NamespacedName{Name: name}, namespace); err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
+			return err
+		}
+		if namespace.DeletionTimestamp == nil {
+			resolved[name] = true
+		}
+	}
+
+	if target.Selector != nil {
+		selector, err := metav1.LabelSelectorAsSelector(target.Selector)
+		if err != nil {
+			return fmt.Errorf("invalid targetNamespaces selector: %w", err)
+		}
+		namespaces := &corev1.NamespaceList{}
+		if err := r.List(ctx, namespaces, client.MatchingLabelsSelector{Selector: selector}); err != nil {
+			return err
+		}
+		for _, namespace := range namespaces.Items {
+			if namespace.DeletionTimestamp == nil {
+				resolved[namespace.Name] = true
+			}
+		}
+	}
+
+	policies, err := policy.MatchingPolicies(ctx, r.Client, monitorStack.Namespace)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(resolved))
+	var refused []string
+	for name := range resolved {
+		if policy.AllowsTargetNamespace(policies, monitorStack.Namespace, name) {
+			names = append(names, name)
+		} else {
+			refused = append(refused, name)
+		}
+	}
+	sort.Strings(names)
+	sort.Strings(refused)
+	monitorStack.Status.TargetNamespaces = names
+
+	if len(refused) > 0 {
+		r.setCondition(monitorStack, conditionTypeTargetNamespacesAllowed, metav1.ConditionFalse, "NamespaceNotAllowed",
+			fmt.Sprintf("namespaces %s are not listed in allowedTargetNamespaces of any MonitorStackPolicy and are not discovered",
+				strings.Join(refused, ", ")))
+	} else {
+		r.setCondition(monitorStack, conditionTypeTargetNamespacesAllowed, metav1.ConditionTrue, "Allowed",
+			"all target namespaces are allowed")
+	}
+	return nil
+}
+
+// reconcilePrometheusDiscoveryRBAC 在服务发现的命名空间中授予Prometheus权限，并删除不再需要的授权
+func (r *MonitorStackReconciler) reconcilePrometheusDiscoveryRBAC(ctx context.Context, monitorStack *monitoringv1.MonitorStack) error {
+	keep := map[string]bool{}
+	if !isClusterWideDiscovery(monitorStack) {
+		for _, namespace := range monitorStack.Status.TargetNamespaces {
+			if err := r.createPrometheusDiscoveryRole(ctx, monitorStack, namespace); err != nil {
+				return err
+			}
+			if err := r.createPrometheusDiscoveryRoleBinding(ctx, monitorStack, namespace); err != nil {
+				return err
+			}
+			keep[namespace] = true
+		}
+	}
+	return r.deletePrometheusDiscoveryRBAC(ctx, monitorStack, keep)
+}
+
+// createPrometheusDiscoveryRole 在指定命名空间中创建服务发现Role
+func (r *MonitorStackReconciler) createPrometheusDiscoveryRole(ctx context.Context, monitorStack *monitoringv1.MonitorStack, namespace string) error {
+	role := &rbacv1.Role{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      r.getPrometheusDiscoveryRoleName(monitorStack),
+			Namespace: namespace,
+			Labels:    r.getPrometheusDiscoveryLabels(monitorStack),
+		},
+		Rules: prometheusNamespacedDiscoveryRules,
+	}
+
+	existing := &rbacv1.Role{}
+	err := r.Get(ctx, types.NamespacedName{Name: role.Name, Namespace: namespace}, existing)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return r.Create(ctx, role)
+		}
+		return err
+	}
+
+	existing.Rules = role.Rules
+	existing.Labels = role.Labels
+	return r.Update(ctx, existing)
+}
+
+// createPrometheusDiscoveryRoleBinding 在指定命名空间中把服务发现Role绑定到Prometheus的ServiceAccount
+func (r *MonitorStackReconciler) createPrometheusDiscoveryRoleBinding(ctx context.Context, monitorStack *monitoringv1.MonitorStack, namespace string) error {
+	name := r.getPrometheusDiscoveryRoleName(monitorStack)
+	binding := &rbacv1.RoleBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels:    r.getPrometheusDiscoveryLabels(monitorStack),
+		},
+		RoleRef: rbacv1.RoleRef{
+			APIGroup: rbacv1.GroupName,
+			Kind:     "Role",
+			Name:     name,
+		},
+		Subjects: []rbacv1.Subject{
+			{
+				Kind:      rbacv1.ServiceAccountKind,
+				Name:      r.getPrometheusServiceAccountName(monitorStack),
+				Namespace: monitorStack.Namespace,
+			},
+		},
+	}
+
+	existing := &rbacv1.RoleBinding{}
+	err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: namespace}, existing)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return r.Create(ctx, binding)
+		}
+		return err
+	}
+
+	// roleRef不可修改，只更新subjects
+	existing.Subjects = binding.Subjects
+	existing.Labels = binding.Labels
+	return r.Update(ctx, existing)
+}
+
+// deletePrometheusDiscoveryRBAC 删除keep以外命名空间中的服务发现Role和RoleBinding
+// keep为空时删除全部，用于禁用Prometheus和删除MonitorStack
+func (r *MonitorStackReconciler) deletePrometheusDiscoveryRBAC(ctx context.Context, monitorStack *monitoringv1.MonitorStack, keep map[string]bool) error {
+	logger := log.FromContext(ctx)
+	selector := client.MatchingLabels{
+		monitorStackNameLabel:      monitorStack.Name,
+		monitorStackNamespaceLabel: monitorStack.Namespace,
+	}
+
+	bindings := &rbacv1.RoleBindingList{}
+	if err := r.List(ctx, bindings, selector); err != nil {
+		return err
+	}
+	for i := range bindings.Items {
+		if keep[bindings.Items[i].Namespace] {
+			continue
+		}
+		logger.Info("Deleting Prometheus discovery RoleBinding", "namespace", bindings.Items[i].Namespace)
+		if err := client.IgnoreNotFound(r.Delete(ctx, &bindings.Items[i])); err != nil {
+			return err
+		}
+	}
+
+	roles := &rbacv1.RoleList{}
+	if err := r.List(ctx, roles, selector); err != nil {
+		return err
+	}
+	for i := range roles.Items {
+		if keep[roles.Items[i].Namespace] {
+			continue
+		}
+		logger.Info("Deleting Prometheus discovery Role", "namespace", roles.Items[i].Namespace)
+		if err := client.IgnoreNotFound(r.Delete(ctx, &roles.Items[i])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// findMonitorStacksForNamespace 命名空间变化后找出限制了服务发现命名空间的MonitorStack
+func (r *MonitorStackReconciler) findMonitorStacksForNamespace(ctx context.Context, obj client.Object) []reconcile.Request {
+	monitorStacks := &monitoringv1.MonitorStackList{}
+	if err := r.List(ctx, monitorStacks); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list MonitorStacks for namespace", "namespace", obj.GetName())
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, monitorStack := range monitorStacks.Items {
+		if monitorStack.Spec.Prometheus.TargetNamespaces == nil {
+			continue
+		}
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Name: monitorStack.Name, Namespace: monitorStack.Namespace},
+		})
+	}
+	return requests
+}
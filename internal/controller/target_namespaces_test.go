@@ -0,0 +1,159 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	monitoringv1 "github.com/ciliverse/monitor-operator/api/v1"
+)
+
+var _ = Describe("Prometheus target namespaces", func() {
+	ctx := context.Background()
+
+	namespaces := func() []client.Object {
+		return []client.Object{
+			&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "monitoring"}},
+			&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a", Labels: map[string]string{"team": "a"}}},
+			&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-b"}},
+		}
+	}
+
+	hasDiscoveryRole := func(r *MonitorStackReconciler, monitorStack *monitoringv1.MonitorStack, namespace string) bool {
+		err := r.Get(ctx, types.NamespacedName{Name: r.getPrometheusDiscoveryRoleName(monitorStack), Namespace: namespace}, &rbacv1.Role{})
+		if errors.IsNotFound(err) {
+			return false
+		}
+		Expect(err).NotTo(HaveOccurred())
+		return true
+	}
+
+	It("discovers only its own namespace by default", func() {
+		r := newFakeReconciler(namespaces()...)
+		monitorStack := newTestMonitorStack()
+
+		Expect(r.resolveTargetNamespaces(ctx, monitorStack)).To(Succeed())
+		Expect(monitorStack.Status.TargetNamespaces).To(Equal([]string{"monitoring"}))
+
+		Expect(r.reconcilePrometheusDiscoveryRBAC(ctx, monitorStack)).To(Succeed())
+		Expect(hasDiscoveryRole(r, monitorStack, "monitoring")).To(BeTrue())
+		Expect(hasDiscoveryRole(r, monitorStack, "team-a")).To(BeFalse())
+
+		config := r.getPrometheusConfig(monitorStack)
+		Expect(config).To(ContainSubstring("            - monitoring\n"))
+		Expect(config).NotTo(ContainSubstring("role: node"))
+	})
+
+	It("combines namespace names and selector and removes access that is no longer needed", func() {
+		objs := append(namespaces(), &monitoringv1.MonitorStackPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: "tenant"},
+			Spec:       monitoringv1.MonitorStackPolicySpec{AllowedTargetNamespaces: []string{"team-a", "team-b"}},
+		})
+		r := newFakeReconciler(objs...)
+		monitorStack := newTestMonitorStack()
+		monitorStack.Spec.Prometheus.TargetNamespaces = &monitoringv1.TargetNamespacesSpec{
+			Names:    []string{"team-b", "missing"},
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "a"}},
+		}
+
+		Expect(r.resolveTargetNamespaces(ctx, monitorStack)).To(Succeed())
+		Expect(monitorStack.Status.TargetNamespaces).To(Equal([]string{"team-a", "team-b"}))
+		Expect(r.reconcilePrometheusDiscoveryRBAC(ctx, monitorStack)).To(Succeed())
+		Expect(hasDiscoveryRole(r, monitorStack, "team-a")).To(BeTrue())
+		Expect(hasDiscoveryRole(r, monitorStack, "team-b")).To(BeTrue())
+
+		monitorStack.Spec.Prometheus.TargetNamespaces.Names = nil
+		Expect(r.resolveTargetNamespaces(ctx, monitorStack)).To(Succeed())
+		Expect(r.reconcilePrometheusDiscoveryRBAC(ctx, monitorStack)).To(Succeed())
+		Expect(hasDiscoveryRole(r, monitorStack, "team-a")).To(BeTrue())
+		Expect(hasDiscoveryRole(r, monitorStack, "team-b")).To(BeFalse())
+	})
+
+	It("discovers the whole cluster for stacks generated by a ClusterMonitorStack", func() {
+		r := newFakeReconciler(namespaces()...)
+		monitorStack := newTestMonitorStack()
+		monitorStack.OwnerReferences = []metav1.OwnerReference{{
+			APIVersion: monitoringv1.GroupVersion.String(),
+			Kind:       "ClusterMonitorStack",
+			Name:       "cluster",
+			UID:        "uid",
+			Controller: &[]bool{true}[0],
+		}}
+
+		Expect(r.resolveTargetNamespaces(ctx, monitorStack)).To(Succeed())
+		Expect(monitorStack.Status.TargetNamespaces).To(BeNil())
+		Expect(r.reconcilePrometheusDiscoveryRBAC(ctx, monitorStack)).To(Succeed())
+		Expect(hasDiscoveryRole(r, monitorStack, "monitoring")).To(BeFalse())
+
+		config := r.getPrometheusConfig(monitorStack)
+		Expect(config).To(ContainSubstring("role: node"))
+		Expect(config).NotTo(ContainSubstring("namespaces:"))
+	})
+
+	It("refuses other namespaces that no policy allows and grants no access there", func() {
+		objs := append(namespaces(), &monitoringv1.MonitorStackPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: "tenant"},
+			Spec:       monitoringv1.MonitorStackPolicySpec{AllowedTargetNamespaces: []string{"team-a"}},
+		})
+		r := newFakeReconciler(objs...)
+		monitorStack := newTestMonitorStack()
+		monitorStack.Spec.Prometheus.TargetNamespaces = &monitoringv1.TargetNamespacesSpec{
+			Names: []string{"monitoring", "team-a", "team-b"},
+		}
+
+		Expect(r.resolveTargetNamespaces(ctx, monitorStack)).To(Succeed())
+		Expect(monitorStack.Status.TargetNamespaces).To(Equal([]string{"monitoring", "team-a"}))
+		condition := meta.FindStatusCondition(monitorStack.Status.Conditions, conditionTypeTargetNamespacesAllowed)
+		Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+		Expect(condition.Reason).To(Equal("NamespaceNotAllowed"))
+		Expect(condition.Message).To(ContainSubstring("team-b"))
+		Expect(condition.Message).NotTo(ContainSubstring("team-a"))
+
+		Expect(r.reconcilePrometheusDiscoveryRBAC(ctx, monitorStack)).To(Succeed())
+		Expect(hasDiscoveryRole(r, monitorStack, "team-a")).To(BeTrue())
+		Expect(hasDiscoveryRole(r, monitorStack, "team-b")).To(BeFalse())
+		Expect(r.getPrometheusConfig(monitorStack)).NotTo(ContainSubstring("team-b"))
+	})
+
+	It("ignores allowed namespaces of policies that do not select the stack's namespace", func() {
+		objs := append(namespaces(), &monitoringv1.MonitorStackPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: "other-tenant"},
+			Spec: monitoringv1.MonitorStackPolicySpec{
+				NamespaceSelector:       &metav1.LabelSelector{MatchLabels: map[string]string{"tenant": "other"}},
+				AllowedTargetNamespaces: []string{"team-a", "team-b"},
+			},
+		})
+		r := newFakeReconciler(objs...)
+		monitorStack := newTestMonitorStack()
+		monitorStack.Spec.Prometheus.TargetNamespaces = &monitoringv1.TargetNamespacesSpec{
+			Names: []string{"monitoring", "team-a"},
+		}
+
+		Expect(r.resolveTargetNamespaces(ctx, monitorStack)).To(Succeed())
+		Expect(monitorStack.Status.TargetNamespaces).To(Equal([]string{"monitoring"}))
+	})
+})
@@ -0,0 +1,323 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	monitoringv1 "github.com/ciliverse/monitor-operator/api/v1"
+)
+
+// 版本升级 - 按组件依次升级镜像（先Prometheus后Grafana），每一步等待滚动更新完成并就绪，
+// 超时未就绪时自动回滚到最后一个可用版本
+//
+// 实际部署的镜像记录在ComponentStatus.Image中，构建Deployment时使用该镜像而不是直接使用spec，
+// 这样才能在升级等待期间保持Grafana的旧版本，并在回滚后保持旧版本
+
+const (
+	// defaultUpgradeTimeout 默认等待新版本就绪的超时时间
+	defaultUpgradeTimeout = 10 * time.Minute
+	// upgradeRequeueInterval 升级进行中的重新协调间隔，用于检查超时
+	upgradeRequeueInterval = 30 * time.Second
+)
+
+// getPrometheusDesiredImage 获取spec中期望的Prometheus镜像
+func (r *MonitorStackReconciler) getPrometheusDesiredImage(monitorStack *monitoringv1.MonitorStack) string {
+	spec := monitorStack.Spec.Prometheus
+	return r.rewriteImage(buildImage(spec.Image, spec.Tag, spec.Digest))
+}
+
+// getGrafanaDesiredImage 获取spec中期望的Grafana镜像
+func (r *MonitorStackReconciler) getGrafanaDesiredImage(monitorStack *monitoringv1.MonitorStack) string {
+	spec := monitorStack.Spec.Grafana
+	return r.rewriteImage(buildImage(spec.Image, spec.Tag, spec.Digest))
+}
+
+// getPrometheusImage 获取实际部署的Prometheus镜像
+func (r *MonitorStackReconciler) getPrometheusImage(monitorStack *monitoringv1.MonitorStack) string {
+	if monitorStack.Status.PrometheusStatus.Image != "" {
+		return monitorStack.Status.PrometheusStatus.Image
+	}
+	return r.getPrometheusDesiredImage(monitorStack)
+}
+
+// getPrometheusTag 获取实际部署的Prometheus镜像对应的版本标签
+// 回滚后部署的是最后可用版本，spec中的标签对应的是回滚前的失败版本
+func getPrometheusTag(monitorStack *monitoringv1.MonitorStack) string {
+	if status := monitorStack.Status.PrometheusStatus; status.Image != "" && status.Tag != "" {
+		return status.Tag
+	}
+	return monitorStack.Spec.Prometheus.Tag
+}
+
+// getGrafanaImage 获取实际部署的Grafana镜像
+func (r *MonitorStackReconciler) getGrafanaImage(monitorStack *monitoringv1.MonitorStack) string {
+	if monitorStack.Status.GrafanaStatus.Image != "" {
+		return monitorStack.Status.GrafanaStatus.Image
+	}
+	return r.getGrafanaDesiredImage(monitorStack)
+}
+
+// getUpgradeTimeout 获取等待新版本就绪的超时时间
+func getUpgradeTimeout(monitorStack *monitoringv1.MonitorStack) time.Duration {
+	if monitorStack.Spec.Upgrade != nil && monitorStack.Spec.Upgrade.Timeout != nil && monitorStack.Spec.Upgrade.Timeout.Duration > 0 {
+		return monitorStack.Spec.Upgrade.Timeout.Duration
+	}
+	return defaultUpgradeTimeout
+}
+
+// isAutoRollbackEnabled 判断是否启用自动回滚
+func isAutoRollbackEnabled(monitorStack *monitoringv1.MonitorStack) bool {
+	return monitorStack.Spec.Upgrade == nil || !monitorStack.Spec.Upgrade.DisableAutoRollback
+}
+
+// isUpgrading 判断是否有组件正在升级
+func isUpgrading(monitorStack *monitoringv1.MonitorStack) bool {
+	return monitorStack.Status.PrometheusStatus.UpgradeStartedAt != nil ||
+		monitorStack.Status.GrafanaStatus.UpgradeStartedAt != nil
+}
+
+// imageRepository 去掉镜像的标签和摘要，返回仓库地址
+func imageRepository(image string) string {
+	if i := strings.Index(image, "@"); i >= 0 {
+		image = image[:i]
+	}
+	// 标签位于最后一个"/"之后，避免把镜像仓库的端口当作标签
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		image = image[:i]
+	}
+	return image
+}
+
+// isRolloutComplete 判断Deployment是否已完成滚动更新并全部就绪
+func isRolloutComplete(deployment *appsv1.Deployment, container, image string) bool {
+	if deployment.Generation != deployment.Status.ObservedGeneration {
+		return false
+	}
+
+	deployed := false
+	for _, c := range deployment.Spec.Template.Spec.Containers {
+		if c.Name == container && c.Image == image {
+			deployed = true
+		}
+	}
+	if !deployed {
+		return false
+	}
+
+	replicas := int32(1)
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+	return deployment.Status.UpdatedReplicas >= replicas &&
+		deployment.Status.ReadyReplicas >= replicas &&
+		deployment.Status.AvailableReplicas >= replicas &&
+		deployment.Status.Replicas == deployment.Status.UpdatedReplicas
+}
+
+// resolveImageDigest 从就绪Pod的容器状态中解析正在运行的镜像摘要
+func (r *MonitorStackReconciler) resolveImageDigest(ctx context.Context, monitorStack *monitoringv1.MonitorStack, component, image string) (string, error) {
+	pods := &corev1.PodList{}
+	if err := r.List(ctx, pods,
+		client.InNamespace(monitorStack.Namespace),
+		client.MatchingLabels(r.getLabels(monitorStack, component)),
+	); err != nil {
+		return "", err
+	}
+
+	for _, pod := range pods.Items {
+		if pod.DeletionTimestamp != nil {
+			continue
+		}
+		deployed := false
+		for _, c := range pod.Spec.Containers {
+			if c.Name == component && c.Image == image {
+				deployed = true
+			}
+		}
+		if !deployed {
+			continue
+		}
+		for _, cs := range pod.Status.ContainerStatuses {
+			// imageID格式如docker-pullable://prom/prometheus@sha256:...
+			if cs.Name == component && cs.Ready {
+				if i := strings.LastIndex(cs.ImageID, "@"); i >= 0 {
+					return cs.ImageID[i+1:], nil
+				}
+			}
+		}
+	}
+	return "", nil
+}
+
+// planComponentUpgrade 计算组件本次要部署的镜像并更新升级状态
+// deploymentNames为组件的所有Deployment（例如Prometheus的各个分片），全部完成滚动更新后升级才算完成；
+// tag为spec中期望镜像的版本标签，与镜像一起记录和回滚；
+// blocked表示前一个组件的升级尚未完成，此时不开始新的升级；返回值表示该组件的升级是否仍在进行中
+func (r *MonitorStackReconciler) planComponentUpgrade(ctx context.Context, monitorStack *monitoringv1.MonitorStack,
+	component string, deploymentNames []string, desired, tag string, status *monitoringv1.ComponentStatus, blocked bool) (bool, error) {
+	logger := log.FromContext(ctx)
+	conditionType := strings.ToUpper(component[:1]) + component[1:] + "Upgraded"
+	autoRollback := isAutoRollbackEnabled(monitorStack)
+
+	// 已经回滚过的镜像，修改为其他版本前不再重试
+	if autoRollback && status.Image != "" && desired == status.FailedImage {
+		r.setCondition(monitorStack, conditionType, metav1.ConditionFalse, "RolledBack",
+			fmt.Sprintf("image %s did not become ready and was rolled back to %s", desired, status.Image))
+		return false, nil
+	}
+
+	// 开始新的升级
+	if status.Image != desired {
+		if status.Image != "" && blocked {
+			r.setCondition(monitorStack, conditionType, metav1.ConditionFalse, "Waiting",
+				fmt.Sprintf("waiting for the previous component to finish upgrading before rolling out %s", desired))
+			return false, nil
+		}
+		logger.Info("Rolling out new image", "component", component, "from", status.Image, "to", desired)
+		now := metav1.Now()
+		status.Image = desired
+		status.Tag = tag
+		status.FailedImage = ""
+		status.UpgradeStartedAt = &now
+		r.setCondition(monitorStack, conditionType, metav1.ConditionFalse, "Upgrading",
+			fmt.Sprintf("rolling out image %s", desired))
+		return true, nil
+	}
+
+	if status.UpgradeStartedAt == nil {
+		// 旧版本没有记录标签，镜像与期望一致时补充
+		if status.Tag == "" {
+			status.Tag = tag
+		}
+		// 没有进行中的升级，刷新正在运行的镜像摘要
+		digest, err := r.resolveImageDigest(ctx, monitorStack, component, status.Image)
+		if err != nil {
+			return false, err
+		}
+		if digest != "" {
+			status.ImageDigest = digest
+		}
+		return false, nil
+	}
+
+	// 等待所有Deployment完成滚动更新
+	complete, err := r.areRolloutsComplete(ctx, monitorStack, deploymentNames, component, status.Image)
+	if err != nil {
+		return true, err
+	}
+
+	if complete {
+		digest, err := r.resolveImageDigest(ctx, monitorStack, component, status.Image)
+		if err != nil {
+			return true, err
+		}
+		// 最后可用版本使用摘要固定，回滚时部署完全相同的镜像
+		status.ImageDigest = digest
+		status.LastKnownGoodImage = status.Image
+		if digest != "" {
+			status.LastKnownGoodImage = imageRepository(status.Image) + "@" + digest
+		}
+		status.LastKnownGoodTag = status.Tag
+		status.UpgradeStartedAt = nil
+		r.setCondition(monitorStack, conditionType, metav1.ConditionTrue, "UpgradeComplete",
+			fmt.Sprintf("image %s is running", status.Image))
+		return false, nil
+	}
+
+	timeout := getUpgradeTimeout(monitorStack)
+	if time.Since(status.UpgradeStartedAt.Time) < timeout {
+		return true, nil
+	}
+
+	// 超时未就绪，回滚到最后一个可用版本
+	if autoRollback && status.LastKnownGoodImage != "" && status.LastKnownGoodImage != status.Image {
+		logger.Info("Upgrade timed out, rolling back", "component", component, "image", status.Image, "rollbackTo", status.LastKnownGoodImage)
+		failed := status.Image
+		status.FailedImage = failed
+		status.Image = status.LastKnownGoodImage
+		status.Tag = status.LastKnownGoodTag
+		status.UpgradeStartedAt = nil
+		r.setCondition(monitorStack, conditionType, metav1.ConditionFalse, "RolledBack",
+			fmt.Sprintf("image %s did not become ready within %s and was rolled back to %s", failed, timeout, status.Image))
+		return false, nil
+	}
+
+	r.setCondition(monitorStack, conditionType, metav1.ConditionFalse, "UpgradeTimeout",
+		fmt.Sprintf("image %s did not become ready within %s", status.Image, timeout))
+	return true, nil
+}
+
+// areRolloutsComplete 判断所有Deployment是否都已使用指定镜像完成滚动更新
+func (r *MonitorStackReconciler) areRolloutsComplete(ctx context.Context, monitorStack *monitoringv1.MonitorStack,
+	deploymentNames []string, container, image string) (bool, error) {
+	for _, name := range deploymentNames {
+		deployment := &appsv1.Deployment{}
+		if err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: monitorStack.Namespace}, deployment); err != nil {
+			if errors.IsNotFound(err) {
+				return false, nil
+			}
+			return false, err
+		}
+		if !isRolloutComplete(deployment, container, image) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// planUpgrades 规划各组件的镜像升级
+// Prometheus先升级，所有分片都完成滚动更新后Grafana再升级
+func (r *MonitorStackReconciler) planUpgrades(ctx context.Context, monitorStack *monitoringv1.MonitorStack) error {
+	prometheusUpgrading := false
+	if monitorStack.Spec.Prometheus.Enabled {
+		shards := getPrometheusShards(monitorStack)
+		deploymentNames := make([]string, 0, shards)
+		for shard := int32(0); shard < shards; shard++ {
+			deploymentNames = append(deploymentNames, r.getPrometheusShardName(monitorStack, shard))
+		}
+
+		var err error
+		prometheusUpgrading, err = r.planComponentUpgrade(ctx, monitorStack, "prometheus",
+			deploymentNames, r.getPrometheusDesiredImage(monitorStack), monitorStack.Spec.Prometheus.Tag,
+			&monitorStack.Status.PrometheusStatus, false)
+		if err != nil {
+			return err
+		}
+	}
+
+	if monitorStack.Spec.Grafana.Enabled {
+		if _, err := r.planComponentUpgrade(ctx, monitorStack, "grafana",
+			[]string{r.getGrafanaName(monitorStack)}, r.getGrafanaDesiredImage(monitorStack), monitorStack.Spec.Grafana.Tag,
+			&monitorStack.Status.GrafanaStatus, prometheusUpgrading); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
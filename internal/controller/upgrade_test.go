@@ -0,0 +1,147 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	monitoringv1 "github.com/ciliverse/monitor-operator/api/v1"
+)
+
+var _ = Describe("Upgrades", func() {
+	const (
+		oldImage = "prom/prometheus:v2.44.0"
+		newImage = "prom/prometheus:v2.45.0"
+	)
+
+	DescribeTable("imageRepository",
+		func(image, expected string) {
+			Expect(imageRepository(image)).To(Equal(expected))
+		},
+		Entry("strips the tag", "prom/prometheus:v2.45.0", "prom/prometheus"),
+		Entry("strips the digest", "prom/prometheus@sha256:abc", "prom/prometheus"),
+		Entry("keeps the registry port", "registry:5000/prom/prometheus:v2.45.0", "registry:5000/prom/prometheus"),
+		Entry("keeps untagged images", "registry:5000/prom/prometheus", "registry:5000/prom/prometheus"),
+	)
+
+	Describe("planComponentUpgrade", func() {
+		ctx := context.Background()
+
+		// rolledOut 构建已更新到image的Deployment，ready表示Pod是否就绪
+		rolledOut := func(name, image string, ready bool) *appsv1.Deployment {
+			readyReplicas := int32(0)
+			if ready {
+				readyReplicas = 1
+			}
+			return &appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "monitoring"},
+				Spec: appsv1.DeploymentSpec{
+					Replicas: &[]int32{1}[0],
+					Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+						Containers: []corev1.Container{{Name: "prometheus", Image: image}},
+					}},
+				},
+				Status: appsv1.DeploymentStatus{
+					Replicas: 1, UpdatedReplicas: 1, ReadyReplicas: readyReplicas, AvailableReplicas: readyReplicas,
+				},
+			}
+		}
+
+		upgradingStatus := func(startedAt time.Time) *monitoringv1.ComponentStatus {
+			return &monitoringv1.ComponentStatus{
+				Image:              newImage,
+				Tag:                "v3.1.0",
+				LastKnownGoodImage: oldImage,
+				LastKnownGoodTag:   "v2.53.0",
+				UpgradeStartedAt:   &metav1.Time{Time: startedAt},
+			}
+		}
+
+		names := []string{"test-prometheus", "test-prometheus-shard-1"}
+
+		It("starts an upgrade when the desired image changes", func() {
+			monitorStack := newTestMonitorStack()
+			status := &monitoringv1.ComponentStatus{Image: oldImage, LastKnownGoodImage: oldImage}
+			upgrading, err := newFakeReconciler().planComponentUpgrade(ctx, monitorStack, "prometheus", names, newImage, "v3.1.0", status, false)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(upgrading).To(BeTrue())
+			Expect(status.Image).To(Equal(newImage))
+			Expect(status.Tag).To(Equal("v3.1.0"))
+			Expect(status.UpgradeStartedAt).NotTo(BeNil())
+		})
+
+		It("waits for the previous component", func() {
+			monitorStack := newTestMonitorStack()
+			status := &monitoringv1.ComponentStatus{Image: oldImage}
+			upgrading, err := newFakeReconciler().planComponentUpgrade(ctx, monitorStack, "grafana", names, newImage, "", status, true)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(upgrading).To(BeFalse())
+			Expect(status.Image).To(Equal(oldImage))
+			Expect(meta.FindStatusCondition(monitorStack.Status.Conditions, "GrafanaUpgraded").Reason).To(Equal("Waiting"))
+		})
+
+		It("keeps upgrading until every shard has rolled out", func() {
+			monitorStack := newTestMonitorStack()
+			status := upgradingStatus(time.Now())
+			reconciler := newFakeReconciler(rolledOut(names[0], newImage, true), rolledOut(names[1], newImage, false))
+			upgrading, err := reconciler.planComponentUpgrade(ctx, monitorStack, "prometheus", names, newImage, "", status, false)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(upgrading).To(BeTrue())
+			Expect(status.UpgradeStartedAt).NotTo(BeNil())
+		})
+
+		It("completes the upgrade once every shard has rolled out", func() {
+			monitorStack := newTestMonitorStack()
+			status := upgradingStatus(time.Now())
+			reconciler := newFakeReconciler(rolledOut(names[0], newImage, true), rolledOut(names[1], newImage, true))
+			upgrading, err := reconciler.planComponentUpgrade(ctx, monitorStack, "prometheus", names, newImage, "v3.1.0", status, false)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(upgrading).To(BeFalse())
+			Expect(status.UpgradeStartedAt).To(BeNil())
+			Expect(status.LastKnownGoodImage).To(Equal(newImage))
+			Expect(status.LastKnownGoodTag).To(Equal("v3.1.0"))
+			Expect(meta.IsStatusConditionTrue(monitorStack.Status.Conditions, "PrometheusUpgraded")).To(BeTrue())
+		})
+
+		It("rolls back when a shard does not become ready in time", func() {
+			monitorStack := newTestMonitorStack()
+			status := upgradingStatus(time.Now().Add(-time.Hour))
+			reconciler := newFakeReconciler(rolledOut(names[0], newImage, true), rolledOut(names[1], newImage, false))
+			upgrading, err := reconciler.planComponentUpgrade(ctx, monitorStack, "prometheus", names, newImage, "v3.1.0", status, false)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(upgrading).To(BeFalse())
+			Expect(status.Image).To(Equal(oldImage))
+			Expect(status.Tag).To(Equal("v2.53.0"))
+			Expect(status.FailedImage).To(Equal(newImage))
+
+			// 回滚过的镜像不会再次尝试
+			upgrading, err = reconciler.planComponentUpgrade(ctx, monitorStack, "prometheus", names, newImage, "", status, false)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(upgrading).To(BeFalse())
+			Expect(status.Image).To(Equal(oldImage))
+			Expect(meta.FindStatusCondition(monitorStack.Status.Conditions, "PrometheusUpgraded").Reason).To(Equal("RolledBack"))
+		})
+	})
+})
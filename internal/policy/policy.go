@@ -0,0 +1,478 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package policy 检查MonitorStack是否符合MonitorStackPolicy，准入Webhook和控制器共用同一套规则
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	monitoringv1 "github.com/ciliverse/monitor-operator/api/v1"
+)
+
+// defaultRegistry 未指定仓库的镜像所属的仓库
+const defaultRegistry = "docker.io"
+
+// MatchingPolicies 获取对指定命名空间生效的策略
+func MatchingPolicies(ctx context.Context, c client.Reader, namespace string) ([]monitoringv1.MonitorStackPolicy, error) {
+	policies := &monitoringv1.MonitorStackPolicyList{}
+	if err := c.List(ctx, policies); err != nil {
+		return nil, err
+	}
+	if len(policies.Items) == 0 {
+		return nil, nil
+	}
+
+	ns := &corev1.Namespace{}
+	if err := c.Get(ctx, types.NamespacedName{Name: namespace}, ns); err != nil {
+		return nil, err
+	}
+
+	var matched []monitoringv1.MonitorStackPolicy
+	for _, p := range policies.Items {
+		if p.Spec.NamespaceSelector == nil {
+			matched = append(matched, p)
+			continue
+		}
+		selector, err := metav1.LabelSelectorAsSelector(p.Spec.NamespaceSelector)
+		if err != nil {
+			return nil, fmt.Errorf("policy %s has an invalid namespaceSelector: %w", p.Name, err)
+		}
+		if selector.Matches(labels.Set(ns.Labels)) {
+			matched = append(matched, p)
+		}
+	}
+	return matched, nil
+}
+
+// SpecImages 返回spec中显式设置的镜像，未设置的镜像由operator决定
+func SpecImages(spec *monitoringv1.MonitorStackSpec) []string {
+	var images []string
+	if spec.Prometheus.Enabled && spec.Prometheus.Image != "" {
+		images = append(images, spec.Prometheus.Image)
+	}
+	if spec.Grafana.Enabled && spec.Grafana.Image != "" {
+		images = append(images, spec.Grafana.Image)
+	}
+	if spec.Prometheus.Enabled && spec.Prometheus.Backup != nil && spec.Prometheus.Backup.Image != "" {
+		images = append(images, spec.Prometheus.Backup.Image)
+	}
+	if spec.Prometheus.Enabled {
+		images = append(images, PodTemplateImages(spec.Prometheus.PodTemplate)...)
+	}
+	if spec.Grafana.Enabled {
+		images = append(images, PodTemplateImages(spec.Grafana.PodTemplate)...)
+	}
+	if spec.Loki != nil && spec.Loki.Enabled {
+		if spec.Loki.Image != "" {
+			images = append(images, spec.Loki.Image)
+		}
+		if spec.Loki.Promtail.Enabled && spec.Loki.Promtail.Image != "" {
+			images = append(images, spec.Loki.Promtail.Image)
+		}
+	}
+	return images
+}
+
+// PodTemplateImages 返回podTemplate覆盖中sidecar容器和初始化容器的镜像
+// 这些镜像不经过镜像仓库重写，按原样检查
+func PodTemplateImages(override *runtime.RawExtension) []string {
+	var images []string
+	for _, container := range podTemplateContainers(override) {
+		if container.Image != "" {
+			images = append(images, container.Image)
+		}
+	}
+	return images
+}
+
+// podTemplateContainers 返回podTemplate覆盖中的初始化容器和容器，无法解析的覆盖由控制器的验证报告
+func podTemplateContainers(override *runtime.RawExtension) []corev1.Container {
+	if override == nil || len(override.Raw) == 0 {
+		return nil
+	}
+	template := corev1.PodTemplateSpec{}
+	if err := json.Unmarshal(override.Raw, &template); err != nil {
+		return nil
+	}
+	return append(template.Spec.InitContainers, template.Spec.Containers...)
+}
+
+// DefaultLimits 把未设置的limits补全为策略允许的最大资源，多个策略时取最小值
+// 默认值只设置requests，没有limits的容器不受资源上限约束，策略限制最大资源时需要补全
+func DefaultLimits(policies []monitoringv1.MonitorStackPolicy, spec *monitoringv1.MonitorStackSpec) {
+	maxCPU := minQuantity(policies, func(r monitoringv1.ResourceList) string { return r.CPU })
+	maxMemory := minQuantity(policies, func(r monitoringv1.ResourceList) string { return r.Memory })
+	fill := func(resources *monitoringv1.ResourceRequirements) {
+		if resources.Limits.CPU == "" {
+			resources.Limits.CPU = maxCPU
+		}
+		if resources.Limits.Memory == "" {
+			resources.Limits.Memory = maxMemory
+		}
+	}
+
+	fill(&spec.Prometheus.Resources)
+	fill(&spec.Grafana.Resources)
+	if spec.Loki != nil {
+		fill(&spec.Loki.Resources)
+		fill(&spec.Loki.Promtail.Resources)
+	}
+}
+
+// minQuantity 返回策略中最小的最大资源，均未设置时返回空字符串
+func minQuantity(policies []monitoringv1.MonitorStackPolicy, get func(monitoringv1.ResourceList) string) string {
+	var result string
+	var minValue resource.Quantity
+	for _, p := range policies {
+		value := get(p.Spec.MaxResources)
+		quantity, err := resource.ParseQuantity(value)
+		if err != nil {
+			continue
+		}
+		if result == "" || quantity.Cmp(minValue) < 0 {
+			result, minValue = value, quantity
+		}
+	}
+	return result
+}
+
+// Violations 检查MonitorStack是否违反策略，返回违反的规则，images为要检查仓库的镜像
+func Violations(p *monitoringv1.MonitorStackPolicy, spec *monitoringv1.MonitorStackSpec, images []string) []string {
+	var violations []string
+	add := func(format string, args ...any) {
+		violations = append(violations, fmt.Sprintf("policy %s: ", p.Name)+fmt.Sprintf(format, args...))
+	}
+
+	prometheus := spec.Prometheus
+	grafana := spec.Grafana
+	var loki monitoringv1.LokiSpec
+	if spec.Loki != nil {
+		loki = *spec.Loki
+	}
+
+	// 数据保留时间
+	if p.Spec.MaxRetention != "" && prometheus.Enabled && prometheus.Retention != "" {
+		maxRetention, err := ParseRetention(p.Spec.MaxRetention)
+		if err == nil {
+			retention, err := ParseRetention(prometheus.Retention)
+			if err != nil {
+				add("invalid retention %q", prometheus.Retention)
+			} else if retention > maxRetention {
+				add("retention %s exceeds the maximum of %s", prometheus.Retention, p.Spec.MaxRetention)
+			}
+		}
+	}
+	if p.Spec.MaxRetention != "" && loki.Enabled && loki.Retention != "" {
+		maxRetention, err := ParseRetention(p.Spec.MaxRetention)
+		if err == nil {
+			retention, err := ParseRetention(loki.Retention)
+			if err != nil {
+				add("invalid loki retention %q", loki.Retention)
+			} else if retention > maxRetention {
+				add("loki retention %s exceeds the maximum of %s", loki.Retention, p.Spec.MaxRetention)
+			}
+		}
+	}
+
+	// 存储大小
+	if p.Spec.MaxStorageSize != "" && prometheus.Enabled && prometheus.Storage.Size != "" {
+		maxSize, err := resource.ParseQuantity(p.Spec.MaxStorageSize)
+		if err == nil {
+			size, err := resource.ParseQuantity(prometheus.Storage.Size)
+			if err != nil {
+				add("invalid storage size %q", prometheus.Storage.Size)
+			} else if size.Cmp(maxSize) > 0 {
+				add("storage size %s exceeds the maximum of %s", prometheus.Storage.Size, p.Spec.MaxStorageSize)
+			}
+		}
+	}
+	if p.Spec.MaxStorageSize != "" && loki.Enabled && loki.Storage.Size != "" {
+		maxSize, err := resource.ParseQuantity(p.Spec.MaxStorageSize)
+		if err == nil {
+			size, err := resource.ParseQuantity(loki.Storage.Size)
+			if err != nil {
+				add("invalid loki storage size %q", loki.Storage.Size)
+			} else if size.Cmp(maxSize) > 0 {
+				add("loki storage size %s exceeds the maximum of %s", loki.Storage.Size, p.Spec.MaxStorageSize)
+			}
+		}
+	}
+
+	// Service类型
+	if len(p.Spec.AllowedServiceTypes) > 0 {
+		if prometheus.Enabled && !slices.Contains(p.Spec.AllowedServiceTypes, serviceType(prometheus.Service)) {
+			add("prometheus service type %s is not allowed", serviceType(prometheus.Service))
+		}
+		if grafana.Enabled && !slices.Contains(p.Spec.AllowedServiceTypes, serviceType(grafana.Service)) {
+			add("grafana service type %s is not allowed", serviceType(grafana.Service))
+		}
+		if loki.Enabled && !slices.Contains(p.Spec.AllowedServiceTypes, serviceType(loki.Service)) {
+			add("loki service type %s is not allowed", serviceType(loki.Service))
+		}
+	}
+
+	// 镜像仓库
+	if len(p.Spec.AllowedImageRegistries) > 0 {
+		for _, image := range images {
+			if !isRegistryAllowed(image, p.Spec.AllowedImageRegistries) {
+				add("image %s is not from an allowed registry", image)
+			}
+		}
+	}
+
+	// 资源
+	if prometheus.Enabled {
+		for _, v := range resourceViolations("prometheus", prometheus.Resources, p.Spec.MaxResources) {
+			add("%s", v)
+		}
+	}
+	if grafana.Enabled {
+		for _, v := range resourceViolations("grafana", grafana.Resources, p.Spec.MaxResources) {
+			add("%s", v)
+		}
+	}
+	if loki.Enabled {
+		for _, v := range resourceViolations("loki", loki.Resources, p.Spec.MaxResources) {
+			add("%s", v)
+		}
+		if loki.Promtail.Enabled {
+			for _, v := range resourceViolations("promtail", loki.Promtail.Resources, p.Spec.MaxResources) {
+				add("%s", v)
+			}
+		}
+	}
+
+	// podTemplate中的sidecar容器和初始化容器，主容器的资源不允许通过覆盖修改
+	for _, component := range []struct {
+		name     string
+		enabled  bool
+		override *runtime.RawExtension
+	}{
+		{"prometheus", prometheus.Enabled, prometheus.PodTemplate},
+		{"grafana", grafana.Enabled, grafana.PodTemplate},
+	} {
+		if !component.enabled {
+			continue
+		}
+		for _, container := range podTemplateContainers(component.override) {
+			if container.Name == component.name {
+				continue
+			}
+			name := fmt.Sprintf("%s container %q", component.name, container.Name)
+			for _, v := range resourceViolations(name, containerResources(container), p.Spec.MaxResources) {
+				add("%s", v)
+			}
+		}
+	}
+
+	// 副本总数
+	if p.Spec.MaxReplicas != nil {
+		if replicas := Replicas(spec); replicas > *p.Spec.MaxReplicas {
+			add("total replicas %d exceeds the maximum of %d", replicas, *p.Spec.MaxReplicas)
+		}
+	}
+
+	// 分片数量
+	if p.Spec.MaxShards != nil && prometheus.Enabled {
+		if shards := prometheusShards(spec); shards > *p.Spec.MaxShards {
+			add("prometheus shards %d exceeds the maximum of %d", shards, *p.Spec.MaxShards)
+		}
+	}
+
+	return violations
+}
+
+// AllowsTargetNamespace 判断位于stackNamespace的MonitorStack是否可以发现namespace中的目标
+// 自身所在的命名空间始终允许，其他命名空间需要至少一个策略在allowedTargetNamespaces中列出
+func AllowsTargetNamespace(policies []monitoringv1.MonitorStackPolicy, stackNamespace, namespace string) bool {
+	if namespace == stackNamespace {
+		return true
+	}
+	for _, p := range policies {
+		if slices.Contains(p.Spec.AllowedTargetNamespaces, namespace) {
+			return true
+		}
+	}
+	return false
+}
+
+// Replicas 返回MonitorStack所有组件最多运行的Pod副本总数
+func Replicas(spec *monitoringv1.MonitorStackSpec) int32 {
+	var replicas int32
+	if spec.Prometheus.Enabled {
+		// 每个分片运行一个副本
+		replicas += prometheusShards(spec)
+	}
+	if spec.Grafana.Enabled {
+		// 启用自动扩缩容时按最大副本数计算
+		if spec.Grafana.Autoscaling != nil {
+			replicas += spec.Grafana.Autoscaling.MaxReplicas
+		} else {
+			replicas++
+		}
+	}
+	// Loki运行一个副本，Promtail是DaemonSet，副本数由节点数决定，不计入
+	if spec.Loki != nil && spec.Loki.Enabled {
+		replicas++
+	}
+	return replicas
+}
+
+// prometheusShards 返回Prometheus的分片数量，未设置时为1
+func prometheusShards(spec *monitoringv1.MonitorStackSpec) int32 {
+	if shards := spec.Prometheus.Shards; shards != nil && *shards > 1 {
+		return *shards
+	}
+	return 1
+}
+
+// AllowsNodeLogCollection 判断是否有策略允许Promtail采集所有命名空间的日志
+func AllowsNodeLogCollection(policies []monitoringv1.MonitorStackPolicy) bool {
+	for _, p := range policies {
+		if p.Spec.AllowNodeLogCollection {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseRetention 解析Prometheus的保留时间，例如15d、1y
+func ParseRetention(retention string) (time.Duration, error) {
+	if len(retention) < 2 {
+		return 0, fmt.Errorf("invalid retention %q", retention)
+	}
+	value, err := strconv.ParseInt(retention[:len(retention)-1], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid retention %q", retention)
+	}
+
+	units := map[byte]time.Duration{
+		's': time.Second,
+		'm': time.Minute,
+		'h': time.Hour,
+		'd': 24 * time.Hour,
+		'y': 365 * 24 * time.Hour,
+	}
+	unit, ok := units[retention[len(retention)-1]]
+	if !ok {
+		return 0, fmt.Errorf("invalid retention %q", retention)
+	}
+	return time.Duration(value) * unit, nil
+}
+
+// serviceType 获取Service类型，未设置时为ClusterIP
+func serviceType(service monitoringv1.ServiceSpec) string {
+	if service.Type == "" {
+		return string(corev1.ServiceTypeClusterIP)
+	}
+	return service.Type
+}
+
+// isRegistryAllowed 判断镜像是否来自允许的仓库
+func isRegistryAllowed(image string, allowed []string) bool {
+	normalized := normalizeImage(image)
+	for _, registry := range allowed {
+		registry = strings.TrimSuffix(registry, "/")
+		if strings.HasPrefix(normalized, registry+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeImage 补全镜像的仓库地址，规则与docker一致
+func normalizeImage(image string) string {
+	image = strings.TrimPrefix(image, "index.docker.io/")
+	i := strings.Index(image, "/")
+	if i < 0 {
+		return defaultRegistry + "/" + image
+	}
+	host := image[:i]
+	if strings.ContainsAny(host, ".:") || host == "localhost" {
+		return image
+	}
+	return defaultRegistry + "/" + image
+}
+
+// containerResources 把容器的资源转换为spec中的资源格式
+func containerResources(container corev1.Container) monitoringv1.ResourceRequirements {
+	format := func(list corev1.ResourceList, name corev1.ResourceName) string {
+		if quantity, ok := list[name]; ok {
+			return quantity.String()
+		}
+		return ""
+	}
+	return monitoringv1.ResourceRequirements{
+		Requests: monitoringv1.ResourceList{
+			CPU:    format(container.Resources.Requests, corev1.ResourceCPU),
+			Memory: format(container.Resources.Requests, corev1.ResourceMemory),
+		},
+		Limits: monitoringv1.ResourceList{
+			CPU:    format(container.Resources.Limits, corev1.ResourceCPU),
+			Memory: format(container.Resources.Limits, corev1.ResourceMemory),
+		},
+	}
+}
+
+// resourceViolations 检查组件的requests和limits是否超过最大资源
+// 策略限制最大资源时必须设置limits，否则容器可以无限制地使用资源
+func resourceViolations(component string, resources monitoringv1.ResourceRequirements, maxResources monitoringv1.ResourceList) []string {
+	var violations []string
+	check := func(kind, name, value, maxValue string) {
+		if maxValue == "" {
+			return
+		}
+		if value == "" {
+			if kind == "limits" {
+				violations = append(violations, fmt.Sprintf("%s limits %s must be set, the maximum is %s", component, name, maxValue))
+			}
+			return
+		}
+		quantity, err := resource.ParseQuantity(value)
+		if err != nil {
+			violations = append(violations, fmt.Sprintf("%s %s %s %q is invalid", component, kind, name, value))
+			return
+		}
+		maxQuantity, err := resource.ParseQuantity(maxValue)
+		if err != nil {
+			return
+		}
+		if quantity.Cmp(maxQuantity) > 0 {
+			violations = append(violations, fmt.Sprintf("%s %s %s %s exceeds the maximum of %s", component, kind, name, value, maxValue))
+		}
+	}
+
+	check("requests", "cpu", resources.Requests.CPU, maxResources.CPU)
+	check("requests", "memory", resources.Requests.Memory, maxResources.Memory)
+	check("limits", "cpu", resources.Limits.CPU, maxResources.CPU)
+	check("limits", "memory", resources.Limits.Memory, maxResources.Memory)
+	return violations
+}
@@ -0,0 +1,112 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	monitoringv1 "github.com/ciliverse/monitor-operator/api/v1"
+	"github.com/ciliverse/monitor-operator/internal/policy"
+)
+
+// log is for logging in this package.
+var monitorstacklog = logf.Log.WithName("monitorstack-resource")
+
+// SetupMonitorStackWebhookWithManager registers the webhook for MonitorStack in the manager.
+func SetupMonitorStackWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).For(&monitoringv1.MonitorStack{}).
+		WithValidator(&MonitorStackCustomValidator{Client: mgr.GetClient()}).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/validate-monitoring-cillian-website-v1-monitorstack,mutating=false,failurePolicy=fail,sideEffects=None,groups=monitoring.cillian.website,resources=monitorstacks,verbs=create;update,versions=v1,name=vmonitorstack-v1.kb.io,admissionReviewVersions=v1
+
+// MonitorStackCustomValidator 在创建和修改MonitorStack时检查所在命名空间的MonitorStackPolicy
+// 未设置的镜像、保留时间等由operator补全默认值，准入阶段只检查显式设置的字段，其余由控制器检查
+type MonitorStackCustomValidator struct {
+	Client client.Reader
+}
+
+var _ webhook.CustomValidator = &MonitorStackCustomValidator{}
+
+// ValidateCreate implements webhook.CustomValidator so a webhook will be registered for the type MonitorStack.
+func (v *MonitorStackCustomValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	monitorstack, ok := obj.(*monitoringv1.MonitorStack)
+	if !ok {
+		return nil, fmt.Errorf("expected a MonitorStack object but got %T", obj)
+	}
+	monitorstacklog.Info("Validation for MonitorStack upon creation", "name", monitorstack.GetName())
+
+	return nil, v.validatePolicies(ctx, monitorstack)
+}
+
+// ValidateUpdate implements webhook.CustomValidator so a webhook will be registered for the type MonitorStack.
+func (v *MonitorStackCustomValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	monitorstack, ok := newObj.(*monitoringv1.MonitorStack)
+	if !ok {
+		return nil, fmt.Errorf("expected a MonitorStack object for the newObj but got %T", newObj)
+	}
+	oldMonitorstack, ok := oldObj.(*monitoringv1.MonitorStack)
+	if !ok {
+		return nil, fmt.Errorf("expected a MonitorStack object for the oldObj but got %T", oldObj)
+	}
+	monitorstacklog.Info("Validation for MonitorStack upon update", "name", monitorstack.GetName())
+
+	// 只修改metadata（例如移除finalizer）或正在删除时不检查，避免策略阻止删除
+	if monitorstack.DeletionTimestamp != nil || equality.Semantic.DeepEqual(oldMonitorstack.Spec, monitorstack.Spec) {
+		return nil, nil
+	}
+
+	return nil, v.validatePolicies(ctx, monitorstack)
+}
+
+// ValidateDelete implements webhook.CustomValidator so a webhook will be registered for the type MonitorStack.
+func (v *MonitorStackCustomValidator) ValidateDelete(_ context.Context, _ runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+// validatePolicies 检查MonitorStack是否违反所在命名空间的策略
+func (v *MonitorStackCustomValidator) validatePolicies(ctx context.Context, monitorstack *monitoringv1.MonitorStack) error {
+	policies, err := policy.MatchingPolicies(ctx, v.Client, monitorstack.Namespace)
+	if err != nil {
+		return fmt.Errorf("failed to get MonitorStackPolicy: %w", err)
+	}
+
+	// 与控制器一致，未设置的limits按策略的最大值检查
+	spec := monitorstack.Spec.DeepCopy()
+	policy.DefaultLimits(policies, spec)
+
+	images := policy.SpecImages(spec)
+	var violations []string
+	for i := range policies {
+		violations = append(violations, policy.Violations(&policies[i], spec, images)...)
+	}
+	if len(violations) > 0 {
+		return fmt.Errorf("MonitorStack violates MonitorStackPolicy: %s", strings.Join(violations, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	monitoringv1 "github.com/ciliverse/monitor-operator/api/v1"
+)
+
+var _ = Describe("MonitorStack Webhook", func() {
+	var (
+		obj       *monitoringv1.MonitorStack
+		oldObj    *monitoringv1.MonitorStack
+		validator MonitorStackCustomValidator
+		c         client.Client
+	)
+
+	BeforeEach(func() {
+		obj = &monitoringv1.MonitorStack{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-resource", Namespace: "default"},
+			Spec: monitoringv1.MonitorStackSpec{
+				Prometheus: monitoringv1.PrometheusSpec{Enabled: true, Retention: "7d"},
+			},
+		}
+		oldObj = obj.DeepCopy()
+
+		// 策略检查只读取策略和命名空间，使用fake client，不依赖envtest
+		testScheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(testScheme)).To(Succeed())
+		Expect(monitoringv1.AddToScheme(testScheme)).To(Succeed())
+		c = fake.NewClientBuilder().WithScheme(testScheme).
+			WithObjects(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}}).Build()
+		validator = MonitorStackCustomValidator{Client: c}
+	})
+
+	Context("When creating or updating MonitorStack under Validating Webhook", func() {
+		It("Should admit creation if no policy exists", func() {
+			Expect(validator.ValidateCreate(ctx, obj)).Error().NotTo(HaveOccurred())
+		})
+
+		It("Should deny creation if a policy is violated", func() {
+			By("creating a policy limiting retention and service types")
+			policy := &monitoringv1.MonitorStackPolicy{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-policy"},
+				Spec: monitoringv1.MonitorStackPolicySpec{
+					MaxRetention:        "1d",
+					AllowedServiceTypes: []string{string(corev1.ServiceTypeClusterIP)},
+				},
+			}
+			Expect(c.Create(ctx, policy)).To(Succeed())
+
+			Expect(validator.ValidateCreate(ctx, obj)).Error().To(HaveOccurred())
+
+			By("admitting an unchanged spec on update")
+			Expect(validator.ValidateUpdate(ctx, oldObj, obj)).Error().NotTo(HaveOccurred())
+		})
+
+		It("Should deny sidecar images from a registry that is not allowed", func() {
+			By("creating a policy limiting image registries")
+			policy := &monitoringv1.MonitorStackPolicy{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-policy"},
+				Spec: monitoringv1.MonitorStackPolicySpec{
+					AllowedImageRegistries: []string{"registry.example.com"},
+				},
+			}
+			Expect(c.Create(ctx, policy)).To(Succeed())
+
+			obj.Spec.Prometheus.PodTemplate = &runtime.RawExtension{
+				Raw: []byte(`{"spec":{"containers":[{"name":"sidecar","image":"registry.example.com/sidecar:v1"}]}}`),
+			}
+			Expect(validator.ValidateCreate(ctx, obj)).Error().NotTo(HaveOccurred())
+
+			obj.Spec.Prometheus.PodTemplate = &runtime.RawExtension{
+				Raw: []byte(`{"spec":{"initContainers":[{"name":"init","image":"busybox:1.36"}]}}`),
+			}
+			Expect(validator.ValidateCreate(ctx, obj)).Error().To(MatchError(ContainSubstring("busybox:1.36")))
+		})
+
+		It("Should check missing limits against the policy maximum", func() {
+			By("creating a policy limiting resources")
+			policy := &monitoringv1.MonitorStackPolicy{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-policy"},
+				Spec: monitoringv1.MonitorStackPolicySpec{
+					MaxResources: monitoringv1.ResourceList{CPU: "2", Memory: "4Gi"},
+				},
+			}
+			Expect(c.Create(ctx, policy)).To(Succeed())
+
+			Expect(validator.ValidateCreate(ctx, obj)).Error().NotTo(HaveOccurred())
+			Expect(obj.Spec.Prometheus.Resources.Limits.Memory).To(BeEmpty(), "the admitted object must not be modified")
+
+			obj.Spec.Prometheus.Resources.Requests.Memory = "8Gi"
+			Expect(validator.ValidateCreate(ctx, obj)).Error().To(MatchError(ContainSubstring("prometheus requests memory 8Gi exceeds")))
+		})
+
+		It("Should deny more replicas than the policy allows", func() {
+			By("creating a policy limiting replicas")
+			policy := &monitoringv1.MonitorStackPolicy{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-policy"},
+				Spec: monitoringv1.MonitorStackPolicySpec{
+					MaxReplicas: &[]int32{1}[0],
+				},
+			}
+			Expect(c.Create(ctx, policy)).To(Succeed())
+
+			obj.Spec.Grafana.Enabled = true
+			Expect(validator.ValidateCreate(ctx, obj)).Error().To(MatchError(ContainSubstring("total replicas 2 exceeds the maximum of 1")))
+		})
+
+		It("Should deny more Prometheus shards than the policy allows", func() {
+			By("creating a policy limiting shards")
+			policy := &monitoringv1.MonitorStackPolicy{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-policy"},
+				Spec: monitoringv1.MonitorStackPolicySpec{
+					MaxShards: &[]int32{2}[0],
+				},
+			}
+			Expect(c.Create(ctx, policy)).To(Succeed())
+
+			obj.Spec.Prometheus.Enabled = true
+			obj.Spec.Prometheus.Shards = &[]int32{3}[0]
+			Expect(validator.ValidateCreate(ctx, obj)).Error().To(MatchError(ContainSubstring("prometheus shards 3 exceeds the maximum of 2")))
+		})
+	})
+})